@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"log/slog"
@@ -13,12 +14,21 @@ import (
 
 // Main function
 func Run() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	err := flag.Parse(os.Args[1:])
 	if err != nil {
 		log.Fatal(err)
 	}
 	// Initialize services
 	serviceinstance.Init()
+	// Opens the pre-orders in background
+	go serviceinstance.RunOrderScheduler(context.Background())
+	// Sends the webhook deliveries in background
+	go serviceinstance.RunWebhookDispatcher(context.Background())
 
 	// Router
 	mux := routes()
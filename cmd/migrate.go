@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"hot-coffee/internal/infrastructure/storage/postgres"
+)
+
+// Migrate subcommand:
+//
+//	hot-coffee migrate [--seed] up|down|status|to <N>|baseline <N>
+func runMigrate(args []string) {
+	set := postgres.SchemaSet
+	if len(args) > 0 && args[0] == "--seed" {
+		set = postgres.SeedSet
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		printMigrateHelp()
+		os.Exit(1)
+	}
+
+	migrator, err := postgres.NewMigrator(set)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var done []postgres.Migration
+	switch args[0] {
+	case "up":
+		done, err = migrator.Up()
+	case "down":
+		done, err = migrator.Down()
+	case "to", "baseline":
+		if len(args) < 2 {
+			log.Fatalf("version is required for %s", args[0])
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil || version < 0 {
+			log.Fatalf("incorrect version provided: %s", args[1])
+		}
+		if args[0] == "to" {
+			done, err = migrator.To(version)
+		} else {
+			done, err = migrator.Baseline(version)
+		}
+	case "status":
+		printMigrationStatus(migrator)
+		return
+	case "--help":
+		printMigrateHelp()
+		return
+	default:
+		printMigrateHelp()
+		os.Exit(1)
+	}
+
+	for _, migration := range done {
+		fmt.Printf("%03d_%s\n", migration.Version, migration.Name)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(done) == 0 {
+		fmt.Println("Nothing to migrate")
+	}
+}
+
+func printMigrationStatus(migrator *postgres.Migrator) {
+	statuses, err := migrator.Status()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "VERSION\tNAME\tAPPLIED AT")
+	for _, status := range statuses {
+		appliedAt := "pending"
+		if status.Applied {
+			appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(writer, "%03d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+	}
+	writer.Flush()
+}
+
+func printMigrateHelp() {
+	fmt.Println(`Database migrations
+
+Usage:
+  hot-coffee migrate [--seed] up|down|status
+  hot-coffee migrate [--seed] to <N>
+  hot-coffee migrate [--seed] baseline <N>
+
+Commands:
+  up          Apply all pending migrations.
+  down        Roll back the last applied migration.
+  status      Show applied and pending migrations.
+  to N        Apply or roll back migrations until N is the last applied one, 0 rolls back everything.
+  baseline N  Mark migrations up to N as applied without running them, for databases created before migrations were tracked.
+
+Options:
+  --seed      Use the mock data set instead of the schema, never run it in production.
+              A seed is applied at the schema version it was written for, the last one below its own version:
+              the schema is migrated up to it first, a newer schema is refused. Run "migrate up" afterwards.`)
+}
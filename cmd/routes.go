@@ -3,6 +3,7 @@ package cmd
 import (
 	"net/http"
 
+	"hot-coffee/internal/flag"
 	httpserver "hot-coffee/internal/infrastructure/server/http"
 )
 
@@ -13,60 +14,135 @@ func routes() http.Handler {
 	// Orders:
 	//     POST /orders: Create a new order.
 	//     GET /orders: Retrieve all orders.
-	mux.HandleFunc("/orders", httpserver.HandleOrders)
+	// POST requests with Idempotency-Key header are replayed instead of processed again
+	handle(mux, "/orders", httpserver.IdempotencyMiddleware(httpserver.HandleOrders))
 	// 	   POST /orders/open: Retrieve all open orders
-	mux.HandleFunc("/orders/open", httpserver.HandleOpenOrders)
+	handle(mux, "/orders/open", httpserver.HandleOpenOrders)
+	//     GET /orders/upcoming?minutes=: Pre-orders to be picked up in the next minutes.
+	handle(mux, "/orders/upcoming", httpserver.HandleUpcomingOrders)
 
 	//     GET /orders/{id}: Retrieve a specific order by ID.
 	//     PUT /orders/{id}: Update an existing order.
 	//     DELETE /orders/{id}: Delete an order.
-	mux.HandleFunc("/orders/{id}", httpserver.HandleOrder)
+	handle(mux, "/orders/{id}", httpserver.HandleOrder)
 	//     POST /orders/{id}/close: Close an order.
-	mux.HandleFunc("/orders/{id}/close", httpserver.HandleOrderClose)
+	handle(mux, "/orders/{id}/close", httpserver.HandleOrderClose)
 	//     POST /orders/{id}/in_progress: Start processing an order.
-	mux.HandleFunc("/orders/{id}/in_progress", httpserver.HandleOrderInProgress)
+	handle(mux, "/orders/{id}/in_progress", httpserver.HandleOrderInProgress)
+	//     POST /orders/{id}/transitions: Move an order to another status.
+	handle(mux, "/orders/{id}/transitions", httpserver.HandleOrderTransitions)
+	//     GET /orders/{id}/history: Status changes of an order with time spent in each status.
+	handle(mux, "/orders/{id}/history", httpserver.HandleOrderHistory)
+	//     GET /orders/{id}/payments: Payments and refunds of an order with its balance.
+	//     POST /orders/{id}/payments: Pay an order with one or several tenders.
+	handle(mux, "/orders/{id}/payments", httpserver.HandleOrderPayments)
+	//     POST /orders/{id}/payments/refunds: Refund an order fully or partially.
+	handle(mux, "/orders/{id}/payments/refunds", httpserver.HandleOrderRefunds)
 	// GET /numberOfOrderedItems?startDate={startDate}&endDate={endDate}
-	mux.HandleFunc("/orders/numberOfOrderedItems", httpserver.HandleNumberOfOrderedItems)
+	handle(mux, "/orders/numberOfOrderedItems", httpserver.HandleNumberOfOrderedItems)
+
+	// Queue:
+	//     GET /queue: Open and in progress orders, the oldest first.
+	handle(mux, "/queue", httpserver.HandleQueue)
+	//     GET /queue/stream: Server-Sent Events of the order changes.
+	// The stream stays open, so it has no time limit
+	mux.HandleFunc("/queue/stream", httpserver.HandleQueueStream)
 
 	// Inventory:
 	//     POST /inventory: Add a new inventory item.
 	//     GET /inventory: Retrieve all inventory items.
-	mux.HandleFunc("/inventory", httpserver.HandleInventory)
+	handle(mux, "/inventory", httpserver.HandleInventory)
 
 	//     GET /inventory/{id}: Retrieve a specific inventory item.
 	//     PUT /inventory/{id}: Update an inventory item.
-	//     DELETE /inventory/{id}: Delete an inventory item.
-	mux.HandleFunc("/inventory/{id}", httpserver.HandleInventoryItem)
+	//     DELETE /inventory/{id}: Archive an inventory item.
+	handle(mux, "/inventory/{id}", httpserver.HandleInventoryItem)
+	//     POST /inventory/{id}/restore: Restore an archived inventory item.
+	handle(mux, "/inventory/{id}/restore", httpserver.HandleInventoryItemRestore)
 
 	// Menu Items:
 	//     POST /menu: Add a new menu item.
 	//     GET /menu: Retrieve all menu items.
-	mux.HandleFunc("/menu", httpserver.HandleMenu)
+	handle(mux, "/menu", httpserver.HandleMenu)
 
 	//     GET /menu/{id}: Retrieve a specific menu item.
 	//     PUT /menu/{id}: Update a menu item.
-	//     DELETE /menu/{id}: Delete a menu item.
-	mux.HandleFunc("/menu/{id}", httpserver.HandleMenuItem)
+	//     DELETE /menu/{id}: Archive a menu item.
+	handle(mux, "/menu/{id}", httpserver.HandleMenuItem)
+	//     POST /menu/{id}/restore: Restore an archived menu item.
+	handle(mux, "/menu/{id}/restore", httpserver.HandleMenuItemRestore)
+
+	// Customers:
+	//     POST /customers: Add a new customer.
+	//     GET /customers?name={name}&phone={phone}: Search customers by name and phone.
+	handle(mux, "/customers", httpserver.HandleCustomers)
+
+	//     GET /customers/{id}: Retrieve a specific customer.
+	//     PUT /customers/{id}: Update a customer.
+	//     DELETE /customers/{id}: Delete a customer without orders, audited.
+	handle(mux, "/customers/{id}", httpserver.HandleCustomer)
+	//     GET /customers/{id}/orders: Order history of the customer, the newest first.
+	handle(mux, "/customers/{id}/orders", httpserver.HandleCustomerOrders)
+	//     GET /customers/{id}/loyalty: Loyalty points balance of the customer with the ledger.
+	handle(mux, "/customers/{id}/loyalty", httpserver.HandleCustomerLoyalty)
+	//     GET /customers/{id}/export: Personal data of the customer with orders and loyalty points, audited.
+	handle(mux, "/customers/{id}/export", httpserver.HandleCustomerExport)
+	//     POST /customers/{id}/anonymize: Scrub the name and the phone, orders are kept, audited.
+	handle(mux, "/customers/{id}/anonymize", httpserver.HandleCustomerAnonymize)
+
+	// Audit:
+	//     GET /audit?action={action}&entity={entity}&entity_id={id}: Audit trail of personal data actions, the newest first.
+	handle(mux, "/audit", httpserver.HandleAudit)
+
+	// Promotions:
+	//     POST /promotions: Add a new promotion.
+	//     GET /promotions: Retrieve all promotions.
+	handle(mux, "/promotions", httpserver.HandlePromotions)
+
+	//     GET /promotions/{id}: Retrieve a specific promotion.
+	//     PUT /promotions/{id}: Update a promotion.
+	//     DELETE /promotions/{id}: Delete a promotion.
+	handle(mux, "/promotions/{id}", httpserver.HandlePromotion)
+
+	// Webhooks:
+	//     POST /webhooks: Subscribe a URL to events.
+	//     GET /webhooks: Retrieve all webhooks.
+	handle(mux, "/webhooks", httpserver.HandleWebhooks)
+
+	//     GET /webhooks/{id}: Retrieve a specific webhook.
+	//     PUT /webhooks/{id}: Update a webhook.
+	//     DELETE /webhooks/{id}: Delete a webhook with its deliveries.
+	handle(mux, "/webhooks/{id}", httpserver.HandleWebhook)
+	//     GET /webhooks/{id}/deliveries?status={status}: Deliveries of a webhook.
+	handle(mux, "/webhooks/{id}/deliveries", httpserver.HandleWebhookDeliveries)
+	//     GET /webhooks/dead-letters: Deliveries which exhausted their retries.
+	handle(mux, "/webhooks/dead-letters", httpserver.HandleWebhookDeadLetters)
+	//     POST /webhooks/deliveries/{id}/retry: Send a dead delivery again.
+	handle(mux, "/webhooks/deliveries/{id}/retry", httpserver.HandleWebhookDeliveryRetry)
 
 	// Aggregations:
 	// GET /reports/total-sales: Get the total sales amount.
-	mux.HandleFunc("/reports/total-sales", httpserver.HandleTotalSales)
+	handle(mux, "/reports/total-sales", httpserver.HandleTotalSales)
 	// GET /reports/popular-items: Get a list of popular menu items.
-	mux.HandleFunc("/reports/popular-items", httpserver.HandlePopularItems)
+	handle(mux, "/reports/popular-items", httpserver.HandlePopularItems)
 
 	// New functionality
 	// GET /reports/orderedItemsByPeriod?period={day|month}&month={month}
-	mux.HandleFunc("/reports/orderedItemsByPeriod", httpserver.HandleOrderedItemsByPeriod)
+	handle(mux, "/reports/orderedItemsByPeriod", httpserver.HandleOrderedItemsByPeriod)
+	// GET /reports/order-throughput?startDate={startDate}&endDate={endDate}&percentile={percentile}
+	handle(mux, "/reports/order-throughput", httpserver.HandleOrderThroughput)
+	// GET /reports/ready-time-accuracy?startDate={startDate}&endDate={endDate}
+	handle(mux, "/reports/ready-time-accuracy", httpserver.HandleReadyTimeAccuracy)
 	// GET /getLeftOvers?sortBy={value}&page={page}&pageSize={pageSize}
-	mux.HandleFunc("/inventory/getLeftOvers", httpserver.HandleInventoryLeftovers)
+	handle(mux, "/inventory/getLeftOvers", httpserver.HandleInventoryLeftovers)
 
 	// GET /reports/search?q=chocolate cake&filter=menu,orders&minPrice=10&maxPrice=12
-	mux.HandleFunc("/reports/search", httpserver.HandleFullTextSearchReport)
+	handle(mux, "/reports/search", httpserver.HandleFullTextSearchReport)
 	// New functionality
 	// GET /getLeftOvers?sortBy=quantity?page=1&pageSize=4
 
 	// POST /orders/batch-process
-	mux.HandleFunc("/orders/batch-process", httpserver.HandleBatchOrders)
+	handle(mux, "/orders/batch-process", httpserver.IdempotencyMiddleware(httpserver.HandleBatchOrders))
 
 	// Logging middleware applied
 	middlewareAppliedMux := httpserver.RequestLoggingMiddleware(mux)
@@ -74,3 +150,8 @@ func routes() http.Handler {
 
 	return middlewareAppliedMux
 }
+
+// Registers the handler with the time limit configured for the route
+func handle(mux *http.ServeMux, pattern string, handler http.HandlerFunc) {
+	mux.Handle(pattern, httpserver.TimeoutMiddleware(flag.RouteTimeout(pattern), handler))
+}
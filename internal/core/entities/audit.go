@@ -0,0 +1,34 @@
+package entities
+
+import "time"
+
+// Actions recorded in the audit trail
+const (
+	CustomerExportAction    = "customer.export"
+	CustomerAnonymizeAction = "customer.anonymize"
+	CustomerDeleteAction    = "customer.delete"
+)
+
+// Entities the audit trail refers to
+const (
+	CustomerEntity = "customer"
+)
+
+// Action on personal data, written in the transaction of the action
+type AuditEntry struct {
+	ID       string `json:"audit_id,omitempty"`
+	Action   string `json:"action"`
+	Entity   string `json:"entity"`
+	EntityID string `json:"entity_id"`
+	// Who asked for the action, as told by the X-Actor header
+	Actor     string    `json:"actor,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Filters of the audit trail, empty values are not applied
+type AuditFilter struct {
+	Action   string
+	Entity   string
+	EntityID string
+}
@@ -0,0 +1,32 @@
+package entities
+
+import "time"
+
+type Customer struct {
+	ID       string `json:"customer_id,omitempty"`
+	Fullname string `json:"fullname"`
+	// Unique among the customers, stored as digits with optional leading +
+	Phone     string     `json:"phone,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	// Set once the name and the phone are scrubbed, such customer cannot be changed
+	AnonymizedAt *time.Time `json:"anonymized_at,omitempty"`
+	// Incremented on every change, compared with If-Match header on update
+	Version int64 `json:"version,omitempty"`
+}
+
+// Personal data of the customer kept by the shop
+type CustomerExport struct {
+	ExportedAt time.Time `json:"exported_at"`
+	Customer   Customer  `json:"customer"`
+	// Orders with their items and discounts, the newest first
+	Orders  []Order        `json:"orders"`
+	Loyalty LoyaltyAccount `json:"loyalty"`
+}
+
+// Filters of the customers search, empty values are not applied
+type CustomerFilter struct {
+	// Part of the full name, case insensitive
+	Name string
+	// Part of the normalized phone
+	Phone string
+}
@@ -0,0 +1,18 @@
+package entities
+
+import "time"
+
+// Response of the request sent with Idempotency-Key header, replayed on the retries of the request
+type IdempotencyRecord struct {
+	Key string `json:"key"`
+	// SHA-256 of the request method, path and body
+	RequestHash string `json:"request_hash"`
+	// Zero while the request is being processed
+	StatusCode  int       `json:"status_code,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Body        []byte    `json:"body,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	// End of the processing lease, a retry takes over the key not completed by then. Zero once completed
+	LockedUntil time.Time `json:"locked_until,omitempty"`
+}
@@ -5,8 +5,27 @@ type InventoryItem struct {
 	IngredientID string  `json:"ingredient_id"`
 	Name         string  `json:"name"`
 	Price        float64 `json:"price"`
-	Quantity     float64 `json:"quantity"`
-	Unit         string  `json:"unit"`
+	// On hand, the ingredients of the closed orders are already taken from it
+	Quantity float64 `json:"quantity"`
+	// Held by the not finished orders, set by the service, provided values are ignored
+	Reserved float64 `json:"reserved"`
+	// Quantity left for the new orders
+	Available float64 `json:"available"`
+	Unit      string  `json:"unit"`
+	// inventory.low webhook event is sent when the quantity falls below it, zero disables it
+	ReorderLevel float64 `json:"reorder_level,omitempty"`
+	// Incremented on every change, compared with If-Match header on update
+	Version int64 `json:"version,omitempty"`
+	// Set when the item is archived instead of deleting
+	DeletedAt string `json:"deleted_at,omitempty"`
+}
+
+// Quantity of the ingredient reserved for or taken by the order line, see OrderItem.Line.
+// Rows written before the lines were recorded have an empty line
+type IngredientUsage struct {
+	IngredientID string
+	Line         string
+	Quantity     float64
 }
 
 type PaginatedInventoryItems struct {
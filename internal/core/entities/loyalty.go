@@ -0,0 +1,46 @@
+package entities
+
+import "time"
+
+// Kinds of the loyalty ledger entries
+const (
+	// Points of the closed order
+	EarnEntry = "earn"
+	// Points spent on the discounts of the order
+	RedeemEntry = "redeem"
+	// Spent points given back when the order is rejected, deleted or refunded in full
+	RestoreEntry = "restore"
+	// Earned points taken back when the order is refunded
+	ReverseEntry = "reverse"
+	// Points not spent before their expiry, computed and never stored
+	ExpireEntry = "expire"
+)
+
+type LoyaltyEntry struct {
+	ID         string `json:"entry_id,omitempty"`
+	CustomerID int64  `json:"customer_id"`
+	OrderID    int64  `json:"order_id,omitempty"`
+	Kind       string `json:"kind"`
+	// Positive points are added to the balance, negative ones are taken from it
+	Points int64 `json:"points"`
+	// Set for the added points only
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Points of the balance expiring at the same time
+type LoyaltyLot struct {
+	Points    int64     `json:"points"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Loyalty balance of the customer with the ledger it is computed from
+type LoyaltyAccount struct {
+	CustomerID string `json:"customer_id"`
+	// Negative when the refunds took back the points already spent
+	Balance int64 `json:"balance"`
+	// Points of the balance by expiry, the soonest first
+	Expiring []LoyaltyLot `json:"expiring"`
+	// The oldest first, with the expired points
+	Entries []LoyaltyEntry `json:"entries"`
+}
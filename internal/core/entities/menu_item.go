@@ -1,5 +1,7 @@
 package entities
 
+import "strconv"
+
 // TODO: Convert all IDs into int64
 type MenuItem struct {
 	ID          string               `json:"product_id"`
@@ -7,6 +9,14 @@ type MenuItem struct {
 	Description string               `json:"description"`
 	Price       float64              `json:"price"`
 	Ingredients []MenuItemIngredient `json:"ingredients"`
+	// Options the customer can pick for the item, e.g. almond milk instead of whole milk
+	Modifiers []MenuItemModifier `json:"modifiers,omitempty"`
+	// Selects the tax rate of the item
+	Category string `json:"category,omitempty"`
+	// Incremented on every change, compared with If-Match header on update
+	Version int64 `json:"version,omitempty"`
+	// Set when the item is archived instead of deleting
+	DeletedAt string `json:"deleted_at,omitempty"`
 }
 
 type MenuItemIngredient struct {
@@ -14,6 +24,53 @@ type MenuItemIngredient struct {
 	Quantity     float64 `json:"quantity"`
 }
 
+type MenuItemModifier struct {
+	// Kept on update when provided, orders reference the modifier by it
+	ID   string `json:"modifier_id,omitempty"`
+	Name string `json:"name"`
+	// Added to the menu item price, can be negative
+	PriceDelta float64 `json:"price_delta"`
+	// Changes of the ingredient quantities per item, negative quantity takes the ingredient away
+	Ingredients []MenuItemIngredient `json:"ingredients,omitempty"`
+	// Set when the modifier is removed from the menu item, old orders keep referencing it
+	DeletedAt string `json:"deleted_at,omitempty"`
+}
+
+// Returns the modifier of the menu item, archived ones included
+func (m MenuItem) Modifier(id int64) (MenuItemModifier, bool) {
+	idStr := strconv.FormatInt(id, 10)
+	for _, modifier := range m.Modifiers {
+		if modifier.ID == idStr {
+			return modifier, true
+		}
+	}
+	return MenuItemModifier{}, false
+}
+
+// Ingredient quantities of one item with the modifiers applied,
+// unknown modifiers are skipped and quantities never drop below zero
+func (m MenuItem) ModifiedIngredients(modifierIDs []int64) map[string]float64 {
+	ingredients := make(map[string]float64)
+	for _, ingredient := range m.Ingredients {
+		ingredients[ingredient.IngredientID] += ingredient.Quantity
+	}
+	for _, id := range modifierIDs {
+		modifier, ok := m.Modifier(id)
+		if !ok {
+			continue
+		}
+		for _, ingredient := range modifier.Ingredients {
+			ingredients[ingredient.IngredientID] += ingredient.Quantity
+		}
+	}
+	for ingredientID, quantity := range ingredients {
+		if quantity <= 0 {
+			delete(ingredients, ingredientID)
+		}
+	}
+	return ingredients
+}
+
 type MenuItemSales struct {
 	ProductID   string `json:"product_id"`
 	ProductName string `json:"product_name"`
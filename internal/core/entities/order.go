@@ -1,5 +1,12 @@
 package entities
 
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
 // TODO: Convert all IDs into int64
 type Order struct {
 	ID           string      `json:"order_id,omitempty"`
@@ -8,16 +15,119 @@ type Order struct {
 	Items        []OrderItem `json:"items"`
 	Status       string      `json:"status,omitempty"`
 	CreatedAt    string      `json:"created_at,omitempty"`
+	// Pre-order is scheduled until the lead time before the pickup
+	PickupAt *time.Time `json:"pickup_at,omitempty"`
+	// Estimated when the order is opened, set by the service, provided values are ignored
+	EstimatedReadyAt *time.Time `json:"estimated_ready_at,omitempty"`
+	// Codes of the promotions requested by the customer
+	PromoCodes []string `json:"promo_codes,omitempty"`
+	// Loyalty points the customer spends on a discount, accepted at creation only
+	RedeemPoints int64 `json:"redeem_points,omitempty"`
+	// Menu items of the order the customer takes for loyalty points, accepted at creation only
+	RedeemItems []int `json:"redeem_items,omitempty"`
+	// Set by the service when the order is written, provided values are ignored
+	Discounts []AppliedDiscount `json:"discounts,omitempty"`
+	// Tip is provided by the customer, the other amounts are computed by the service
+	Subtotal      float64 `json:"subtotal"`
+	DiscountTotal float64 `json:"discount_total,omitempty"`
+	Tax           float64 `json:"tax"`
+	ServiceCharge float64 `json:"service_charge,omitempty"`
+	Tip           float64 `json:"tip,omitempty"`
+	GrandTotal    float64 `json:"grand_total"`
+	// Incremented on every change, compared with If-Match header on update
+	Version int64 `json:"version,omitempty"`
+}
+
+// Copies the monetary amounts of the other order
+func (o *Order) SetAmounts(amounts Order) {
+	o.Subtotal = amounts.Subtotal
+	o.DiscountTotal = amounts.DiscountTotal
+	o.Tax = amounts.Tax
+	o.ServiceCharge = amounts.ServiceCharge
+	o.Tip = amounts.Tip
+	o.GrandTotal = amounts.GrandTotal
+}
+
+// Sort fields of the orders listing
+const (
+	OrderSortCreatedAt = "created_at"
+	OrderSortTotal     = "total"
+	OrderSortID        = "order_id"
+)
+
+// Filters of the orders listing, zero values are not applied
+type OrderFilter struct {
+	Status string
+	// Part of the customer name, case insensitive
+	Customer    string
+	CustomerID  int64
+	CreatedFrom time.Time
+	// Exclusive
+	CreatedTo  time.Time
+	MenuItemID int
+	MinTotal   float64
+	MaxTotal   float64
+	// Any of the statuses, applied together with Status
+	Statuses []string
+	// Orders picked up until the time, inclusive, orders without pickup are skipped
+	PickupTo   time.Time
+	SortBy     string
+	Descending bool
+	// Zero returns all matching orders
+	Limit int
+	// Orders after the position of the cursor are returned
+	After *OrderCursor
+}
+
+// Position of the last returned order in the listing sort
+type OrderCursor struct {
+	SortBy    string    `json:"s"`
+	CreatedAt time.Time `json:"c"`
+	Total     float64   `json:"t,omitempty"`
+	OrderID   int64     `json:"i"`
+}
+
+type OrdersPage struct {
+	Orders     []Order      `json:"orders"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+	Next       *OrderCursor `json:"-"`
 }
 
 type OrderItem struct {
 	ProductID         int    `json:"product_id"`
 	Quantity          int    `json:"quantity"`
 	CustomizationInfo string `json:"customization_info,omitempty"`
+	// Modifiers of the menu item picked by the customer
+	ModifierIDs []int64 `json:"modifier_ids,omitempty"`
+	// Menu item price and ingredients cost at the time the order was written,
+	// set by the service, provided values are ignored
+	UnitPrice float64 `json:"unit_price,omitempty"`
+	UnitCost  float64 `json:"unit_cost,omitempty"`
+	TaxRate   float64 `json:"tax_rate,omitempty"`
+}
+
+// Key of the order line: the product with the picked modifiers, e.g. "3" or "3:7,9".
+// Items of the same line take the same ingredients
+func (i OrderItem) Line() string {
+	modifierIDs := append([]int64(nil), i.ModifierIDs...)
+	sort.Slice(modifierIDs, func(a, b int) bool { return modifierIDs[a] < modifierIDs[b] })
+
+	var line strings.Builder
+	line.WriteString(strconv.Itoa(i.ProductID))
+	for idx, id := range modifierIDs {
+		if idx == 0 {
+			line.WriteByte(':')
+		} else {
+			line.WriteByte(',')
+		}
+		line.WriteString(strconv.FormatInt(id, 10))
+	}
+	return line.String()
 }
 
 type TotalSales struct {
 	Total float64 `json:"total_sales"`
+	Tax   float64 `json:"tax_total"`
 }
 
 type OrderedItemsCountByPeriod struct {
@@ -47,13 +157,14 @@ type OrderedMenuItemsCount struct {
 
 // Order Statuses
 const (
+	ScheduledStatus  = "scheduled"
 	OpenStatus       = "open"
 	ClosedStatus     = "closed"
 	RejectedStatus   = "rejected"
 	InProgressStatus = "in progress"
 )
 
-var Statuses = []string{OpenStatus, ClosedStatus, RejectedStatus, InProgressStatus}
+var Statuses = []string{ScheduledStatus, OpenStatus, ClosedStatus, RejectedStatus, InProgressStatus}
 
 type OrderReport struct {
 	ID           string   `json:"order_id,omitempty"`
@@ -62,3 +173,74 @@ type OrderReport struct {
 	Total        float64  `json:"total,omitempty"`
 	Relevance    float64  `json:"relevance"`
 }
+
+type OrderStatusChange struct {
+	PastStatus string    `json:"past_status,omitempty"`
+	NewStatus  string    `json:"new_status"`
+	Reason     string    `json:"reason,omitempty"`
+	ChangedAt  time.Time `json:"changed_at"`
+	// Time spent in the new status, until now for the current not final status
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+type OrderHistory struct {
+	OrderID     string              `json:"order_id"`
+	Status      string              `json:"status"`
+	Transitions []OrderStatusChange `json:"transitions"`
+}
+
+// Moments of opening and closing of the closed order
+type OrderCloseTime struct {
+	OrderID  int64
+	OpenedAt time.Time
+	ClosedAt time.Time
+}
+
+// Preparation of the closed order
+type PreparationTime struct {
+	OrderID     int64
+	MenuItemIDs []int
+	OpenedAt    time.Time
+	// Zero if the order was closed without going in progress
+	StartedAt        time.Time
+	ClosedAt         time.Time
+	EstimatedReadyAt *time.Time
+}
+
+// Estimated ready times compared with the close times, positive errors are late orders
+type ReadyTimeAccuracy struct {
+	Orders                   int     `json:"orders"`
+	MeanErrorSeconds         float64 `json:"mean_error_seconds"`
+	MeanAbsoluteErrorSeconds float64 `json:"mean_absolute_error_seconds"`
+	OnTimePercent            float64 `json:"on_time_percent"`
+}
+
+type HourReadyTimeAccuracy struct {
+	Hour int `json:"hour"`
+	ReadyTimeAccuracy
+}
+
+type MenuItemReadyTimeAccuracy struct {
+	MenuItemID int `json:"menu_item_id"`
+	// Currently estimated preparation of the item alone
+	PreparationSeconds float64 `json:"preparation_seconds"`
+	ReadyTimeAccuracy
+}
+
+type ReadyTimeReport struct {
+	Overall    ReadyTimeAccuracy           `json:"overall"`
+	ByHour     []HourReadyTimeAccuracy     `json:"by_hour"`
+	ByMenuItem []MenuItemReadyTimeAccuracy `json:"by_menu_item"`
+}
+
+type OrderThroughput struct {
+	Date              string  `json:"date"`
+	ClosedOrders      int     `json:"closed_orders"`
+	AverageSeconds    float64 `json:"average_seconds"`
+	PercentileSeconds float64 `json:"percentile_seconds"`
+}
+
+type OrderThroughputReport struct {
+	Percentile int               `json:"percentile"`
+	Days       []OrderThroughput `json:"days"`
+}
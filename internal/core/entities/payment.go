@@ -0,0 +1,40 @@
+package entities
+
+// Tenders the order can be paid with
+const (
+	CashTender  = "cash"
+	CardTender  = "card"
+	OtherTender = "other"
+)
+
+var Tenders = []string{CashTender, CardTender, OtherTender}
+
+// Kinds of the money movement
+const (
+	PaymentKind = "payment"
+	RefundKind  = "refund"
+)
+
+type Payment struct {
+	ID      string `json:"payment_id,omitempty"`
+	OrderID int64  `json:"order_id,omitempty"`
+	Kind    string `json:"kind"`
+	Tender  string `json:"tender"`
+	// Always positive, the kind tells the direction
+	Amount float64 `json:"amount"`
+	Reason string  `json:"reason,omitempty"`
+	// Items whose ingredients were returned to inventory by the refund
+	RestockedItems []OrderItem `json:"restocked_items,omitempty"`
+	CreatedAt      string      `json:"created_at,omitempty"`
+}
+
+// Payments of the order with the amounts summed up
+type OrderPayments struct {
+	OrderID    int64   `json:"order_id"`
+	GrandTotal float64 `json:"grand_total"`
+	Paid       float64 `json:"paid"`
+	Refunded   float64 `json:"refunded"`
+	// Amount left to pay, the order can be closed when it is zero
+	Balance  float64   `json:"balance"`
+	Payments []Payment `json:"payments"`
+}
@@ -0,0 +1,48 @@
+package entities
+
+// Discount types of promotion
+const (
+	// Percent of the matched items price, DiscountValue is the percent
+	PercentDiscount = "percent"
+	// Fixed amount once per order, DiscountValue is the amount
+	FixedDiscount = "fixed"
+	// DiscountValue units of the menu item are free for every MinQuantity units ordered
+	FreeItemsDiscount = "free_items"
+)
+
+var DiscountTypes = []string{PercentDiscount, FixedDiscount, FreeItemsDiscount}
+
+type Promotion struct {
+	ID   string `json:"promotion_id,omitempty"`
+	Name string `json:"name"`
+	// Promotion with a code is applied only when the order provides the code
+	Code string `json:"code,omitempty"`
+	// Menu item the promotion is bound to, zero applies it to the whole order
+	MenuItemID int `json:"menu_item_id,omitempty"`
+	// Least quantity of the menu item or of all items in the order
+	MinQuantity   int     `json:"min_quantity,omitempty"`
+	DiscountType  string  `json:"discount_type"`
+	DiscountValue float64 `json:"discount_value"`
+	// Period of the promotion in RFC 3339, empty leaves it unbounded
+	StartsAt string `json:"starts_at,omitempty"`
+	EndsAt   string `json:"ends_at,omitempty"`
+	// Daily window in HH:MM local time, e.g. happy hour from 15:00 to 17:00
+	DailyFrom string `json:"daily_from,omitempty"`
+	DailyTo   string `json:"daily_to,omitempty"`
+	// Number of orders the promotion can be applied to, zero is unlimited
+	UsageLimit int `json:"usage_limit,omitempty"`
+	UsageCount int `json:"usage_count"`
+	// Disabled promotion is kept but never applied
+	Disabled bool `json:"disabled,omitempty"`
+	// Incremented on every change, compared with If-Match header on update
+	Version int64 `json:"version,omitempty"`
+}
+
+// Discount of the promotion or of the redeemed loyalty points applied to the order
+type AppliedDiscount struct {
+	PromotionID int64   `json:"promotion_id"`
+	Name        string  `json:"name"`
+	Amount      float64 `json:"amount"`
+	// Loyalty points the discount was redeemed for, zero for the promotions
+	Points int64 `json:"points,omitempty"`
+}
@@ -0,0 +1,44 @@
+package entities
+
+import "time"
+
+// Order waiting to be prepared by the baristas
+type QueueOrder struct {
+	OrderID      int64  `json:"order_id"`
+	CustomerName string `json:"customer_name"`
+	Status       string `json:"status"`
+	CreatedAt    string `json:"created_at"`
+	// Time since the order was created
+	AgeSeconds float64     `json:"age_seconds"`
+	PickupAt   *time.Time  `json:"pickup_at,omitempty"`
+	Items      []QueueItem `json:"items"`
+}
+
+// Order item with the menu names resolved
+type QueueItem struct {
+	ProductID         int      `json:"product_id"`
+	Name              string   `json:"name"`
+	Quantity          int      `json:"quantity"`
+	Modifiers         []string `json:"modifiers,omitempty"`
+	CustomizationInfo string   `json:"customization_info,omitempty"`
+}
+
+// Types of the order events
+const (
+	OrderCreatedEvent       = "order.created"
+	OrderUpdatedEvent       = "order.updated"
+	OrderStatusChangedEvent = "order.status_changed"
+	OrderDeletedEvent       = "order.deleted"
+)
+
+// Change of the order published after it is committed
+type OrderEvent struct {
+	ID         string    `json:"event_id"`
+	Type       string    `json:"type"`
+	OrderID    int64     `json:"order_id"`
+	PastStatus string    `json:"past_status,omitempty"`
+	Status     string    `json:"status,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// Queue entry of the order, set while the order is in the queue
+	Order *QueueOrder `json:"order,omitempty"`
+}
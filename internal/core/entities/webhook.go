@@ -0,0 +1,73 @@
+package entities
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Sent when the inventory item quantity falls below its reorder level
+const InventoryLowEvent = "inventory.low"
+
+// Events the webhooks can subscribe to
+var WebhookEventTypes = []string{
+	OrderCreatedEvent,
+	OrderUpdatedEvent,
+	OrderStatusChangedEvent,
+	OrderDeletedEvent,
+	InventoryLowEvent,
+}
+
+type Webhook struct {
+	ID         string   `json:"webhook_id,omitempty"`
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	// Signs the deliveries, never returned back
+	Secret   string `json:"secret,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+	// Incremented on every change, compared with If-Match header on update
+	Version int64 `json:"version,omitempty"`
+}
+
+// Statuses of the webhook delivery
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	// Retries are exhausted, the delivery is kept in the dead-letter list
+	DeliveryDead = "dead"
+)
+
+// Event written to the outbox for one webhook, sent by the dispatcher
+type WebhookDelivery struct {
+	ID        string `json:"delivery_id"`
+	WebhookID int64  `json:"webhook_id"`
+	EventID   string `json:"event_id"`
+	EventType string `json:"event_type"`
+	// Request body, signed as it is stored
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastError      string          `json:"last_error,omitempty"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// Body of the webhook request
+type WebhookEvent struct {
+	ID         string      `json:"event_id"`
+	Type       string      `json:"type"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+// Data of the order events
+type OrderEventData struct {
+	PastStatus string `json:"past_status,omitempty"`
+	Order      Order  `json:"order"`
+}
+
+// Data of the inventory.low event
+type InventoryEventData struct {
+	Item InventoryItem `json:"item"`
+}
@@ -13,8 +13,14 @@ import (
 
 // Errors instances
 var (
-	ErrIncorrectRequest = New("incorrect request provided")
-	ErrIDAlreadyExists  = New("entity with such id already exists")
+	ErrIncorrectRequest  = New("incorrect request provided")
+	ErrIDAlreadyExists   = New("entity with such id already exists")
+	ErrVersionMismatch   = New("entity version differs from the expected one")
+	ErrUsageLimitReached = New("usage limit of the entity is reached")
+	// Unique value other than id is taken by another entity
+	ErrUniqueViolation = New("entity with such unique value already exists")
+	// Entity is referenced by others and cannot be deleted
+	ErrReferenced = New("entity is referenced by other entities")
 )
 
 // General Application error type \\
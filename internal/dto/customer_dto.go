@@ -0,0 +1,7 @@
+package dto
+
+// Body of POST /customers/{id}/anonymize, the body itself is optional
+type AnonymizeRequest struct {
+	// Why the data is scrubbed, e.g. the reference of the deletion request
+	Reason string `json:"reason,omitempty"`
+}
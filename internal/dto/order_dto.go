@@ -1,9 +1,50 @@
 package dto
 
+import (
+	"time"
+
+	"hot-coffee/internal/core/entities"
+)
+
 type OrderReport struct {
 	ID           int64   `json:"order_id"`
+	Reference    string  `json:"reference,omitempty"`
 	CustomerName string  `json:"customer_name"`
 	Status       string  `json:"status,omitempty"`
 	Total        float64 `json:"total,omitempty"`
 	Reason       string  `json:"reason,omitempty"`
 }
+
+// Response of the order creation
+type OrderCreated struct {
+	Message          string     `json:"message"`
+	OrderID          string     `json:"order_id"`
+	Status           string     `json:"status"`
+	EstimatedReadyAt *time.Time `json:"estimated_ready_at,omitempty"`
+}
+
+// Order of the batch, the client reference is echoed in its report
+type BatchOrder struct {
+	entities.Order
+	Reference string `json:"reference,omitempty"`
+}
+
+type OrderTransition struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Query parameters of GET /orders
+type OrderQuery struct {
+	Status      string
+	Customer    string
+	CreatedFrom string
+	CreatedTo   string
+	MenuItemID  string
+	MinTotal    string
+	MaxTotal    string
+	SortBy      string
+	Order       string
+	Limit       string
+	Cursor      string
+}
@@ -0,0 +1,23 @@
+package dto
+
+import "hot-coffee/internal/core/entities"
+
+// Amount paid or refunded with the tender
+type TenderAmount struct {
+	Tender string  `json:"tender"`
+	Amount float64 `json:"amount"`
+}
+
+// Body of POST /orders/{id}/payments, several tenders split the bill
+type PaymentRequest struct {
+	Tenders []TenderAmount `json:"tenders"`
+}
+
+// Body of POST /orders/{id}/payments/refunds
+type RefundRequest struct {
+	// Empty refunds everything paid and not refunded yet, to the same tenders
+	Tenders []TenderAmount `json:"tenders,omitempty"`
+	Reason  string         `json:"reason,omitempty"`
+	// Order items whose ingredients go back to inventory
+	Restock []entities.OrderItem `json:"restock,omitempty"`
+}
@@ -5,14 +5,61 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
+
+	"hot-coffee/internal/utils"
 )
 
 // Global flags
 var (
 	StoragePath = "data"
 	Port        = 4000
+	Storage     = "postgres"
+	// Default time limit of request processing
+	Timeout = 10 * time.Second
+	// Time limits overriding the default one, by route pattern
+	RouteTimeouts = map[string]time.Duration{
+		"/orders/batch-process": 60 * time.Second,
+	}
+	// Tax percent of the menu items without own category rate
+	TaxRate float64
+	// Tax percents overriding the default one, by menu item category
+	CategoryTaxRates = map[string]float64{}
+	// Percent of the discounted items price added to every order
+	ServiceCharge float64
+	// Time the responses of the requests with Idempotency-Key are replayed
+	IdempotencyTTL = 24 * time.Hour
+	// Time the request holds its Idempotency-Key, the retries take over the key of the request lost by a crash
+	IdempotencyLease = 2 * time.Minute
+	// Number of orders of the batch created concurrently
+	BatchWorkers = 8
+	// Time before the pickup the pre-order is opened
+	PreorderLeadTime = 15 * time.Minute
+	// How often the scheduler looks for the pre-orders to open
+	SchedulerInterval = 30 * time.Second
+	// How often the dispatcher looks for the webhook deliveries due
+	WebhookInterval = 5 * time.Second
+	// Delay before the first retry of the failed webhook delivery, doubled on every next one
+	WebhookBackoff = 30 * time.Second
+	// Attempts after which the webhook delivery is moved to the dead letters
+	WebhookMaxAttempts = 8
+	// Baristas preparing the queued orders in parallel, divides the estimated queue wait
+	Baristas = 1
+	// Loyalty points earned per currency unit of the closed order, the tip is not counted
+	LoyaltyPointsPerUnit = 1.0
+	// Loyalty points earned per ordered menu item on top of the amount points, by menu item id
+	LoyaltyItemPoints = map[int]int64{}
+	// Discount given for one redeemed loyalty point
+	LoyaltyPointValue = 0.01
+	// Loyalty points the free menu item costs, by menu item id
+	LoyaltyRewards = map[int]int64{}
+	// Time the earned loyalty points can be redeemed
+	LoyaltyExpiry = 365 * 24 * time.Hour
 )
 
+// Supported storage backends
+var storages = []string{"postgres", "memory", "file"}
+
 func Parse(args []string) (err error) {
 	for _, arg := range args {
 		if arg == "--help" {
@@ -39,6 +86,123 @@ func Parse(args []string) (err error) {
 			} else if Port < 1024 || Port > 65535 {
 				return fmt.Errorf("incorrect range port, port must me between 1024 and 65535")
 			}
+		case "dir":
+			if flagValue == "" {
+				return fmt.Errorf("empty storage directory provided")
+			}
+			StoragePath = flagValue
+		case "storage":
+			if !utils.In(flagValue, storages) {
+				return fmt.Errorf("unknown storage: %s, must be one of: %s", flagValue, strings.Join(storages, ", "))
+			}
+			Storage = flagValue
+		case "timeout":
+			Timeout, err = time.ParseDuration(flagValue)
+			if err != nil || Timeout <= 0 {
+				return fmt.Errorf("incorrect timeout provided: %s", flagValue)
+			}
+		case "route-timeout":
+			pattern, durationStr, found := strings.Cut(flagValue, "=")
+			if !found || pattern == "" {
+				return fmt.Errorf("route timeout must be in form <route>=<duration>: %s", flagValue)
+			}
+			duration, err := time.ParseDuration(durationStr)
+			if err != nil || duration <= 0 {
+				return fmt.Errorf("incorrect timeout of route %s provided: %s", pattern, durationStr)
+			}
+			RouteTimeouts[pattern] = duration
+		case "tax-rate":
+			TaxRate, err = parsePercent(flagValue)
+			if err != nil {
+				return fmt.Errorf("incorrect tax rate provided: %s", flagValue)
+			}
+		case "category-tax":
+			category, rateStr, found := strings.Cut(flagValue, "=")
+			if !found || category == "" {
+				return fmt.Errorf("category tax must be in form <category>=<percent>: %s", flagValue)
+			}
+			rate, err := parsePercent(rateStr)
+			if err != nil {
+				return fmt.Errorf("incorrect tax rate of category %s provided: %s", category, rateStr)
+			}
+			CategoryTaxRates[category] = rate
+		case "service-charge":
+			ServiceCharge, err = parsePercent(flagValue)
+			if err != nil {
+				return fmt.Errorf("incorrect service charge provided: %s", flagValue)
+			}
+		case "idempotency-ttl":
+			IdempotencyTTL, err = time.ParseDuration(flagValue)
+			if err != nil || IdempotencyTTL <= 0 {
+				return fmt.Errorf("incorrect idempotency key expiration provided: %s", flagValue)
+			}
+		case "idempotency-lease":
+			IdempotencyLease, err = time.ParseDuration(flagValue)
+			if err != nil || IdempotencyLease <= 0 {
+				return fmt.Errorf("incorrect idempotency key lease provided: %s", flagValue)
+			}
+		case "batch-workers":
+			BatchWorkers, err = strconv.Atoi(flagValue)
+			if err != nil || BatchWorkers < 1 {
+				return fmt.Errorf("incorrect number of batch workers provided: %s", flagValue)
+			}
+		case "preorder-lead-time":
+			PreorderLeadTime, err = time.ParseDuration(flagValue)
+			if err != nil || PreorderLeadTime < 0 {
+				return fmt.Errorf("incorrect pre-order lead time provided: %s", flagValue)
+			}
+		case "scheduler-interval":
+			SchedulerInterval, err = time.ParseDuration(flagValue)
+			if err != nil || SchedulerInterval <= 0 {
+				return fmt.Errorf("incorrect scheduler interval provided: %s", flagValue)
+			}
+		case "webhook-interval":
+			WebhookInterval, err = time.ParseDuration(flagValue)
+			if err != nil || WebhookInterval <= 0 {
+				return fmt.Errorf("incorrect webhook dispatch interval provided: %s", flagValue)
+			}
+		case "webhook-backoff":
+			WebhookBackoff, err = time.ParseDuration(flagValue)
+			if err != nil || WebhookBackoff <= 0 {
+				return fmt.Errorf("incorrect webhook retry backoff provided: %s", flagValue)
+			}
+		case "webhook-max-attempts":
+			WebhookMaxAttempts, err = strconv.Atoi(flagValue)
+			if err != nil || WebhookMaxAttempts < 1 {
+				return fmt.Errorf("incorrect number of webhook delivery attempts provided: %s", flagValue)
+			}
+		case "baristas":
+			Baristas, err = strconv.Atoi(flagValue)
+			if err != nil || Baristas < 1 {
+				return fmt.Errorf("incorrect number of baristas provided: %s", flagValue)
+			}
+		case "loyalty-points-per-unit":
+			LoyaltyPointsPerUnit, err = strconv.ParseFloat(flagValue, 64)
+			if err != nil || LoyaltyPointsPerUnit < 0 {
+				return fmt.Errorf("incorrect loyalty points per currency unit provided: %s", flagValue)
+			}
+		case "loyalty-item-points":
+			menuItemID, points, err := parseMenuItemPoints(flagValue)
+			if err != nil {
+				return fmt.Errorf("incorrect loyalty item points provided: %w", err)
+			}
+			LoyaltyItemPoints[menuItemID] = points
+		case "loyalty-point-value":
+			LoyaltyPointValue, err = strconv.ParseFloat(flagValue, 64)
+			if err != nil || LoyaltyPointValue <= 0 {
+				return fmt.Errorf("incorrect loyalty point value provided: %s", flagValue)
+			}
+		case "loyalty-reward":
+			menuItemID, points, err := parseMenuItemPoints(flagValue)
+			if err != nil {
+				return fmt.Errorf("incorrect loyalty reward provided: %w", err)
+			}
+			LoyaltyRewards[menuItemID] = points
+		case "loyalty-expiry":
+			LoyaltyExpiry, err = time.ParseDuration(flagValue)
+			if err != nil || LoyaltyExpiry <= 0 {
+				return fmt.Errorf("incorrect loyalty points expiry provided: %s", flagValue)
+			}
 		case "endpoints":
 			PrintEndPoints()
 			os.Exit(0)
@@ -51,16 +215,85 @@ func Parse(args []string) (err error) {
 	return nil
 }
 
+func parsePercent(value string) (float64, error) {
+	percent, err := strconv.ParseFloat(value, 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return 0, fmt.Errorf("percent must be a number between 0 and 100")
+	}
+	return percent, nil
+}
+
+// Parses <menu item id>=<points>
+func parseMenuItemPoints(value string) (int, int64, error) {
+	idStr, pointsStr, found := strings.Cut(value, "=")
+	if !found {
+		return 0, 0, fmt.Errorf("must be in form <menu item id>=<points>: %s", value)
+	}
+	menuItemID, err := strconv.Atoi(idStr)
+	if err != nil || menuItemID < 1 {
+		return 0, 0, fmt.Errorf("menu item id must be a positive integer: %s", idStr)
+	}
+	points, err := strconv.ParseInt(pointsStr, 10, 64)
+	if err != nil || points < 1 {
+		return 0, 0, fmt.Errorf("points must be a positive integer: %s", pointsStr)
+	}
+	return menuItemID, points, nil
+}
+
 func PrintHelp() {
 	fmt.Println(`Coffee Shop Management System
 
 Usage:
-  hot-coffee [--port <N>] [--dir <S>] 
+  hot-coffee [--port <N>] [--dir <S>] [--storage <S>] [--timeout <D>] [--route-timeout <R>=<D>]
+             [--tax-rate <P>] [--category-tax <C>=<P>] [--service-charge <P>] [--idempotency-ttl <D>]
+             [--idempotency-lease <D>] [--batch-workers <N>] [--preorder-lead-time <D>] [--scheduler-interval <D>]
+             [--webhook-interval <D>] [--webhook-backoff <D>] [--webhook-max-attempts <N>]
+             [--baristas <N>] [--loyalty-points-per-unit <N>] [--loyalty-item-points <ID>=<N>]
+             [--loyalty-point-value <V>] [--loyalty-reward <ID>=<N>] [--loyalty-expiry <D>]
+  hot-coffee migrate [--seed] up|down|status|to <N>|baseline <N>
   hot-coffee --help
 
 Options:
   --help       Show this screen.
   --port N     Port number.
+  --dir S      Directory of the file storage (default: data).
+  --storage S  Storage backend: postgres (default), memory or file.
+  --timeout D  Time limit of request processing, e.g. 10s (default: 10s).
+  --route-timeout R=D
+               Time limit of the route, e.g. /reports/total-sales=30s, can be repeated.
+  --tax-rate P Tax percent of the menu items (default: 0).
+  --category-tax C=P
+               Tax percent of the menu item category, e.g. bakery=5, can be repeated.
+  --service-charge P
+               Service charge percent added to every order (default: 0).
+  --idempotency-ttl D
+               Time the Idempotency-Key responses are replayed, e.g. 1h (default: 24h).
+  --idempotency-lease D
+               Time the request holds its Idempotency-Key before a retry can take it over,
+               longer than the route timeouts (default: 2m).
+  --batch-workers N
+               Number of batch orders created concurrently (default: 8).
+  --preorder-lead-time D
+               Time before the pickup the pre-order is opened, e.g. 10m (default: 15m).
+  --scheduler-interval D
+               How often the pre-orders due are opened, e.g. 1m (default: 30s).
+  --webhook-interval D
+               How often the webhook deliveries due are sent, e.g. 1s (default: 5s).
+  --webhook-backoff D
+               Delay before the first webhook retry, doubled on every next one (default: 30s).
+  --webhook-max-attempts N
+               Attempts before the webhook delivery is dead-lettered (default: 8).
+  --baristas N Baristas preparing the orders in parallel, used by ready time estimates (default: 1).
+  --loyalty-points-per-unit N
+               Loyalty points earned per currency unit of the closed order (default: 1).
+  --loyalty-item-points ID=N
+               Loyalty points earned per ordered menu item, e.g. 3=10, can be repeated.
+  --loyalty-point-value V
+               Discount given for one redeemed loyalty point (default: 0.01).
+  --loyalty-reward ID=N
+               Loyalty points the free menu item costs, e.g. 1=150, can be repeated.
+  --loyalty-expiry D
+               Time the earned loyalty points can be redeemed, e.g. 2160h (default: 8760h).
   --endpoints  Show the api endpoints.
   `)
 }
@@ -71,11 +304,16 @@ func PrintEndPoints() {
 
 ▶ Orders
   ├─ POST    /orders
-  │          → Create a new order.
+  │          → Create a new order, Idempotency-Key header makes retries safe.
+  │            Response has the estimated ready time of the order.
   ├─ GET     /orders
-  │          → Retrieve all orders.
+  │          ?status=&customer=&createdFrom=&createdTo=&menuItem=&minTotal=&maxTotal=&sortBy=&order=&limit=&cursor=
+  │          → Retrieve a page of orders, next_cursor of the response continues the listing.
   ├─ GET     /orders/open
   │          → Get a list of open orders.
+  ├─ GET     /orders/upcoming
+  │          ?minutes={minutes}
+  │          → Pre-orders to be picked up in the next minutes, earliest first.
   ├─ GET     /orders/{id}
   │          → Retrieve a specific order by ID.
   ├─ PUT     /orders/{id}
@@ -84,6 +322,21 @@ func PrintEndPoints() {
   │          → Delete an order.
   ├─ POST    /orders/{id}/close
   │          → Close an order.
+  ├─ POST    /orders/{id}/in_progress
+  │          → Start processing an order.
+  ├─ POST    /orders/{id}/transitions
+  │          → Move an order to another status with a reason.
+  ├─ GET     /orders/{id}/history
+  │          → Status changes of an order with time spent in each status.
+  ├─ GET     /orders/{id}/payments
+  │          → Payments and refunds of an order with its balance.
+  ├─ POST    /orders/{id}/payments
+  │          → Pay an order, several tenders split the bill.
+  ├─ POST    /orders/{id}/payments/refunds
+  │          → Refund an order fully or partially, optionally restocking its items.
+  ├─ POST    /orders/batch-process
+  │          ?atomic={true|false}
+  │          → Create several orders, atomic batch is created entirely or not at all.
   └─ GET     /orders/numberOfOrderedItems
              ?startDate={startDate}&endDate={endDate}
   │          → Returns a list of ordered items and their quantities for a specified time period.
@@ -92,6 +345,12 @@ func PrintEndPoints() {
   │            - startDate (optional): Start date in YYYY-MM-DD format.
   │            - endDate   (optional): End date in YYYY-MM-DD format.
 
+▶ Queue
+  ├─ GET     /queue
+  │          → Open and in progress orders, the oldest first, with menu names of the items.
+  └─ GET     /queue/stream
+             → Server-Sent Events of the order changes, Last-Event-ID header resumes the stream.
+
 ▶ Menu Items
   ├─ POST    /menu
   │          → Add a new menu item.
@@ -101,20 +360,79 @@ func PrintEndPoints() {
   │          → Retrieve a specific menu item.
   ├─ PUT     /menu/{id}
   │          → Update a menu item.
-  └─ DELETE  /menu/{id}
-             → Delete a menu item.
+  ├─ DELETE  /menu/{id}
+  │          → Archive a menu item.
+  └─ POST    /menu/{id}/restore
+             → Restore an archived menu item.
+
+▶ Customers
+  ├─ POST    /customers
+  │          → Add a new customer.
+  ├─ GET     /customers?name={name}&phone={phone}
+  │          → Search customers by part of the name and of the phone.
+  ├─ GET     /customers/{id}
+  │          → Retrieve a specific customer.
+  ├─ PUT     /customers/{id}
+  │          → Update a customer.
+  ├─ DELETE  /customers/{id}
+  │          → Delete a customer without orders.
+  ├─ GET     /customers/{id}/orders
+  │          → Order history of the customer, the newest first.
+  ├─ GET     /customers/{id}/loyalty
+  │          → Loyalty points balance of the customer with the ledger and the expiring points.
+  ├─ GET     /customers/{id}/export
+  │          → Personal data of the customer with orders and loyalty points, audited.
+  └─ POST    /customers/{id}/anonymize
+             → Scrub the name and the phone of the customer, orders are kept, audited.
+
+▶ Audit
+  └─ GET     /audit?action={action}&entity={entity}&entity_id={id}
+             → Audit trail of the personal data exports, anonymizations and deletions.
+
+▶ Promotions
+  ├─ POST    /promotions
+  │          → Add a new promotion.
+  ├─ GET     /promotions
+  │          → Retrieve all promotions.
+  ├─ GET     /promotions/{id}
+  │          → Retrieve a specific promotion.
+  ├─ PUT     /promotions/{id}
+  │          → Update a promotion.
+  └─ DELETE  /promotions/{id}
+             → Delete a promotion.
+
+▶ Webhooks
+  ├─ POST    /webhooks
+  │          → Subscribe a URL to events, deliveries are signed with the secret.
+  ├─ GET     /webhooks
+  │          → Retrieve all webhooks.
+  ├─ GET     /webhooks/{id}
+  │          → Retrieve a specific webhook.
+  ├─ PUT     /webhooks/{id}
+  │          → Update a webhook, empty secret keeps the current one.
+  ├─ DELETE  /webhooks/{id}
+  │          → Delete a webhook with its deliveries.
+  ├─ GET     /webhooks/{id}/deliveries
+  │          ?status={pending|delivered|dead}
+  │          → Deliveries of a webhook, the newest first.
+  ├─ GET     /webhooks/dead-letters
+  │          → Deliveries which exhausted their retries.
+  └─ POST    /webhooks/deliveries/{id}/retry
+             → Send a dead delivery again.
 
 ▶ Inventory
   ├─ POST    /inventory
   │          → Add a new inventory item.
   ├─ GET     /inventory
-  │          → Retrieve all inventory items.
+  │          → Retrieve all inventory items with on hand, reserved and available quantities.
   ├─ GET     /inventory/{id}
   │          → Retrieve a specific inventory item.
   ├─ PUT     /inventory/{id}
   │          → Update an inventory item.
   ├─ DELETE  /inventory/{id}
-  │          → Delete an inventory item.
+  │          → Archive an inventory item.
+  ├─ POST    /inventory/{id}/restore
+  │          → Restore an archived inventory item.
   └─ GET     /inventory/getLeftOvers
              ?sortBy={value}&page={page}&pageSize={pageSize}
   │          → Returns the inventory leftovers in the coffee shop, including sorting and pagination options.
@@ -129,6 +447,12 @@ func PrintEndPoints() {
   │          → Get the total sales amount.
   ├─ GET     /reports/popular-items
   │          → Get a list of popular menu items.
+  ├─ GET     /reports/order-throughput
+  │          ?startDate={startDate}&endDate={endDate}&percentile={percentile}
+  │          → Average and percentile time from open to closed per day.
+  ├─ GET     /reports/ready-time-accuracy
+  │          ?startDate={startDate}&endDate={endDate}
+  │          → Estimated ready times compared with the close times, by hour and menu item.
   ├─ GET     /reports/search
   │          ?q={query}&filter={orders|menu|all}&minPrice={minPrice}&maxPrice={maxPrice}
   │          → Search through orders, menu items, and customers with partial matching and ranking.
@@ -149,3 +473,11 @@ func PrintEndPoints() {
 
 ==========================================`)
 }
+
+// Returns the time limit of route pattern
+func RouteTimeout(pattern string) time.Duration {
+	if timeout, ok := RouteTimeouts[pattern]; ok {
+		return timeout
+	}
+	return Timeout
+}
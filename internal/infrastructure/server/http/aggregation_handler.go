@@ -12,7 +12,8 @@ import (
 
 // Errors
 var (
-	ErrNonIntegerYear = fmt.Errorf("year must be an integer")
+	ErrNonIntegerYear       = fmt.Errorf("year must be an integer")
+	ErrNonIntegerPercentile = fmt.Errorf("percentile must be an integer")
 )
 
 // Route: GET /reports/total-sales
@@ -24,7 +25,7 @@ func HandleTotalSales(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sales, err := serviceinstance.OrderService.GetTotalSales()
+	sales, err := serviceinstance.OrderService.GetTotalSales(r.Context())
 	if err != nil {
 		jsonErrorRespond(w, err, http.StatusBadRequest)
 		return
@@ -47,7 +48,7 @@ func HandlePopularItems(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	popularItems, err := serviceinstance.OrderService.GetPopularMenuItems()
+	popularItems, err := serviceinstance.OrderService.GetPopularMenuItems(r.Context())
 	if err != nil {
 		jsonErrorRespond(w, err, http.StatusInternalServerError)
 		return
@@ -77,7 +78,7 @@ func HandleOrderedItemsByPeriod(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodGet:
-		items, err := serviceinstance.OrderService.GetOrderedItemsByPeriod(period, month, year)
+		items, err := serviceinstance.OrderService.GetOrderedItemsByPeriod(r.Context(), period, month, year)
 		if err != nil {
 			statusCode := http.StatusInternalServerError
 			switch {
@@ -114,7 +115,7 @@ func HandleNumberOfOrderedItems(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodGet:
-		items, err := serviceinstance.OrderService.GetOrderedMenuItemsCountByPeriod(startDate, endDate)
+		items, err := serviceinstance.OrderService.GetOrderedMenuItemsCountByPeriod(r.Context(), startDate, endDate)
 		if err != nil {
 			statusCode := http.StatusInternalServerError
 			if errors.Is(err, serviceinstance.ErrEndDateEarlierThanStartDate) || errors.Is(err, serviceinstance.ErrInvalidDate) {
@@ -139,6 +140,79 @@ func HandleNumberOfOrderedItems(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// Route: GET /reports/order-throughput?startDate={startDate}&endDate={endDate}&percentile={percentile}
+func HandleOrderThroughput(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	startDate := r.URL.Query().Get("startDate")
+	endDate := r.URL.Query().Get("endDate")
+	percentileStr := r.URL.Query().Get("percentile")
+
+	percentile, err := strconv.Atoi(percentileStr)
+	if err != nil && percentileStr != "" {
+		jsonErrorRespond(w, ErrNonIntegerPercentile, http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		report, err := serviceinstance.OrderService.GetOrderThroughput(r.Context(), startDate, endDate, percentile)
+		if err != nil {
+			statusCode := http.StatusInternalServerError
+			if errors.Is(err, serviceinstance.ErrEndDateEarlierThanStartDate) ||
+				errors.Is(err, serviceinstance.ErrInvalidDate) ||
+				errors.Is(err, serviceinstance.ErrInvalidPercentile) {
+				statusCode = http.StatusBadRequest
+			}
+			jsonErrorRespond(w, err, statusCode)
+			return
+		}
+
+		jsonPayload, err := json.MarshalIndent(report, "", "   ")
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.Write(jsonPayload)
+		return
+	default:
+		w.Header().Set("Allow", "GET")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+// Route: GET /reports/ready-time-accuracy?startDate={startDate}&endDate={endDate}
+func HandleReadyTimeAccuracy(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		report, err := serviceinstance.OrderService.GetReadyTimeReport(r.Context(), r.URL.Query().Get("startDate"), r.URL.Query().Get("endDate"))
+		if err != nil {
+			statusCode := http.StatusInternalServerError
+			if errors.Is(err, serviceinstance.ErrEndDateEarlierThanStartDate) ||
+				errors.Is(err, serviceinstance.ErrInvalidDate) {
+				statusCode = http.StatusBadRequest
+			}
+			jsonErrorRespond(w, err, statusCode)
+			return
+		}
+
+		jsonPayload, err := json.MarshalIndent(report, "", "   ")
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.Write(jsonPayload)
+		return
+	default:
+		w.Header().Set("Allow", "GET")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
 // Route: GET /reports/search?q=chocolate cake&filter=menu,orders&minPrice=10
 func HandleFullTextSearchReport(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -150,7 +224,7 @@ func HandleFullTextSearchReport(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodGet:
-		orders, err := serviceinstance.AggregationService.FullTextSearchReport(queryString, filter, minPrice, maxPrice)
+		orders, err := serviceinstance.AggregationService.FullTextSearchReport(r.Context(), queryString, filter, minPrice, maxPrice)
 		if err != nil {
 			statusCode := http.StatusInternalServerError
 			switch {
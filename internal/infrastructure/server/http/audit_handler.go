@@ -0,0 +1,48 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"hot-coffee/internal/core/errors"
+	"hot-coffee/internal/service/serviceinstance"
+)
+
+// Route: /audit
+func HandleAudit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		values := r.URL.Query()
+		entries, err := serviceinstance.AuditService.GetAuditTrail(r.Context(), values.Get("action"), values.Get("entity"), values.Get("entity_id"))
+		if err != nil {
+			jsonErrorRespond(w, err, auditErrorStatus(err))
+			return
+		}
+
+		jsonPayload, err := json.MarshalIndent(entries, "", "   ")
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.Write(jsonPayload)
+		return
+	default:
+		w.Header().Set("Allow", "GET")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+// Status code of the failed audit request, the filters are the only input
+func auditErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, serviceinstance.ErrUnknownAuditAction),
+		errors.Is(err, serviceinstance.ErrUnknownAuditEntity),
+		errors.Is(err, serviceinstance.ErrNonNumericID),
+		errors.Is(err, serviceinstance.ErrNegativeID),
+		errors.Is(err, serviceinstance.ErrZeroID):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,224 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+	"hot-coffee/internal/dto"
+	"hot-coffee/internal/service/serviceinstance"
+)
+
+// Route: /customers
+func HandleCustomers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		values := r.URL.Query()
+		customers, err := serviceinstance.CustomerService.SearchCustomers(r.Context(), values.Get("name"), values.Get("phone"))
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		jsonPayload, err := json.MarshalIndent(customers, "", "   ")
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.Write(jsonPayload)
+		return
+	case http.MethodPost:
+		var customer entities.Customer
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&customer)
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusBadRequest)
+			return
+		}
+
+		id, err := serviceinstance.CustomerService.CreateCustomer(r.Context(), customer)
+		if err != nil {
+			jsonErrorRespond(w, err, customerErrorStatus(err))
+			return
+		}
+		jsonMessageRespond(w, fmt.Sprintf("Successfully created Customer with ID: %d", id), http.StatusCreated)
+		return
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+// Route: /customers/<id>
+func HandleCustomer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := r.PathValue("id")
+	switch r.Method {
+	case http.MethodGet:
+		customer, err := serviceinstance.CustomerService.GetCustomer(r.Context(), id)
+		if err != nil {
+			jsonErrorRespond(w, err, customerErrorStatus(err))
+			return
+		}
+
+		setETag(w, customer.Version)
+		jsonPayload, err := json.MarshalIndent(customer, "", "   ")
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.Write(jsonPayload)
+		return
+	case http.MethodPut:
+		var customer entities.Customer
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&customer)
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusBadRequest)
+			return
+		}
+		customer.Version, err = ifMatchVersion(r)
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusPreconditionFailed)
+			return
+		}
+
+		err = serviceinstance.CustomerService.UpdateCustomer(r.Context(), id, customer)
+		if err != nil {
+			jsonErrorRespond(w, err, customerErrorStatus(err))
+			return
+		}
+		jsonMessageRespond(w, "Customer successfully updated", http.StatusOK)
+		return
+	case http.MethodDelete:
+		err := serviceinstance.CustomerService.DeleteCustomer(r.Context(), id, requestActor(r))
+		if err != nil {
+			jsonErrorRespond(w, err, customerErrorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+// Route: /customers/<id>/orders
+func HandleCustomerOrders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := r.PathValue("id")
+	switch r.Method {
+	case http.MethodGet:
+		orders, err := serviceinstance.CustomerService.GetCustomerOrders(r.Context(), id)
+		if err != nil {
+			jsonErrorRespond(w, err, customerErrorStatus(err))
+			return
+		}
+
+		jsonPayload, err := json.MarshalIndent(orders, "", "   ")
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.Write(jsonPayload)
+		return
+	default:
+		w.Header().Set("Allow", "GET")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+// Route: /customers/<id>/export
+func HandleCustomerExport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := r.PathValue("id")
+	switch r.Method {
+	case http.MethodGet:
+		export, err := serviceinstance.CustomerService.ExportCustomer(r.Context(), id, requestActor(r))
+		if err != nil {
+			jsonErrorRespond(w, err, customerErrorStatus(err))
+			return
+		}
+
+		jsonPayload, err := json.MarshalIndent(export, "", "   ")
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="customer-%s.json"`, export.Customer.ID))
+		w.Write(jsonPayload)
+		return
+	default:
+		w.Header().Set("Allow", "GET")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+// Route: /customers/<id>/anonymize
+func HandleCustomerAnonymize(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := r.PathValue("id")
+	switch r.Method {
+	case http.MethodPost:
+		var request dto.AnonymizeRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+			jsonErrorRespond(w, fmt.Errorf("invalid JSON provided: %w", err), http.StatusBadRequest)
+			return
+		}
+
+		customer, err := serviceinstance.CustomerService.AnonymizeCustomer(r.Context(), id, requestActor(r), request.Reason)
+		if err != nil {
+			jsonErrorRespond(w, err, customerErrorStatus(err))
+			return
+		}
+
+		setETag(w, customer.Version)
+		jsonPayload, err := json.MarshalIndent(customer, "", "   ")
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.Write(jsonPayload)
+		return
+	default:
+		w.Header().Set("Allow", "POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+// Status code of the failed customer request, validation errors are answered with 400
+func customerErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, serviceinstance.ErrCustomerNotExists):
+		return http.StatusNotFound
+	case errors.Is(err, serviceinstance.ErrCustomerPhoneTaken),
+		errors.Is(err, serviceinstance.ErrCustomerHasOrders),
+		errors.Is(err, serviceinstance.ErrCustomerAnonymized):
+		return http.StatusConflict
+	case errors.Is(err, serviceinstance.ErrCustomerVersionMismatch):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, serviceinstance.ErrEmptyCustomerFullname),
+		errors.Is(err, serviceinstance.ErrInvalidPhone),
+		errors.Is(err, serviceinstance.ErrCustomerIDCollision),
+		errors.Is(err, serviceinstance.ErrEmptyID),
+		errors.Is(err, serviceinstance.ErrNonNumericID),
+		errors.Is(err, serviceinstance.ErrNegativeID),
+		errors.Is(err, serviceinstance.ErrZeroID):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
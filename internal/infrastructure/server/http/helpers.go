@@ -1,10 +1,24 @@
 package httpserver
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Non-standard status code of request closed by client
+const StatusClientClosedRequest = 499
+
+// Errors
+var (
+	ErrRequestCanceled = errors.New("request canceled")
+	ErrRequestTimeout  = errors.New("request processing timed out")
+	ErrInvalidIfMatch  = errors.New("If-Match header must contain single entity tag")
 )
 
 type errorEnveloper struct {
@@ -14,6 +28,15 @@ type errorEnveloper struct {
 // TODO: Move error handling from this helper to handlers
 // TODO: Move error logging to another place
 func jsonErrorRespond(w http.ResponseWriter, err error, statusCode int) {
+	if code, ctxErr := contextErrorStatus(err); code != 0 {
+		slog.Error(err.Error())
+		statusCode, err = code, ctxErr
+		w.WriteHeader(statusCode)
+		json, _ := json.Marshal(errorEnveloper{Err: err.Error()})
+		w.Write(json)
+		return
+	}
+
 	if statusCode == 0 {
 		w.WriteHeader(http.StatusBadRequest)
 	} else {
@@ -44,3 +67,45 @@ func jsonMessageRespond(w http.ResponseWriter, message string, statusCode int) {
 	w.Write(json)
 
 }
+
+// Returns status code and error shown to client for context errors, zero code for other errors
+func contextErrorStatus(err error) (int, error) {
+	switch {
+	case err == nil:
+		return 0, nil
+	case errors.Is(err, context.Canceled):
+		return StatusClientClosedRequest, ErrRequestCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, ErrRequestTimeout
+	}
+	return 0, nil
+}
+
+// Sets version of entity as strong entity tag
+func setETag(w http.ResponseWriter, version int64) {
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, version))
+}
+
+// Returns version required by If-Match header, 0 if the header is absent or matches any version
+func ifMatchVersion(r *http.Request) (int64, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+
+	// Weak tags are never matched by If-Match
+	if !strings.HasPrefix(header, `"`) || !strings.HasSuffix(header, `"`) || len(header) < 2 {
+		return 0, ErrInvalidIfMatch
+	}
+
+	version, err := strconv.ParseInt(header[1:len(header)-1], 10, 64)
+	if err != nil || version < 1 {
+		return 0, ErrInvalidIfMatch
+	}
+	return version, nil
+}
+
+// Who makes the request, as told by X-Actor header. Recorded in the audit trail, empty if the header is absent
+func requestActor(r *http.Request) string {
+	return strings.TrimSpace(r.Header.Get("X-Actor"))
+}
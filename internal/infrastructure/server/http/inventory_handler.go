@@ -22,7 +22,7 @@ func HandleInventory(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	switch r.Method {
 	case http.MethodGet:
-		items, err := serviceinstance.InventoryService.GetInventoryItems()
+		items, err := serviceinstance.InventoryService.GetInventoryItems(r.Context())
 		if err != nil {
 			if errors.Is(err, serviceinstance.ErrNoInventoryItems) {
 				jsonMessageRespond(w, err.Error(), http.StatusOK)
@@ -47,7 +47,7 @@ func HandleInventory(w http.ResponseWriter, r *http.Request) {
 			jsonErrorRespond(w, err, http.StatusInternalServerError)
 			return
 		}
-		err = serviceinstance.InventoryService.CreateInventoryItem(item)
+		err = serviceinstance.InventoryService.CreateInventoryItem(r.Context(), item)
 		if err != nil {
 			statusCode := http.StatusBadRequest
 			switch err {
@@ -73,7 +73,7 @@ func HandleInventoryItem(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	switch r.Method {
 	case http.MethodGet:
-		item, err := serviceinstance.InventoryService.GetInventoryItem(id)
+		item, err := serviceinstance.InventoryService.GetInventoryItem(r.Context(), id)
 		if err != nil {
 			statusCode := http.StatusBadRequest
 			switch err {
@@ -84,6 +84,7 @@ func HandleInventoryItem(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		setETag(w, item.Version)
 		jsonPayload, err := json.MarshalIndent(item, "", "   ")
 		if err != nil {
 			jsonErrorRespond(w, err, http.StatusInternalServerError)
@@ -99,12 +100,21 @@ func HandleInventoryItem(w http.ResponseWriter, r *http.Request) {
 			jsonErrorRespond(w, err, http.StatusInternalServerError)
 			return
 		}
-		err = serviceinstance.InventoryService.UpdateInventoryItem(id, item)
+		item.Version, err = ifMatchVersion(r)
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusPreconditionFailed)
+			return
+		}
+		err = serviceinstance.InventoryService.UpdateInventoryItem(r.Context(), id, item)
 		if err != nil {
 			statusCode := http.StatusBadRequest
 			switch err {
 			case serviceinstance.ErrInventoryItemDoesntExist:
 				statusCode = http.StatusNotFound
+			case serviceinstance.ErrInventoryItemVersionMismatch:
+				statusCode = http.StatusPreconditionFailed
+			case serviceinstance.ErrQuantityBelowReserved:
+				statusCode = http.StatusConflict
 			}
 			jsonErrorRespond(w, err, statusCode)
 			return
@@ -112,7 +122,7 @@ func HandleInventoryItem(w http.ResponseWriter, r *http.Request) {
 		jsonMessageRespond(w, "Inventory Item successfully updated", http.StatusOK)
 		return
 	case http.MethodDelete:
-		err := serviceinstance.InventoryService.DeleteInventoryItem(id)
+		err := serviceinstance.InventoryService.DeleteInventoryItem(r.Context(), id)
 		if err != nil {
 			statusCode := http.StatusBadRequest
 			switch err {
@@ -131,6 +141,34 @@ func HandleInventoryItem(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Route: /inventory/{id}/restore
+func HandleInventoryItemRestore(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := r.PathValue("id")
+	switch r.Method {
+	case http.MethodPost:
+		err := serviceinstance.InventoryService.RestoreInventoryItem(r.Context(), id)
+		if err != nil {
+			statusCode := http.StatusBadRequest
+			switch err {
+			case serviceinstance.ErrInventoryItemDoesntExist:
+				statusCode = http.StatusNotFound
+			case serviceinstance.ErrInventoryItemNotArchived:
+				statusCode = http.StatusConflict
+			}
+			jsonErrorRespond(w, err, statusCode)
+			return
+		}
+		jsonMessageRespond(w, "Inventory Item successfully restored", http.StatusOK)
+		return
+	default:
+		w.Header().Set("Allow", "POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
 // Route: /inventory/getLeftOvers?sortBy={value}&page={page}&pageSize={pageSize}
 func HandleInventoryLeftovers(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -152,7 +190,7 @@ func HandleInventoryLeftovers(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodGet:
-		items, err := serviceinstance.InventoryService.GetLeftovers(sortBy, page, pageSize)
+		items, err := serviceinstance.InventoryService.GetLeftovers(r.Context(), sortBy, page, pageSize)
 		if err != nil {
 			statusCode := http.StatusInternalServerError
 			switch {
@@ -0,0 +1,35 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"hot-coffee/internal/service/serviceinstance"
+)
+
+// Route: /customers/<id>/loyalty
+func HandleCustomerLoyalty(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := r.PathValue("id")
+	switch r.Method {
+	case http.MethodGet:
+		account, err := serviceinstance.LoyaltyService.GetLoyalty(r.Context(), id)
+		if err != nil {
+			jsonErrorRespond(w, err, customerErrorStatus(err))
+			return
+		}
+
+		jsonPayload, err := json.MarshalIndent(account, "", "   ")
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.Write(jsonPayload)
+		return
+	default:
+		w.Header().Set("Allow", "GET")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
@@ -14,7 +14,7 @@ func HandleMenu(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	switch r.Method {
 	case http.MethodGet:
-		items, err := serviceinstance.MenuService.GetMenuItems()
+		items, err := serviceinstance.MenuService.GetMenuItems(r.Context())
 		if err != nil {
 			if errors.Is(err, serviceinstance.ErrNoMenuItems) {
 				jsonMessageRespond(w, "No menu items", http.StatusOK)
@@ -40,7 +40,7 @@ func HandleMenu(w http.ResponseWriter, r *http.Request) {
 			jsonErrorRespond(w, err, http.StatusInternalServerError)
 			return
 		}
-		err = serviceinstance.MenuService.CreateMenuItem(item)
+		err = serviceinstance.MenuService.CreateMenuItem(r.Context(), item)
 		if err != nil {
 			statusCode := http.StatusBadRequest
 			switch err {
@@ -67,7 +67,7 @@ func HandleMenuItem(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	switch r.Method {
 	case http.MethodGet:
-		item, err := serviceinstance.MenuService.GetMenuItem(id)
+		item, err := serviceinstance.MenuService.GetMenuItem(r.Context(), id)
 		if err != nil {
 			statusCode := http.StatusBadRequest
 			switch err {
@@ -78,6 +78,7 @@ func HandleMenuItem(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		setETag(w, item.Version)
 		jsonPayload, err := json.MarshalIndent(item, "", "   ")
 		if err != nil {
 			jsonErrorRespond(w, err, http.StatusInternalServerError)
@@ -93,12 +94,19 @@ func HandleMenuItem(w http.ResponseWriter, r *http.Request) {
 			jsonErrorRespond(w, err, http.StatusInternalServerError)
 			return
 		}
-		err = serviceinstance.MenuService.UpdateMenuItem(id, item)
+		item.Version, err = ifMatchVersion(r)
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusPreconditionFailed)
+			return
+		}
+		err = serviceinstance.MenuService.UpdateMenuItem(r.Context(), id, item)
 		if err != nil {
 			statusCode := http.StatusBadRequest
 			switch err {
 			case serviceinstance.ErrMenuItemNotExists:
 				statusCode = http.StatusNotFound
+			case serviceinstance.ErrMenuItemVersionMismatch:
+				statusCode = http.StatusPreconditionFailed
 			}
 			jsonErrorRespond(w, err, statusCode)
 			return
@@ -106,7 +114,7 @@ func HandleMenuItem(w http.ResponseWriter, r *http.Request) {
 		jsonMessageRespond(w, "Menu Item successfully updated", http.StatusOK)
 		return
 	case http.MethodDelete:
-		err := serviceinstance.MenuService.DeleteMenuItem(id)
+		err := serviceinstance.MenuService.DeleteMenuItem(r.Context(), id)
 		if err != nil {
 			statusCode := http.StatusBadRequest
 			switch err {
@@ -124,3 +132,31 @@ func HandleMenuItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// Route: /menu/<id>/restore
+func HandleMenuItemRestore(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := r.PathValue("id")
+	switch r.Method {
+	case http.MethodPost:
+		err := serviceinstance.MenuService.RestoreMenuItem(r.Context(), id)
+		if err != nil {
+			statusCode := http.StatusBadRequest
+			switch err {
+			case serviceinstance.ErrMenuItemNotExists:
+				statusCode = http.StatusNotFound
+			case serviceinstance.ErrMenuItemNotArchived:
+				statusCode = http.StatusConflict
+			}
+			jsonErrorRespond(w, err, statusCode)
+			return
+		}
+		jsonMessageRespond(w, "Menu Item successfully restored", http.StatusOK)
+		return
+	default:
+		w.Header().Set("Allow", "POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
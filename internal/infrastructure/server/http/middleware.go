@@ -1,9 +1,19 @@
 package httpserver
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"time"
+
+	"hot-coffee/internal/core/errors"
+	"hot-coffee/internal/service/serviceinstance"
 )
 
 func RequestLoggingMiddleware(next http.Handler) http.Handler {
@@ -19,3 +29,139 @@ func HeadersMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// Limits the request processing time, the request context is canceled on timeout or client disconnect
+func TimeoutMiddleware(timeout time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		r = r.WithContext(ctx)
+		next.ServeHTTP(&contextResponseWriter{ResponseWriter: w, ctx: ctx}, r)
+	})
+}
+
+// Replaces server error response with 499 or 504 if it was caused by canceled request context,
+// the storage drivers do not always return context errors on cancellation
+type contextResponseWriter struct {
+	http.ResponseWriter
+	ctx      context.Context
+	replaced bool
+}
+
+func (w *contextResponseWriter) WriteHeader(statusCode int) {
+	if statusCode >= 500 {
+		if code, err := contextErrorStatus(w.ctx.Err()); code != 0 {
+			w.replaced = true
+			w.ResponseWriter.WriteHeader(code)
+			json, _ := json.Marshal(errorEnveloper{Err: err.Error()})
+			w.ResponseWriter.Write(json)
+			return
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *contextResponseWriter) Write(b []byte) (int, error) {
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Makes POST requests with Idempotency-Key header safe to retry: the first response is stored
+// and replayed for the same request, the key reused with another request is rejected with 422.
+// Server errors are not stored and the key of the panicked request is freed, the request can be
+// retried with the same key. The key of the request lost by a crash is taken over after the lease.
+func IdempotencyMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, ok := r.Header["Idempotency-Key"]
+		if r.Method != http.MethodPost || !ok {
+			next(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			jsonErrorRespond(w, fmt.Errorf("failed to read request body: %w", err), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		fmt.Fprintf(hash, "%s %s\n", r.Method, r.URL.Path)
+		hash.Write(body)
+		requestHash := hex.EncodeToString(hash.Sum(nil))
+
+		record, replay, err := serviceinstance.IdempotencyService.Begin(r.Context(), key[0], requestHash)
+		if err != nil {
+			statusCode := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, serviceinstance.ErrInvalidIdempotencyKey):
+				statusCode = http.StatusBadRequest
+			case errors.Is(err, serviceinstance.ErrIdempotencyKeyReused):
+				statusCode = http.StatusUnprocessableEntity
+			case errors.Is(err, serviceinstance.ErrIdempotencyKeyInProgress):
+				statusCode = http.StatusConflict
+			}
+			jsonErrorRespond(w, err, statusCode)
+			return
+		}
+		if replay {
+			w.Header().Set("Content-Type", record.ContentType)
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.StatusCode)
+			w.Write(record.Body)
+			return
+		}
+
+		// The key is released or the response is saved even if the request timed out meanwhile
+		ctx := context.WithoutCancel(r.Context())
+		release := func() {
+			if err := serviceinstance.IdempotencyService.Release(ctx, record); err != nil {
+				slog.Error("Error while releasing idempotency key", "key", record.Key, "error", err.Error())
+			}
+		}
+		defer func() {
+			if p := recover(); p != nil {
+				release()
+				panic(p)
+			}
+		}()
+
+		recorder := &recordingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next(recorder, r)
+
+		if recorder.statusCode >= 500 || recorder.statusCode == StatusClientClosedRequest {
+			release()
+			return
+		}
+		err = serviceinstance.IdempotencyService.Complete(ctx, record, recorder.statusCode, w.Header().Get("Content-Type"), recorder.body.Bytes())
+		if err != nil {
+			slog.Error("Error while saving idempotent response", "key", record.Key, "error", err.Error())
+		}
+	}
+}
+
+// Copies the response to the buffer while writing it
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (w *recordingResponseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.statusCode = statusCode
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *recordingResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
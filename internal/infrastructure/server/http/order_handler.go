@@ -4,28 +4,54 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"hot-coffee/internal/core/entities"
 	"hot-coffee/internal/core/errors"
+	"hot-coffee/internal/dto"
 	"hot-coffee/internal/service/serviceinstance"
 )
 
-// Route: /orders
+// Route: /orders?status=&customer=&createdFrom=&createdTo=&menuItem=&minTotal=&maxTotal=&sortBy=&order=&limit=&cursor=
 func HandleOrders(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		w.Header().Set("Content-Type", "application/json")
-		orders, err := serviceinstance.OrderService.GetOrders()
+		values := r.URL.Query()
+		query := dto.OrderQuery{
+			Status:      values.Get("status"),
+			Customer:    values.Get("customer"),
+			CreatedFrom: values.Get("createdFrom"),
+			CreatedTo:   values.Get("createdTo"),
+			MenuItemID:  values.Get("menuItem"),
+			MinTotal:    values.Get("minTotal"),
+			MaxTotal:    values.Get("maxTotal"),
+			SortBy:      values.Get("sortBy"),
+			Order:       values.Get("order"),
+			Limit:       values.Get("limit"),
+			Cursor:      values.Get("cursor"),
+		}
+
+		page, err := serviceinstance.OrderService.ListOrders(r.Context(), query)
 		if err != nil {
-			if errors.Is(err, serviceinstance.ErrNoOrders) {
-				jsonMessageRespond(w, "No orders", http.StatusOK)
-				return
+			statusCode := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, serviceinstance.ErrInvalidStatusFilter),
+				errors.Is(err, serviceinstance.ErrInvalidCreatedAtFilter),
+				errors.Is(err, serviceinstance.ErrInvalidMenuItemFilter),
+				errors.Is(err, serviceinstance.ErrInvalidTotalFilter),
+				errors.Is(err, serviceinstance.ErrMinTotalGreaterThanMax),
+				errors.Is(err, serviceinstance.ErrInvalidSortField),
+				errors.Is(err, serviceinstance.ErrInvalidSortOrder),
+				errors.Is(err, serviceinstance.ErrInvalidLimit),
+				errors.Is(err, serviceinstance.ErrInvalidCursor):
+				statusCode = http.StatusBadRequest
 			}
-			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			jsonErrorRespond(w, err, statusCode)
 			return
 		}
 
-		jsonPayload, err := json.MarshalIndent(orders, "", "   ")
+		jsonPayload, err := json.MarshalIndent(page, "", "   ")
 		if err != nil {
 			jsonErrorRespond(w, err, http.StatusInternalServerError)
 			return
@@ -42,13 +68,24 @@ func HandleOrders(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		orderID, err := serviceinstance.OrderService.CreateOrder(order)
+		created, err := serviceinstance.OrderService.CreateOrder(r.Context(), order)
 		if err != nil {
 			jsonErrorRespond(w, err, http.StatusBadRequest)
 			return
 		}
 
-		jsonMessageRespond(w, fmt.Sprintf("Successfully created Order with ID: %d", orderID), http.StatusCreated)
+		jsonPayload, err := json.MarshalIndent(dto.OrderCreated{
+			Message:          fmt.Sprintf("Successfully created Order with ID: %s", created.ID),
+			OrderID:          created.ID,
+			Status:           created.Status,
+			EstimatedReadyAt: created.EstimatedReadyAt,
+		}, "", "   ")
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write(jsonPayload)
 		return
 	case http.MethodOptions:
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
@@ -71,11 +108,12 @@ func HandleOrder(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		w.Header().Set("Content-Type", "application/json")
-		order, err := serviceinstance.OrderService.GetOrder(id)
+		order, err := serviceinstance.OrderService.GetOrder(r.Context(), id)
 		if err != nil {
 			jsonErrorRespond(w, err, http.StatusBadRequest)
 			return
 		}
+		setETag(w, order.Version)
 		jsonPayload, err := json.MarshalIndent(order, "", "   ")
 		if err != nil {
 			jsonErrorRespond(w, err, http.StatusInternalServerError)
@@ -92,20 +130,42 @@ func HandleOrder(w http.ResponseWriter, r *http.Request) {
 			jsonErrorRespond(w, err, http.StatusInternalServerError)
 			return
 		}
-		err = serviceinstance.OrderService.UpdateOrder(id, order)
+		order.Version, err = ifMatchVersion(r)
 		if err != nil {
-			jsonErrorRespond(w, err, http.StatusBadRequest)
+			jsonErrorRespond(w, err, http.StatusPreconditionFailed)
+			return
+		}
+		err = serviceinstance.OrderService.UpdateOrder(r.Context(), id, order)
+		if err != nil {
+			statusCode := http.StatusBadRequest
+			switch {
+			case errors.Is(err, serviceinstance.ErrOrderIDCollision):
+				statusCode = http.StatusBadRequest
+			case errors.Is(err, serviceinstance.ErrOrderVersionMismatch):
+				statusCode = http.StatusPreconditionFailed
+			case errors.Is(err, serviceinstance.ErrOrderNotExists):
+				statusCode = http.StatusNotFound
+			case errors.Is(err, serviceinstance.ErrIllegalOrderTransition),
+				errors.Is(err, serviceinstance.ErrClosedOrderCannotBeModified),
+				errors.Is(err, serviceinstance.ErrOrderNotSettled),
+				errors.Is(err, serviceinstance.ErrOrderTotalBelowPaidTotal):
+				statusCode = http.StatusConflict
+			}
+			jsonErrorRespond(w, err, statusCode)
 			return
 		}
 		jsonMessageRespond(w, "Successfully updated order", http.StatusOK)
 		return
 	case http.MethodDelete:
-		err := serviceinstance.OrderService.DeleteOrder(id)
+		err := serviceinstance.OrderService.DeleteOrder(r.Context(), id)
 		if err != nil {
 			if errors.Is(err, serviceinstance.ErrOrderNotExists) {
 				w.Header().Set("Content-Type", "application/json")
 				jsonErrorRespond(w, err, http.StatusNotFound)
 				return
+			} else if errors.Is(err, serviceinstance.ErrOrderHasPayments) {
+				jsonErrorRespond(w, err, http.StatusConflict)
+				return
 			}
 			jsonErrorRespond(w, err, http.StatusBadRequest)
 			return
@@ -114,7 +174,8 @@ func HandleOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	case http.MethodOptions:
 		w.Header().Set("Access-Control-Allow-Methods", "GET, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag")
 		w.WriteHeader(http.StatusNoContent)
 		return
 	default:
@@ -130,9 +191,9 @@ func HandleOrderClose(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	switch r.Method {
 	case http.MethodPost:
-		err := serviceinstance.OrderService.CloseOrder(id)
+		err := serviceinstance.OrderService.CloseOrder(r.Context(), id)
 		if err != nil {
-			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			jsonErrorRespond(w, err, transitionErrorStatus(err))
 			return
 		}
 
@@ -152,9 +213,9 @@ func HandleOrderInProgress(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	switch r.Method {
 	case http.MethodPost:
-		err := serviceinstance.OrderService.SetInProgress(id)
+		err := serviceinstance.OrderService.SetInProgress(r.Context(), id)
 		if err != nil {
-			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			jsonErrorRespond(w, err, transitionErrorStatus(err))
 			return
 		}
 	case http.MethodOptions:
@@ -169,11 +230,99 @@ func HandleOrderInProgress(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Route: /orders/<id>/transitions
+func HandleOrderTransitions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := r.PathValue("id")
+	switch r.Method {
+	case http.MethodPost:
+		var transition dto.OrderTransition
+		if err := json.NewDecoder(r.Body).Decode(&transition); err != nil {
+			jsonErrorRespond(w, fmt.Errorf("invalid JSON provided: %w", err), http.StatusBadRequest)
+			return
+		}
+
+		err := serviceinstance.OrderService.TransitionOrder(r.Context(), id, transition.Status, transition.Reason)
+		if err != nil {
+			jsonErrorRespond(w, err, transitionErrorStatus(err))
+			return
+		}
+		jsonMessageRespond(w, fmt.Sprintf("Order moved to %q status", transition.Status), http.StatusOK)
+		return
+	case http.MethodOptions:
+		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", "POST, OPTIONS")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+// Route: /orders/<id>/history
+func HandleOrderHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := r.PathValue("id")
+	switch r.Method {
+	case http.MethodGet:
+		history, err := serviceinstance.OrderService.GetOrderHistory(r.Context(), id)
+		if err != nil {
+			statusCode := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, serviceinstance.ErrOrderNotExists):
+				statusCode = http.StatusNotFound
+			case errors.Is(err, serviceinstance.ErrEmptyID),
+				errors.Is(err, serviceinstance.ErrNonNumericID),
+				errors.Is(err, serviceinstance.ErrNegativeID),
+				errors.Is(err, serviceinstance.ErrZeroID):
+				statusCode = http.StatusBadRequest
+			}
+			jsonErrorRespond(w, err, statusCode)
+			return
+		}
+
+		jsonPayload, err := json.MarshalIndent(history, "", "   ")
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.Write(jsonPayload)
+		return
+	default:
+		w.Header().Set("Allow", "GET")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+// Status code of the failed order status change
+func transitionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, serviceinstance.ErrIllegalOrderTransition),
+		errors.Is(err, serviceinstance.ErrOrderVersionMismatch),
+		errors.Is(err, serviceinstance.ErrOrderNotSettled):
+		return http.StatusConflict
+	case errors.Is(err, serviceinstance.ErrOrderNotExists):
+		return http.StatusNotFound
+	case errors.Is(err, serviceinstance.ErrIncorrectOrderStatus),
+		errors.Is(err, serviceinstance.ErrEmptyID),
+		errors.Is(err, serviceinstance.ErrNonNumericID),
+		errors.Is(err, serviceinstance.ErrNegativeID),
+		errors.Is(err, serviceinstance.ErrZeroID):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
 func HandleOpenOrders(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		w.Header().Set("Content-Type", "application/json")
-		openOrders, err := serviceinstance.OrderService.GetOpenOrders()
+		openOrders, err := serviceinstance.OrderService.GetOpenOrders(r.Context())
 		if err != nil {
 			jsonErrorRespond(w, err, http.StatusInternalServerError)
 			return
@@ -198,8 +347,37 @@ func HandleOpenOrders(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Route: /orders/upcoming?minutes=
+func HandleUpcomingOrders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		orders, err := serviceinstance.OrderService.GetUpcomingOrders(r.Context(), r.URL.Query().Get("minutes"))
+		if err != nil {
+			statusCode := http.StatusInternalServerError
+			if errors.Is(err, serviceinstance.ErrInvalidUpcomingMinutes) {
+				statusCode = http.StatusBadRequest
+			}
+			jsonErrorRespond(w, err, statusCode)
+			return
+		}
+
+		jsonPayload, err := json.MarshalIndent(orders, "", "   ")
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.Write(jsonPayload)
+		return
+	default:
+		w.Header().Set("Allow", "GET")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
 type batchRequest struct {
-	Orders []entities.Order `json:"orders"`
+	Orders []dto.BatchOrder `json:"orders"`
 }
 
 // POST /orders/batch-process
@@ -215,8 +393,18 @@ func HandleBatchOrders(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		atomic := false
+		if atomicStr := r.URL.Query().Get("atomic"); atomicStr != "" {
+			var err error
+			atomic, err = strconv.ParseBool(atomicStr)
+			if err != nil {
+				jsonErrorRespond(w, fmt.Errorf("atomic must be true or false: %s", atomicStr), http.StatusBadRequest)
+				return
+			}
+		}
+
 		// Service Call \\
-		response, err := serviceinstance.OrderService.CreateOrders(req.Orders)
+		response, err := serviceinstance.OrderService.CreateOrders(r.Context(), req.Orders, atomic)
 		if err != nil {
 			jsonErrorRespond(w, err, http.StatusBadRequest)
 			return
@@ -228,7 +416,11 @@ func HandleBatchOrders(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Response \\
-		w.WriteHeader(http.StatusCreated)
+		if response.Summary.RolledBack {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
 		w.Write(json)
 		return
 	} else {
@@ -0,0 +1,110 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+	"hot-coffee/internal/dto"
+	"hot-coffee/internal/service/serviceinstance"
+)
+
+// Route: /orders/<id>/payments
+func HandleOrderPayments(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := r.PathValue("id")
+	switch r.Method {
+	case http.MethodGet:
+		payments, err := serviceinstance.PaymentService.GetOrderPayments(r.Context(), id)
+		if err != nil {
+			jsonErrorRespond(w, err, paymentErrorStatus(err))
+			return
+		}
+		writeOrderPayments(w, payments, http.StatusOK)
+		return
+	case http.MethodPost:
+		var request dto.PaymentRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			jsonErrorRespond(w, fmt.Errorf("invalid JSON provided: %w", err), http.StatusBadRequest)
+			return
+		}
+
+		payments, err := serviceinstance.PaymentService.AddPayments(r.Context(), id, request)
+		if err != nil {
+			jsonErrorRespond(w, err, paymentErrorStatus(err))
+			return
+		}
+		writeOrderPayments(w, payments, http.StatusCreated)
+		return
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+// Route: /orders/<id>/payments/refunds
+func HandleOrderRefunds(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := r.PathValue("id")
+	switch r.Method {
+	case http.MethodPost:
+		var request dto.RefundRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			jsonErrorRespond(w, fmt.Errorf("invalid JSON provided: %w", err), http.StatusBadRequest)
+			return
+		}
+
+		payments, err := serviceinstance.PaymentService.RefundPayments(r.Context(), id, request)
+		if err != nil {
+			jsonErrorRespond(w, err, paymentErrorStatus(err))
+			return
+		}
+		writeOrderPayments(w, payments, http.StatusCreated)
+		return
+	default:
+		w.Header().Set("Allow", "POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+func writeOrderPayments(w http.ResponseWriter, payments entities.OrderPayments, statusCode int) {
+	jsonPayload, err := json.MarshalIndent(payments, "", "   ")
+	if err != nil {
+		jsonErrorRespond(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(statusCode)
+	w.Write(jsonPayload)
+}
+
+// Status code of the failed payment request, validation errors are answered with 400
+func paymentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, serviceinstance.ErrOrderNotExists),
+		errors.Is(err, serviceinstance.ErrMenuItemNotExists):
+		return http.StatusNotFound
+	case errors.Is(err, serviceinstance.ErrOrderNotPayable),
+		errors.Is(err, serviceinstance.ErrPaymentExceedsBalance),
+		errors.Is(err, serviceinstance.ErrRefundExceedsPaid),
+		errors.Is(err, serviceinstance.ErrNothingToRefund),
+		errors.Is(err, serviceinstance.ErrRestockOfNotClosedOrder),
+		errors.Is(err, serviceinstance.ErrRestockExceedsOrdered):
+		return http.StatusConflict
+	case errors.Is(err, serviceinstance.ErrNoTenders),
+		errors.Is(err, serviceinstance.ErrInvalidTender),
+		errors.Is(err, serviceinstance.ErrNonPositivePayment),
+		errors.Is(err, serviceinstance.ErrNonPositiveRestock),
+		errors.Is(err, serviceinstance.ErrEmptyID),
+		errors.Is(err, serviceinstance.ErrNonNumericID),
+		errors.Is(err, serviceinstance.ErrNegativeID),
+		errors.Is(err, serviceinstance.ErrZeroID):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,127 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+	"hot-coffee/internal/service/serviceinstance"
+)
+
+// Route: /promotions
+func HandlePromotions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		promotions, err := serviceinstance.PromotionService.GetPromotions(r.Context())
+		if err != nil {
+			if errors.Is(err, serviceinstance.ErrNoPromotions) {
+				jsonMessageRespond(w, "No promotions", http.StatusOK)
+				return
+			}
+			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		jsonPayload, err := json.MarshalIndent(promotions, "", "   ")
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.Write(jsonPayload)
+		return
+	case http.MethodPost:
+		var promotion entities.Promotion
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&promotion)
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusBadRequest)
+			return
+		}
+
+		id, err := serviceinstance.PromotionService.CreatePromotion(r.Context(), promotion)
+		if err != nil {
+			jsonErrorRespond(w, err, promotionErrorStatus(err))
+			return
+		}
+		jsonMessageRespond(w, fmt.Sprintf("Successfully created Promotion with ID: %d", id), http.StatusCreated)
+		return
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+// Route: /promotions/<id>
+func HandlePromotion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := r.PathValue("id")
+	switch r.Method {
+	case http.MethodGet:
+		promotion, err := serviceinstance.PromotionService.GetPromotion(r.Context(), id)
+		if err != nil {
+			jsonErrorRespond(w, err, promotionErrorStatus(err))
+			return
+		}
+
+		setETag(w, promotion.Version)
+		jsonPayload, err := json.MarshalIndent(promotion, "", "   ")
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.Write(jsonPayload)
+		return
+	case http.MethodPut:
+		var promotion entities.Promotion
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&promotion)
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusBadRequest)
+			return
+		}
+		promotion.Version, err = ifMatchVersion(r)
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusPreconditionFailed)
+			return
+		}
+
+		err = serviceinstance.PromotionService.UpdatePromotion(r.Context(), id, promotion)
+		if err != nil {
+			jsonErrorRespond(w, err, promotionErrorStatus(err))
+			return
+		}
+		jsonMessageRespond(w, "Promotion successfully updated", http.StatusOK)
+		return
+	case http.MethodDelete:
+		err := serviceinstance.PromotionService.DeletePromotion(r.Context(), id)
+		if err != nil {
+			jsonErrorRespond(w, err, promotionErrorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+// Status code of the failed promotion request, validation errors are answered with 400
+func promotionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, serviceinstance.ErrPromotionNotExists):
+		return http.StatusNotFound
+	case errors.Is(err, serviceinstance.ErrPromotionAlreadyExists),
+		errors.Is(err, serviceinstance.ErrUsageLimitBelowUsage):
+		return http.StatusConflict
+	case errors.Is(err, serviceinstance.ErrPromotionVersionMismatch):
+		return http.StatusPreconditionFailed
+	}
+	return http.StatusBadRequest
+}
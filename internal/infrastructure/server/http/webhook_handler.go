@@ -0,0 +1,212 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+	"hot-coffee/internal/service/serviceinstance"
+)
+
+// Route: /webhooks
+func HandleWebhooks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		webhooks, err := serviceinstance.WebhookService.GetWebhooks(r.Context())
+		if err != nil {
+			if errors.Is(err, serviceinstance.ErrNoWebhooks) {
+				jsonMessageRespond(w, "No webhooks", http.StatusOK)
+				return
+			}
+			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		jsonPayload, err := json.MarshalIndent(webhooks, "", "   ")
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.Write(jsonPayload)
+		return
+	case http.MethodPost:
+		var webhook entities.Webhook
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&webhook)
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusBadRequest)
+			return
+		}
+
+		id, err := serviceinstance.WebhookService.CreateWebhook(r.Context(), webhook)
+		if err != nil {
+			jsonErrorRespond(w, err, webhookErrorStatus(err))
+			return
+		}
+		jsonMessageRespond(w, fmt.Sprintf("Successfully created Webhook with ID: %d", id), http.StatusCreated)
+		return
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+// Route: /webhooks/<id>
+func HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := r.PathValue("id")
+	switch r.Method {
+	case http.MethodGet:
+		webhook, err := serviceinstance.WebhookService.GetWebhook(r.Context(), id)
+		if err != nil {
+			jsonErrorRespond(w, err, webhookErrorStatus(err))
+			return
+		}
+
+		setETag(w, webhook.Version)
+		jsonPayload, err := json.MarshalIndent(webhook, "", "   ")
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.Write(jsonPayload)
+		return
+	case http.MethodPut:
+		var webhook entities.Webhook
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&webhook)
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusBadRequest)
+			return
+		}
+		webhook.Version, err = ifMatchVersion(r)
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusPreconditionFailed)
+			return
+		}
+
+		err = serviceinstance.WebhookService.UpdateWebhook(r.Context(), id, webhook)
+		if err != nil {
+			jsonErrorRespond(w, err, webhookErrorStatus(err))
+			return
+		}
+		jsonMessageRespond(w, "Webhook successfully updated", http.StatusOK)
+		return
+	case http.MethodDelete:
+		err := serviceinstance.WebhookService.DeleteWebhook(r.Context(), id)
+		if err != nil {
+			jsonErrorRespond(w, err, webhookErrorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+// Route: /webhooks/<id>/deliveries
+func HandleWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		deliveries, err := serviceinstance.WebhookService.GetWebhookDeliveries(r.Context(), r.PathValue("id"), r.URL.Query().Get("status"))
+		if err != nil {
+			jsonErrorRespond(w, err, webhookErrorStatus(err))
+			return
+		}
+		writeWebhookDeliveries(w, deliveries)
+		return
+	default:
+		w.Header().Set("Allow", "GET")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+// Route: /webhooks/dead-letters
+func HandleWebhookDeadLetters(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		deliveries, err := serviceinstance.WebhookService.GetDeadLetters(r.Context())
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			return
+		}
+		writeWebhookDeliveries(w, deliveries)
+		return
+	default:
+		w.Header().Set("Allow", "GET")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+// Route: /webhooks/deliveries/<id>/retry
+func HandleWebhookDeliveryRetry(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodPost:
+		delivery, err := serviceinstance.WebhookService.RetryDelivery(r.Context(), r.PathValue("id"))
+		if err != nil {
+			jsonErrorRespond(w, err, webhookErrorStatus(err))
+			return
+		}
+
+		jsonPayload, err := json.MarshalIndent(delivery, "", "   ")
+		if err != nil {
+			jsonErrorRespond(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(jsonPayload)
+		return
+	default:
+		w.Header().Set("Allow", "POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+func writeWebhookDeliveries(w http.ResponseWriter, deliveries []entities.WebhookDelivery) {
+	jsonPayload, err := json.MarshalIndent(deliveries, "", "   ")
+	if err != nil {
+		jsonErrorRespond(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Write(jsonPayload)
+}
+
+// Status code of the failed webhook request, validation errors are answered with 400
+func webhookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, serviceinstance.ErrWebhookNotExists),
+		errors.Is(err, serviceinstance.ErrDeliveryNotExists):
+		return http.StatusNotFound
+	case errors.Is(err, serviceinstance.ErrWebhookAlreadyExists),
+		errors.Is(err, serviceinstance.ErrDeliveryNotDead):
+		return http.StatusConflict
+	case errors.Is(err, serviceinstance.ErrWebhookVersionMismatch):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, serviceinstance.ErrInvalidWebhookURL),
+		errors.Is(err, serviceinstance.ErrNoWebhookEventTypes),
+		errors.Is(err, serviceinstance.ErrUnknownWebhookEvent),
+		errors.Is(err, serviceinstance.ErrEmptyWebhookSecret),
+		errors.Is(err, serviceinstance.ErrWebhookIDCollision),
+		errors.Is(err, serviceinstance.ErrInvalidDeliveryStatus),
+		errors.Is(err, serviceinstance.ErrEmptyID),
+		errors.Is(err, serviceinstance.ErrNonNumericID),
+		errors.Is(err, serviceinstance.ErrNegativeID),
+		errors.Is(err, serviceinstance.ErrZeroID):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,29 @@
+//go:build !unix
+
+package jsonfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Creates the lock file exclusively, stale lock file left by crashed process must be removed by hand
+func lockDir(dir string) (*os.File, error) {
+	path := filepath.Join(dir, lockFileName)
+	lock, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0o644)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, fmt.Errorf("storage directory %s is used by another process, remove %s if it is not", dir, path)
+		}
+		return nil, fmt.Errorf("failed to create lock file: %w", err)
+	}
+
+	fmt.Fprintf(lock, "%d\n", os.Getpid())
+	return lock, nil
+}
+
+func unlockDir(lock *os.File) {
+	lock.Close()
+	os.Remove(lock.Name())
+}
@@ -0,0 +1,278 @@
+package jsonfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"hot-coffee/internal/infrastructure/storage/memory"
+	"hot-coffee/internal/repository"
+)
+
+const (
+	lockFileName     = ".lock"
+	manifestFileName = "manifest.json"
+)
+
+// Persists every table of in-memory storage as separate JSON file in the directory
+type fileStorage struct {
+	dir  string
+	lock *os.File
+	// Last content written per table, unchanged tables are not rewritten
+	written  map[string][]byte
+	manifest manifest
+}
+
+// Lists the files holding the tables. Changed tables are written to the files of the
+// next generation and replacing the manifest commits all of them at once
+type manifest struct {
+	Generation int64 `json:"generation"`
+	// File of the table, the tables missing here are read from the file named after the table
+	Files map[string]string `json:"files"`
+}
+
+func NewRepository(dir string) (*repository.Repository, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	lock, err := lockDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	storage := &fileStorage{
+		dir:      dir,
+		lock:     lock,
+		written:  make(map[string][]byte),
+		manifest: manifest{Files: make(map[string]string)},
+	}
+
+	data, err := storage.load()
+	if err != nil {
+		unlockDir(lock)
+		return nil, err
+	}
+
+	slog.Info("JSON file storage opened", "directory", dir)
+	return memory.NewRepositoryWithStorage(memory.NewStorage(data, storage.save)), nil
+}
+
+// Reads all table files listed by the manifest, missing files are treated as empty tables
+func (s *fileStorage) load() (*memory.Data, error) {
+	raw, err := os.ReadFile(filepath.Join(s.dir, manifestFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", manifestFileName, err)
+	} else if err == nil {
+		if err := json.Unmarshal(raw, &s.manifest); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", manifestFileName, err)
+		}
+	}
+	if s.manifest.Files == nil {
+		s.manifest.Files = make(map[string]string)
+	}
+
+	data := memory.NewData()
+	for name, table := range tables(data) {
+		file := s.file(name)
+		raw, err := os.ReadFile(filepath.Join(s.dir, file))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+
+		if err := json.Unmarshal(raw, table); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", file, err)
+		}
+		s.written[name] = raw
+	}
+
+	s.removeStale()
+	return data, nil
+}
+
+// Writes the tables changed by the write, all of them if changed is nil. Either all
+// changed tables are stored or none of them
+func (s *fileStorage) save(data *memory.Data, changed []interface{}) error {
+	next := manifest{Generation: s.manifest.Generation + 1, Files: maps.Clone(s.manifest.Files)}
+	contents := make(map[string][]byte)
+	for name, table := range tables(data) {
+		if changed != nil && !slices.Contains(changed, table) {
+			continue
+		}
+
+		raw, err := json.MarshalIndent(table, "", "   ")
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", name, err)
+		}
+
+		if bytes.Equal(raw, s.written[name]) {
+			continue
+		}
+		contents[name] = raw
+		next.Files[name] = generationFile(name, next.Generation)
+	}
+	if len(contents) == 0 {
+		return nil
+	}
+
+	// Files of the next generation are not read until the manifest lists them
+	if err := s.writeGeneration(next, contents); err != nil {
+		for name := range contents {
+			os.Remove(filepath.Join(s.dir, next.Files[name]))
+		}
+		return err
+	}
+
+	// Replaced manifest is the commit, the write cannot be rolled back after it
+	previous := s.manifest
+	s.manifest = next
+	for name, raw := range contents {
+		s.written[name] = raw
+	}
+	if err := syncDir(s.dir); err != nil {
+		slog.Error("Failed to sync storage directory, the last write may be lost on crash", "directory", s.dir, "error", err)
+	}
+
+	for name := range contents {
+		if file := previous.Files[name]; file != "" {
+			os.Remove(filepath.Join(s.dir, file))
+		} else {
+			os.Remove(filepath.Join(s.dir, name))
+		}
+	}
+	return nil
+}
+
+// Writes the table files of the generation and then the manifest listing them
+func (s *fileStorage) writeGeneration(next manifest, contents map[string][]byte) error {
+	for name, raw := range contents {
+		if err := writeFileSynced(filepath.Join(s.dir, next.Files[name]), raw); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	// Table files must be in the directory before the manifest refers to them
+	if err := syncDir(s.dir); err != nil {
+		return fmt.Errorf("failed to sync storage directory: %w", err)
+	}
+
+	raw, err := json.MarshalIndent(next, "", "   ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", manifestFileName, err)
+	}
+	if err := writeFileAtomic(filepath.Join(s.dir, manifestFileName), raw); err != nil {
+		return fmt.Errorf("failed to write %s: %w", manifestFileName, err)
+	}
+	return nil
+}
+
+// Returns the file the table is read from
+func (s *fileStorage) file(name string) string {
+	if file := s.manifest.Files[name]; file != "" {
+		return file
+	}
+	return name
+}
+
+// Removes the files left by the writes interrupted before the manifest was replaced
+// or before the files of the previous generation were removed
+func (s *fileStorage) removeStale() {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		file := entry.Name()
+		if strings.Contains(file, ".tmp-") {
+			os.Remove(filepath.Join(s.dir, file))
+			continue
+		}
+		// Other generations of the table and its file written before the manifest
+		for name := range tables(memory.NewData()) {
+			if file != s.file(name) && (file == name || isGenerationFile(file, name)) {
+				os.Remove(filepath.Join(s.dir, file))
+			}
+		}
+	}
+}
+
+// Name of the table file of the generation, orders.json is written as orders.3.json
+func generationFile(name string, generation int64) string {
+	return strings.TrimSuffix(name, ".json") + "." + strconv.FormatInt(generation, 10) + ".json"
+}
+
+func isGenerationFile(file, name string) bool {
+	generation, ok := strings.CutPrefix(file, strings.TrimSuffix(name, ".json")+".")
+	if !ok {
+		return false
+	}
+	generation, ok = strings.CutSuffix(generation, ".json")
+	_, err := strconv.ParseInt(generation, 10, 64)
+	return ok && err == nil
+}
+
+// Writes content to the new file and flushes it to disk
+func writeFileSynced(path string, content []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Writes content to temporary file and renames it over the target,
+// so readers never observe partially written file
+func writeFileAtomic(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Maps file names to the tables of data, the file is named by JSON tag of the table
+func tables(data *memory.Data) map[string]interface{} {
+	result := make(map[string]interface{})
+
+	value := reflect.ValueOf(data).Elem()
+	for idx := 0; idx < value.NumField(); idx++ {
+		tag := strings.Split(value.Type().Field(idx).Tag.Get("json"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		result[tag+".json"] = value.Field(idx).Addr().Interface()
+	}
+	return result
+}
@@ -0,0 +1,88 @@
+package jsonfile
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/infrastructure/storage/memory"
+	"hot-coffee/internal/repository"
+)
+
+func TestSaveGenerations(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// Table written before the manifest existed
+	legacy := `[{"ingredient_id": "1", "name": "Milk", "quantity": 10, "unit": "ml", "version": 1}]`
+	if err := os.WriteFile(filepath.Join(dir, "inventory.json"), []byte(legacy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	storage, repositories := openTestStorage(t, dir)
+	assertInventory(t, repositories, "Milk")
+	if err := repositories.Inventory.Create(ctx, entities.InventoryItem{Name: "Beans", Quantity: 5, Unit: "grams"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	file := storage.manifest.Files["inventory.json"]
+	if file == "" || file == "inventory.json" {
+		t.Fatalf("manifest lists %q for inventory, want generation file", file)
+	}
+	assertFiles(t, dir, map[string]bool{"inventory.json": false, file: true, manifestFileName: true})
+
+	// Files of the write interrupted before the manifest was replaced are not read
+	for name, content := range map[string]string{
+		"inventory.99.json":      `[]`,
+		"manifest.json.tmp-1234": `{}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, repositories = openTestStorage(t, dir)
+	assertInventory(t, repositories, "Milk", "Beans")
+	assertFiles(t, dir, map[string]bool{"inventory.99.json": false, "manifest.json.tmp-1234": false, file: true})
+}
+
+func openTestStorage(t *testing.T, dir string) (*fileStorage, *repository.Repository) {
+	t.Helper()
+	storage := &fileStorage{dir: dir, written: make(map[string][]byte), manifest: manifest{Files: make(map[string]string)}}
+	data, err := storage.load()
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	return storage, memory.NewRepositoryWithStorage(memory.NewStorage(data, storage.save))
+}
+
+func assertInventory(t *testing.T, repositories *repository.Repository, want ...string) {
+	t.Helper()
+	items, err := repositories.Inventory.GetAll(context.Background())
+	if err != nil {
+		t.Fatalf("GetAll() error = %v", err)
+	}
+	var got []string
+	for _, item := range items {
+		got = append(got, item.Name)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("inventory = %v, want %v", got, want)
+	}
+	for idx := range want {
+		if got[idx] != want[idx] {
+			t.Fatalf("inventory = %v, want %v", got, want)
+		}
+	}
+}
+
+// Checks which of the files are in the directory
+func assertFiles(t *testing.T, dir string, want map[string]bool) {
+	t.Helper()
+	for name, exists := range want {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if exists != (err == nil) {
+			t.Errorf("file %s exists = %v, want %v", name, err == nil, exists)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package jsonfile
+
+// Directories cannot be opened for syncing, the renames are flushed by the file system
+func syncDir(dir string) error {
+	return nil
+}
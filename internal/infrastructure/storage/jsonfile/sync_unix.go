@@ -0,0 +1,15 @@
+//go:build unix
+
+package jsonfile
+
+import "os"
+
+// Flushes the directory entries, so created and renamed files survive a crash
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
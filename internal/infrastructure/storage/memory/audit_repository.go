@@ -0,0 +1,71 @@
+package memory
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"hot-coffee/internal/core/entities"
+)
+
+type auditRepository struct {
+	storage *Storage
+}
+
+func NewAuditRepository(storage *Storage) *auditRepository {
+	return &auditRepository{storage}
+}
+
+func (r *auditRepository) Create(ctx context.Context, entry entities.AuditEntry) (auditID int64, err error) {
+	err = r.storage.write(ctx, func(d *Data) error {
+		auditID = d.nextID("audit_log")
+		change(d, &d.AuditLog)
+		d.AuditLog = append(d.AuditLog, AuditEntry{
+			ID:        auditID,
+			Action:    entry.Action,
+			Entity:    entry.Entity,
+			EntityID:  entry.EntityID,
+			Actor:     entry.Actor,
+			Reason:    entry.Reason,
+			CreatedAt: time.Now(),
+		})
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return auditID, nil
+}
+
+func (r *auditRepository) GetAll(ctx context.Context, filter entities.AuditFilter) (entries []entities.AuditEntry, err error) {
+	entries = []entities.AuditEntry{}
+	err = r.storage.read(ctx, func(d *Data) error {
+		for i := len(d.AuditLog) - 1; i >= 0; i-- {
+			entry := d.AuditLog[i]
+			if filter.Action != "" && entry.Action != filter.Action {
+				continue
+			}
+			if filter.Entity != "" && entry.Entity != filter.Entity {
+				continue
+			}
+			if filter.EntityID != "" && entry.EntityID != filter.EntityID {
+				continue
+			}
+			entries = append(entries, entry.toEntity())
+		}
+		return nil
+	})
+	return entries, err
+}
+
+func (e AuditEntry) toEntity() entities.AuditEntry {
+	return entities.AuditEntry{
+		ID:        strconv.FormatInt(e.ID, 10),
+		Action:    e.Action,
+		Entity:    e.Entity,
+		EntityID:  e.EntityID,
+		Actor:     e.Actor,
+		Reason:    e.Reason,
+		CreatedAt: e.CreatedAt,
+	}
+}
@@ -0,0 +1,187 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+)
+
+type customerRepository struct {
+	storage *Storage
+}
+
+func NewCustomerRepository(storage *Storage) *customerRepository {
+	return &customerRepository{storage}
+}
+
+func (r *customerRepository) Create(ctx context.Context, customer entities.Customer) (customerID int64, err error) {
+	err = r.storage.write(ctx, func(d *Data) error {
+		if customer.Phone != "" && d.customerPhoneIndex(customer.Phone) != -1 {
+			return errors.ErrUniqueViolation
+		}
+
+		customerID = d.nextID("customers")
+		change(d, &d.Customers)
+		d.Customers = append(d.Customers, Customer{
+			ID:        customerID,
+			Fullname:  customer.Fullname,
+			Phone:     customer.Phone,
+			CreatedAt: time.Now(),
+			Version:   1,
+		})
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return customerID, nil
+}
+
+func (r *customerRepository) GetAll(ctx context.Context, filter entities.CustomerFilter) (customers []entities.Customer, err error) {
+	customers = []entities.Customer{}
+	err = r.storage.read(ctx, func(d *Data) error {
+		for _, customer := range d.Customers {
+			if filter.Name != "" && !strings.Contains(strings.ToLower(customer.Fullname), strings.ToLower(filter.Name)) {
+				continue
+			}
+			if filter.Phone != "" && !strings.Contains(customer.Phone, filter.Phone) {
+				continue
+			}
+			customers = append(customers, customer.toEntity())
+		}
+		return nil
+	})
+	return customers, err
+}
+
+func (r *customerRepository) GetById(ctx context.Context, idStr string) (customer entities.Customer, err error) {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return customer, ErrNonNumericID
+	}
+
+	err = r.storage.read(ctx, func(d *Data) error {
+		idx := d.customerIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		}
+		customer = d.Customers[idx].toEntity()
+		return nil
+	})
+	return customer, err
+}
+
+func (r *customerRepository) Update(ctx context.Context, idStr string, customer entities.Customer) error {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.customerIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		} else if customer.Version != 0 && customer.Version != d.Customers[idx].Version {
+			return errors.ErrVersionMismatch
+		} else if d.Customers[idx].AnonymizedAt != nil {
+			// Mimics the update skipping anonymized rows
+			return errors.ErrVersionMismatch
+		}
+		if customer.Phone != "" {
+			if phoneIdx := d.customerPhoneIndex(customer.Phone); phoneIdx != -1 && phoneIdx != idx {
+				return errors.ErrUniqueViolation
+			}
+		}
+
+		change(d, &d.Customers)
+		d.Customers[idx].Fullname = customer.Fullname
+		d.Customers[idx].Phone = customer.Phone
+		d.Customers[idx].Version++
+		return nil
+	})
+}
+
+func (r *customerRepository) Anonymize(ctx context.Context, idStr string, fullname string) error {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.customerIndex(id)
+		if idx == -1 || d.Customers[idx].AnonymizedAt != nil {
+			return sql.ErrNoRows
+		}
+
+		now := time.Now()
+		change(d, &d.Customers)
+		d.Customers[idx].Fullname = fullname
+		d.Customers[idx].Phone = ""
+		d.Customers[idx].AnonymizedAt = &now
+		d.Customers[idx].Version++
+		return nil
+	})
+}
+
+func (r *customerRepository) Delete(ctx context.Context, idStr string) error {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.customerIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		}
+		// Mimics ON DELETE RESTRICT of the orders and the loyalty ledger
+		for _, order := range d.Orders {
+			if order.CustomerID == id {
+				return errors.ErrReferenced
+			}
+		}
+		for _, entry := range d.LoyaltyLedger {
+			if entry.CustomerID == id {
+				return errors.ErrReferenced
+			}
+		}
+		change(d, &d.Customers)
+		d.Customers = append(d.Customers[:idx], d.Customers[idx+1:]...)
+		return nil
+	})
+}
+
+func (c Customer) toEntity() entities.Customer {
+	createdAt := c.CreatedAt
+	return entities.Customer{
+		ID:           strconv.FormatInt(c.ID, 10),
+		Fullname:     c.Fullname,
+		Phone:        c.Phone,
+		CreatedAt:    &createdAt,
+		AnonymizedAt: c.AnonymizedAt,
+		Version:      c.Version,
+	}
+}
+
+func (d *Data) customerPhoneIndex(phone string) int {
+	for idx, customer := range d.Customers {
+		if customer.Phone == phone {
+			return idx
+		}
+	}
+	return -1
+}
+
+// Customers of the older storage files were created without versions
+func (d *Data) backfillCustomers() {
+	for idx := range d.Customers {
+		if d.Customers[idx].Version == 0 {
+			d.Customers[idx].Version = 1
+		}
+	}
+}
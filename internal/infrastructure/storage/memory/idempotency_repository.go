@@ -0,0 +1,108 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"time"
+
+	"hot-coffee/internal/core/entities"
+)
+
+type idempotencyRepository struct {
+	storage *Storage
+}
+
+func NewIdempotencyRepository(storage *Storage) *idempotencyRepository {
+	return &idempotencyRepository{storage}
+}
+
+func (r *idempotencyRepository) Reserve(ctx context.Context, record entities.IdempotencyRecord, now time.Time) (existing entities.IdempotencyRecord, reserved bool, err error) {
+	err = r.storage.write(ctx, func(d *Data) error {
+		change(d, &d.IdempotencyKeys)
+		live := d.IdempotencyKeys[:0]
+		for _, stored := range d.IdempotencyKeys {
+			if stored.ExpiresAt.After(now) {
+				live = append(live, stored)
+			}
+		}
+		d.IdempotencyKeys = live
+
+		record.StatusCode = 0
+		record.Body = nil
+		record.CreatedAt = now
+		if idx := d.idempotencyKeyIndex(record.Key); idx != -1 {
+			existing = d.IdempotencyKeys[idx]
+			// The same request not completed within the lease was lost, the retry takes its key over
+			if existing.StatusCode != 0 || existing.RequestHash != record.RequestHash || existing.LockedUntil.After(now) {
+				return nil
+			}
+			d.IdempotencyKeys[idx] = record
+			reserved = true
+			return nil
+		}
+		d.IdempotencyKeys = append(d.IdempotencyKeys, record)
+		reserved = true
+		return nil
+	})
+	return existing, reserved, err
+}
+
+func (r *idempotencyRepository) Complete(ctx context.Context, key string, lockedUntil time.Time, statusCode int, contentType string, body []byte) error {
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.idempotencyKeyIndex(key)
+		if idx == -1 || !d.IdempotencyKeys[idx].LockedUntil.Equal(lockedUntil) {
+			return sql.ErrNoRows
+		}
+		change(d, &d.IdempotencyKeys)
+		d.IdempotencyKeys[idx].LockedUntil = time.Time{}
+		d.IdempotencyKeys[idx].StatusCode = statusCode
+		d.IdempotencyKeys[idx].ContentType = contentType
+		d.IdempotencyKeys[idx].Body = append([]byte(nil), body...)
+		return nil
+	})
+}
+
+func (r *idempotencyRepository) Delete(ctx context.Context, key string, lockedUntil time.Time) error {
+	return r.storage.write(ctx, func(d *Data) error {
+		if idx := d.idempotencyKeyIndex(key); idx != -1 && d.IdempotencyKeys[idx].LockedUntil.Equal(lockedUntil) {
+			change(d, &d.IdempotencyKeys)
+			d.IdempotencyKeys = append(d.IdempotencyKeys[:idx], d.IdempotencyKeys[idx+1:]...)
+		}
+		return nil
+	})
+}
+
+func (r *idempotencyRepository) SearchBodies(ctx context.Context, text []byte) (records []entities.IdempotencyRecord, err error) {
+	err = r.storage.read(ctx, func(d *Data) error {
+		for _, record := range d.IdempotencyKeys {
+			if record.StatusCode != 0 && bytes.Contains(record.Body, text) {
+				record.Body = append([]byte(nil), record.Body...)
+				records = append(records, record)
+			}
+		}
+		return nil
+	})
+	return records, err
+}
+
+func (r *idempotencyRepository) UpdateBody(ctx context.Context, key string, body []byte) error {
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.idempotencyKeyIndex(key)
+		if idx == -1 || d.IdempotencyKeys[idx].StatusCode == 0 {
+			return sql.ErrNoRows
+		}
+		change(d, &d.IdempotencyKeys)
+		d.IdempotencyKeys[idx].Body = append([]byte(nil), body...)
+		return nil
+	})
+}
+
+func (d *Data) idempotencyKeyIndex(key string) int {
+	for idx, record := range d.IdempotencyKeys {
+		if record.Key == key {
+			return idx
+		}
+	}
+	return -1
+}
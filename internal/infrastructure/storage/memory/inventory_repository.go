@@ -0,0 +1,381 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+)
+
+// Errors
+var (
+	ErrNonNumericID = errors.New("non-numeric ID provided")
+	// Mimics the restricting foreign key of the inventory reservations
+	ErrOrderHasReservations = errors.New("order still has inventory reservations")
+)
+
+type inventoryRepository struct {
+	storage *Storage
+}
+
+func NewInventoryRepository(storage *Storage) *inventoryRepository {
+	return &inventoryRepository{storage}
+}
+
+func (r *inventoryRepository) Create(ctx context.Context, item entities.InventoryItem) error {
+	return r.storage.write(ctx, func(d *Data) error {
+		if item.IngredientID != "" {
+			id, err := strconv.ParseInt(item.IngredientID, 10, 64)
+			if err != nil {
+				return ErrNonNumericID
+			}
+			if d.inventoryIndex(id) != -1 {
+				return errors.ErrIDAlreadyExists
+			}
+			d.seenID("inventory", id)
+		} else {
+			item.IngredientID = strconv.FormatInt(d.nextID("inventory"), 10)
+		}
+
+		item.Version = 1
+		item.Reserved = 0
+		item.DeletedAt = ""
+		change(d, &d.Inventory)
+		d.Inventory = append(d.Inventory, item)
+		return nil
+	})
+}
+
+func (r *inventoryRepository) GetAll(ctx context.Context) (items []entities.InventoryItem, err error) {
+	err = r.storage.read(ctx, func(d *Data) error {
+		for _, item := range d.Inventory {
+			if item.DeletedAt == "" {
+				items = append(items, item)
+			}
+		}
+		if len(items) == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (r *inventoryRepository) GetById(ctx context.Context, idStr string) (item entities.InventoryItem, err error) {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return item, ErrNonNumericID
+	}
+
+	err = r.storage.read(ctx, func(d *Data) error {
+		idx := d.inventoryIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		}
+		item = d.Inventory[idx]
+		return nil
+	})
+	return item, err
+}
+
+func (r *inventoryRepository) Update(ctx context.Context, idStr string, item entities.InventoryItem) error {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.inventoryIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		}
+		if item.Version != 0 && item.Version != d.Inventory[idx].Version {
+			return errors.ErrVersionMismatch
+		} else if item.Quantity < d.Inventory[idx].Reserved {
+			return errors.NewErrInsufficientIngredient(idStr)
+		}
+		item.IngredientID = d.Inventory[idx].IngredientID
+		item.Reserved = d.Inventory[idx].Reserved
+		item.Version = d.Inventory[idx].Version + 1
+		item.DeletedAt = d.Inventory[idx].DeletedAt
+		change(d, &d.Inventory)
+		d.Inventory[idx] = item
+		return nil
+	})
+}
+
+// Archives the inventory item, the transactions keep referencing it
+func (r *inventoryRepository) Delete(ctx context.Context, idStr string) error {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.inventoryIndex(id)
+		if idx == -1 || d.Inventory[idx].DeletedAt != "" {
+			return sql.ErrNoRows
+		}
+		change(d, &d.Inventory)
+		d.Inventory[idx].DeletedAt = time.Now().Format(time.RFC3339Nano)
+		d.Inventory[idx].Version++
+		return nil
+	})
+}
+
+// Brings back the archived inventory item
+func (r *inventoryRepository) Restore(ctx context.Context, idStr string) error {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.inventoryIndex(id)
+		if idx == -1 || d.Inventory[idx].DeletedAt == "" {
+			return sql.ErrNoRows
+		}
+		change(d, &d.Inventory)
+		d.Inventory[idx].DeletedAt = ""
+		d.Inventory[idx].Version++
+		return nil
+	})
+}
+
+func (r *inventoryRepository) GetPage(ctx context.Context, sortBy string, offset, rowCount int) (entities.PaginatedInventoryItems, error) {
+	page := entities.PaginatedInventoryItems{
+		Items: []entities.PageInventoryItem{},
+	}
+
+	err := r.storage.read(ctx, func(d *Data) error {
+		items := []entities.InventoryItem{}
+		for _, item := range d.Inventory {
+			if item.DeletedAt == "" {
+				items = append(items, item)
+			}
+		}
+		sort.SliceStable(items, func(i, j int) bool {
+			switch sortBy {
+			case "price":
+				return items[i].Price < items[j].Price
+			case "quantity":
+				return items[i].Quantity < items[j].Quantity
+			default:
+				return atoi64(items[i].IngredientID) < atoi64(items[j].IngredientID)
+			}
+		})
+
+		page.TotalPages = int(math.Ceil(float64(len(items)) / float64(rowCount)))
+		page.CurrentPage = offset/rowCount + 1
+		page.PageSize = rowCount
+		page.HasNextPage = page.CurrentPage < page.TotalPages
+
+		for idx := offset; idx < len(items) && idx < offset+rowCount; idx++ {
+			page.Items = append(page.Items, entities.PageInventoryItem{
+				Name:     items[idx].Name,
+				Price:    items[idx].Price,
+				Quantity: items[idx].Quantity,
+			})
+		}
+		return nil
+	})
+	return page, err
+}
+
+func (r *inventoryRepository) AdjustQuantity(ctx context.Context, idStr string, difference float64) error {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.inventoryIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		}
+		if d.Inventory[idx].Quantity+difference < d.Inventory[idx].Reserved {
+			return errors.NewErrInsufficientIngredient(idStr)
+		}
+		change(d, &d.Inventory)
+		d.Inventory[idx].Quantity += difference
+		return nil
+	})
+}
+
+func (r *inventoryRepository) SaveTransaction(ctx context.Context, idStr string, orderID int64, line string, quantity float64) error {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	return r.storage.write(ctx, func(d *Data) error {
+		if d.inventoryIndex(id) == -1 {
+			return sql.ErrNoRows
+		}
+		change(d, &d.InventoryTransactions)
+		d.InventoryTransactions = append(d.InventoryTransactions, InventoryTransaction{
+			InventoryItemID: id,
+			OrderID:         orderID,
+			Line:            line,
+			Quantity:        quantity,
+			ChangedAt:       time.Now(),
+		})
+		return nil
+	})
+}
+
+func (r *inventoryRepository) GetTransactions(ctx context.Context, orderID int64) (transactions []entities.IngredientUsage, err error) {
+	err = r.storage.read(ctx, func(d *Data) error {
+		sums := make(map[[2]string]int)
+		for _, transaction := range d.InventoryTransactions {
+			if transaction.OrderID != orderID {
+				continue
+			}
+			key := [2]string{strconv.FormatInt(transaction.InventoryItemID, 10), transaction.Line}
+			if idx, ok := sums[key]; ok {
+				transactions[idx].Quantity += transaction.Quantity
+				continue
+			}
+			sums[key] = len(transactions)
+			transactions = append(transactions, entities.IngredientUsage{
+				IngredientID: key[0],
+				Line:         key[1],
+				Quantity:     transaction.Quantity,
+			})
+		}
+		return nil
+	})
+	return transactions, err
+}
+
+func (r *inventoryRepository) AdjustReserved(ctx context.Context, idStr string, difference float64) error {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.inventoryIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		}
+		reserved := d.Inventory[idx].Reserved + difference
+		if reserved < 0 || reserved > d.Inventory[idx].Quantity {
+			return errors.NewErrInsufficientIngredient(idStr)
+		}
+		change(d, &d.Inventory)
+		d.Inventory[idx].Reserved = reserved
+		return nil
+	})
+}
+
+func (r *inventoryRepository) SaveReservation(ctx context.Context, idStr string, orderID int64, line string, quantity float64) error {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	return r.storage.write(ctx, func(d *Data) error {
+		if d.inventoryIndex(id) == -1 || d.orderIndex(orderID) == -1 {
+			return sql.ErrNoRows
+		}
+		change(d, &d.InventoryReservations)
+		for idx := range d.InventoryReservations {
+			reservation := &d.InventoryReservations[idx]
+			if reservation.OrderID == orderID && reservation.InventoryItemID == id && reservation.Line == line {
+				reservation.Quantity += quantity
+				return nil
+			}
+		}
+		d.InventoryReservations = append(d.InventoryReservations, InventoryReservation{
+			OrderID:         orderID,
+			InventoryItemID: id,
+			Line:            line,
+			Quantity:        quantity,
+		})
+		return nil
+	})
+}
+
+func (r *inventoryRepository) GetReservations(ctx context.Context, orderID int64) (reservations []entities.IngredientUsage, err error) {
+	err = r.storage.read(ctx, func(d *Data) error {
+		for _, reservation := range d.InventoryReservations {
+			if reservation.OrderID == orderID {
+				reservations = append(reservations, entities.IngredientUsage{
+					IngredientID: strconv.FormatInt(reservation.InventoryItemID, 10),
+					Line:         reservation.Line,
+					Quantity:     reservation.Quantity,
+				})
+			}
+		}
+		return nil
+	})
+	return reservations, err
+}
+
+func (r *inventoryRepository) DeleteReservations(ctx context.Context, orderID int64) error {
+	return r.storage.write(ctx, func(d *Data) error {
+		change(d, &d.InventoryReservations)
+		reservations := d.InventoryReservations[:0]
+		for _, reservation := range d.InventoryReservations {
+			if reservation.OrderID != orderID {
+				reservations = append(reservations, reservation)
+			}
+		}
+		d.InventoryReservations = reservations
+		return nil
+	})
+}
+
+// Not finished orders written before the reservations deducted their ingredients,
+// the deductions become reservations
+func (d *Data) backfillReservations() {
+	deducted := make(map[[2]int64]float64)
+	transactions := d.InventoryTransactions[:0]
+	for _, transaction := range d.InventoryTransactions {
+		idx := d.orderIndex(transaction.OrderID)
+		if idx != -1 && !isFinishedStatus(d.Orders[idx].Status) {
+			deducted[[2]int64{transaction.OrderID, transaction.InventoryItemID}] -= transaction.Quantity
+			continue
+		}
+		transactions = append(transactions, transaction)
+	}
+	d.InventoryTransactions = transactions
+
+	for key, quantity := range deducted {
+		idx := d.inventoryIndex(key[1])
+		if quantity <= 0 || idx == -1 {
+			continue
+		}
+		d.Inventory[idx].Quantity += quantity
+		d.Inventory[idx].Reserved += quantity
+		d.InventoryReservations = append(d.InventoryReservations, InventoryReservation{
+			OrderID:         key[0],
+			InventoryItemID: key[1],
+			Quantity:        quantity,
+		})
+	}
+}
+
+func isFinishedStatus(status string) bool {
+	return status == entities.ClosedStatus || status == entities.RejectedStatus
+}
+
+func (d *Data) inventoryIndex(id int64) int {
+	for idx, item := range d.Inventory {
+		if atoi64(item.IngredientID) == id {
+			return idx
+		}
+	}
+	return -1
+}
+
+func atoi64(str string) int64 {
+	num, _ := strconv.ParseInt(str, 10, 64)
+	return num
+}
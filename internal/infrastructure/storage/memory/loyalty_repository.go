@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"hot-coffee/internal/core/entities"
+)
+
+type loyaltyRepository struct {
+	storage *Storage
+}
+
+func NewLoyaltyRepository(storage *Storage) *loyaltyRepository {
+	return &loyaltyRepository{storage}
+}
+
+// The write lock of the transaction already keeps the other changes out
+func (r *loyaltyRepository) LockCustomer(ctx context.Context, customerID int64) error {
+	return r.storage.read(ctx, func(d *Data) error {
+		if d.customerIndex(customerID) == -1 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
+
+func (r *loyaltyRepository) Create(ctx context.Context, entry entities.LoyaltyEntry) (entryID int64, err error) {
+	err = r.storage.write(ctx, func(d *Data) error {
+		if d.customerIndex(entry.CustomerID) == -1 {
+			return sql.ErrNoRows
+		}
+
+		entryID = d.nextID("loyalty_ledger")
+		change(d, &d.LoyaltyLedger)
+		d.LoyaltyLedger = append(d.LoyaltyLedger, LoyaltyEntry{
+			ID:         entryID,
+			CustomerID: entry.CustomerID,
+			OrderID:    entry.OrderID,
+			Kind:       entry.Kind,
+			Points:     entry.Points,
+			ExpiresAt:  entry.ExpiresAt,
+			CreatedAt:  time.Now(),
+		})
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return entryID, nil
+}
+
+func (r *loyaltyRepository) GetByCustomerID(ctx context.Context, customerID int64) (entries []entities.LoyaltyEntry, err error) {
+	entries = []entities.LoyaltyEntry{}
+	err = r.storage.read(ctx, func(d *Data) error {
+		for _, entry := range d.LoyaltyLedger {
+			if entry.CustomerID == customerID {
+				entries = append(entries, entry.toEntity())
+			}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+func (e LoyaltyEntry) toEntity() entities.LoyaltyEntry {
+	return entities.LoyaltyEntry{
+		ID:         strconv.FormatInt(e.ID, 10),
+		CustomerID: e.CustomerID,
+		OrderID:    e.OrderID,
+		Kind:       e.Kind,
+		Points:     e.Points,
+		ExpiresAt:  e.ExpiresAt,
+		CreatedAt:  e.CreatedAt,
+	}
+}
@@ -0,0 +1,274 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+)
+
+type menuRepository struct {
+	storage *Storage
+}
+
+func NewMenuRepository(storage *Storage) *menuRepository {
+	return &menuRepository{storage}
+}
+
+func (r *menuRepository) Create(ctx context.Context, item entities.MenuItem) (menuItemID int, err error) {
+	err = r.storage.write(ctx, func(d *Data) error {
+		if item.ID != "" {
+			id, err := strconv.ParseInt(item.ID, 10, 64)
+			if err != nil {
+				return ErrNonNumericID
+			}
+			if d.menuItemIndex(id) != -1 {
+				return errors.ErrIDAlreadyExists
+			}
+			d.seenID("menu_items", id)
+		} else {
+			item.ID = strconv.FormatInt(d.nextID("menu_items"), 10)
+		}
+
+		item.Ingredients = append([]entities.MenuItemIngredient{}, item.Ingredients...)
+		item.Modifiers, err = d.saveModifiers(nil, item.Modifiers)
+		if err != nil {
+			return err
+		}
+		item.Version = 1
+		item.DeletedAt = ""
+		change(d, &d.MenuItems)
+		d.MenuItems = append(d.MenuItems, copyMenuItem(item))
+		menuItemID = int(atoi64(item.ID))
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return menuItemID, nil
+}
+
+func (r *menuRepository) GetAll(ctx context.Context) (items []entities.MenuItem, err error) {
+	err = r.storage.read(ctx, func(d *Data) error {
+		for _, item := range d.MenuItems {
+			if item.DeletedAt == "" {
+				item = copyMenuItem(item)
+				modifiers := item.Modifiers[:0]
+				for _, modifier := range item.Modifiers {
+					if modifier.DeletedAt == "" {
+						modifiers = append(modifiers, modifier)
+					}
+				}
+				item.Modifiers = modifiers
+				items = append(items, item)
+			}
+		}
+		if len(items) == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (r *menuRepository) GetById(ctx context.Context, idStr string) (item entities.MenuItem, err error) {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return item, ErrNonNumericID
+	}
+
+	err = r.storage.read(ctx, func(d *Data) error {
+		idx := d.menuItemIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		}
+		item = copyMenuItem(d.MenuItems[idx])
+		return nil
+	})
+	return item, err
+}
+
+func (r *menuRepository) Update(ctx context.Context, idStr string, item entities.MenuItem) error {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.menuItemIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		}
+		if item.Version != 0 && item.Version != d.MenuItems[idx].Version {
+			return errors.ErrVersionMismatch
+		}
+		item.Modifiers, err = d.saveModifiers(d.MenuItems[idx].Modifiers, item.Modifiers)
+		if err != nil {
+			return err
+		}
+		item.ID = d.MenuItems[idx].ID
+		item.Version = d.MenuItems[idx].Version + 1
+		item.DeletedAt = d.MenuItems[idx].DeletedAt
+		change(d, &d.MenuItems)
+		d.MenuItems[idx] = copyMenuItem(item)
+		return nil
+	})
+}
+
+// Archives the menu item, the orders keep referencing it
+func (r *menuRepository) Delete(ctx context.Context, idStr string) error {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.menuItemIndex(id)
+		if idx == -1 || d.MenuItems[idx].DeletedAt != "" {
+			return sql.ErrNoRows
+		}
+		change(d, &d.MenuItems)
+		d.MenuItems[idx].DeletedAt = time.Now().Format(time.RFC3339Nano)
+		d.MenuItems[idx].Version++
+		return nil
+	})
+}
+
+// Brings back the archived menu item
+func (r *menuRepository) Restore(ctx context.Context, idStr string) error {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.menuItemIndex(id)
+		if idx == -1 || d.MenuItems[idx].DeletedAt == "" {
+			return sql.ErrNoRows
+		}
+		change(d, &d.MenuItems)
+		d.MenuItems[idx].DeletedAt = ""
+		d.MenuItems[idx].Version++
+		return nil
+	})
+}
+
+func (r *menuRepository) AddPriceDifference(ctx context.Context, id int, priceDifference float64) error {
+	return r.storage.write(ctx, func(d *Data) error {
+		if d.menuItemIndex(int64(id)) == -1 {
+			return sql.ErrNoRows
+		}
+		change(d, &d.PriceHistory)
+		d.PriceHistory = append(d.PriceHistory, PriceHistory{
+			MenuItemID:      int64(id),
+			PriceDifference: priceDifference,
+			ChangedAt:       time.Now(),
+		})
+		return nil
+	})
+}
+
+func (r *menuRepository) GetMenusFullTextSearchReport(ctx context.Context, q string, minPrice, maxPrice int) ([]entities.MenuReport, error) {
+	menus := []entities.MenuReport{}
+	err := r.storage.read(ctx, func(d *Data) error {
+		for _, item := range d.MenuItems {
+			relevance := substringRelevance(q, item.Name+" "+item.Description)
+			if relevance == 0 {
+				continue
+			}
+
+			if (minPrice == 0 || item.Price >= float64(minPrice)) && (maxPrice == 0 || item.Price <= float64(maxPrice)) {
+				menus = append(menus, entities.MenuReport{
+					ID:          item.ID,
+					Name:        item.Name,
+					Description: item.Description,
+					Price:       item.Price,
+					Relevance:   relevance,
+				})
+			}
+		}
+		return nil
+	})
+
+	sort.SliceStable(menus, func(i, j int) bool {
+		return menus[i].Relevance > menus[j].Relevance
+	})
+	return menus, err
+}
+
+func (d *Data) menuItemIndex(id int64) int {
+	for idx, item := range d.MenuItems {
+		if atoi64(item.ID) == id {
+			return idx
+		}
+	}
+	return -1
+}
+
+func copyMenuItem(item entities.MenuItem) entities.MenuItem {
+	item.Ingredients = append([]entities.MenuItemIngredient{}, item.Ingredients...)
+	modifiers := make([]entities.MenuItemModifier, 0, len(item.Modifiers))
+	for _, modifier := range item.Modifiers {
+		modifier.Ingredients = append([]entities.MenuItemIngredient(nil), modifier.Ingredients...)
+		modifiers = append(modifiers, modifier)
+	}
+	item.Modifiers = modifiers
+	return item
+}
+
+// Merges the provided modifiers into the stored ones: the ones with id are updated,
+// the others get new ids, stored modifiers missing in the list are archived
+func (d *Data) saveModifiers(stored, provided []entities.MenuItemModifier) ([]entities.MenuItemModifier, error) {
+	kept := make(map[string]bool)
+	modifiers := make([]entities.MenuItemModifier, 0, len(stored)+len(provided))
+	for _, modifier := range provided {
+		if modifier.ID != "" {
+			found := false
+			for _, storedModifier := range stored {
+				found = found || storedModifier.ID == modifier.ID
+			}
+			if !found {
+				return nil, sql.ErrNoRows
+			}
+		} else {
+			modifier.ID = strconv.FormatInt(d.nextID("menu_item_modifiers"), 10)
+		}
+		modifier.DeletedAt = ""
+		kept[modifier.ID] = true
+		modifiers = append(modifiers, modifier)
+	}
+
+	for _, modifier := range stored {
+		if kept[modifier.ID] {
+			continue
+		}
+		if modifier.DeletedAt == "" {
+			modifier.DeletedAt = time.Now().Format(time.RFC3339)
+		}
+		modifiers = append(modifiers, modifier)
+	}
+	return modifiers, nil
+}
+
+// Share of the query words found in the text, rounded to two digits
+func substringRelevance(q, text string) float64 {
+	words := strings.Fields(strings.ToLower(q))
+	if len(words) == 0 {
+		return 0
+	}
+
+	text = strings.ToLower(text)
+	matched := 0
+	for _, word := range words {
+		if strings.Contains(text, word) {
+			matched++
+		}
+	}
+	return math.Round(float64(matched)/float64(len(words))*100) / 100
+}
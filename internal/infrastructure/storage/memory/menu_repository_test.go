@@ -0,0 +1,58 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"hot-coffee/internal/core/entities"
+)
+
+func TestGetMenusFullTextSearchReport(t *testing.T) {
+	ctx := context.Background()
+	r := NewMenuRepository(NewStorage(nil, nil))
+	for _, item := range []entities.MenuItem{
+		{Name: "Caffe Latte", Description: "Espresso with steamed milk", Price: 4},
+		{Name: "Flat White", Description: "Espresso with microfoam milk", Price: 5},
+		{Name: "Blueberry Muffin", Description: "Baked fresh every morning", Price: 3},
+	} {
+		if _, err := r.Create(ctx, item); err != nil {
+			t.Fatalf("Create(%q) error = %v", item.Name, err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		q        string
+		minPrice int
+		maxPrice int
+		// Names of the found items, most relevant first
+		want []string
+	}{
+		{name: "case insensitive substring", q: "LATT", want: []string{"Caffe Latte"}},
+		{name: "description searched", q: "milk", want: []string{"Caffe Latte", "Flat White"}},
+		{name: "items matching more words first", q: "microfoam milk", want: []string{"Flat White", "Caffe Latte"}},
+		{name: "price range", q: "milk", minPrice: 5, want: []string{"Flat White"}},
+		{name: "nothing matched", q: "cocoa"},
+		{name: "empty query", q: " "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			menus, err := r.GetMenusFullTextSearchReport(ctx, tt.q, tt.minPrice, tt.maxPrice)
+			if err != nil {
+				t.Fatalf("GetMenusFullTextSearchReport() error = %v", err)
+			}
+			var got []string
+			for _, menu := range menus {
+				got = append(got, menu.Name)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("found = %v, want %v", got, tt.want)
+			}
+			for idx := range tt.want {
+				if got[idx] != tt.want[idx] {
+					t.Fatalf("found = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
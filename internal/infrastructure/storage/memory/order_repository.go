@@ -0,0 +1,776 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+	"hot-coffee/internal/utils"
+	"hot-coffee/internal/vo"
+)
+
+// Errors
+var (
+	ErrPeriodTypeInvalid = errors.New("incorrect period type provided")
+	ErrIncorrectMenuItem = errors.New("incorrect menu item fetched, it's absent in menu item count struct")
+)
+
+type orderRepository struct {
+	storage *Storage
+}
+
+func NewOrderRepository(storage *Storage) *orderRepository {
+	return &orderRepository{storage}
+}
+
+func (r *orderRepository) Create(ctx context.Context, order entities.Order) (orderID int64, err error) {
+	err = r.storage.write(ctx, func(d *Data) error {
+		if order.ID != "" {
+			id, err := strconv.ParseInt(order.ID, 10, 64)
+			if err != nil {
+				return ErrNonNumericID
+			}
+			if d.orderIndex(id) != -1 {
+				return errors.ErrIDAlreadyExists
+			}
+			d.seenID("orders", id)
+			orderID = id
+		} else {
+			orderID = d.nextID("orders")
+		}
+
+		change(d, &d.Orders)
+		d.Orders = append(d.Orders, Order{
+			ID:               orderID,
+			CustomerID:       order.CustomerID,
+			Status:           order.Status,
+			CreatedAt:        time.Now(),
+			PickupAt:         order.PickupAt,
+			EstimatedReadyAt: order.EstimatedReadyAt,
+			Items:            append([]entities.OrderItem{}, order.Items...),
+			Amounts:          orderAmounts(order),
+			Version:          1,
+		})
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return orderID, nil
+}
+
+func (r *orderRepository) GetAll(ctx context.Context) (orders []entities.Order, err error) {
+	err = r.storage.read(ctx, func(d *Data) error {
+		if len(d.Orders) == 0 {
+			return sql.ErrNoRows
+		}
+		for _, record := range d.Orders {
+			order := record.toEntity()
+			if idx := d.customerIndex(record.CustomerID); idx != -1 {
+				order.CustomerName = d.Customers[idx].Fullname
+			}
+			orders = append(orders, order)
+		}
+		return nil
+	})
+	return orders, err
+}
+
+func (r *orderRepository) GetFiltered(ctx context.Context, filter entities.OrderFilter) (entities.OrdersPage, error) {
+	page := entities.OrdersPage{Orders: []entities.Order{}}
+
+	err := r.storage.read(ctx, func(d *Data) error {
+		type listedOrder struct {
+			record Order
+			total  float64
+		}
+
+		var listed []listedOrder
+		for _, record := range d.Orders {
+			total := record.Amounts.GrandTotal
+			if !d.orderMatches(record, total, filter) {
+				continue
+			}
+			listed = append(listed, listedOrder{record, total})
+		}
+
+		// Compares the order with the position in the sort, ties are broken by the id
+		compare := func(order listedOrder, createdAt time.Time, total float64, orderID int64) int {
+			switch filter.SortBy {
+			case entities.OrderSortTotal:
+				if order.total != total {
+					return cmp.Compare(order.total, total)
+				}
+			case entities.OrderSortID:
+			default:
+				if !order.record.CreatedAt.Equal(createdAt) {
+					return order.record.CreatedAt.Compare(createdAt)
+				}
+			}
+			return cmp.Compare(order.record.ID, orderID)
+		}
+		before := func(order, other listedOrder) bool {
+			result := compare(order, other.record.CreatedAt, other.total, other.record.ID)
+			if filter.Descending {
+				return result > 0
+			}
+			return result < 0
+		}
+		sort.Slice(listed, func(i, j int) bool {
+			return before(listed[i], listed[j])
+		})
+
+		if cursor := filter.After; cursor != nil {
+			start := len(listed)
+			for idx, order := range listed {
+				result := compare(order, cursor.CreatedAt, cursor.Total, cursor.OrderID)
+				if (!filter.Descending && result > 0) || (filter.Descending && result < 0) {
+					start = idx
+					break
+				}
+			}
+			listed = listed[start:]
+		}
+
+		if filter.Limit > 0 && len(listed) > filter.Limit {
+			listed = listed[:filter.Limit]
+			last := listed[len(listed)-1]
+			page.Next = &entities.OrderCursor{
+				SortBy:    filter.SortBy,
+				CreatedAt: last.record.CreatedAt,
+				Total:     last.total,
+				OrderID:   last.record.ID,
+			}
+		}
+
+		for _, order := range listed {
+			entity := order.record.toEntity()
+			if idx := d.customerIndex(order.record.CustomerID); idx != -1 {
+				entity.CustomerName = d.Customers[idx].Fullname
+			}
+			page.Orders = append(page.Orders, entity)
+		}
+		return nil
+	})
+	return page, err
+}
+
+func (d *Data) orderMatches(order Order, total float64, filter entities.OrderFilter) bool {
+	if filter.Status != "" && order.Status != filter.Status {
+		return false
+	}
+	if len(filter.Statuses) != 0 && !utils.In(order.Status, filter.Statuses) {
+		return false
+	}
+	if !filter.PickupTo.IsZero() && (order.PickupAt == nil || order.PickupAt.After(filter.PickupTo)) {
+		return false
+	}
+	if filter.Customer != "" {
+		idx := d.customerIndex(order.CustomerID)
+		if idx == -1 || !strings.Contains(strings.ToLower(d.Customers[idx].Fullname), strings.ToLower(filter.Customer)) {
+			return false
+		}
+	}
+	if filter.CustomerID != 0 && order.CustomerID != filter.CustomerID {
+		return false
+	}
+	if !filter.CreatedFrom.IsZero() && order.CreatedAt.Before(filter.CreatedFrom) {
+		return false
+	}
+	if !filter.CreatedTo.IsZero() && !order.CreatedAt.Before(filter.CreatedTo) {
+		return false
+	}
+	if filter.MenuItemID != 0 {
+		found := false
+		for _, item := range order.Items {
+			if item.ProductID == filter.MenuItemID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if filter.MinTotal != 0 && total < filter.MinTotal {
+		return false
+	}
+	if filter.MaxTotal != 0 && total > filter.MaxTotal {
+		return false
+	}
+	return true
+}
+
+func (r *orderRepository) GetById(ctx context.Context, idStr string) (order entities.Order, err error) {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return order, ErrNonNumericID
+	}
+
+	err = r.storage.read(ctx, func(d *Data) error {
+		idx := d.orderIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		}
+		order = d.Orders[idx].toEntity()
+		if customerIdx := d.customerIndex(order.CustomerID); customerIdx != -1 {
+			order.CustomerName = d.Customers[customerIdx].Fullname
+		}
+		return nil
+	})
+	return order, err
+}
+
+func (r *orderRepository) GetOrderRevenue(ctx context.Context, orderID int64) (totalOrderRevenue float64, err error) {
+	err = r.storage.read(ctx, func(d *Data) error {
+		idx := d.orderIndex(orderID)
+		if idx == -1 {
+			return sql.ErrNoRows
+		}
+		totalOrderRevenue = d.Orders[idx].total()
+		return nil
+	})
+	return totalOrderRevenue, err
+}
+
+func (r *orderRepository) Update(ctx context.Context, idStr string, order entities.Order) error {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.orderIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		} else if order.Version != 0 && order.Version != d.Orders[idx].Version {
+			return errors.ErrVersionMismatch
+		}
+		change(d, &d.Orders)
+		d.Orders[idx].CustomerID = order.CustomerID
+		d.Orders[idx].Status = order.Status
+		d.Orders[idx].PickupAt = order.PickupAt
+		d.Orders[idx].Items = append([]entities.OrderItem{}, order.Items...)
+		d.Orders[idx].Amounts.SetAmounts(order)
+		d.Orders[idx].Version++
+		return nil
+	})
+}
+
+func (r *orderRepository) Delete(ctx context.Context, idStr string) error {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.orderIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		}
+		for _, reservation := range d.InventoryReservations {
+			if reservation.OrderID == id {
+				return ErrOrderHasReservations
+			}
+		}
+		change(d, &d.Orders)
+		d.Orders = append(d.Orders[:idx], d.Orders[idx+1:]...)
+
+		// Cascade the deletion to status history, inventory transactions and payments
+		change(d, &d.StatusHistory)
+		history := d.StatusHistory[:0]
+		for _, record := range d.StatusHistory {
+			if record.OrderID != id {
+				history = append(history, record)
+			}
+		}
+		d.StatusHistory = history
+
+		change(d, &d.InventoryTransactions)
+		transactions := d.InventoryTransactions[:0]
+		for _, transaction := range d.InventoryTransactions {
+			if transaction.OrderID != id {
+				transactions = append(transactions, transaction)
+			}
+		}
+		d.InventoryTransactions = transactions
+
+		change(d, &d.Payments)
+		payments := d.Payments[:0]
+		for _, payment := range d.Payments {
+			if payment.OrderID != id {
+				payments = append(payments, payment)
+			}
+		}
+		d.Payments = payments
+
+		// Mimics ON DELETE SET NULL of the loyalty ledger, the points stay with the customer
+		change(d, &d.LoyaltyLedger)
+		for entryIdx := range d.LoyaltyLedger {
+			if d.LoyaltyLedger[entryIdx].OrderID == id {
+				d.LoyaltyLedger[entryIdx].OrderID = 0
+			}
+		}
+		return nil
+	})
+}
+
+func (r *orderRepository) GetOrderedItemsCountByPeriod(ctx context.Context, period, month string, year int) (map[string]int, error) {
+	orderedItemsCount := make(map[string]int)
+	if period != "day" && period != "month" {
+		return orderedItemsCount, ErrPeriodTypeInvalid
+	}
+
+	err := r.storage.read(ctx, func(d *Data) error {
+		for _, order := range d.Orders {
+			createdAt := order.CreatedAt.Local()
+			if order.Status != entities.ClosedStatus || createdAt.Year() != year {
+				continue
+			}
+
+			var key string
+			if period == "day" {
+				if createdAt.Month().String() != month {
+					continue
+				}
+				key = strconv.Itoa(createdAt.Day())
+			} else {
+				key = strings.ToLower(createdAt.Month().String())
+			}
+
+			for _, item := range order.Items {
+				orderedItemsCount[key] += item.Quantity
+			}
+		}
+		return nil
+	})
+	return orderedItemsCount, err
+}
+
+func (r *orderRepository) GetOrderedMenuItemsCountByPeriod(ctx context.Context, startDate, endDate time.Time) (entities.OrderedMenuItemsCount, error) {
+	menuItemsCount := entities.OrderedMenuItemsCount{}
+	countByName := make(map[string]int)
+
+	err := r.storage.read(ctx, func(d *Data) error {
+		for _, order := range d.Orders {
+			if !startDate.IsZero() && order.CreatedAt.Before(startDate) {
+				continue
+			} else if !endDate.IsZero() && order.CreatedAt.After(endDate) {
+				continue
+			}
+
+			for _, item := range order.Items {
+				if idx := d.menuItemIndex(int64(item.ProductID)); idx != -1 {
+					countByName[d.MenuItems[idx].Name] += item.Quantity
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return menuItemsCount, err
+	}
+
+	for menuItemName, itemCount := range countByName {
+		switch menuItemName {
+		case "Espresso":
+			menuItemsCount.Espresso = itemCount
+		case "Latte":
+			menuItemsCount.Latte = itemCount
+		case "Cappuccino":
+			menuItemsCount.Cappuccino = itemCount
+		case "Americano":
+			menuItemsCount.Americano = itemCount
+		case "Flat White":
+			menuItemsCount.FlatWhite = itemCount
+		case "Mocha":
+			menuItemsCount.Mocha = itemCount
+		case "Croissant":
+			menuItemsCount.Croissant = itemCount
+		case "Muffin":
+			menuItemsCount.Muffin = itemCount
+		case "Blueberry Muffin":
+			menuItemsCount.BlueberryMuffin = itemCount
+		case "Chocolate Chip Cookie":
+			menuItemsCount.ChocolateChipCookie = itemCount
+		case "Bagel":
+			menuItemsCount.Bagel = itemCount
+		case "Cheesecake":
+			menuItemsCount.Cheesecake = itemCount
+		case "Tiramisu":
+			menuItemsCount.Tiramisu = itemCount
+		case "Chocolate Cake":
+			menuItemsCount.ChocolateCake = itemCount
+		case "Vanilla Cupcake":
+			menuItemsCount.VanillaCupcake = itemCount
+		default:
+			return menuItemsCount, ErrIncorrectMenuItem
+		}
+	}
+
+	return menuItemsCount, nil
+}
+
+func (r *orderRepository) SetOrderStatusHistory(ctx context.Context, id int64, pastStatus, newStatus, reason string) error {
+	return r.storage.write(ctx, func(d *Data) error {
+		if d.orderIndex(id) == -1 {
+			return sql.ErrNoRows
+		}
+		change(d, &d.StatusHistory)
+		d.StatusHistory = append(d.StatusHistory, StatusHistory{
+			OrderID:    id,
+			PastStatus: pastStatus,
+			NewStatus:  newStatus,
+			Reason:     reason,
+			ChangedAt:  time.Now(),
+		})
+		return nil
+	})
+}
+
+func (r *orderRepository) UpdateStatus(ctx context.Context, id int64, pastStatus, newStatus string) error {
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.orderIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		} else if d.Orders[idx].Status != pastStatus {
+			return errors.ErrVersionMismatch
+		}
+		change(d, &d.Orders)
+		d.Orders[idx].Status = newStatus
+		d.Orders[idx].Version++
+		return nil
+	})
+}
+
+func (r *orderRepository) GetOrderStatusHistory(ctx context.Context, id int64) (history []entities.OrderStatusChange, err error) {
+	history = []entities.OrderStatusChange{}
+	err = r.storage.read(ctx, func(d *Data) error {
+		for _, record := range d.StatusHistory {
+			if record.OrderID == id {
+				history = append(history, entities.OrderStatusChange{
+					PastStatus: record.PastStatus,
+					NewStatus:  record.NewStatus,
+					Reason:     record.Reason,
+					ChangedAt:  record.ChangedAt,
+				})
+			}
+		}
+		return nil
+	})
+
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].ChangedAt.Before(history[j].ChangedAt)
+	})
+	return history, err
+}
+
+func (r *orderRepository) GetOrderCloseTimes(ctx context.Context, startDate, endDate time.Time) (closeTimes []entities.OrderCloseTime, err error) {
+	err = r.storage.read(ctx, func(d *Data) error {
+		byOrder := make(map[int64]*entities.OrderCloseTime)
+		for _, record := range d.StatusHistory {
+			if record.NewStatus != entities.OpenStatus && record.NewStatus != entities.ClosedStatus {
+				continue
+			}
+
+			closeTime, exists := byOrder[record.OrderID]
+			if !exists {
+				closeTime = &entities.OrderCloseTime{OrderID: record.OrderID}
+				byOrder[record.OrderID] = closeTime
+			}
+
+			if record.NewStatus == entities.OpenStatus && (closeTime.OpenedAt.IsZero() || record.ChangedAt.Before(closeTime.OpenedAt)) {
+				closeTime.OpenedAt = record.ChangedAt
+			} else if record.NewStatus == entities.ClosedStatus && record.ChangedAt.After(closeTime.ClosedAt) {
+				closeTime.ClosedAt = record.ChangedAt
+			}
+		}
+
+		for _, closeTime := range byOrder {
+			if closeTime.OpenedAt.IsZero() || closeTime.ClosedAt.IsZero() {
+				continue
+			} else if !startDate.IsZero() && closeTime.ClosedAt.Before(startDate) {
+				continue
+			} else if !endDate.IsZero() && !closeTime.ClosedAt.Before(endDate) {
+				continue
+			}
+			closeTimes = append(closeTimes, *closeTime)
+		}
+		return nil
+	})
+	return closeTimes, err
+}
+
+func (r *orderRepository) GetPreparationTimes(ctx context.Context, startDate, endDate time.Time) (preparations []entities.PreparationTime, err error) {
+	err = r.storage.read(ctx, func(d *Data) error {
+		byOrder := make(map[int64]*entities.PreparationTime)
+		for _, record := range d.StatusHistory {
+			preparation, exists := byOrder[record.OrderID]
+			if !exists {
+				preparation = &entities.PreparationTime{OrderID: record.OrderID}
+				byOrder[record.OrderID] = preparation
+			}
+
+			switch record.NewStatus {
+			case entities.OpenStatus:
+				if preparation.OpenedAt.IsZero() || record.ChangedAt.Before(preparation.OpenedAt) {
+					preparation.OpenedAt = record.ChangedAt
+				}
+			case entities.InProgressStatus:
+				if record.ChangedAt.After(preparation.StartedAt) {
+					preparation.StartedAt = record.ChangedAt
+				}
+			case entities.ClosedStatus:
+				if record.ChangedAt.After(preparation.ClosedAt) {
+					preparation.ClosedAt = record.ChangedAt
+				}
+			}
+		}
+
+		for _, order := range d.Orders {
+			preparation, exists := byOrder[order.ID]
+			if !exists || order.Status != entities.ClosedStatus {
+				continue
+			} else if preparation.OpenedAt.IsZero() || preparation.ClosedAt.IsZero() {
+				continue
+			} else if !startDate.IsZero() && preparation.ClosedAt.Before(startDate) {
+				continue
+			} else if !endDate.IsZero() && !preparation.ClosedAt.Before(endDate) {
+				continue
+			}
+
+			seen := make(map[int]bool)
+			for _, item := range order.Items {
+				if !seen[item.ProductID] {
+					seen[item.ProductID] = true
+					preparation.MenuItemIDs = append(preparation.MenuItemIDs, item.ProductID)
+				}
+			}
+			preparation.EstimatedReadyAt = order.EstimatedReadyAt
+			preparations = append(preparations, *preparation)
+		}
+		return nil
+	})
+
+	sort.SliceStable(preparations, func(i, j int) bool {
+		return preparations[i].ClosedAt.Before(preparations[j].ClosedAt)
+	})
+	return preparations, err
+}
+
+func (r *orderRepository) SetEstimatedReadyAt(ctx context.Context, id int64, readyAt time.Time) error {
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.orderIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		}
+		change(d, &d.Orders)
+		d.Orders[idx].EstimatedReadyAt = &readyAt
+		return nil
+	})
+}
+
+func (r *orderRepository) GetOrdersFullTextSearchReport(ctx context.Context, q string, minPrice, maxPrice int) ([]entities.OrderReport, error) {
+	orders := []entities.OrderReport{}
+	err := r.storage.read(ctx, func(d *Data) error {
+		for _, order := range d.Orders {
+			report := entities.OrderReport{
+				ID:    strconv.FormatInt(order.ID, 10),
+				Items: []string{},
+			}
+			if idx := d.customerIndex(order.CustomerID); idx != -1 {
+				report.CustomerName = d.Customers[idx].Fullname
+			}
+
+			for _, item := range order.Items {
+				if idx := d.menuItemIndex(int64(item.ProductID)); idx != -1 {
+					report.Items = append(report.Items, d.MenuItems[idx].Name)
+					report.Total += item.UnitPrice * float64(item.Quantity)
+				}
+			}
+			if len(report.Items) == 0 {
+				continue
+			}
+			for _, discount := range order.Discounts {
+				report.Total -= discount.Amount
+			}
+
+			report.Relevance = substringRelevance(q, report.CustomerName+" "+strings.Join(report.Items, " "))
+			if report.Relevance == 0 {
+				continue
+			}
+
+			if (minPrice == 0 || report.Total >= float64(minPrice)) && (maxPrice == 0 || report.Total <= float64(maxPrice)) {
+				orders = append(orders, report)
+			}
+		}
+		return nil
+	})
+
+	sort.SliceStable(orders, func(i, j int) bool {
+		return orders[i].Relevance > orders[j].Relevance
+	})
+	return orders, err
+}
+
+func (r *orderRepository) FetchInventoryUpdates(ctx context.Context, orderIDs []int64) (inventoryUpdates []vo.InventoryUpdate, err error) {
+	err = r.storage.read(ctx, func(d *Data) error {
+		orders := make(map[int64]bool, len(orderIDs))
+		for _, orderID := range orderIDs {
+			orders[orderID] = true
+		}
+
+		// Rows written by the inventory service, so the modifiers are counted as they were reserved
+		used := make(map[int64]float64)
+		for _, reservation := range d.InventoryReservations {
+			if orders[reservation.OrderID] {
+				used[reservation.InventoryItemID] += reservation.Quantity
+			}
+		}
+		for _, transaction := range d.InventoryTransactions {
+			if orders[transaction.OrderID] {
+				used[transaction.InventoryItemID] -= transaction.Quantity
+			}
+		}
+
+		for _, item := range d.Inventory {
+			quantity, exists := used[atoi64(item.IngredientID)]
+			if !exists {
+				continue
+			}
+			inventoryUpdates = append(inventoryUpdates, vo.InventoryUpdate{
+				IngredientID: item.IngredientID,
+				Name:         item.Name,
+				Quantity:     quantity,
+				Remaining:    item.Quantity - item.Reserved,
+			})
+		}
+		return nil
+	})
+	return inventoryUpdates, err
+}
+
+func (o Order) toEntity() entities.Order {
+	return entities.Order{
+		ID:            strconv.FormatInt(o.ID, 10),
+		CustomerID:    o.CustomerID,
+		Items:         append([]entities.OrderItem{}, o.Items...),
+		Discounts:     append([]entities.AppliedDiscount(nil), o.Discounts...),
+		Status:        o.Status,
+		Subtotal:      o.Amounts.Subtotal,
+		DiscountTotal: o.Amounts.DiscountTotal,
+		Tax:           o.Amounts.Tax,
+		ServiceCharge: o.Amounts.ServiceCharge,
+		Tip:           o.Amounts.Tip,
+		GrandTotal:    o.Amounts.GrandTotal,
+		CreatedAt:     o.CreatedAt.Format(time.RFC3339Nano),
+		PickupAt:      o.PickupAt,
+		Version:       o.Version,
+
+		EstimatedReadyAt: o.EstimatedReadyAt,
+	}
+}
+
+func orderAmounts(order entities.Order) (amounts OrderAmounts) {
+	amounts.SetAmounts(order)
+	return amounts
+}
+
+// Price of the items without the applied discounts
+func (o Order) total() (total float64) {
+	for _, item := range o.Items {
+		total += item.UnitPrice * float64(item.Quantity)
+	}
+	for _, discount := range o.Discounts {
+		total -= discount.Amount
+	}
+	return total
+}
+
+func (r *orderRepository) SetOrderDiscounts(ctx context.Context, id int64, discounts []entities.AppliedDiscount) error {
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.orderIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		}
+		change(d, &d.Orders)
+		d.Orders[idx].Discounts = append([]entities.AppliedDiscount{}, discounts...)
+		return nil
+	})
+}
+
+// Fills the price snapshots of order items stored before they were introduced.
+// The price at order time is the current price without the changes made after the order,
+// the cost is taken from the current inventory prices
+func (d *Data) backfillPriceSnapshots() {
+	for orderIdx := range d.Orders {
+		order := &d.Orders[orderIdx]
+		for itemIdx := range order.Items {
+			item := &order.Items[itemIdx]
+			if item.UnitPrice != 0 {
+				continue
+			}
+
+			menuIdx := d.menuItemIndex(int64(item.ProductID))
+			if menuIdx == -1 {
+				continue
+			}
+			menuItem := d.MenuItems[menuIdx]
+
+			price := menuItem.Price
+			for _, change := range d.PriceHistory {
+				if change.MenuItemID == int64(item.ProductID) && change.ChangedAt.After(order.CreatedAt) {
+					price -= change.PriceDifference
+				}
+			}
+			item.UnitPrice = math.Max(price, 0)
+
+			if item.UnitCost == 0 {
+				for _, ingredient := range menuItem.Ingredients {
+					if idx := d.inventoryIndex(atoi64(ingredient.IngredientID)); idx != -1 {
+						item.UnitCost += ingredient.Quantity * d.Inventory[idx].Price
+					}
+				}
+			}
+		}
+
+		// Orders written before the amounts were stored
+		if order.Amounts.GrandTotal == 0 {
+			var subtotal, discountTotal float64
+			for _, item := range order.Items {
+				subtotal += item.UnitPrice * float64(item.Quantity)
+			}
+			for _, discount := range order.Discounts {
+				discountTotal += discount.Amount
+			}
+			order.Amounts.Subtotal = subtotal
+			order.Amounts.DiscountTotal = discountTotal
+			order.Amounts.GrandTotal = math.Max(subtotal-discountTotal, 0)
+		}
+	}
+}
+
+func (d *Data) orderIndex(id int64) int {
+	for idx, order := range d.Orders {
+		if order.ID == id {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (d *Data) customerIndex(id int64) int {
+	for idx, customer := range d.Customers {
+		if customer.ID == id {
+			return idx
+		}
+	}
+	return -1
+}
@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"hot-coffee/internal/core/entities"
+)
+
+type paymentRepository struct {
+	storage *Storage
+}
+
+func NewPaymentRepository(storage *Storage) *paymentRepository {
+	return &paymentRepository{storage}
+}
+
+func (r *paymentRepository) Create(ctx context.Context, payment entities.Payment) (paymentID int64, err error) {
+	err = r.storage.write(ctx, func(d *Data) error {
+		if d.orderIndex(payment.OrderID) == -1 {
+			return sql.ErrNoRows
+		}
+		paymentID = d.nextID("payments")
+		change(d, &d.Payments)
+		d.Payments = append(d.Payments, Payment{
+			ID:             paymentID,
+			OrderID:        payment.OrderID,
+			Kind:           payment.Kind,
+			Tender:         payment.Tender,
+			Amount:         payment.Amount,
+			Reason:         payment.Reason,
+			RestockedItems: append([]entities.OrderItem(nil), payment.RestockedItems...),
+			CreatedAt:      time.Now(),
+		})
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return paymentID, nil
+}
+
+func (r *paymentRepository) GetByOrderID(ctx context.Context, orderID int64) (payments []entities.Payment, err error) {
+	err = r.storage.read(ctx, func(d *Data) error {
+		payments = []entities.Payment{}
+		for _, payment := range d.Payments {
+			if payment.OrderID == orderID {
+				payments = append(payments, payment.toEntity())
+			}
+		}
+		return nil
+	})
+	return payments, err
+}
+
+// Writes are serialized by the storage lock, only the order existence is checked
+func (r *paymentRepository) LockOrder(ctx context.Context, orderID int64) error {
+	return r.storage.read(ctx, func(d *Data) error {
+		if d.orderIndex(orderID) == -1 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
+
+func (p Payment) toEntity() entities.Payment {
+	return entities.Payment{
+		ID:             strconv.FormatInt(p.ID, 10),
+		OrderID:        p.OrderID,
+		Kind:           p.Kind,
+		Tender:         p.Tender,
+		Amount:         p.Amount,
+		Reason:         p.Reason,
+		RestockedItems: append([]entities.OrderItem(nil), p.RestockedItems...),
+		CreatedAt:      p.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// Closed orders of the older storage files are considered paid
+func (d *Data) backfillPayments() {
+	for _, order := range d.Orders {
+		if order.Status != entities.ClosedStatus || order.Amounts.GrandTotal <= 0 {
+			continue
+		}
+		paid := false
+		for _, payment := range d.Payments {
+			if payment.OrderID == order.ID {
+				paid = true
+				break
+			}
+		}
+		if !paid {
+			d.Payments = append(d.Payments, Payment{
+				ID:        d.nextID("payments"),
+				OrderID:   order.ID,
+				Kind:      entities.PaymentKind,
+				Tender:    entities.OtherTender,
+				Amount:    order.Amounts.GrandTotal,
+				Reason:    "recorded before payments tracking",
+				CreatedAt: order.CreatedAt,
+			})
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"strconv"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+)
+
+type promotionRepository struct {
+	storage *Storage
+}
+
+func NewPromotionRepository(storage *Storage) *promotionRepository {
+	return &promotionRepository{storage}
+}
+
+func (r *promotionRepository) Create(ctx context.Context, promotion entities.Promotion) (promotionID int64, err error) {
+	err = r.storage.write(ctx, func(d *Data) error {
+		if promotion.ID != "" {
+			id, err := strconv.ParseInt(promotion.ID, 10, 64)
+			if err != nil {
+				return ErrNonNumericID
+			}
+			if d.promotionIndex(id) != -1 {
+				return errors.ErrIDAlreadyExists
+			}
+			d.seenID("promotions", id)
+			promotionID = id
+		} else {
+			promotionID = d.nextID("promotions")
+		}
+		if promotion.Code != "" && d.promotionCodeIndex(promotion.Code) != -1 {
+			return errors.ErrIDAlreadyExists
+		}
+
+		promotion.ID = strconv.FormatInt(promotionID, 10)
+		promotion.UsageCount = 0
+		promotion.Version = 1
+		change(d, &d.Promotions)
+		d.Promotions = append(d.Promotions, promotion)
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return promotionID, nil
+}
+
+func (r *promotionRepository) GetAll(ctx context.Context) (promotions []entities.Promotion, err error) {
+	err = r.storage.read(ctx, func(d *Data) error {
+		if len(d.Promotions) == 0 {
+			return sql.ErrNoRows
+		}
+		promotions = append(promotions, d.Promotions...)
+		return nil
+	})
+	return promotions, err
+}
+
+func (r *promotionRepository) GetById(ctx context.Context, idStr string) (promotion entities.Promotion, err error) {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return promotion, ErrNonNumericID
+	}
+
+	err = r.storage.read(ctx, func(d *Data) error {
+		idx := d.promotionIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		}
+		promotion = d.Promotions[idx]
+		return nil
+	})
+	return promotion, err
+}
+
+func (r *promotionRepository) Update(ctx context.Context, idStr string, promotion entities.Promotion) error {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.promotionIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		} else if promotion.Version != 0 && promotion.Version != d.Promotions[idx].Version {
+			return errors.ErrVersionMismatch
+		}
+		if promotion.Code != "" {
+			if codeIdx := d.promotionCodeIndex(promotion.Code); codeIdx != -1 && codeIdx != idx {
+				return errors.ErrIDAlreadyExists
+			}
+		}
+		if promotion.UsageLimit != 0 && promotion.UsageLimit < d.Promotions[idx].UsageCount {
+			return errors.ErrUsageLimitReached
+		}
+
+		promotion.ID = d.Promotions[idx].ID
+		promotion.UsageCount = d.Promotions[idx].UsageCount
+		promotion.Version = d.Promotions[idx].Version + 1
+		change(d, &d.Promotions)
+		d.Promotions[idx] = promotion
+		return nil
+	})
+}
+
+// Applied discounts keep the promotion name after deleting
+func (r *promotionRepository) Delete(ctx context.Context, idStr string) error {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.promotionIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		}
+		change(d, &d.Promotions)
+		d.Promotions = append(d.Promotions[:idx], d.Promotions[idx+1:]...)
+
+		// Mimics ON DELETE SET NULL of the applied discounts
+		for orderIdx, order := range d.Orders {
+			applied := func(discount entities.AppliedDiscount) bool { return discount.PromotionID == id }
+			if !slices.ContainsFunc(order.Discounts, applied) {
+				continue
+			}
+			discounts := slices.Clone(order.Discounts)
+			for discountIdx := range discounts {
+				if applied(discounts[discountIdx]) {
+					discounts[discountIdx].PromotionID = 0
+				}
+			}
+			change(d, &d.Orders)
+			d.Orders[orderIdx].Discounts = discounts
+		}
+		return nil
+	})
+}
+
+func (r *promotionRepository) IncrementUsage(ctx context.Context, id int64) error {
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.promotionIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		}
+		promotion := &d.Promotions[idx]
+		if promotion.UsageLimit != 0 && promotion.UsageCount >= promotion.UsageLimit {
+			return errors.ErrUsageLimitReached
+		}
+		change(d, &d.Promotions)
+		promotion.UsageCount++
+		return nil
+	})
+}
+
+func (r *promotionRepository) DecrementUsage(ctx context.Context, id int64) error {
+	return r.storage.write(ctx, func(d *Data) error {
+		if idx := d.promotionIndex(id); idx != -1 && d.Promotions[idx].UsageCount > 0 {
+			change(d, &d.Promotions)
+			d.Promotions[idx].UsageCount--
+		}
+		return nil
+	})
+}
+
+func (d *Data) promotionIndex(id int64) int {
+	for idx, promotion := range d.Promotions {
+		if atoi64(promotion.ID) == id {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (d *Data) promotionCodeIndex(code string) int {
+	for idx, promotion := range d.Promotions {
+		if promotion.Code == code {
+			return idx
+		}
+	}
+	return -1
+}
@@ -0,0 +1,349 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/repository"
+)
+
+// Records which have no entity counterpart \\
+
+type Customer struct {
+	ID           int64      `json:"customer_id"`
+	Fullname     string     `json:"fullname"`
+	Phone        string     `json:"phone,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	AnonymizedAt *time.Time `json:"anonymized_at,omitempty"`
+	Version      int64      `json:"version"`
+}
+
+type Order struct {
+	ID         int64                `json:"order_id"`
+	CustomerID int64                `json:"customer_id"`
+	Status     string               `json:"status"`
+	CreatedAt  time.Time            `json:"created_at"`
+	PickupAt   *time.Time           `json:"pickup_at,omitempty"`
+	Items      []entities.OrderItem `json:"items"`
+	Version    int64                `json:"version"`
+	// Discounts applied to the order
+	Discounts []entities.AppliedDiscount `json:"discounts,omitempty"`
+	Amounts   OrderAmounts               `json:"amounts"`
+	// Kept by Update, changed only by SetEstimatedReadyAt
+	EstimatedReadyAt *time.Time `json:"estimated_ready_at,omitempty"`
+}
+
+// Monetary columns of the order
+type OrderAmounts struct {
+	Subtotal      float64 `json:"subtotal"`
+	DiscountTotal float64 `json:"discount_total"`
+	Tax           float64 `json:"tax"`
+	ServiceCharge float64 `json:"service_charge"`
+	Tip           float64 `json:"tip"`
+	GrandTotal    float64 `json:"grand_total"`
+}
+
+func (a *OrderAmounts) SetAmounts(order entities.Order) {
+	a.Subtotal = order.Subtotal
+	a.DiscountTotal = order.DiscountTotal
+	a.Tax = order.Tax
+	a.ServiceCharge = order.ServiceCharge
+	a.Tip = order.Tip
+	a.GrandTotal = order.GrandTotal
+}
+
+type StatusHistory struct {
+	OrderID    int64     `json:"order_id"`
+	PastStatus string    `json:"past_status,omitempty"`
+	NewStatus  string    `json:"new_status"`
+	Reason     string    `json:"reason,omitempty"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+type InventoryTransaction struct {
+	InventoryItemID int64     `json:"inventory_item_id"`
+	OrderID         int64     `json:"order_id"`
+	Line            string    `json:"order_line,omitempty"`
+	Quantity        float64   `json:"transaction_quantity"`
+	ChangedAt       time.Time `json:"changed_at"`
+}
+
+type InventoryReservation struct {
+	OrderID         int64   `json:"order_id"`
+	InventoryItemID int64   `json:"inventory_item_id"`
+	Line            string  `json:"order_line,omitempty"`
+	Quantity        float64 `json:"quantity"`
+}
+
+type Payment struct {
+	ID             int64                `json:"payment_id"`
+	OrderID        int64                `json:"order_id"`
+	Kind           string               `json:"kind"`
+	Tender         string               `json:"tender"`
+	Amount         float64              `json:"amount"`
+	Reason         string               `json:"reason,omitempty"`
+	RestockedItems []entities.OrderItem `json:"restocked_items,omitempty"`
+	CreatedAt      time.Time            `json:"created_at"`
+}
+
+type LoyaltyEntry struct {
+	ID         int64      `json:"entry_id"`
+	CustomerID int64      `json:"customer_id"`
+	OrderID    int64      `json:"order_id,omitempty"`
+	Kind       string     `json:"kind"`
+	Points     int64      `json:"points"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type AuditEntry struct {
+	ID        int64     `json:"audit_id"`
+	Action    string    `json:"action"`
+	Entity    string    `json:"entity"`
+	EntityID  string    `json:"entity_id"`
+	Actor     string    `json:"actor,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type PriceHistory struct {
+	MenuItemID      int64     `json:"menu_item_id"`
+	PriceDifference float64   `json:"price_difference"`
+	ChangedAt       time.Time `json:"changed_at"`
+}
+
+// Data holds every table of the in-memory storage
+type Data struct {
+	Customers             []Customer                   `json:"customers"`
+	Orders                []Order                      `json:"orders"`
+	MenuItems             []entities.MenuItem          `json:"menu_items"`
+	Inventory             []entities.InventoryItem     `json:"inventory"`
+	StatusHistory         []StatusHistory              `json:"order_status_history"`
+	InventoryTransactions []InventoryTransaction       `json:"inventory_transactions"`
+	InventoryReservations []InventoryReservation       `json:"inventory_reservations"`
+	PriceHistory          []PriceHistory               `json:"price_history"`
+	Promotions            []entities.Promotion         `json:"promotions"`
+	Payments              []Payment                    `json:"payments"`
+	LoyaltyLedger         []LoyaltyEntry               `json:"loyalty_ledger"`
+	AuditLog              []AuditEntry                 `json:"audit_log"`
+	IdempotencyKeys       []entities.IdempotencyRecord `json:"idempotency_keys"`
+	Webhooks              []entities.Webhook           `json:"webhooks"`
+	WebhookDeliveries     []entities.WebhookDelivery   `json:"webhook_deliveries"`
+	// Last issued id per table, mimics SERIAL columns
+	Sequences map[string]int64 `json:"sequences"`
+
+	// Undo log of the running write, nil outside of write
+	journal *journal
+}
+
+// Tables changed by the write with their state before it, the write is rolled back by restoring them
+type journal struct {
+	restore map[interface{}]func()
+}
+
+// Saves the table before its first change in the write, so the failed write can restore it.
+// Every write must pass the table here before changing it, the nested records are replaced
+// as a whole and never changed in place.
+func change[T any](d *Data, table *[]T) {
+	if d.journal == nil {
+		return
+	} else if _, ok := d.journal.restore[table]; ok {
+		return
+	}
+	saved := slices.Clone(*table)
+	d.journal.restore[table] = func() { *table = saved }
+}
+
+func NewData() *Data {
+	return &Data{Sequences: make(map[string]int64)}
+}
+
+// Returns next id of the table sequence
+func (d *Data) nextID(table string) int64 {
+	d.changeSequences()
+	d.Sequences[table]++
+	return d.Sequences[table]
+}
+
+// Moves the sequence forward if explicit id was inserted
+func (d *Data) seenID(table string, id int64) {
+	if d.Sequences[table] < id {
+		d.changeSequences()
+		d.Sequences[table] = id
+	}
+}
+
+func (d *Data) changeSequences() {
+	if d.journal == nil {
+		return
+	} else if _, ok := d.journal.restore[&d.Sequences]; ok {
+		return
+	}
+	saved := maps.Clone(d.Sequences)
+	d.journal.restore[&d.Sequences] = func() { d.Sequences = saved }
+}
+
+// Pointers to the tables changed by the running write
+func (d *Data) changed() []interface{} {
+	tables := make([]interface{}, 0, len(d.journal.restore))
+	for table := range d.journal.restore {
+		tables = append(tables, table)
+	}
+	return tables
+}
+
+func (d *Data) rollback() {
+	for _, restore := range d.journal.restore {
+		restore()
+	}
+}
+
+// Storage is the shared state of all in-memory repositories
+type Storage struct {
+	mu   sync.RWMutex
+	data *Data
+	// Called after every successful write with the pointers to the changed tables, nil changed
+	// stands for all tables. Nil if nothing should be persisted
+	persist func(data *Data, changed []interface{}) error
+	// Set after the first write persisted all tables, including the backfilled ones
+	persisted bool
+}
+
+func NewStorage(data *Data, persist func(data *Data, changed []interface{}) error) *Storage {
+	if data == nil {
+		data = NewData()
+	}
+	if data.Sequences == nil {
+		data.Sequences = make(map[string]int64)
+	}
+	data.backfillPriceSnapshots()
+	data.backfillPayments()
+	data.backfillReservations()
+	data.backfillCustomers()
+	return &Storage{data: data, persist: persist}
+}
+
+func NewRepository() *repository.Repository {
+	return NewRepositoryWithStorage(NewStorage(nil, nil))
+}
+
+func NewRepositoryWithStorage(storage *Storage) *repository.Repository {
+	return &repository.Repository{
+		Inventory:   NewInventoryRepository(storage),
+		Menu:        NewMenuRepository(storage),
+		Order:       NewOrderRepository(storage),
+		Customer:    NewCustomerRepository(storage),
+		Loyalty:     NewLoyaltyRepository(storage),
+		Audit:       NewAuditRepository(storage),
+		Promotion:   NewPromotionRepository(storage),
+		Payment:     NewPaymentRepository(storage),
+		Idempotency: NewIdempotencyRepository(storage),
+		Webhook:     NewWebhookRepository(storage),
+		UnitOfWork:  NewUnitOfWork(storage),
+	}
+}
+
+// Context key of the transaction opened by unit of work
+type txKey struct{}
+
+// Context key of the functions run after the transaction is committed
+type afterCommitKey struct{}
+
+type unitOfWork struct {
+	storage *Storage
+}
+
+func NewUnitOfWork(storage *Storage) *unitOfWork {
+	return &unitOfWork{storage}
+}
+
+// Holds the exclusive lock for the whole transaction, the repositories called with
+// the transaction context work on the locked data without locking it again
+func (u *unitOfWork) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if u.storage.inTx(ctx) {
+		return fn(ctx)
+	}
+
+	var hooks []func(ctx context.Context)
+	err := u.storage.write(ctx, func(d *Data) error {
+		txCtx := context.WithValue(context.WithValue(ctx, afterCommitKey{}, &hooks), txKey{}, u.storage)
+		return fn(txCtx)
+	})
+	if err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		hook(ctx)
+	}
+	return nil
+}
+
+func (u *unitOfWork) AfterCommit(ctx context.Context, fn func(ctx context.Context)) {
+	if hooks, ok := ctx.Value(afterCommitKey{}).(*[]func(ctx context.Context)); ok && u.storage.inTx(ctx) {
+		*hooks = append(*hooks, fn)
+		return
+	}
+	fn(ctx)
+}
+
+func (s *Storage) inTx(ctx context.Context) bool {
+	return ctx.Value(txKey{}) == s
+}
+
+// Runs read-only function under the shared lock
+func (s *Storage) read(ctx context.Context, fn func(d *Data) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	} else if s.inTx(ctx) {
+		return fn(s.data)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return fn(s.data)
+}
+
+// Runs function under the exclusive lock, changes are discarded on any error or panic
+func (s *Storage) write(ctx context.Context, fn func(d *Data) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	} else if s.inTx(ctx) {
+		// Rolled back and persisted by unit of work
+		return fn(s.data)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.journal = &journal{restore: make(map[interface{}]func())}
+	committed := false
+	defer func() {
+		// Also runs while panicking, the panic goes on with the tables restored
+		if !committed {
+			s.data.rollback()
+		}
+		s.data.journal = nil
+	}()
+
+	if err := fn(s.data); err != nil {
+		return err
+	}
+
+	changed := s.data.changed()
+	if s.persist == nil || (s.persisted && len(changed) == 0) {
+		committed = true
+		return nil
+	} else if !s.persisted {
+		changed = nil
+	}
+	if err := s.persist(s.data, changed); err != nil {
+		return err
+	}
+	s.persisted = true
+	committed = true
+	return nil
+}
@@ -0,0 +1,134 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"hot-coffee/internal/core/entities"
+)
+
+func TestWriteRollback(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name string
+		// Changes the storage in the transaction, the returned error rolls it back
+		change func(ctx context.Context, repositories *testRepositories) error
+		// Tables persisted by the committed transaction
+		wantChanged int
+	}{
+		{
+			name: "committed insert",
+			change: func(ctx context.Context, r *testRepositories) error {
+				_, err := r.order.Create(ctx, entities.Order{Status: entities.OpenStatus})
+				return err
+			},
+			// Orders and sequences
+			wantChanged: 2,
+		},
+		{
+			name: "failed after insert",
+			change: func(ctx context.Context, r *testRepositories) error {
+				if _, err := r.order.Create(ctx, entities.Order{Status: entities.OpenStatus}); err != nil {
+					return err
+				}
+				return errFailed
+			},
+		},
+		{
+			name: "failed after update and delete",
+			change: func(ctx context.Context, r *testRepositories) error {
+				if err := r.inventory.AdjustReserved(ctx, "1", 5); err != nil {
+					return err
+				}
+				if err := r.promotion.Delete(ctx, "1"); err != nil {
+					return err
+				}
+				return errFailed
+			},
+		},
+		{
+			name: "panic after update",
+			change: func(ctx context.Context, r *testRepositories) error {
+				if err := r.inventory.AdjustReserved(ctx, "1", 5); err != nil {
+					return err
+				}
+				panic("failed")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			var persisted [][]interface{}
+			storage := NewStorage(nil, func(data *Data, changed []interface{}) error {
+				persisted = append(persisted, changed)
+				return nil
+			})
+			r := &testRepositories{
+				order:     NewOrderRepository(storage),
+				inventory: NewInventoryRepository(storage),
+				promotion: NewPromotionRepository(storage),
+			}
+
+			if err := r.inventory.Create(ctx, entities.InventoryItem{Name: "Milk", Quantity: 10, Unit: "ml"}); err != nil {
+				t.Fatalf("Create() inventory item error = %v", err)
+			}
+			if _, err := r.promotion.Create(ctx, entities.Promotion{Name: "Tenth off"}); err != nil {
+				t.Fatalf("Create() promotion error = %v", err)
+			}
+			persisted = nil
+			before := marshalData(t, storage.data)
+
+			// Panic is reported as the failure, the storage must be unlocked after it
+			err := func() (err error) {
+				defer func() {
+					if recover() != nil {
+						err = errFailed
+					}
+				}()
+				return NewUnitOfWork(storage).Do(ctx, func(ctx context.Context) error { return tt.change(ctx, r) })
+			}()
+			if !storage.mu.TryLock() {
+				t.Fatal("storage is locked after the transaction")
+			}
+			storage.mu.Unlock()
+			after := marshalData(t, storage.data)
+
+			if tt.wantChanged == 0 {
+				if !errors.Is(err, errFailed) {
+					t.Fatalf("Do() error = %v, want %v", err, errFailed)
+				} else if after != before {
+					t.Fatalf("data after rollback = %s, want %s", after, before)
+				} else if len(persisted) != 0 {
+					t.Fatalf("rolled back transaction persisted %d times", len(persisted))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			} else if after == before {
+				t.Fatal("committed transaction changed nothing")
+			} else if len(persisted) != 1 || len(persisted[0]) != tt.wantChanged {
+				t.Fatalf("persisted tables = %v, want one write of %d tables", persisted, tt.wantChanged)
+			}
+		})
+	}
+}
+
+type testRepositories struct {
+	order     *orderRepository
+	inventory *inventoryRepository
+	promotion *promotionRepository
+}
+
+func marshalData(t *testing.T, data *Data) string {
+	t.Helper()
+	raw, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	return string(raw)
+}
@@ -0,0 +1,269 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+)
+
+type webhookRepository struct {
+	storage *Storage
+}
+
+func NewWebhookRepository(storage *Storage) *webhookRepository {
+	return &webhookRepository{storage}
+}
+
+func (r *webhookRepository) Create(ctx context.Context, webhook entities.Webhook) (webhookID int64, err error) {
+	err = r.storage.write(ctx, func(d *Data) error {
+		if webhook.ID != "" {
+			id, err := strconv.ParseInt(webhook.ID, 10, 64)
+			if err != nil {
+				return ErrNonNumericID
+			}
+			if d.webhookIndex(id) != -1 {
+				return errors.ErrIDAlreadyExists
+			}
+			d.seenID("webhooks", id)
+			webhookID = id
+		} else {
+			webhookID = d.nextID("webhooks")
+		}
+
+		webhook.ID = strconv.FormatInt(webhookID, 10)
+		webhook.EventTypes = append([]string(nil), webhook.EventTypes...)
+		webhook.Version = 1
+		change(d, &d.Webhooks)
+		d.Webhooks = append(d.Webhooks, webhook)
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return webhookID, nil
+}
+
+func (r *webhookRepository) GetAll(ctx context.Context) (webhooks []entities.Webhook, err error) {
+	err = r.storage.read(ctx, func(d *Data) error {
+		if len(d.Webhooks) == 0 {
+			return sql.ErrNoRows
+		}
+		for _, webhook := range d.Webhooks {
+			webhook.EventTypes = append([]string(nil), webhook.EventTypes...)
+			webhooks = append(webhooks, webhook)
+		}
+		return nil
+	})
+	return webhooks, err
+}
+
+func (r *webhookRepository) GetById(ctx context.Context, idStr string) (webhook entities.Webhook, err error) {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return webhook, ErrNonNumericID
+	}
+
+	err = r.storage.read(ctx, func(d *Data) error {
+		idx := d.webhookIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		}
+		webhook = d.Webhooks[idx]
+		webhook.EventTypes = append([]string(nil), webhook.EventTypes...)
+		return nil
+	})
+	return webhook, err
+}
+
+func (r *webhookRepository) Update(ctx context.Context, idStr string, webhook entities.Webhook) error {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.webhookIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		} else if webhook.Version != 0 && webhook.Version != d.Webhooks[idx].Version {
+			return errors.ErrVersionMismatch
+		}
+
+		webhook.ID = d.Webhooks[idx].ID
+		webhook.EventTypes = append([]string(nil), webhook.EventTypes...)
+		webhook.Version = d.Webhooks[idx].Version + 1
+		change(d, &d.Webhooks)
+		d.Webhooks[idx] = webhook
+		return nil
+	})
+}
+
+func (r *webhookRepository) Delete(ctx context.Context, idStr string) error {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.webhookIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		}
+		change(d, &d.Webhooks)
+		d.Webhooks = append(d.Webhooks[:idx], d.Webhooks[idx+1:]...)
+
+		// Mimics ON DELETE CASCADE of the deliveries
+		change(d, &d.WebhookDeliveries)
+		deliveries := d.WebhookDeliveries[:0]
+		for _, delivery := range d.WebhookDeliveries {
+			if delivery.WebhookID != id {
+				deliveries = append(deliveries, delivery)
+			}
+		}
+		d.WebhookDeliveries = deliveries
+		return nil
+	})
+}
+
+func (r *webhookRepository) CreateDelivery(ctx context.Context, delivery entities.WebhookDelivery) (deliveryID int64, err error) {
+	err = r.storage.write(ctx, func(d *Data) error {
+		if d.webhookIndex(delivery.WebhookID) == -1 {
+			return sql.ErrNoRows
+		}
+
+		deliveryID = d.nextID("webhook_deliveries")
+		delivery.ID = strconv.FormatInt(deliveryID, 10)
+		delivery.Status = entities.DeliveryPending
+		delivery.Attempts = 0
+		change(d, &d.WebhookDeliveries)
+		d.WebhookDeliveries = append(d.WebhookDeliveries, delivery)
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return deliveryID, nil
+}
+
+// The exclusive lock keeps the concurrent dispatchers from claiming the same deliveries
+func (r *webhookRepository) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) (deliveries []entities.WebhookDelivery, err error) {
+	err = r.storage.write(ctx, func(d *Data) error {
+		for idx := range d.WebhookDeliveries {
+			if len(deliveries) == limit {
+				break
+			}
+			delivery := &d.WebhookDeliveries[idx]
+			if delivery.Status != entities.DeliveryPending || delivery.NextAttemptAt.After(now) {
+				continue
+			}
+			change(d, &d.WebhookDeliveries)
+			delivery.NextAttemptAt = now.Add(lease)
+			deliveries = append(deliveries, *delivery)
+		}
+		return nil
+	})
+	return deliveries, err
+}
+
+func (r *webhookRepository) UpdateDelivery(ctx context.Context, delivery entities.WebhookDelivery) error {
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.deliveryIndex(atoi64(delivery.ID))
+		if idx == -1 {
+			return sql.ErrNoRows
+		}
+
+		change(d, &d.WebhookDeliveries)
+		stored := &d.WebhookDeliveries[idx]
+		stored.Status = delivery.Status
+		stored.Attempts = delivery.Attempts
+		stored.NextAttemptAt = delivery.NextAttemptAt
+		stored.LastError = delivery.LastError
+		stored.LastStatusCode = delivery.LastStatusCode
+		stored.DeliveredAt = delivery.DeliveredAt
+		return nil
+	})
+}
+
+func (r *webhookRepository) SearchDeliveries(ctx context.Context, text []byte) (deliveries []entities.WebhookDelivery, err error) {
+	err = r.storage.read(ctx, func(d *Data) error {
+		for _, delivery := range d.WebhookDeliveries {
+			if bytes.Contains(delivery.Payload, text) {
+				delivery.Payload = append([]byte(nil), delivery.Payload...)
+				deliveries = append(deliveries, delivery)
+			}
+		}
+		return nil
+	})
+	return deliveries, err
+}
+
+func (r *webhookRepository) UpdatePayload(ctx context.Context, idStr string, payload []byte) error {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	return r.storage.write(ctx, func(d *Data) error {
+		idx := d.deliveryIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		}
+		change(d, &d.WebhookDeliveries)
+		d.WebhookDeliveries[idx].Payload = append([]byte(nil), payload...)
+		return nil
+	})
+}
+
+func (r *webhookRepository) GetDeliveries(ctx context.Context, webhookID int64, status string) (deliveries []entities.WebhookDelivery, err error) {
+	err = r.storage.read(ctx, func(d *Data) error {
+		deliveries = []entities.WebhookDelivery{}
+		for idx := len(d.WebhookDeliveries) - 1; idx >= 0; idx-- {
+			delivery := d.WebhookDeliveries[idx]
+			if (webhookID == 0 || delivery.WebhookID == webhookID) && (status == "" || delivery.Status == status) {
+				deliveries = append(deliveries, delivery)
+			}
+		}
+		return nil
+	})
+	return deliveries, err
+}
+
+func (r *webhookRepository) GetDeliveryById(ctx context.Context, idStr string) (delivery entities.WebhookDelivery, err error) {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return delivery, ErrNonNumericID
+	}
+
+	err = r.storage.read(ctx, func(d *Data) error {
+		idx := d.deliveryIndex(id)
+		if idx == -1 {
+			return sql.ErrNoRows
+		}
+		delivery = d.WebhookDeliveries[idx]
+		return nil
+	})
+	return delivery, err
+}
+
+func (d *Data) webhookIndex(id int64) int {
+	for idx, webhook := range d.Webhooks {
+		if atoi64(webhook.ID) == id {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (d *Data) deliveryIndex(id int64) int {
+	for idx, delivery := range d.WebhookDeliveries {
+		if atoi64(delivery.ID) == id {
+			return idx
+		}
+	}
+	return -1
+}
@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"hot-coffee/internal/core/entities"
+	"log/slog"
+	"os"
+)
+
+type auditRepository struct {
+	db *sql.DB
+}
+
+var auditRepositoryInstance *auditRepository
+
+func NewAuditRepository() *auditRepository {
+	if auditRepositoryInstance != nil {
+		return auditRepositoryInstance
+	}
+
+	db, err := openDB()
+	if err != nil {
+		slog.Error("Error while opening connection with PostgreSQL: ", "error:", err.Error())
+		os.Exit(1)
+	}
+
+	auditRepositoryInstance = &auditRepository{
+		db: db,
+	}
+
+	return auditRepositoryInstance
+}
+
+func (r *auditRepository) Create(ctx context.Context, entry entities.AuditEntry) (int64, error) {
+	query := `
+		INSERT INTO audit_log (action, entity, entity_id, actor, reason)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING audit_id
+	`
+
+	var auditID int64
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
+		entry.Action, entry.Entity, entry.EntityID, entry.Actor, entry.Reason,
+	).Scan(&auditID)
+	if err != nil {
+		return -1, err
+	}
+	return auditID, nil
+}
+
+func (r *auditRepository) GetAll(ctx context.Context, filter entities.AuditFilter) ([]entities.AuditEntry, error) {
+	query := `
+		SELECT audit_id, action, entity, entity_id, actor, reason, created_at
+		FROM audit_log
+		WHERE ($1 = '' OR action = $1)
+			AND ($2 = '' OR entity = $2)
+			AND ($3 = '' OR entity_id = $3)
+		ORDER BY audit_id DESC
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, filter.Action, filter.Entity, filter.EntityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []entities.AuditEntry{}
+	for rows.Next() {
+		var entry entities.AuditEntry
+		err := rows.Scan(&entry.ID, &entry.Action, &entry.Entity, &entry.EntityID, &entry.Actor, &entry.Reason, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
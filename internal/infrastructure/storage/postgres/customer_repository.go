@@ -0,0 +1,215 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type customerRepository struct {
+	db *sql.DB
+}
+
+var customerRepositoryInstance *customerRepository
+
+func NewCustomerRepository() *customerRepository {
+	if customerRepositoryInstance != nil {
+		return customerRepositoryInstance
+	}
+
+	db, err := openDB()
+	if err != nil {
+		slog.Error("Error while opening connection with PostgreSQL: ", "error:", err.Error())
+		os.Exit(1)
+	}
+
+	customerRepositoryInstance = &customerRepository{
+		db: db,
+	}
+
+	return customerRepositoryInstance
+}
+
+const customerColumns = `customer_id, fullname, phone, created_at, anonymized_at, version`
+
+func (r *customerRepository) Create(ctx context.Context, customer entities.Customer) (int64, error) {
+	query := `
+		INSERT INTO customers (fullname, phone)
+		VALUES ($1, $2)
+		RETURNING customer_id
+	`
+
+	var customerID int64
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, customer.Fullname, nullString(customer.Phone)).Scan(&customerID)
+	if err != nil {
+		return -1, customerError(err)
+	}
+	return customerID, nil
+}
+
+func (r *customerRepository) GetAll(ctx context.Context, filter entities.CustomerFilter) ([]entities.Customer, error) {
+	query := `
+		SELECT ` + customerColumns + `
+		FROM customers
+		WHERE ($1 = '' OR fullname ILIKE '%' || $1 || '%')
+			AND ($2 = '' OR phone LIKE '%' || $2 || '%')
+		ORDER BY customer_id
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, filter.Name, filter.Phone)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	customers := []entities.Customer{}
+	for rows.Next() {
+		customer, err := scanCustomer(rows)
+		if err != nil {
+			return nil, err
+		}
+		customers = append(customers, customer)
+	}
+	return customers, rows.Err()
+}
+
+func (r *customerRepository) GetById(ctx context.Context, idStr string) (entities.Customer, error) {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return entities.Customer{}, ErrNonNumericID
+	}
+
+	query := `SELECT ` + customerColumns + ` FROM customers WHERE customer_id = $1`
+	return scanCustomer(conn(ctx, r.db).QueryRowContext(ctx, query, id))
+}
+
+func (r *customerRepository) Update(ctx context.Context, idStr string, customer entities.Customer) error {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	query := `
+		UPDATE customers
+		SET
+			fullname = $1,
+			phone = $2,
+			version = version + 1
+		WHERE customer_id = $3 AND ($4 = 0 OR version = $4) AND anonymized_at IS NULL
+	`
+
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, customer.Fullname, nullString(customer.Phone), id, customer.Version)
+	if err != nil {
+		return customerError(err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return versionMismatchOrNoRows(ctx, r.db, "customers", "customer_id", id)
+	}
+	return nil
+}
+
+// Replaces the name, drops the phone and marks the customer anonymized,
+// sql.ErrNoRows if the customer does not exist or is anonymized already
+func (r *customerRepository) Anonymize(ctx context.Context, idStr string, fullname string) error {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	query := `
+		UPDATE customers
+		SET
+			fullname = $1,
+			phone = NULL,
+			anonymized_at = NOW(),
+			version = version + 1
+		WHERE customer_id = $2 AND anonymized_at IS NULL
+	`
+
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, fullname, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *customerRepository) Delete(ctx context.Context, idStr string) error {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM customers WHERE customer_id = $1`, id)
+	if err != nil {
+		return customerError(err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func scanCustomer(row rowScanner) (entities.Customer, error) {
+	var (
+		customer     entities.Customer
+		phone        sql.NullString
+		createdAt    time.Time
+		anonymizedAt sql.NullTime
+	)
+	err := row.Scan(&customer.ID, &customer.Fullname, &phone, &createdAt, &anonymizedAt, &customer.Version)
+	if err != nil {
+		return customer, err
+	}
+
+	customer.Phone = phone.String
+	customer.CreatedAt = &createdAt
+	customer.AnonymizedAt = timePointer(anonymizedAt)
+	return customer, nil
+}
+
+// Taken phone and customer referenced by orders
+func customerError(err error) error {
+	if pqErr, ok := err.(*pq.Error); ok {
+		switch pqErr.Code {
+		case "23505": // unique_violation
+			return errors.ErrUniqueViolation
+		case "23503": // foreign_key_violation
+			return errors.ErrReferenced
+		}
+	}
+	return err
+}
+
+// Empty string is passed as NULL
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
@@ -0,0 +1,138 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"hot-coffee/internal/core/entities"
+	"log/slog"
+	"os"
+	"time"
+)
+
+type idempotencyRepository struct {
+	db *sql.DB
+}
+
+var idempotencyRepositoryInstance *idempotencyRepository
+
+func NewIdempotencyRepository() *idempotencyRepository {
+	if idempotencyRepositoryInstance != nil {
+		return idempotencyRepositoryInstance
+	}
+
+	db, err := openDB()
+	if err != nil {
+		slog.Error("Error while opening connection with PostgreSQL: ", "error:", err.Error())
+		os.Exit(1)
+	}
+
+	idempotencyRepositoryInstance = &idempotencyRepository{
+		db: db,
+	}
+
+	return idempotencyRepositoryInstance
+}
+
+func (r *idempotencyRepository) Reserve(ctx context.Context, record entities.IdempotencyRecord, now time.Time) (existing entities.IdempotencyRecord, reserved bool, err error) {
+	if _, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, now); err != nil {
+		return existing, false, err
+	}
+
+	// Concurrent requests with the same key race for the insert, only one of them wins.
+	// The same request not completed within the lease was lost, the retry takes its key over.
+	query := `
+		INSERT INTO idempotency_keys (key, request_hash, created_at, expires_at, locked_until)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (key) DO UPDATE
+		SET created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at, locked_until = EXCLUDED.locked_until
+		WHERE idempotency_keys.status_code IS NULL
+			AND idempotency_keys.request_hash = EXCLUDED.request_hash
+			AND idempotency_keys.locked_until <= EXCLUDED.created_at
+	`
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, record.Key, record.RequestHash, now, record.ExpiresAt, record.LockedUntil)
+	if err != nil {
+		return existing, false, err
+	}
+	if rowsAffected, err := res.RowsAffected(); err != nil {
+		return existing, false, err
+	} else if rowsAffected == 1 {
+		return existing, true, nil
+	}
+
+	var statusCode sql.NullInt64
+	var lockedUntil sql.NullTime
+	query = `
+		SELECT key, request_hash, status_code, content_type, body, created_at, expires_at, locked_until
+		FROM idempotency_keys
+		WHERE key = $1
+	`
+	err = conn(ctx, r.db).QueryRowContext(ctx, query, record.Key).Scan(
+		&existing.Key, &existing.RequestHash, &statusCode, &existing.ContentType, &existing.Body,
+		&existing.CreatedAt, &existing.ExpiresAt, &lockedUntil,
+	)
+	existing.StatusCode = int(statusCode.Int64)
+	existing.LockedUntil = lockedUntil.Time
+	return existing, false, err
+}
+
+func (r *idempotencyRepository) Complete(ctx context.Context, key string, lockedUntil time.Time, statusCode int, contentType string, body []byte) error {
+	query := `
+		UPDATE idempotency_keys
+		SET status_code = $3, content_type = $4, body = $5, locked_until = NULL
+		WHERE key = $1 AND locked_until = $2
+	`
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, key, lockedUntil, statusCode, contentType, body)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *idempotencyRepository) Delete(ctx context.Context, key string, lockedUntil time.Time) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM idempotency_keys WHERE key = $1 AND locked_until = $2`, key, lockedUntil)
+	return err
+}
+
+func (r *idempotencyRepository) SearchBodies(ctx context.Context, text []byte) ([]entities.IdempotencyRecord, error) {
+	query := `
+		SELECT key, request_hash, status_code, content_type, body, created_at, expires_at
+		FROM idempotency_keys
+		WHERE status_code IS NOT NULL AND position($1::bytea IN body) > 0
+	`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, text)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []entities.IdempotencyRecord
+	for rows.Next() {
+		var record entities.IdempotencyRecord
+		err := rows.Scan(&record.Key, &record.RequestHash, &record.StatusCode, &record.ContentType, &record.Body,
+			&record.CreatedAt, &record.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func (r *idempotencyRepository) UpdateBody(ctx context.Context, key string, body []byte) error {
+	query := `UPDATE idempotency_keys SET body = $2 WHERE key = $1 AND status_code IS NOT NULL`
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, key, body)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
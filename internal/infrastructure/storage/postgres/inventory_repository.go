@@ -1,6 +1,7 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"hot-coffee/internal/core/entities"
@@ -45,7 +46,7 @@ func NewInventoryRepository() *inventoryRepository {
 	return inventoryRepositoryInstance
 }
 
-func (r *inventoryRepository) Create(item entities.InventoryItem) error {
+func (r *inventoryRepository) Create(ctx context.Context, item entities.InventoryItem) error {
 	var (
 		query string
 		args  []interface{}
@@ -55,19 +56,19 @@ func (r *inventoryRepository) Create(item entities.InventoryItem) error {
 		id, _ := strconv.Atoi(item.IngredientID)
 
 		query = `
-			INSERT INTO inventory (inventory_item_id, name, price, quantity, unit) 
-			VALUES ($1, $2, $3, $4, $5)
+			INSERT INTO inventory (inventory_item_id, name, price, quantity, unit, reorder_level) 
+			VALUES ($1, $2, $3, $4, $5, $6)
 		`
-		args = []interface{}{id, item.Name, item.Price, item.Quantity, item.Unit}
+		args = []interface{}{id, item.Name, item.Price, item.Quantity, item.Unit, item.ReorderLevel}
 	} else {
 		query = `
-			INSERT INTO inventory (name, price, quantity, unit) 
-			VALUES ($1, $2, $3, $4)
+			INSERT INTO inventory (name, price, quantity, unit, reorder_level) 
+			VALUES ($1, $2, $3, $4, $5)
 		`
-		args = []interface{}{item.Name, item.Price, item.Quantity, item.Unit}
+		args = []interface{}{item.Name, item.Price, item.Quantity, item.Unit, item.ReorderLevel}
 	}
 
-	_, err := r.db.Exec(query, args...)
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, args...)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok {
 			if pqErr.Code == "23505" { // unique_violation
@@ -81,13 +82,14 @@ func (r *inventoryRepository) Create(item entities.InventoryItem) error {
 
 }
 
-func (r *inventoryRepository) GetAll() ([]entities.InventoryItem, error) {
+func (r *inventoryRepository) GetAll(ctx context.Context) ([]entities.InventoryItem, error) {
 	query := `
-		SELECT * 
+		SELECT inventory_item_id, name, price, quantity, reserved, unit, reorder_level, version
 		FROM inventory
+		WHERE deleted_at IS NULL
 	`
 	// Query to get multiple users
-	rows, err := r.db.Query(query)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -97,7 +99,7 @@ func (r *inventoryRepository) GetAll() ([]entities.InventoryItem, error) {
 	var items []entities.InventoryItem
 	for rows.Next() {
 		var item entities.InventoryItem
-		if err := rows.Scan(&item.IngredientID, &item.Name, &item.Price, &item.Quantity, &item.Unit); err != nil {
+		if err := rows.Scan(&item.IngredientID, &item.Name, &item.Price, &item.Quantity, &item.Reserved, &item.Unit, &item.ReorderLevel, &item.Version); err != nil {
 			return nil, err
 		}
 		items = append(items, item)
@@ -110,7 +112,7 @@ func (r *inventoryRepository) GetAll() ([]entities.InventoryItem, error) {
 	return items, nil
 }
 
-func (r *inventoryRepository) GetById(idStr string) (entities.InventoryItem, error) {
+func (r *inventoryRepository) GetById(ctx context.Context, idStr string) (entities.InventoryItem, error) {
 	id, err := strconv.Atoi(idStr)
 	var item entities.InventoryItem
 
@@ -119,22 +121,24 @@ func (r *inventoryRepository) GetById(idStr string) (entities.InventoryItem, err
 	}
 
 	query := `
-		SELECT * 
+		SELECT inventory_item_id, name, price, quantity, reserved, unit, reorder_level, version, deleted_at
 		FROM inventory
 		WHERE inventory_item_id = $1
 	`
 	// Query to get multiple users
-	row := r.db.QueryRow(query, id)
+	row := conn(ctx, r.db).QueryRowContext(ctx, query, id)
 
-	if err := row.Scan(&item.IngredientID, &item.Name, &item.Price, &item.Quantity, &item.Unit); err != nil {
+	var deletedAt sql.NullString
+	if err := row.Scan(&item.IngredientID, &item.Name, &item.Price, &item.Quantity, &item.Reserved, &item.Unit, &item.ReorderLevel, &item.Version, &deletedAt); err != nil {
 		return item, err
 	}
+	item.DeletedAt = deletedAt.String
 
 	return item, nil
 
 }
 
-func (r *inventoryRepository) Update(idStr string, item entities.InventoryItem) error {
+func (r *inventoryRepository) Update(ctx context.Context, idStr string, item entities.InventoryItem) error {
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
 		return ErrNonNumericID
@@ -146,14 +150,21 @@ func (r *inventoryRepository) Update(idStr string, item entities.InventoryItem)
 			name = $2, 
 			price = $3,
 			quantity = $4, 
-			unit = $5
-		WHERE inventory_item_id = $1
+			unit = $5,
+			reorder_level = $6,
+			version = version + 1
+		WHERE inventory_item_id = $1 AND ($7 = 0 OR version = $7)
 		`
 
-	args := []interface{}{id, item.Name, item.Price, item.Quantity, item.Unit}
+	args := []interface{}{id, item.Name, item.Price, item.Quantity, item.Unit, item.ReorderLevel, item.Version}
 
-	res, err := r.db.Exec(query, args...)
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, args...)
 	if err != nil {
+		// Quantity on hand cannot drop below the reserved one
+		var pgErr *pq.Error
+		if errors.As(err, &pgErr) && pgErr.Code == "23514" && pgErr.Constraint == "reserved_within_quantity" {
+			return errors.NewErrInsufficientIngredient(idStr)
+		}
 		return err
 	}
 
@@ -163,40 +174,61 @@ func (r *inventoryRepository) Update(idStr string, item entities.InventoryItem)
 	}
 
 	if rowsAffected == 0 {
-		return sql.ErrNoRows
+		return versionMismatchOrNoRows(ctx, r.db, "inventory", "inventory_item_id", id)
 	}
 
 	return nil
 
 }
 
-func (r *inventoryRepository) saveInventoryTransaction(tx *sql.Tx, productID int64, orderID int64, quantity float64) error {
+// Archives the inventory item, the transactions keep referencing it
+func (r *inventoryRepository) Delete(ctx context.Context, idStr string) error {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
 	query := `
-	INSERT INTO inventory_transactions(inventory_item_id, order_id, transaction_quantity)
-	VALUES ($1, $2, $3)
+		UPDATE inventory
+		SET 
+			deleted_at = NOW(),
+			version = version + 1
+		WHERE inventory_item_id = $1 AND deleted_at IS NULL
 	`
-	args := []interface{}{productID, orderID, quantity}
 
-	_, err := tx.Exec(query, args...)
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, id)
 	if err != nil {
 		return err
+	}
 
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not get affected rows: %w", err)
 	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
 	return nil
 }
 
-func (r *inventoryRepository) Delete(idStr string) error {
+// Brings back the archived inventory item
+func (r *inventoryRepository) Restore(ctx context.Context, idStr string) error {
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
 		return ErrNonNumericID
 	}
 
 	query := `
-		DELETE FROM inventory
-		WHERE inventory_item_id = $1
+		UPDATE inventory
+		SET 
+			deleted_at = NULL,
+			version = version + 1
+		WHERE inventory_item_id = $1 AND deleted_at IS NOT NULL
 	`
 
-	res, err := r.db.Exec(query, id)
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -213,14 +245,14 @@ func (r *inventoryRepository) Delete(idStr string) error {
 	return nil
 }
 
-func (r *inventoryRepository) GetPage(sortBy string, offset, rowCount int) (entities.PaginatedInventoryItems, error) {
+func (r *inventoryRepository) GetPage(ctx context.Context, sortBy string, offset, rowCount int) (entities.PaginatedInventoryItems, error) {
 	page := entities.PaginatedInventoryItems{
 		Items: []entities.PageInventoryItem{},
 	}
 
 	// Get the total number of items for pagination
 	var totalCount int
-	err := r.db.QueryRow(`SELECT COUNT(*) FROM inventory`).Scan(&totalCount)
+	err := conn(ctx, r.db).QueryRowContext(ctx, `SELECT COUNT(*) FROM inventory WHERE deleted_at IS NULL`).Scan(&totalCount)
 	if err != nil {
 		return page, err
 	}
@@ -228,6 +260,7 @@ func (r *inventoryRepository) GetPage(sortBy string, offset, rowCount int) (enti
 	query := `
 		SELECT name, quantity, price
 		FROM inventory
+		WHERE deleted_at IS NULL
 		LIMIT $2 OFFSET $1
 	`
 
@@ -237,7 +270,7 @@ func (r *inventoryRepository) GetPage(sortBy string, offset, rowCount int) (enti
 	page.PageSize = rowCount
 	page.HasNextPage = page.CurrentPage < page.TotalPages
 
-	rows, err := r.db.Query(query, offset, rowCount)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, offset, rowCount)
 	if err != nil {
 		return page, err
 	}
@@ -270,109 +303,145 @@ func (r *inventoryRepository) GetPage(sortBy string, offset, rowCount int) (enti
 	return page, nil
 }
 
-type inventoryCount struct {
-	ingredientID    string
-	ingredientCount float64
-	itemCount       int
-}
+// Changes the quantity of inventory item by the difference, fails if the quantity becomes negative
+func (r *inventoryRepository) AdjustQuantity(ctx context.Context, idStr string, difference float64) error {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return ErrNonNumericID
+	}
 
-// TODO: Bring it to service layer
-func (r *inventoryRepository) deductOrAddOrderItemsIngredients(tx *sql.Tx, orderID int64, add bool) error {
-	// Part 1 Join Menu Items and their Ingredients
-	// We fetch data to know how many ingredients to deduct
-
-	// MUST DO: INDEXATION for query IDs
-	joinQuery := `
-		SELECT
-			mii.inventory_item_id,
-			mii.quantity as ingredient_quantity,
-			oi.quantity as item_count
-		FROM menu_items_ingredients mii
-		JOIN order_items oi USING(menu_item_id)
-		WHERE oi.order_id = $1
+	query := `
+        UPDATE inventory
+		SET  
+			quantity = quantity + $2
+		WHERE inventory_item_id = $1
 	`
-	menuItemsIngredients := make([]entities.MenuItemIngredient, 0)
-
-	rows, err := tx.Query(joinQuery, orderID)
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, id, difference)
 	if err != nil {
-		tx.Rollback()
+		var pgErr *pq.Error
+		if errors.As(err, &pgErr) {
+			if pgErr.Code == "23514" && (pgErr.Constraint == "positive_quantity" || pgErr.Constraint == "reserved_within_quantity") {
+				return errors.NewErrInsufficientIngredient(idStr)
+			}
+		}
 		return err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var count inventoryCount
-		var countRaw []byte
-		if err := rows.Scan(&count.ingredientID, &count.ingredientCount, &countRaw); err != nil {
-			tx.Rollback()
-			return err
-		}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not get affected rows: %w", err)
+	}
 
-		// Convert countRaw to string, parse as float, and convert to int
-		countFloat, err := strconv.ParseFloat(string(countRaw), 64)
-		if err != nil {
-			return fmt.Errorf("error parsing count: %v", err)
-		}
-		count.itemCount = int(countFloat) // Convert to int (rounding down)
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
 
-		menuItemsIngredients = append(menuItemsIngredients, entities.MenuItemIngredient{
-			IngredientID: count.ingredientID,
-			Quantity:     count.ingredientCount * float64(count.itemCount),
-		})
+func (r *inventoryRepository) SaveTransaction(ctx context.Context, idStr string, orderID int64, line string, quantity float64) error {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return ErrNonNumericID
 	}
 
-	// Part 2 Deduction part
-	var deductQuery string
-	if add {
-		deductQuery = `
-        UPDATE inventory
-		SET  
-			quantity = quantity + $2 
-		WHERE inventory_item_id = $1
+	query := `
+	INSERT INTO inventory_transactions(inventory_item_id, order_id, order_line, transaction_quantity)
+	VALUES ($1, $2, $3, $4)
 	`
-	} else {
-		deductQuery = `
-        UPDATE inventory
-		SET  
-			quantity = quantity - $2 
-		WHERE inventory_item_id = $1
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, id, orderID, line, quantity)
+	return err
+}
+
+func (r *inventoryRepository) GetTransactions(ctx context.Context, orderID int64) ([]entities.IngredientUsage, error) {
+	query := `
+		SELECT inventory_item_id, order_line, SUM(transaction_quantity)
+		FROM inventory_transactions
+		WHERE order_id = $1
+		GROUP BY inventory_item_id, order_line
 	`
+	return r.queryUsages(ctx, query, orderID)
+}
 
+func (r *inventoryRepository) AdjustReserved(ctx context.Context, idStr string, difference float64) error {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return ErrNonNumericID
 	}
 
-	for _, menuItemIngredient := range menuItemsIngredients {
-		args := []interface{}{menuItemIngredient.IngredientID, menuItemIngredient.Quantity}
-		_, err := tx.Exec(deductQuery, args...)
-		if err != nil {
-			var pgErr *pq.Error
-			if errors.As(err, &pgErr) {
-				if pgErr.Code == "23514" && pgErr.Constraint == "positive_quantity" {
-					return errors.NewErrInsufficientIngredient(menuItemIngredient.IngredientID)
-				}
+	query := `
+		UPDATE inventory
+		SET
+			reserved = reserved + $2
+		WHERE inventory_item_id = $1
+	`
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, id, difference)
+	if err != nil {
+		var pgErr *pq.Error
+		if errors.As(err, &pgErr) {
+			if pgErr.Code == "23514" && pgErr.Constraint == "reserved_within_quantity" {
+				return errors.NewErrInsufficientIngredient(idStr)
 			}
-
-			tx.Rollback()
-			return err
 		}
+		return err
+	}
 
-		ingredientID, err := strconv.Atoi(menuItemIngredient.IngredientID)
-		if err != nil {
-			slog.Error("Error while converting Menu Item Ingredient into integer value:", "Ingredient ID", ingredientID, "error", err.Error())
-			continue
-		}
-		var differenceQuantity float64
-		if add {
-			differenceQuantity = menuItemIngredient.Quantity
-		} else {
-			differenceQuantity = -menuItemIngredient.Quantity
-		}
-		err = r.saveInventoryTransaction(tx, int64(ingredientID), orderID, differenceQuantity)
-		if err != nil {
-			tx.Rollback()
-			return err
-		}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not get affected rows: %w", err)
+	}
 
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
 	}
 
 	return nil
 }
+
+func (r *inventoryRepository) SaveReservation(ctx context.Context, idStr string, orderID int64, line string, quantity float64) error {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	query := `
+		INSERT INTO inventory_reservations (order_id, inventory_item_id, order_line, quantity)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (order_id, inventory_item_id, order_line) DO UPDATE
+		SET quantity = inventory_reservations.quantity + EXCLUDED.quantity
+	`
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, orderID, id, line, quantity)
+	return err
+}
+
+func (r *inventoryRepository) GetReservations(ctx context.Context, orderID int64) ([]entities.IngredientUsage, error) {
+	query := `
+		SELECT inventory_item_id, order_line, quantity
+		FROM inventory_reservations
+		WHERE order_id = $1
+	`
+	return r.queryUsages(ctx, query, orderID)
+}
+
+func (r *inventoryRepository) queryUsages(ctx context.Context, query string, orderID int64) ([]entities.IngredientUsage, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usages []entities.IngredientUsage
+	for rows.Next() {
+		var usage entities.IngredientUsage
+		if err := rows.Scan(&usage.IngredientID, &usage.Line, &usage.Quantity); err != nil {
+			return nil, err
+		}
+		usages = append(usages, usage)
+	}
+	return usages, rows.Err()
+}
+
+func (r *inventoryRepository) DeleteReservations(ctx context.Context, orderID int64) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM inventory_reservations WHERE order_id = $1`, orderID)
+	return err
+}
@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"hot-coffee/internal/core/entities"
+	"log/slog"
+	"os"
+)
+
+type loyaltyRepository struct {
+	db *sql.DB
+}
+
+var loyaltyRepositoryInstance *loyaltyRepository
+
+func NewLoyaltyRepository() *loyaltyRepository {
+	if loyaltyRepositoryInstance != nil {
+		return loyaltyRepositoryInstance
+	}
+
+	db, err := openDB()
+	if err != nil {
+		slog.Error("Error while opening connection with PostgreSQL: ", "error:", err.Error())
+		os.Exit(1)
+	}
+
+	loyaltyRepositoryInstance = &loyaltyRepository{
+		db: db,
+	}
+
+	return loyaltyRepositoryInstance
+}
+
+func (r *loyaltyRepository) LockCustomer(ctx context.Context, customerID int64) error {
+	var id int64
+	query := `SELECT customer_id FROM customers WHERE customer_id = $1 FOR UPDATE`
+	return conn(ctx, r.db).QueryRowContext(ctx, query, customerID).Scan(&id)
+}
+
+func (r *loyaltyRepository) Create(ctx context.Context, entry entities.LoyaltyEntry) (int64, error) {
+	query := `
+		INSERT INTO loyalty_ledger (customer_id, order_id, kind, points, expires_at)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5)
+		RETURNING entry_id
+	`
+
+	var expiresAt sql.NullTime
+	if entry.ExpiresAt != nil {
+		expiresAt = nullTime(*entry.ExpiresAt)
+	}
+
+	var entryID int64
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
+		entry.CustomerID, entry.OrderID, entry.Kind, entry.Points, expiresAt,
+	).Scan(&entryID)
+	if err != nil {
+		return -1, err
+	}
+	return entryID, nil
+}
+
+func (r *loyaltyRepository) GetByCustomerID(ctx context.Context, customerID int64) ([]entities.LoyaltyEntry, error) {
+	query := `
+		SELECT entry_id, customer_id, COALESCE(order_id, 0), kind, points, expires_at, created_at
+		FROM loyalty_ledger
+		WHERE customer_id = $1
+		ORDER BY entry_id
+	`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []entities.LoyaltyEntry{}
+	for rows.Next() {
+		var (
+			entry     entities.LoyaltyEntry
+			expiresAt sql.NullTime
+		)
+		err := rows.Scan(&entry.ID, &entry.CustomerID, &entry.OrderID, &entry.Kind, &entry.Points, &expiresAt, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entry.ExpiresAt = timePointer(expiresAt)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -1,6 +1,7 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"hot-coffee/internal/core/entities"
@@ -8,6 +9,7 @@ import (
 	"log/slog"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -36,7 +38,7 @@ func NewMenuRepository() *menuRepository {
 	return menuRepositoryInstance
 }
 
-func (r *menuRepository) Create(item entities.MenuItem) (int, error) {
+func (r *menuRepository) Create(ctx context.Context, item entities.MenuItem) (int, error) {
 	var (
 		query string
 		args  []interface{}
@@ -45,67 +47,49 @@ func (r *menuRepository) Create(item entities.MenuItem) (int, error) {
 	// If item.ID (menu_item_id) is non-zero, we use it explicitly
 	if item.ID != "" {
 		query = `
-            INSERT INTO menu_items (menu_item_id, name, description, price)
-            VALUES ($1, $2, $3, $4)
+            INSERT INTO menu_items (menu_item_id, name, description, price, category)
+            VALUES ($1, $2, $3, $4, $5)
             RETURNING menu_item_id
         `
-		args = []interface{}{item.ID, item.Name, item.Description, item.Price}
+		args = []interface{}{item.ID, item.Name, item.Description, item.Price, item.Category}
 	} else {
 		query = `
-            INSERT INTO menu_items (name, description, price)
-            VALUES ($1, $2, $3)
+            INSERT INTO menu_items (name, description, price, category)
+            VALUES ($1, $2, $3, $4)
             RETURNING menu_item_id
         `
-		args = []interface{}{item.Name, item.Description, item.Price}
-	}
-
-	// Start transaction
-	tx, err := r.db.Begin()
-	if err != nil {
-		return -1, err
+		args = []interface{}{item.Name, item.Description, item.Price, item.Category}
 	}
 
-	// Insert the menu item and get the menu_item_id
 	var menuItemID int
-	err = tx.QueryRow(query, args...).Scan(&menuItemID)
-	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok {
-			if pqErr.Code == "23505" { // unique_violation
-				return -1, errors.ErrIDAlreadyExists
+	err := runInTx(ctx, r.db, func(ctx context.Context) error {
+		// Insert the menu item and get the menu_item_id
+		err := conn(ctx, r.db).QueryRowContext(ctx, query, args...).Scan(&menuItemID)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok {
+				if pqErr.Code == "23505" { // unique_violation
+					return errors.ErrIDAlreadyExists
+				}
 			}
+			return err
 		}
-		tx.Rollback()
-		return -1, err
-	}
-
-	// Insert ingredients
-	ingredientQuery := `
-        INSERT INTO menu_items_ingredients (menu_item_id, inventory_item_id, quantity)
-        VALUES ($1, $2, $3)
-    `
 
-	for _, ingredient := range item.Ingredients {
-		_, err = tx.Exec(ingredientQuery, menuItemID, ingredient.IngredientID, ingredient.Quantity)
-		if err != nil {
-			tx.Rollback()
-			return -1, err
+		if err := r.insertIngredients(ctx, menuItemID, item.Ingredients); err != nil {
+			return err
 		}
-	}
-
-	// Commit transaction
-	err = tx.Commit()
+		return r.saveModifiers(ctx, menuItemID, item.Modifiers)
+	})
 	if err != nil {
-		tx.Rollback()
 		return -1, err
 	}
 
 	return menuItemID, nil
 }
 
-func (r *menuRepository) GetAll() ([]entities.MenuItem, error) {
+func (r *menuRepository) GetAll(ctx context.Context) ([]entities.MenuItem, error) {
 	query := `
 		SELECT 
-			mi.menu_item_id, mi.name, mi.description, mi.price, 
+			mi.menu_item_id, mi.name, mi.description, mi.price, mi.category, mi.version,
 			mii.inventory_item_id, mii.quantity
 		FROM 
 			menu_items mi
@@ -113,9 +97,11 @@ func (r *menuRepository) GetAll() ([]entities.MenuItem, error) {
 			menu_items_ingredients mii 
 		ON 
 			mi.menu_item_id = mii.menu_item_id
+		WHERE 
+			mi.deleted_at IS NULL
 	`
 
-	rows, err := r.db.Query(query)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -131,12 +117,14 @@ func (r *menuRepository) GetAll() ([]entities.MenuItem, error) {
 			name          string
 			description   string
 			price         float64
+			category      string
+			version       int64
 			ingredientID  sql.NullString
 			ingredientQty sql.NullFloat64
 		)
 
 		// Scan basic menu item fields and ingredient fields
-		if err := rows.Scan(&menuItemID, &name, &description, &price, &ingredientID, &ingredientQty); err != nil {
+		if err := rows.Scan(&menuItemID, &name, &description, &price, &category, &version, &ingredientID, &ingredientQty); err != nil {
 			return nil, err
 		}
 
@@ -153,7 +141,9 @@ func (r *menuRepository) GetAll() ([]entities.MenuItem, error) {
 				Name:        name,
 				Description: description,
 				Price:       price,
+				Category:    category,
 				Ingredients: []entities.MenuItemIngredient{},
+				Version:     version,
 			}
 		}
 
@@ -180,10 +170,14 @@ func (r *menuRepository) GetAll() ([]entities.MenuItem, error) {
 		return nil, sql.ErrNoRows
 	}
 
+	if err := r.attachModifiers(ctx, menuItems, false); err != nil {
+		return nil, err
+	}
+
 	return menuItems, nil
 }
 
-func (r *menuRepository) GetById(idStr string) (entities.MenuItem, error) {
+func (r *menuRepository) GetById(ctx context.Context, idStr string) (entities.MenuItem, error) {
 	// Parse the ID as an integer
 	id, err := strconv.Atoi(idStr)
 	var menuItem entities.MenuItem
@@ -195,7 +189,7 @@ func (r *menuRepository) GetById(idStr string) (entities.MenuItem, error) {
 	// Query to get menu item and its ingredients
 	query := `
 		SELECT 
-			mi.menu_item_id, mi.name, mi.description, mi.price, 
+			mi.menu_item_id, mi.name, mi.description, mi.price, mi.category, mi.version, mi.deleted_at,
 			mii.inventory_item_id, mii.quantity
 		FROM 
 			menu_items mi
@@ -207,7 +201,7 @@ func (r *menuRepository) GetById(idStr string) (entities.MenuItem, error) {
 			mi.menu_item_id = $1
 	`
 
-	rows, err := r.db.Query(query, id)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, id)
 	if err != nil {
 		return menuItem, err
 	}
@@ -223,12 +217,15 @@ func (r *menuRepository) GetById(idStr string) (entities.MenuItem, error) {
 			name          string
 			description   string
 			price         float64
+			category      string
+			version       int64
+			deletedAt     sql.NullString
 			ingredientID  sql.NullString
 			ingredientQty sql.NullFloat64
 		)
 
 		// Scan the row
-		if err := rows.Scan(&menuItemID, &name, &description, &price, &ingredientID, &ingredientQty); err != nil {
+		if err := rows.Scan(&menuItemID, &name, &description, &price, &category, &version, &deletedAt, &ingredientID, &ingredientQty); err != nil {
 			return menuItem, err
 		}
 
@@ -238,6 +235,9 @@ func (r *menuRepository) GetById(idStr string) (entities.MenuItem, error) {
 			menuItem.Name = name
 			menuItem.Description = description
 			menuItem.Price = price
+			menuItem.Category = category
+			menuItem.Version = version
+			menuItem.DeletedAt = deletedAt.String
 		}
 
 		// Append ingredients, if any
@@ -259,10 +259,16 @@ func (r *menuRepository) GetById(idStr string) (entities.MenuItem, error) {
 		return menuItem, sql.ErrNoRows
 	}
 
-	return menuItem, nil
+	// Archived modifiers are needed by the old orders
+	menuItems := []entities.MenuItem{menuItem}
+	if err := r.attachModifiers(ctx, menuItems, true); err != nil {
+		return menuItem, err
+	}
+
+	return menuItems[0], nil
 }
 
-func (r *menuRepository) Update(idStr string, item entities.MenuItem) error {
+func (r *menuRepository) Update(ctx context.Context, idStr string, item entities.MenuItem) error {
 	// Convert ID from string to integer
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -270,71 +276,219 @@ func (r *menuRepository) Update(idStr string, item entities.MenuItem) error {
 	}
 
 	// Use a transaction to ensure atomicity
-	tx, err := r.db.Begin()
-	if err != nil {
-		return err
-	}
-
-	// Update the main menu item
-	query := `
+	return runInTx(ctx, r.db, func(ctx context.Context) error {
+		// Update the main menu item
+		query := `
         UPDATE menu_items
         SET 
             name = $2, 
             description = $3, 
-            price = $4
-        WHERE menu_item_id = $1
+            price = $4,
+            category = $5,
+            version = version + 1
+        WHERE menu_item_id = $1 AND ($6 = 0 OR version = $6)
 	`
-	_, err = tx.Exec(query, id, item.Name, item.Description, item.Price)
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
+		res, err := conn(ctx, r.db).ExecContext(ctx, query, id, item.Name, item.Description, item.Price, item.Category, item.Version)
+		if err != nil {
+			return err
+		}
 
-	// Delete existing ingredients for the menu item
-	deleteQuery := `
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("could not get affected rows: %w", err)
+		}
+
+		if rowsAffected == 0 {
+			return versionMismatchOrNoRows(ctx, r.db, "menu_items", "menu_item_id", id)
+		}
+
+		// Delete existing ingredients for the menu item
+		deleteQuery := `
         DELETE FROM menu_items_ingredients 
         WHERE menu_item_id = $1
 	`
-	_, err = tx.Exec(deleteQuery, id)
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
+		_, err = conn(ctx, r.db).ExecContext(ctx, deleteQuery, id)
+		if err != nil {
+			return err
+		}
+
+		// Insert updated ingredients
+		if err := r.insertIngredients(ctx, id, item.Ingredients); err != nil {
+			return err
+		}
+		return r.saveModifiers(ctx, id, item.Modifiers)
+	})
+}
 
-	// Insert updated ingredients
+func (r *menuRepository) insertIngredients(ctx context.Context, menuItemID int, ingredients []entities.MenuItemIngredient) error {
 	insertQuery := `
         INSERT INTO menu_items_ingredients (menu_item_id, inventory_item_id, quantity)
         VALUES ($1, $2, $3)
 	`
-	for _, ingredient := range item.Ingredients {
-		_, err = tx.Exec(insertQuery, id, ingredient.IngredientID, ingredient.Quantity)
+	for _, ingredient := range ingredients {
+		_, err := conn(ctx, r.db).ExecContext(ctx, insertQuery, menuItemID, ingredient.IngredientID, ingredient.Quantity)
 		if err != nil {
-			tx.Rollback()
 			return err
 		}
 	}
+	return nil
+}
 
-	// Commit the transaction
-	err = tx.Commit()
+// Writes the modifiers of the menu item: the ones with id are updated, the others are inserted.
+// Modifiers missing in the list are archived, so the orders can keep referencing them.
+func (r *menuRepository) saveModifiers(ctx context.Context, menuItemID int, modifiers []entities.MenuItemModifier) error {
+	keptIDs := []int64{}
+	for _, modifier := range modifiers {
+		var (
+			modifierID int64
+			err        error
+		)
+		if modifier.ID != "" {
+			query := `
+			UPDATE menu_item_modifiers
+			SET name = $3, price_delta = $4, deleted_at = NULL
+			WHERE modifier_id = $1 AND menu_item_id = $2
+			RETURNING modifier_id
+			`
+			err = conn(ctx, r.db).QueryRowContext(ctx, query, modifier.ID, menuItemID, modifier.Name, modifier.PriceDelta).Scan(&modifierID)
+		} else {
+			query := `
+			INSERT INTO menu_item_modifiers (menu_item_id, name, price_delta)
+			VALUES ($1, $2, $3)
+			RETURNING modifier_id
+			`
+			err = conn(ctx, r.db).QueryRowContext(ctx, query, menuItemID, modifier.Name, modifier.PriceDelta).Scan(&modifierID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to save modifier %q: %w", modifier.Name, err)
+		}
+		keptIDs = append(keptIDs, modifierID)
+
+		if _, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM menu_item_modifier_ingredients WHERE modifier_id = $1`, modifierID); err != nil {
+			return err
+		}
+		query := `
+		INSERT INTO menu_item_modifier_ingredients (modifier_id, inventory_item_id, quantity)
+		VALUES ($1, $2, $3)
+		`
+		for _, ingredient := range modifier.Ingredients {
+			if _, err := conn(ctx, r.db).ExecContext(ctx, query, modifierID, ingredient.IngredientID, ingredient.Quantity); err != nil {
+				return err
+			}
+		}
+	}
+
+	query := `
+	UPDATE menu_item_modifiers
+	SET deleted_at = NOW()
+	WHERE menu_item_id = $1 AND deleted_at IS NULL AND NOT (modifier_id = ANY($2))
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, menuItemID, pq.Array(keptIDs))
+	return err
+}
+
+// Loads the modifiers with their ingredients into the menu items
+func (r *menuRepository) attachModifiers(ctx context.Context, menuItems []entities.MenuItem, withArchived bool) error {
+	itemIndex := make(map[string]int, len(menuItems))
+	menuItemIDs := make([]string, 0, len(menuItems))
+	for idx, item := range menuItems {
+		itemIndex[item.ID] = idx
+		menuItemIDs = append(menuItemIDs, item.ID)
+	}
+
+	query := `
+	SELECT m.menu_item_id, m.modifier_id, m.name, m.price_delta, m.deleted_at,
+		mi.inventory_item_id, mi.quantity
+	FROM menu_item_modifiers m
+	LEFT JOIN menu_item_modifier_ingredients mi ON mi.modifier_id = m.modifier_id
+	WHERE m.menu_item_id = ANY($1::INTEGER[]) AND ($2 OR m.deleted_at IS NULL)
+	ORDER BY m.modifier_id, mi.inventory_item_id
+	`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, pq.Array(menuItemIDs), withArchived)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			menuItemID    string
+			modifier      entities.MenuItemModifier
+			deletedAt     sql.NullTime
+			ingredientID  sql.NullString
+			ingredientQty sql.NullFloat64
+		)
+		err := rows.Scan(&menuItemID, &modifier.ID, &modifier.Name, &modifier.PriceDelta, &deletedAt,
+			&ingredientID, &ingredientQty)
+		if err != nil {
+			return err
+		}
+
+		// Modifier with several ingredients spans several rows
+		item := &menuItems[itemIndex[menuItemID]]
+		if len(item.Modifiers) == 0 || item.Modifiers[len(item.Modifiers)-1].ID != modifier.ID {
+			if deletedAt.Valid {
+				modifier.DeletedAt = deletedAt.Time.Format(time.RFC3339)
+			}
+			item.Modifiers = append(item.Modifiers, modifier)
+		}
+		if ingredientID.Valid && ingredientQty.Valid {
+			last := &item.Modifiers[len(item.Modifiers)-1]
+			last.Ingredients = append(last.Ingredients, entities.MenuItemIngredient{
+				IngredientID: ingredientID.String,
+				Quantity:     ingredientQty.Float64,
+			})
+		}
+	}
+	return rows.Err()
+}
+
+// Archives the menu item, the orders keep referencing it
+func (r *menuRepository) Delete(ctx context.Context, idStr string) error {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	query := `
+        UPDATE menu_items
+        SET 
+            deleted_at = NOW(),
+            version = version + 1
+        WHERE menu_item_id = $1 AND deleted_at IS NULL
+	`
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, id)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
 
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
 	return nil
 }
 
-func (r *menuRepository) Delete(idStr string) error {
+// Brings back the archived menu item
+func (r *menuRepository) Restore(ctx context.Context, idStr string) error {
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
 		return ErrNonNumericID
 	}
 
-	deleteQuery := `
-        DELETE FROM menu_items
-        WHERE menu_item_id = $1
+	query := `
+        UPDATE menu_items
+        SET 
+            deleted_at = NULL,
+            version = version + 1
+        WHERE menu_item_id = $1 AND deleted_at IS NOT NULL
 	`
-	res, err := r.db.Exec(deleteQuery, id)
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -351,13 +505,13 @@ func (r *menuRepository) Delete(idStr string) error {
 	return nil
 }
 
-func (r *menuRepository) AddPriceDifference(id int, price_difference float64) error {
+func (r *menuRepository) AddPriceDifference(ctx context.Context, id int, price_difference float64) error {
 	query := `
 	INSERT INTO price_history(menu_item_id, price_difference)
 	VALUES ($1, $2)
 	`
 
-	_, err := r.db.Exec(query, id, price_difference)
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, id, price_difference)
 	if err != nil {
 		return err
 	}
@@ -365,7 +519,7 @@ func (r *menuRepository) AddPriceDifference(id int, price_difference float64) er
 	return nil
 }
 
-func (r *menuRepository) GetMenusFullTextSearchReport(q string, minPrice, maxPrice int) ([]entities.MenuReport, error) {
+func (r *menuRepository) GetMenusFullTextSearchReport(ctx context.Context, q string, minPrice, maxPrice int) ([]entities.MenuReport, error) {
 	query := `
 	SELECT 
     menu_item_id, 
@@ -379,7 +533,7 @@ func (r *menuRepository) GetMenusFullTextSearchReport(q string, minPrice, maxPri
 	WHERE to_tsvector(name || ' ' || description) @@ websearch_to_tsquery($1)
 	ORDER BY relevance DESC;
 	`
-	rows, err := r.db.Query(query, q)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, q)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,396 @@
+package postgres
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"hot-coffee/internal/core/errors"
+	"hot-coffee/migrations"
+)
+
+// Errors
+var (
+	ErrUnknownMigrationSet    = errors.New("unknown migration set")
+	ErrMigrationNotExists     = errors.New("migration with such version does not exist")
+	ErrNoAppliedMigrations    = errors.New("no applied migrations to roll back")
+	ErrMigrationFileNotPaired = errors.New("migration must have both up and down files")
+	ErrSeedSchemaVersion      = errors.New("database schema is newer than the seed was written for, seed a new database")
+)
+
+// Migration sets and the tables recording their applied versions
+const (
+	SchemaSet = "schema"
+	SeedSet   = "seed"
+)
+
+var migrationTables = map[string]string{
+	SchemaSet: "schema_migrations",
+	SeedSet:   "seed_migrations",
+}
+
+// 001_create_customers.up.sql
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time
+	Applied   bool
+}
+
+type Migrator struct {
+	db         *sql.DB
+	table      string
+	migrations []Migration
+	// Schema the seeds are applied to, nil for the schema set
+	schema *Migrator
+}
+
+func NewMigrator(set string) (*Migrator, error) {
+	table, ok := migrationTables[set]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMigrationSet, set)
+	}
+
+	list, err := loadMigrations(migrations.FS, set)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Migrator{
+		db:         db,
+		table:      table,
+		migrations: list,
+	}
+
+	if err := m.createTable(); err != nil {
+		return nil, err
+	}
+
+	if set == SeedSet {
+		if m.schema, err = NewMigrator(SchemaSet); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Applies all pending migrations
+func (m *Migrator) Up() ([]Migration, error) {
+	if len(m.migrations) == 0 {
+		return nil, nil
+	}
+	return m.To(m.migrations[len(m.migrations)-1].Version)
+}
+
+// Rolls back the last applied migration
+func (m *Migrator) Down() ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	current := m.current(applied)
+	if current == 0 {
+		return nil, ErrNoAppliedMigrations
+	}
+
+	// Version preceding the current one
+	target := 0
+	for _, migration := range m.migrations {
+		if migration.Version < current {
+			target = migration.Version
+		}
+	}
+	return m.To(target)
+}
+
+// Applies or rolls back migrations until the provided version is the last applied one, 0 rolls back everything
+func (m *Migrator) To(version int) ([]Migration, error) {
+	if version != 0 && m.find(version) == -1 {
+		return nil, fmt.Errorf("%w: %d", ErrMigrationNotExists, version)
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+
+	// Roll back newer migrations, the newest first
+	for idx := len(m.migrations) - 1; idx >= 0; idx-- {
+		migration := m.migrations[idx]
+		if _, isApplied := applied[migration.Version]; !isApplied || migration.Version <= version {
+			continue
+		}
+		if err := m.run(migration, false); err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+
+	// Apply pending migrations, the oldest first
+	for _, migration := range m.migrations {
+		if _, isApplied := applied[migration.Version]; isApplied || migration.Version > version {
+			continue
+		}
+		if m.schema != nil {
+			schemaDone, err := m.schema.prepareSeed(migration)
+			done = append(done, schemaDone...)
+			if err != nil {
+				return done, err
+			}
+		}
+		if err := m.run(migration, true); err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Records migrations up to the provided version as applied without running them,
+// used for databases created before the migrations were tracked
+func (m *Migrator) Baseline(version int) ([]Migration, error) {
+	if m.find(version) == -1 {
+		return nil, fmt.Errorf("%w: %d", ErrMigrationNotExists, version)
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range m.migrations {
+		if _, isApplied := applied[migration.Version]; isApplied || migration.Version > version {
+			continue
+		}
+
+		query := fmt.Sprintf(`INSERT INTO %s(version, name, checksum) VALUES ($1, $2, $3)`, m.table)
+		if _, err := m.db.Exec(query, migration.Version, migration.Name, migration.Checksum); err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Brings the schema to the version the seed was written for, the last schema version below the seed's one.
+// The schema migrations after it then convert the mock data like the real data.
+// A schema newer than that is not rolled back, the seed is refused
+func (m *Migrator) prepareSeed(seed Migration) ([]Migration, error) {
+	target := 0
+	for _, migration := range m.migrations {
+		if migration.Version < seed.Version {
+			target = migration.Version
+		}
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	current := m.current(applied)
+	if current > target {
+		return nil, fmt.Errorf("%w: %03d_%s needs schema version %d, the database is at %d", ErrSeedSchemaVersion, seed.Version, seed.Name, target, current)
+	} else if current == target {
+		return nil, nil
+	}
+	return m.To(target)
+}
+
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		appliedAt, isApplied := applied[migration.Version]
+		statuses = append(statuses, MigrationStatus{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			AppliedAt: appliedAt,
+			Applied:   isApplied,
+		})
+	}
+	return statuses, nil
+}
+
+func (m *Migrator) createTable() error {
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s(
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`, m.table)
+	_, err := m.db.Exec(query)
+	return err
+}
+
+// Returns applied versions with their time of applying,
+// fails if any applied migration was modified or removed afterwards
+func (m *Migrator) applied() (map[int]time.Time, error) {
+	query := fmt.Sprintf(`SELECT version, checksum, applied_at FROM %s ORDER BY version`, m.table)
+	rows, err := m.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			version   int
+			checksum  string
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &checksum, &appliedAt); err != nil {
+			return nil, err
+		}
+
+		idx := m.find(version)
+		if idx == -1 {
+			return nil, fmt.Errorf("applied migration %d is absent in the binary", version)
+		} else if m.migrations[idx].Checksum != checksum {
+			return nil, fmt.Errorf("checksum mismatch of applied migration %d_%s, the file was modified after applying", version, m.migrations[idx].Name)
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// Runs up or down part of migration and records it in single transaction
+func (m *Migrator) run(migration Migration, up bool) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var (
+		script      string
+		recordQuery string
+		args        []interface{}
+	)
+	if up {
+		script = migration.Up
+		recordQuery = fmt.Sprintf(`INSERT INTO %s(version, name, checksum) VALUES ($1, $2, $3)`, m.table)
+		args = []interface{}{migration.Version, migration.Name, migration.Checksum}
+	} else {
+		script = migration.Down
+		recordQuery = fmt.Sprintf(`DELETE FROM %s WHERE version = $1`, m.table)
+		args = []interface{}{migration.Version}
+	}
+
+	if _, err := tx.Exec(script); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+
+	if _, err := tx.Exec(recordQuery, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Version of the last applied migration, 0 if nothing applied
+func (m *Migrator) current(applied map[int]time.Time) int {
+	current := 0
+	for version := range applied {
+		if version > current {
+			current = version
+		}
+	}
+	return current
+}
+
+func (m *Migrator) find(version int) int {
+	for idx, migration := range m.migrations {
+		if migration.Version == version {
+			return idx
+		}
+	}
+	return -1
+}
+
+// Reads migrations of the directory sorted by version
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("different names of migration %d: %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+			sum := sha256.Sum256(content)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	list := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("%w: %d_%s", ErrMigrationFileNotPaired, migration.Version, migration.Name)
+		}
+		list = append(list, *migration)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+	return list, nil
+}
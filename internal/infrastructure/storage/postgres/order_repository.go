@@ -1,6 +1,7 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"hot-coffee/internal/core/entities"
@@ -21,12 +22,6 @@ var (
 	ErrIncorrectMenuItem = errors.New("incorrect menu item fetched, it's absent in menu item count struct")
 )
 
-// Constants
-const (
-	deduct = false
-	add    = true
-)
-
 type orderRepository struct {
 	db *sql.DB
 }
@@ -51,22 +46,9 @@ func NewOrderRepository() *orderRepository {
 	return orderRepositoryInstance
 }
 
-func (r *orderRepository) Create(order entities.Order) (int64, error) {
-	// Begin the transaction
-	tx, err := r.db.Begin()
-	if err != nil {
-		return 0, fmt.Errorf("failed to start transaction: %w", err)
-	}
-
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
-
+func (r *orderRepository) Create(ctx context.Context, order entities.Order) (int64, error) {
 	var (
 		insertOrderQuery string
-		row              *sql.Row
 		args             []interface{}
 	)
 
@@ -74,80 +56,74 @@ func (r *orderRepository) Create(order entities.Order) (int64, error) {
 		// Convert string ID to int64
 		orderIDInt, convErr := strconv.ParseInt(order.ID, 10, 64)
 		if convErr != nil {
-			tx.Rollback()
 			return -1, fmt.Errorf("invalid order ID: %w", convErr)
 		}
 
 		insertOrderQuery = `
-			INSERT INTO orders(order_id, customer_id, status)
-			VALUES ($1, $2, $3)
+			INSERT INTO orders(customer_id, status, subtotal, discount_total, tax, service_charge, tip, grand_total, pickup_at, estimated_ready_at, order_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 			RETURNING order_id
 		`
-		args = []interface{}{orderIDInt, order.CustomerID, order.Status}
-		row = tx.QueryRow(insertOrderQuery, args...)
+		args = append(orderArgs(order), order.EstimatedReadyAt, orderIDInt)
 	} else {
 		insertOrderQuery = `
-			INSERT INTO orders(customer_id, status)
-			VALUES ($1, $2)
+			INSERT INTO orders(customer_id, status, subtotal, discount_total, tax, service_charge, tip, grand_total, pickup_at, estimated_ready_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 			RETURNING order_id
 		`
-		args = []interface{}{order.CustomerID, order.Status}
-		row = tx.QueryRow(insertOrderQuery, args...)
+		args = append(orderArgs(order), order.EstimatedReadyAt)
 	}
 
 	var orderID int64
-	err = row.Scan(&orderID)
-	if err != nil {
-		tx.Rollback()
-		if pqErr, ok := err.(*pq.Error); ok {
-			if pqErr.Code == "23505" { // unique_violation
-				return -1, errors.ErrIDAlreadyExists
-			}
-		}
-		return -1, fmt.Errorf("failed to scan order ID from row: %w", err)
-	}
-
-	// Insert order items
-	insertOrderItemQuery := `
-		INSERT INTO order_items(menu_item_id, order_id, quantity, customization_info)
-		VALUES ($1, $2, $3, $4)
-	`
-	for _, item := range order.Items {
-		_, err = tx.Exec(insertOrderItemQuery, item.ProductID, orderID, item.Quantity, item.CustomizationInfo)
+	err := runInTx(ctx, r.db, func(ctx context.Context) error {
+		err := conn(ctx, r.db).QueryRowContext(ctx, insertOrderQuery, args...).Scan(&orderID)
 		if err != nil {
-			tx.Rollback()
-			return -1, fmt.Errorf("failed to insert order item: %w", err)
+			if pqErr, ok := err.(*pq.Error); ok {
+				if pqErr.Code == "23505" { // unique_violation
+					return errors.ErrIDAlreadyExists
+				}
+			}
+			return fmt.Errorf("failed to scan order ID from row: %w", err)
 		}
-	}
-
-	// Deduct inventory
-	err = inventoryRepositoryInstance.deductOrAddOrderItemsIngredients(tx, orderID, deduct)
-	if err != nil {
-		tx.Rollback()
-		return -1, fmt.Errorf("failed to deduct order items ingredients: %w", err)
-	}
 
-	err = tx.Commit()
+		return r.insertItems(ctx, orderID, order.Items)
+	})
 	if err != nil {
-		tx.Rollback()
-		return -1, fmt.Errorf("failed to commit transaction after order creation: %w", err)
+		return -1, err
 	}
 
 	return orderID, nil
 }
 
-func (r *orderRepository) GetAll() ([]entities.Order, error) {
+// Arguments of the order columns from customer_id to pickup_at
+func orderArgs(order entities.Order) []interface{} {
+	return []interface{}{
+		order.CustomerID, order.Status,
+		order.Subtotal, order.DiscountTotal, order.Tax, order.ServiceCharge, order.Tip, order.GrandTotal,
+		order.PickupAt,
+	}
+}
+
+// Order columns read by GetAll, GetFiltered and GetById in the order they are scanned
+const orderColumns = `
+		o.order_id, o.customer_id, c.fullname, o.status, o.created_at, o.pickup_at, o.estimated_ready_at, o.version,
+		o.subtotal, o.discount_total, o.tax, o.service_charge, o.tip, o.grand_total`
+
+// Every order has a customer, anonymized ones included
+const orderCustomerJoin = `
+	JOIN customers c ON c.customer_id = o.customer_id`
+
+func (r *orderRepository) GetAll(ctx context.Context) ([]entities.Order, error) {
 	query := `
-	SELECT 	
-		o.order_id, c.fullname, o.status, o.created_at,
-		oi.menu_item_id, oi.quantity, oi.customization_info
+	SELECT` + orderColumns + `,
+		oi.menu_item_id, oi.quantity, oi.customization_info, oi.unit_price, oi.unit_cost, oi.tax_rate, oi.modifier_ids
 	FROM
 		orders o
-	LEFT JOIN order_items oi USING(order_id)
-	JOIN customers c USING(customer_id)
+	LEFT JOIN order_items oi USING(order_id)` + orderCustomerJoin + `
+	ORDER BY o.order_id
 	`
 
-	rows, err := r.db.Query(query)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -159,15 +135,26 @@ func (r *orderRepository) GetAll() ([]entities.Order, error) {
 	for rows.Next() {
 		var (
 			orderItemID       string
-			customerID        string
+			customerID        int64
+			customerName      string
 			status            string
-			createdAt         string
+			createdAt         time.Time
+			pickupAt          sql.NullTime
+			estimatedReadyAt  sql.NullTime
+			version           int64
 			menuItemIDString  sql.NullString
 			quantity          sql.NullFloat64
 			customizationInfo sql.NullString
+			unitPrice         sql.NullFloat64
+			unitCost          sql.NullFloat64
+			taxRate           sql.NullFloat64
+			modifierIDs       pq.Int64Array
+			amounts           entities.Order
 		)
 
-		if err := rows.Scan(&orderItemID, &customerID, &status, &createdAt, &menuItemIDString, &quantity, &customizationInfo); err != nil {
+		if err := rows.Scan(&orderItemID, &customerID, &customerName, &status, &createdAt, &pickupAt, &estimatedReadyAt, &version,
+			&amounts.Subtotal, &amounts.DiscountTotal, &amounts.Tax, &amounts.ServiceCharge, &amounts.Tip, &amounts.GrandTotal,
+			&menuItemIDString, &quantity, &customizationInfo, &unitPrice, &unitCost, &taxRate, &modifierIDs); err != nil {
 			return nil, err
 		}
 
@@ -178,11 +165,17 @@ func (r *orderRepository) GetAll() ([]entities.Order, error) {
 
 			currentItem = &entities.Order{
 				ID:           orderItemID,
-				CustomerName: customerID,
+				CustomerID:   customerID,
+				CustomerName: customerName,
 				Items:        []entities.OrderItem{},
 				Status:       status,
-				CreatedAt:    createdAt,
+				CreatedAt:    createdAt.Format(time.RFC3339Nano),
+				PickupAt:     timePointer(pickupAt),
+				Version:      version,
+
+				EstimatedReadyAt: timePointer(estimatedReadyAt),
 			}
+			currentItem.SetAmounts(amounts)
 		}
 
 		menuItemID, _ := strconv.Atoi(menuItemIDString.String)
@@ -192,6 +185,10 @@ func (r *orderRepository) GetAll() ([]entities.Order, error) {
 				ProductID:         menuItemID,
 				Quantity:          int(quantity.Float64),
 				CustomizationInfo: customizationInfo.String,
+				UnitPrice:         unitPrice.Float64,
+				UnitCost:          unitCost.Float64,
+				TaxRate:           taxRate.Float64,
+				ModifierIDs:       modifierIDs,
 			})
 		}
 	}
@@ -208,10 +205,193 @@ func (r *orderRepository) GetAll() ([]entities.Order, error) {
 		return nil, sql.ErrNoRows
 	}
 
+	if err := r.attachDiscounts(ctx, orderItems); err != nil {
+		return nil, err
+	}
+
 	return orderItems, nil
 }
 
-func (r *orderRepository) GetById(idStr string) (entities.Order, error) {
+// Filtering, sorting and keyset pagination are done by the database,
+// only the items of the returned orders are fetched
+func (r *orderRepository) GetFiltered(ctx context.Context, filter entities.OrderFilter) (entities.OrdersPage, error) {
+	page := entities.OrdersPage{Orders: []entities.Order{}}
+
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	addCondition := func(condition string, values ...interface{}) {
+		for _, value := range values {
+			args = append(args, value)
+			condition = strings.Replace(condition, "?", "$"+strconv.Itoa(len(args)), 1)
+		}
+		conditions = append(conditions, condition)
+	}
+
+	if filter.Status != "" {
+		addCondition("o.status = ?", filter.Status)
+	}
+	if len(filter.Statuses) != 0 {
+		addCondition("o.status::text = ANY(?)", pq.Array(filter.Statuses))
+	}
+	if !filter.PickupTo.IsZero() {
+		addCondition("o.pickup_at <= ?", filter.PickupTo)
+	}
+	if filter.Customer != "" {
+		addCondition("c.fullname ILIKE '%' || ? || '%'", filter.Customer)
+	}
+	if filter.CustomerID != 0 {
+		addCondition("o.customer_id = ?", filter.CustomerID)
+	}
+	if !filter.CreatedFrom.IsZero() {
+		addCondition("o.created_at >= ?", filter.CreatedFrom)
+	}
+	if !filter.CreatedTo.IsZero() {
+		addCondition("o.created_at < ?", filter.CreatedTo)
+	}
+	if filter.MenuItemID != 0 {
+		addCondition("EXISTS (SELECT 1 FROM order_items i WHERE i.order_id = o.order_id AND i.menu_item_id = ?)", filter.MenuItemID)
+	}
+	if filter.MinTotal != 0 {
+		addCondition("o.grand_total >= ?", filter.MinTotal)
+	}
+	if filter.MaxTotal != 0 {
+		addCondition("o.grand_total <= ?", filter.MaxTotal)
+	}
+
+	sortColumn := "o.created_at"
+	switch filter.SortBy {
+	case entities.OrderSortTotal:
+		sortColumn = "o.grand_total"
+	case entities.OrderSortID:
+		sortColumn = ""
+	}
+	direction, comparison := "ASC", ">"
+	if filter.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	if cursor := filter.After; cursor != nil {
+		switch sortColumn {
+		case "o.created_at":
+			addCondition("(o.created_at, o.order_id) "+comparison+" (?, ?)", cursor.CreatedAt, cursor.OrderID)
+		case "o.grand_total":
+			addCondition("(o.grand_total, o.order_id) "+comparison+" (?, ?)", cursor.Total, cursor.OrderID)
+		default:
+			addCondition("o.order_id "+comparison+" ?", cursor.OrderID)
+		}
+	}
+
+	query := `
+	SELECT` + orderColumns + `
+	FROM
+		orders o` + orderCustomerJoin + `
+	`
+	if len(conditions) > 0 {
+		query += "WHERE " + strings.Join(conditions, " AND ") + "\n"
+	}
+	if sortColumn != "" {
+		query += "ORDER BY " + sortColumn + " " + direction + ", o.order_id " + direction + "\n"
+	} else {
+		query += "ORDER BY o.order_id " + direction + "\n"
+	}
+	// One more order tells whether the next page exists
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit+1)
+		query += "LIMIT $" + strconv.Itoa(len(args))
+	}
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	var (
+		orderIDs  []int64
+		createdAt []time.Time
+	)
+	for rows.Next() {
+		var (
+			order    entities.Order
+			orderID  int64
+			created  time.Time
+			pickupAt sql.NullTime
+			readyAt  sql.NullTime
+		)
+		if err := rows.Scan(&orderID, &order.CustomerID, &order.CustomerName, &order.Status, &created, &pickupAt, &readyAt, &order.Version,
+			&order.Subtotal, &order.DiscountTotal, &order.Tax, &order.ServiceCharge, &order.Tip, &order.GrandTotal); err != nil {
+			return page, err
+		}
+		order.ID = strconv.FormatInt(orderID, 10)
+		order.CreatedAt = created.Format(time.RFC3339Nano)
+		order.PickupAt = timePointer(pickupAt)
+		order.EstimatedReadyAt = timePointer(readyAt)
+		order.Items = []entities.OrderItem{}
+
+		page.Orders = append(page.Orders, order)
+		orderIDs = append(orderIDs, orderID)
+		createdAt = append(createdAt, created)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	if filter.Limit > 0 && len(page.Orders) > filter.Limit {
+		page.Orders = page.Orders[:filter.Limit]
+		orderIDs = orderIDs[:filter.Limit]
+
+		last := len(page.Orders) - 1
+		page.Next = &entities.OrderCursor{
+			SortBy:    filter.SortBy,
+			CreatedAt: createdAt[last],
+			Total:     page.Orders[last].GrandTotal,
+			OrderID:   orderIDs[last],
+		}
+	}
+
+	if len(orderIDs) == 0 {
+		return page, nil
+	}
+
+	itemsQuery := `
+	SELECT order_id, menu_item_id, quantity, customization_info, unit_price, unit_cost, tax_rate, modifier_ids
+	FROM order_items
+	WHERE order_id = ANY($1)
+	`
+	itemRows, err := conn(ctx, r.db).QueryContext(ctx, itemsQuery, pq.Array(orderIDs))
+	if err != nil {
+		return page, err
+	}
+	defer itemRows.Close()
+
+	orderIndex := make(map[int64]int, len(orderIDs))
+	for idx, orderID := range orderIDs {
+		orderIndex[orderID] = idx
+	}
+	for itemRows.Next() {
+		var (
+			orderID  int64
+			item     entities.OrderItem
+			quantity float64
+		)
+		if err := itemRows.Scan(&orderID, &item.ProductID, &quantity, &item.CustomizationInfo, &item.UnitPrice, &item.UnitCost, &item.TaxRate, (*pq.Int64Array)(&item.ModifierIDs)); err != nil {
+			return page, err
+		}
+		item.Quantity = int(quantity)
+
+		idx := orderIndex[orderID]
+		page.Orders[idx].Items = append(page.Orders[idx].Items, item)
+	}
+	if err := itemRows.Err(); err != nil {
+		return page, err
+	}
+
+	return page, r.attachDiscounts(ctx, page.Orders)
+}
+
+func (r *orderRepository) GetById(ctx context.Context, idStr string) (entities.Order, error) {
 	// Parse the ID as an integer
 	id, err := strconv.Atoi(idStr)
 	var order entities.Order
@@ -221,19 +401,18 @@ func (r *orderRepository) GetById(idStr string) (entities.Order, error) {
 	}
 
 	query := `
-	SELECT 	
-		o.order_id, o.customer_id, o.status, o.created_at,
-		oi.menu_item_id, oi.quantity, oi.customization_info
+	SELECT` + orderColumns + `,
+		oi.menu_item_id, oi.quantity, oi.customization_info, oi.unit_price, oi.unit_cost, oi.tax_rate, oi.modifier_ids
 	FROM
 		orders o
 	LEFT JOIN
 		order_items oi
 	ON 
-		o.order_id = oi.order_id
+		o.order_id = oi.order_id` + orderCustomerJoin + `
 	WHERE o.order_id = $1
 	`
 
-	rows, err := r.db.Query(query, id)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, id)
 	if err != nil {
 		return order, err
 	}
@@ -244,22 +423,38 @@ func (r *orderRepository) GetById(idStr string) (entities.Order, error) {
 		var (
 			orderItemID       string
 			customerID        int64
+			customerName      string
 			status            string
-			createdAt         string
+			createdAt         time.Time
+			pickupAt          sql.NullTime
+			estimatedReadyAt  sql.NullTime
+			version           int64
 			menuItemID        sql.NullString
 			quantity          sql.NullFloat64
 			customizationInfo sql.NullString
+			unitPrice         sql.NullFloat64
+			unitCost          sql.NullFloat64
+			taxRate           sql.NullFloat64
+			modifierIDs       pq.Int64Array
+			amounts           entities.Order
 		)
 
-		if err := rows.Scan(&orderItemID, &customerID, &status, &createdAt, &menuItemID, &quantity, &customizationInfo); err != nil {
+		if err := rows.Scan(&orderItemID, &customerID, &customerName, &status, &createdAt, &pickupAt, &estimatedReadyAt, &version,
+			&amounts.Subtotal, &amounts.DiscountTotal, &amounts.Tax, &amounts.ServiceCharge, &amounts.Tip, &amounts.GrandTotal,
+			&menuItemID, &quantity, &customizationInfo, &unitPrice, &unitCost, &taxRate, &modifierIDs); err != nil {
 			return order, err
 		}
 
 		if order.ID == "" {
 			order.ID = orderItemID
 			order.CustomerID = customerID
+			order.CustomerName = customerName
 			order.Status = status
-			order.CreatedAt = createdAt
+			order.CreatedAt = createdAt.Format(time.RFC3339Nano)
+			order.PickupAt = timePointer(pickupAt)
+			order.EstimatedReadyAt = timePointer(estimatedReadyAt)
+			order.Version = version
+			order.SetAmounts(amounts)
 		}
 
 		menuItemIDInteger, _ := strconv.Atoi(menuItemID.String)
@@ -269,6 +464,10 @@ func (r *orderRepository) GetById(idStr string) (entities.Order, error) {
 				ProductID:         menuItemIDInteger,
 				Quantity:          int(quantity.Float64),
 				CustomizationInfo: customizationInfo.String,
+				UnitPrice:         unitPrice.Float64,
+				UnitCost:          unitCost.Float64,
+				TaxRate:           taxRate.Float64,
+				ModifierIDs:       modifierIDs,
 			})
 		}
 	}
@@ -281,35 +480,96 @@ func (r *orderRepository) GetById(idStr string) (entities.Order, error) {
 	if order.ID == "" {
 		return order, sql.ErrNoRows
 	}
-	return order, nil
+
+	orders := []entities.Order{order}
+	if err := r.attachDiscounts(ctx, orders); err != nil {
+		return order, err
+	}
+	return orders[0], nil
+}
+
+// Fills the discounts applied to the orders
+func (r *orderRepository) attachDiscounts(ctx context.Context, orders []entities.Order) error {
+	orderIndex := make(map[int64]int, len(orders))
+	orderIDs := make([]int64, 0, len(orders))
+	for idx, order := range orders {
+		orderID, _ := strconv.ParseInt(order.ID, 10, 64)
+		orderIndex[orderID] = idx
+		orderIDs = append(orderIDs, orderID)
+	}
+
+	query := `
+	SELECT order_id, COALESCE(promotion_id, 0), name, amount, points
+	FROM order_discounts
+	WHERE order_id = ANY($1)
+	`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, pq.Array(orderIDs))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			orderID  int64
+			discount entities.AppliedDiscount
+		)
+		if err := rows.Scan(&orderID, &discount.PromotionID, &discount.Name, &discount.Amount, &discount.Points); err != nil {
+			return err
+		}
+		idx := orderIndex[orderID]
+		orders[idx].Discounts = append(orders[idx].Discounts, discount)
+	}
+	return rows.Err()
+}
+
+func (r *orderRepository) SetOrderDiscounts(ctx context.Context, id int64, discounts []entities.AppliedDiscount) error {
+	return runInTx(ctx, r.db, func(ctx context.Context) error {
+		if _, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM order_discounts WHERE order_id = $1`, id); err != nil {
+			return err
+		}
+
+		query := `
+		INSERT INTO order_discounts(order_id, promotion_id, name, amount, points)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5)
+		`
+		for _, discount := range discounts {
+			if _, err := conn(ctx, r.db).ExecContext(ctx, query, id, discount.PromotionID, discount.Name, discount.Amount, discount.Points); err != nil {
+				return fmt.Errorf("failed to insert order discount: %w", err)
+			}
+		}
+		return nil
+	})
 }
 
-func (r *orderRepository) GetOrderRevenue(orderID int64) (totalOrderRevenue float64, err error) {
+func (r *orderRepository) GetOrderRevenue(ctx context.Context, orderID int64) (totalOrderRevenue float64, err error) {
 	// Common table expression query
 	query := `
 		WITH payment AS (
- 	   		SELECT SUM(mi.price * oi.quantity) AS paymentSum
+ 	   		SELECT COALESCE(SUM(oi.unit_price * oi.quantity), 0) AS paymentSum
  	   		FROM order_items oi
- 	   		JOIN menu_items mi USING(menu_item_id)
  	   		WHERE oi.order_id = $1
 		),
 		first_cost AS (
-		    SELECT SUM(oi.quantity * mii.quantity * i.price) AS firstCost
+		    SELECT COALESCE(SUM(oi.unit_cost * oi.quantity), 0) AS firstCost
 		    FROM order_items oi 
-		    JOIN menu_items_ingredients mii USING(menu_item_id)
-		    JOIN inventory i USING(inventory_item_id)
 		    WHERE oi.order_id = $1
+		),
+		discount AS (
+		    SELECT COALESCE(SUM(od.amount), 0) AS discountSum
+		    FROM order_discounts od
+		    WHERE od.order_id = $1
 		)
-		SELECT p.paymentSum AS total_revenue
-		FROM payment p, first_cost fc
+		SELECT p.paymentSum - d.discountSum AS total_revenue
+		FROM payment p, first_cost fc, discount d
 	`
 
-	err = r.db.QueryRow(query, orderID).Scan(&totalOrderRevenue)
+	err = conn(ctx, r.db).QueryRowContext(ctx, query, orderID).Scan(&totalOrderRevenue)
 	return totalOrderRevenue, err
 
 }
 
-func (r *orderRepository) Update(idStr string, order entities.Order) error {
+func (r *orderRepository) Update(ctx context.Context, idStr string, order entities.Order) error {
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
 		return ErrNonNumericID
@@ -317,63 +577,65 @@ func (r *orderRepository) Update(idStr string, order entities.Order) error {
 
 	query := `
 		UPDATE orders
-		SET customer_id = $1, status = $2
-		WHERE order_id = $3
+		SET customer_id = $1, status = $2,
+			subtotal = $3, discount_total = $4, tax = $5, service_charge = $6, tip = $7, grand_total = $8,
+			pickup_at = $9, version = version + 1
+		WHERE order_id = $10 AND ($11 = 0 OR version = $11)
 	`
-	tx, err := r.db.Begin()
-	if err != nil {
-		return err
-	}
+	return runInTx(ctx, r.db, func(ctx context.Context) error {
+		res, err := conn(ctx, r.db).ExecContext(ctx, query, append(orderArgs(order), id, order.Version)...)
+		if err != nil {
+			return err
+		}
 
-	// Add ingredients back
-	err = inventoryRepositoryInstance.deductOrAddOrderItemsIngredients(tx, int64(id), add)
-	if err != nil {
-		return err
-	}
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("could not get affected rows: %w", err)
+		}
 
-	_, err = tx.Exec(query, order.CustomerID, order.Status, id)
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
+		if rowsAffected == 0 {
+			return versionMismatchOrNoRows(ctx, r.db, "orders", "order_id", id)
+		}
 
-	deleteItemsQuery := `
+		deleteItemsQuery := `
 		DELETE FROM order_items WHERE order_id = $1
 	`
-	_, err = tx.Exec(deleteItemsQuery, id)
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
-
-	orderItemsQuery := `
-		INSERT INTO order_items(menu_item_id, order_id, quantity, customization_info)
-		VALUES ($1, $2, $3, $4)
-	`
-	for _, item := range order.Items {
-		_, err = tx.Exec(orderItemsQuery, item.ProductID, id, item.Quantity, item.CustomizationInfo)
+		_, err = conn(ctx, r.db).ExecContext(ctx, deleteItemsQuery, id)
 		if err != nil {
-			tx.Rollback()
 			return err
 		}
-	}
 
-	// Deduct new ingredients
-	err = inventoryRepositoryInstance.deductOrAddOrderItemsIngredients(tx, int64(id), deduct)
-	if err != nil {
-		return err
-	}
+		return r.insertItems(ctx, int64(id), order.Items)
+	})
+}
 
-	err = tx.Commit()
-	if err != nil {
-		tx.Rollback()
-		return err
+// Pointer to the valid time, nil for NULL
+func timePointer(value sql.NullTime) *time.Time {
+	if !value.Valid {
+		return nil
 	}
+	return &value.Time
+}
 
+func (r *orderRepository) insertItems(ctx context.Context, orderID int64, items []entities.OrderItem) error {
+	insertOrderItemQuery := `
+		INSERT INTO order_items(menu_item_id, order_id, quantity, customization_info, unit_price, unit_cost, tax_rate, modifier_ids)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	for _, item := range items {
+		modifierIDs := pq.Int64Array(item.ModifierIDs)
+		if modifierIDs == nil {
+			modifierIDs = pq.Int64Array{}
+		}
+		_, err := conn(ctx, r.db).ExecContext(ctx, insertOrderItemQuery, item.ProductID, orderID, item.Quantity, item.CustomizationInfo, item.UnitPrice, item.UnitCost, item.TaxRate, modifierIDs)
+		if err != nil {
+			return fmt.Errorf("failed to insert order item: %w", err)
+		}
+	}
 	return nil
 }
 
-func (r *orderRepository) Delete(idStr string) error {
+func (r *orderRepository) Delete(ctx context.Context, idStr string) error {
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
 		return ErrNonNumericID
@@ -382,7 +644,7 @@ func (r *orderRepository) Delete(idStr string) error {
 	deleteOrderQuery := `
 		DELETE FROM orders WHERE order_id = $1
 	`
-	res, err := r.db.Exec(deleteOrderQuery, id)
+	res, err := conn(ctx, r.db).ExecContext(ctx, deleteOrderQuery, id)
 	if err != nil {
 		return err
 	}
@@ -399,7 +661,7 @@ func (r *orderRepository) Delete(idStr string) error {
 	return nil
 }
 
-func (r *orderRepository) GetOrderedItemsCountByPeriod(period, month string, year int) (map[string]int, error) {
+func (r *orderRepository) GetOrderedItemsCountByPeriod(ctx context.Context, period, month string, year int) (map[string]int, error) {
 	var query string
 	var args []interface{}
 	var orderedItemsCount map[string]int = make(map[string]int)
@@ -449,7 +711,7 @@ func (r *orderRepository) GetOrderedItemsCountByPeriod(period, month string, yea
 	}
 
 	// Query the database
-	rows, err := r.db.Query(query, args...)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
 	if err != nil {
 		return orderedItemsCount, err
 	}
@@ -484,7 +746,7 @@ func (r *orderRepository) GetOrderedItemsCountByPeriod(period, month string, yea
 	return orderedItemsCount, nil
 }
 
-func (r *orderRepository) GetOrderedMenuItemsCountByPeriod(startDate, endDate time.Time) (entities.OrderedMenuItemsCount, error) {
+func (r *orderRepository) GetOrderedMenuItemsCountByPeriod(ctx context.Context, startDate, endDate time.Time) (entities.OrderedMenuItemsCount, error) {
 	menuItemsCount := entities.OrderedMenuItemsCount{}
 	var query string
 	var args []interface{}
@@ -542,7 +804,7 @@ func (r *orderRepository) GetOrderedMenuItemsCountByPeriod(startDate, endDate ti
 	}
 
 	// Query the database
-	rows, err := r.db.Query(query, args...)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
 	if err != nil {
 		return menuItemsCount, err
 	}
@@ -604,7 +866,7 @@ func (r *orderRepository) GetOrderedMenuItemsCountByPeriod(startDate, endDate ti
 	return menuItemsCount, nil
 }
 
-func (r *orderRepository) SetOrderStatusHistory(id int64, pastStatus, newStatus string) error {
+func (r *orderRepository) SetOrderStatusHistory(ctx context.Context, id int64, pastStatus, newStatus, reason string) error {
 
 	var query string
 	var args []interface{}
@@ -612,19 +874,19 @@ func (r *orderRepository) SetOrderStatusHistory(id int64, pastStatus, newStatus
 	// Insert NULL for past_status if it's the first status change
 	if pastStatus == "" {
 		query = `
-		INSERT INTO order_status_history(order_id, new_status)
-		VALUES ($1, $2)
+		INSERT INTO order_status_history(order_id, new_status, reason)
+		VALUES ($1, $2, $3)
 		`
-		args = []interface{}{id, newStatus}
+		args = []interface{}{id, newStatus, reason}
 	} else {
 		query = `
-		INSERT INTO order_status_history(order_id, past_status, new_status)
-		VALUES ($1, $2, $3)
+		INSERT INTO order_status_history(order_id, past_status, new_status, reason)
+		VALUES ($1, $2, $3, $4)
 		`
-		args = []interface{}{id, pastStatus, newStatus}
+		args = []interface{}{id, pastStatus, newStatus, reason}
 	}
 
-	_, err := r.db.Exec(query, args...)
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, args...)
 	if err != nil {
 		return err
 	}
@@ -632,58 +894,152 @@ func (r *orderRepository) SetOrderStatusHistory(id int64, pastStatus, newStatus
 	return nil
 }
 
-func (r *orderRepository) GetCustomerIDByName(fullname string, phone string) (int64, error) {
-	var customer_id int64
-	var query string
-	var args []interface{}
-	switch {
-	case phone != "":
-		query = ` 
-		SELECT 
-			customer_id
-		FROM customers
-		WHERE fullname = $1 AND phone = $2
-		`
-		args = []interface{}{fullname, phone}
-	default:
-		query = ` 
-		SELECT 
-			customer_id
-		FROM customers
-		WHERE fullname = $1
-		`
-		args = []interface{}{fullname}
+func (r *orderRepository) UpdateStatus(ctx context.Context, id int64, pastStatus, newStatus string) error {
+	query := `
+		UPDATE orders
+		SET status = $3, version = version + 1
+		WHERE order_id = $1 AND status = $2
+	`
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, id, pastStatus, newStatus)
+	if err != nil {
+		return err
 	}
 
-	row := r.db.QueryRow(query, args...)
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not get affected rows: %w", err)
+	}
 
-	err := row.Scan(&customer_id)
-	// Handle no existing customer
-	if err == sql.ErrNoRows {
-		insertQuery := `
-			INSERT INTO customers 
-				(fullname)
-			VALUES 
-				($1)
-			RETURNING customer_id
-		`
-		row := r.db.QueryRow(insertQuery, fullname)
-		if row.Err() != nil {
-			return 0, err
+	if rowsAffected == 0 {
+		return versionMismatchOrNoRows(ctx, r.db, "orders", "order_id", int(id))
+	}
+
+	return nil
+}
+
+func (r *orderRepository) GetOrderStatusHistory(ctx context.Context, id int64) ([]entities.OrderStatusChange, error) {
+	query := `
+		SELECT COALESCE(past_status, ''), new_status, reason, changed_at
+		FROM order_status_history
+		WHERE order_id = $1
+		ORDER BY changed_at
+	`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []entities.OrderStatusChange{}
+	for rows.Next() {
+		var change entities.OrderStatusChange
+		if err := rows.Scan(&change.PastStatus, &change.NewStatus, &change.Reason, &change.ChangedAt); err != nil {
+			return nil, err
 		}
+		history = append(history, change)
+	}
 
-		err = row.Scan(&customer_id)
-		if err != nil {
-			return 0, err
+	return history, rows.Err()
+}
+
+func (r *orderRepository) GetOrderCloseTimes(ctx context.Context, startDate, endDate time.Time) ([]entities.OrderCloseTime, error) {
+	query := `
+		SELECT opened.order_id, MIN(opened.changed_at), MAX(closed.changed_at)
+		FROM order_status_history opened
+		JOIN order_status_history closed USING(order_id)
+		WHERE opened.new_status = 'open' AND closed.new_status = 'closed'
+			AND ($1::timestamptz IS NULL OR closed.changed_at >= $1)
+			AND ($2::timestamptz IS NULL OR closed.changed_at < $2)
+		GROUP BY opened.order_id
+	`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, nullTime(startDate), nullTime(endDate))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var closeTimes []entities.OrderCloseTime
+	for rows.Next() {
+		var closeTime entities.OrderCloseTime
+		if err := rows.Scan(&closeTime.OrderID, &closeTime.OpenedAt, &closeTime.ClosedAt); err != nil {
+			return nil, err
 		}
+		closeTimes = append(closeTimes, closeTime)
+	}
 
-	} else if err != nil {
-		return 0, err
+	return closeTimes, rows.Err()
+}
+
+func (r *orderRepository) GetPreparationTimes(ctx context.Context, startDate, endDate time.Time) ([]entities.PreparationTime, error) {
+	query := `
+		SELECT order_id, menu_item_ids, opened_at, started_at, closed_at, estimated_ready_at
+		FROM (
+			SELECT
+				o.order_id,
+				o.estimated_ready_at,
+				ARRAY(SELECT DISTINCT oi.menu_item_id FROM order_items oi WHERE oi.order_id = o.order_id) AS menu_item_ids,
+				(SELECT MIN(h.changed_at) FROM order_status_history h WHERE h.order_id = o.order_id AND h.new_status = 'open') AS opened_at,
+				(SELECT MAX(h.changed_at) FROM order_status_history h WHERE h.order_id = o.order_id AND h.new_status = 'in progress') AS started_at,
+				(SELECT MAX(h.changed_at) FROM order_status_history h WHERE h.order_id = o.order_id AND h.new_status = 'closed') AS closed_at
+			FROM orders o
+			WHERE o.status = 'closed'
+		) preparations
+		WHERE opened_at IS NOT NULL AND closed_at IS NOT NULL
+			AND ($1::timestamptz IS NULL OR closed_at >= $1)
+			AND ($2::timestamptz IS NULL OR closed_at < $2)
+		ORDER BY closed_at
+	`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, nullTime(startDate), nullTime(endDate))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var preparations []entities.PreparationTime
+	for rows.Next() {
+		var (
+			preparation      entities.PreparationTime
+			menuItemIDs      pq.Int64Array
+			startedAt        sql.NullTime
+			estimatedReadyAt sql.NullTime
+		)
+		if err := rows.Scan(&preparation.OrderID, &menuItemIDs, &preparation.OpenedAt, &startedAt, &preparation.ClosedAt, &estimatedReadyAt); err != nil {
+			return nil, err
+		}
+		for _, menuItemID := range menuItemIDs {
+			preparation.MenuItemIDs = append(preparation.MenuItemIDs, int(menuItemID))
+		}
+		preparation.StartedAt = startedAt.Time
+		preparation.EstimatedReadyAt = timePointer(estimatedReadyAt)
+		preparations = append(preparations, preparation)
+	}
+
+	return preparations, rows.Err()
+}
+
+func (r *orderRepository) SetEstimatedReadyAt(ctx context.Context, id int64, readyAt time.Time) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE orders SET estimated_ready_at = $2 WHERE order_id = $1`, id, readyAt)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not get affected rows: %w", err)
 	}
-	return customer_id, nil
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
-func (r *orderRepository) GetOrdersFullTextSearchReport(q string, minPrice, maxPrice int) ([]entities.OrderReport, error) {
+// Zero time is passed as NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func (r *orderRepository) GetOrdersFullTextSearchReport(ctx context.Context, q string, minPrice, maxPrice int) ([]entities.OrderReport, error) {
 
 	query := `
 	SELECT 	
@@ -691,7 +1047,9 @@ func (r *orderRepository) GetOrdersFullTextSearchReport(q string, minPrice, maxP
 	ROUND(CAST(
 		ts_rank(setweight(to_tsvector(c.fullname || ' ' || string_agg(m.name, ' ')), 'A'), 
 		websearch_to_tsquery($1)) AS numeric), 2) AS relevance, 
-	sum(m.price) AS total
+	sum(oi.unit_price * oi.quantity) - (
+		SELECT COALESCE(SUM(od.amount), 0) FROM order_discounts od WHERE od.order_id = o.order_id
+	) AS total
 	FROM orders o
 	JOIN order_items oi USING(order_id)
 	JOIN customers c USING(customer_id)
@@ -701,7 +1059,7 @@ func (r *orderRepository) GetOrdersFullTextSearchReport(q string, minPrice, maxP
 	ORDER BY relevance DESC;
 	`
 
-	rows, err := r.db.Query(query, q)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, q)
 	if err != nil {
 		return nil, err
 	}
@@ -728,26 +1086,32 @@ func (r *orderRepository) GetOrdersFullTextSearchReport(q string, minPrice, maxP
 	return orders, nil
 }
 
-func (r *orderRepository) FetchInventoryUpdates(orderIDs []int64) (inventoryUpdates []vo.InventoryUpdate, err error) {
+func (r *orderRepository) FetchInventoryUpdates(ctx context.Context, orderIDs []int64) (inventoryUpdates []vo.InventoryUpdate, err error) {
+	// Rows written by the inventory service, so the modifiers are counted as they were reserved
 	query := `
 		SELECT 
 			i.inventory_item_id,
 			i.name,
-			SUM(mii.quantity * oi.quantity) AS quantity_used,
-			i.quantity AS remaining
-		FROM 
-			order_items oi
-		JOIN 
-			menu_items_ingredients mii ON oi.menu_item_id = mii.menu_item_id
+			SUM(u.quantity) AS quantity_used,
+			i.quantity - i.reserved AS remaining
+		FROM (
+			SELECT inventory_item_id, quantity
+			FROM inventory_reservations
+			WHERE order_id = ANY($1)
+			UNION ALL
+			SELECT inventory_item_id, -transaction_quantity
+			FROM inventory_transactions
+			WHERE order_id = ANY($1)
+		) u
 		JOIN 
-			inventory i ON mii.inventory_item_id = i.inventory_item_id
-		WHERE 
-			oi.order_id = ANY($1)
+			inventory i ON u.inventory_item_id = i.inventory_item_id
 		GROUP BY 
-			i.inventory_item_id, i.name, i.quantity;
+			i.inventory_item_id, i.name, i.quantity, i.reserved
+		ORDER BY
+			i.inventory_item_id;
 	`
 
-	rows, err := r.db.Query(query, pq.Array(orderIDs))
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, pq.Array(orderIDs))
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch inventory updates: %w", err)
 	}
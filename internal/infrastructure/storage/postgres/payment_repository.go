@@ -0,0 +1,132 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"hot-coffee/internal/core/entities"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type paymentRepository struct {
+	db *sql.DB
+}
+
+var paymentRepositoryInstance *paymentRepository
+
+func NewPaymentRepository() *paymentRepository {
+	if paymentRepositoryInstance != nil {
+		return paymentRepositoryInstance
+	}
+
+	db, err := openDB()
+	if err != nil {
+		slog.Error("Error while opening connection with PostgreSQL: ", "error:", err.Error())
+		os.Exit(1)
+	}
+
+	paymentRepositoryInstance = &paymentRepository{
+		db: db,
+	}
+
+	return paymentRepositoryInstance
+}
+
+func (r *paymentRepository) Create(ctx context.Context, payment entities.Payment) (int64, error) {
+	var paymentID int64
+	err := runInTx(ctx, r.db, func(ctx context.Context) error {
+		query := `
+			INSERT INTO payments (order_id, kind, tender, amount, reason)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING payment_id
+		`
+		err := conn(ctx, r.db).QueryRowContext(ctx, query,
+			payment.OrderID, payment.Kind, payment.Tender, payment.Amount, payment.Reason,
+		).Scan(&paymentID)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range payment.RestockedItems {
+			query := `
+				INSERT INTO refund_items (payment_id, menu_item_id, quantity, modifier_ids)
+				VALUES ($1, $2, $3, $4)
+			`
+			modifierIDs := pq.Int64Array(item.ModifierIDs)
+			if modifierIDs == nil {
+				modifierIDs = pq.Int64Array{}
+			}
+			if _, err := conn(ctx, r.db).ExecContext(ctx, query, paymentID, item.ProductID, item.Quantity, modifierIDs); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return paymentID, nil
+}
+
+func (r *paymentRepository) GetByOrderID(ctx context.Context, orderID int64) ([]entities.Payment, error) {
+	query := `
+		SELECT p.payment_id, p.kind, p.tender, p.amount, p.reason, p.created_at,
+			ri.menu_item_id, ri.quantity, ri.modifier_ids
+		FROM payments p
+		LEFT JOIN refund_items ri ON ri.payment_id = p.payment_id
+		WHERE p.order_id = $1
+		ORDER BY p.created_at, p.payment_id, ri.menu_item_id, ri.modifier_ids
+	`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := []entities.Payment{}
+	for rows.Next() {
+		var (
+			paymentID  int64
+			payment    entities.Payment
+			createdAt  time.Time
+			menuItemID sql.NullInt64
+			quantity   sql.NullInt64
+			modifiers  pq.Int64Array
+		)
+		err := rows.Scan(&paymentID, &payment.Kind, &payment.Tender, &payment.Amount, &payment.Reason, &createdAt,
+			&menuItemID, &quantity, &modifiers)
+		if err != nil {
+			return nil, err
+		}
+
+		// Refund with several restocked items spans several rows
+		payment.ID = strconv.FormatInt(paymentID, 10)
+		if len(payments) == 0 || payments[len(payments)-1].ID != payment.ID {
+			payment.OrderID = orderID
+			payment.CreatedAt = createdAt.Format(time.RFC3339)
+			payments = append(payments, payment)
+		}
+		if menuItemID.Valid {
+			last := &payments[len(payments)-1]
+			last.RestockedItems = append(last.RestockedItems, entities.OrderItem{
+				ProductID:   int(menuItemID.Int64),
+				Quantity:    int(quantity.Int64),
+				ModifierIDs: modifiers,
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+func (r *paymentRepository) LockOrder(ctx context.Context, orderID int64) error {
+	var id int64
+	query := `SELECT order_id FROM orders WHERE order_id = $1 FOR UPDATE`
+	return conn(ctx, r.db).QueryRowContext(ctx, query, orderID).Scan(&id)
+}
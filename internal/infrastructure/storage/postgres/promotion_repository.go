@@ -0,0 +1,280 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type promotionRepository struct {
+	db *sql.DB
+}
+
+var promotionRepositoryInstance *promotionRepository
+
+func NewPromotionRepository() *promotionRepository {
+	if promotionRepositoryInstance != nil {
+		return promotionRepositoryInstance
+	}
+
+	db, err := openDB()
+	if err != nil {
+		slog.Error("Error while opening connection with PostgreSQL: ", "error:", err.Error())
+		os.Exit(1)
+	}
+
+	promotionRepositoryInstance = &promotionRepository{
+		db: db,
+	}
+
+	return promotionRepositoryInstance
+}
+
+const promotionColumns = `
+	promotion_id, name, COALESCE(code, ''), COALESCE(menu_item_id, 0), min_quantity,
+	discount_type, discount_value, starts_at, ends_at,
+	COALESCE(to_char(daily_from, 'HH24:MI'), ''), COALESCE(to_char(daily_to, 'HH24:MI'), ''),
+	usage_limit, usage_count, disabled, version
+`
+
+func (r *promotionRepository) Create(ctx context.Context, promotion entities.Promotion) (int64, error) {
+	args := promotionArgs(promotion)
+
+	var query string
+	if promotion.ID != "" {
+		id, err := strconv.ParseInt(promotion.ID, 10, 64)
+		if err != nil {
+			return -1, ErrNonNumericID
+		}
+		query = `
+			INSERT INTO promotions (name, code, menu_item_id, min_quantity, discount_type, discount_value,
+				starts_at, ends_at, daily_from, daily_to, usage_limit, disabled, promotion_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			RETURNING promotion_id
+		`
+		args = append(args, id)
+	} else {
+		query = `
+			INSERT INTO promotions (name, code, menu_item_id, min_quantity, discount_type, discount_value,
+				starts_at, ends_at, daily_from, daily_to, usage_limit, disabled)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			RETURNING promotion_id
+		`
+	}
+
+	var promotionID int64
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, args...).Scan(&promotionID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			if pqErr.Code == "23505" { // unique_violation
+				return -1, errors.ErrIDAlreadyExists
+			}
+		}
+		return -1, err
+	}
+	return promotionID, nil
+}
+
+func (r *promotionRepository) GetAll(ctx context.Context) ([]entities.Promotion, error) {
+	query := `SELECT ` + promotionColumns + ` FROM promotions ORDER BY promotion_id`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var promotions []entities.Promotion
+	for rows.Next() {
+		promotion, err := scanPromotion(rows)
+		if err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, promotion)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(promotions) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return promotions, nil
+}
+
+func (r *promotionRepository) GetById(ctx context.Context, idStr string) (entities.Promotion, error) {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return entities.Promotion{}, ErrNonNumericID
+	}
+
+	query := `SELECT ` + promotionColumns + ` FROM promotions WHERE promotion_id = $1`
+	return scanPromotion(conn(ctx, r.db).QueryRowContext(ctx, query, id))
+}
+
+func (r *promotionRepository) Update(ctx context.Context, idStr string, promotion entities.Promotion) error {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	query := `
+		UPDATE promotions
+		SET
+			name = $1,
+			code = $2,
+			menu_item_id = $3,
+			min_quantity = $4,
+			discount_type = $5,
+			discount_value = $6,
+			starts_at = $7,
+			ends_at = $8,
+			daily_from = $9,
+			daily_to = $10,
+			usage_limit = $11,
+			disabled = $12,
+			version = version + 1
+		WHERE promotion_id = $13 AND ($14 = 0 OR version = $14)
+	`
+	args := append(promotionArgs(promotion), id, promotion.Version)
+
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, args...)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			if pqErr.Code == "23505" { // unique_violation
+				return errors.ErrIDAlreadyExists
+			} else if pqErr.Code == "23514" && pqErr.Constraint == "usage_within_limit" {
+				return errors.ErrUsageLimitReached
+			}
+		}
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return versionMismatchOrNoRows(ctx, r.db, "promotions", "promotion_id", id)
+	}
+	return nil
+}
+
+// Applied discounts keep the promotion name after deleting
+func (r *promotionRepository) Delete(ctx context.Context, idStr string) error {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM promotions WHERE promotion_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *promotionRepository) IncrementUsage(ctx context.Context, id int64) error {
+	query := `
+		UPDATE promotions
+		SET usage_count = usage_count + 1
+		WHERE promotion_id = $1 AND (usage_limit = 0 OR usage_count < usage_limit)
+	`
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return errors.ErrUsageLimitReached
+	}
+	return nil
+}
+
+func (r *promotionRepository) DecrementUsage(ctx context.Context, id int64) error {
+	query := `
+		UPDATE promotions
+		SET usage_count = usage_count - 1
+		WHERE promotion_id = $1 AND usage_count > 0
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, id)
+	return err
+}
+
+// Arguments of the promotion columns in the insert order, empty values are stored as NULL
+func promotionArgs(promotion entities.Promotion) []interface{} {
+	nullString := func(value string) sql.NullString {
+		return sql.NullString{String: value, Valid: value != ""}
+	}
+	nullTimestamp := func(value string) sql.NullTime {
+		t, err := time.Parse(time.RFC3339, value)
+		return sql.NullTime{Time: t, Valid: err == nil}
+	}
+
+	return []interface{}{
+		promotion.Name,
+		nullString(promotion.Code),
+		sql.NullInt64{Int64: int64(promotion.MenuItemID), Valid: promotion.MenuItemID != 0},
+		promotion.MinQuantity,
+		promotion.DiscountType,
+		promotion.DiscountValue,
+		nullTimestamp(promotion.StartsAt),
+		nullTimestamp(promotion.EndsAt),
+		nullString(promotion.DailyFrom),
+		nullString(promotion.DailyTo),
+		promotion.UsageLimit,
+		promotion.Disabled,
+	}
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPromotion(row rowScanner) (entities.Promotion, error) {
+	var (
+		promotion        entities.Promotion
+		startsAt, endsAt sql.NullTime
+	)
+
+	err := row.Scan(
+		&promotion.ID, &promotion.Name, &promotion.Code, &promotion.MenuItemID, &promotion.MinQuantity,
+		&promotion.DiscountType, &promotion.DiscountValue, &startsAt, &endsAt,
+		&promotion.DailyFrom, &promotion.DailyTo,
+		&promotion.UsageLimit, &promotion.UsageCount, &promotion.Disabled, &promotion.Version,
+	)
+	if err != nil {
+		return promotion, err
+	}
+
+	if startsAt.Valid {
+		promotion.StartsAt = startsAt.Time.Format(time.RFC3339)
+	}
+	if endsAt.Valid {
+		promotion.EndsAt = endsAt.Time.Format(time.RFC3339)
+	}
+	return promotion, nil
+}
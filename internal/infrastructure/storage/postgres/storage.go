@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"hot-coffee/internal/core/errors"
 	"hot-coffee/internal/repository"
 	"log/slog"
 	"os"
@@ -28,12 +29,35 @@ var postgresDB *sql.DB
 
 func NewRepository() *repository.Repository {
 	return &repository.Repository{
-		Inventory: NewInventoryRepository(),
-		Menu:      NewMenuRepository(),
-		Order:     NewOrderRepository(),
+		Inventory:   NewInventoryRepository(),
+		Menu:        NewMenuRepository(),
+		Order:       NewOrderRepository(),
+		Customer:    NewCustomerRepository(),
+		Loyalty:     NewLoyaltyRepository(),
+		Audit:       NewAuditRepository(),
+		Promotion:   NewPromotionRepository(),
+		Payment:     NewPaymentRepository(),
+		Idempotency: NewIdempotencyRepository(),
+		Webhook:     NewWebhookRepository(),
+		UnitOfWork:  NewUnitOfWork(),
 	}
 }
 
+// Explains why the versioned update affected no rows:
+// either the row does not exist or its version was changed by another request
+func versionMismatchOrNoRows(ctx context.Context, db *sql.DB, table, idColumn string, id int) error {
+	var exists bool
+	query := fmt.Sprintf(`SELECT EXISTS(SELECT 1 FROM %s WHERE %s = $1)`, table, idColumn)
+	if err := conn(ctx, db).QueryRowContext(ctx, query, id).Scan(&exists); err != nil {
+		return err
+	}
+
+	if !exists {
+		return sql.ErrNoRows
+	}
+	return errors.ErrVersionMismatch
+}
+
 func openDB() (*sql.DB, error) {
 
 	if postgresDB != nil {
@@ -0,0 +1,355 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type webhookRepository struct {
+	db *sql.DB
+}
+
+var webhookRepositoryInstance *webhookRepository
+
+func NewWebhookRepository() *webhookRepository {
+	if webhookRepositoryInstance != nil {
+		return webhookRepositoryInstance
+	}
+
+	db, err := openDB()
+	if err != nil {
+		slog.Error("Error while opening connection with PostgreSQL: ", "error:", err.Error())
+		os.Exit(1)
+	}
+
+	webhookRepositoryInstance = &webhookRepository{
+		db: db,
+	}
+
+	return webhookRepositoryInstance
+}
+
+const webhookColumns = `webhook_id, url, event_types, secret, disabled, version`
+
+const deliveryColumns = `
+	delivery_id, webhook_id, event_id, event_type, payload, status, attempts,
+	next_attempt_at, last_error, last_status_code, created_at, delivered_at
+`
+
+func (r *webhookRepository) Create(ctx context.Context, webhook entities.Webhook) (int64, error) {
+	args := []interface{}{webhook.URL, pq.Array(webhook.EventTypes), webhook.Secret, webhook.Disabled}
+
+	var query string
+	if webhook.ID != "" {
+		id, err := strconv.ParseInt(webhook.ID, 10, 64)
+		if err != nil {
+			return -1, ErrNonNumericID
+		}
+		query = `
+			INSERT INTO webhooks (url, event_types, secret, disabled, webhook_id)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING webhook_id
+		`
+		args = append(args, id)
+	} else {
+		query = `
+			INSERT INTO webhooks (url, event_types, secret, disabled)
+			VALUES ($1, $2, $3, $4)
+			RETURNING webhook_id
+		`
+	}
+
+	var webhookID int64
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, args...).Scan(&webhookID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			if pqErr.Code == "23505" { // unique_violation
+				return -1, errors.ErrIDAlreadyExists
+			}
+		}
+		return -1, err
+	}
+	return webhookID, nil
+}
+
+func (r *webhookRepository) GetAll(ctx context.Context) ([]entities.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks ORDER BY webhook_id`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []entities.Webhook
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(webhooks) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return webhooks, nil
+}
+
+func (r *webhookRepository) GetById(ctx context.Context, idStr string) (entities.Webhook, error) {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return entities.Webhook{}, ErrNonNumericID
+	}
+
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE webhook_id = $1`
+	return scanWebhook(conn(ctx, r.db).QueryRowContext(ctx, query, id))
+}
+
+func (r *webhookRepository) Update(ctx context.Context, idStr string, webhook entities.Webhook) error {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	query := `
+		UPDATE webhooks
+		SET
+			url = $1,
+			event_types = $2,
+			secret = $3,
+			disabled = $4,
+			version = version + 1
+		WHERE webhook_id = $5 AND ($6 = 0 OR version = $6)
+	`
+	args := []interface{}{webhook.URL, pq.Array(webhook.EventTypes), webhook.Secret, webhook.Disabled, id, webhook.Version}
+
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return versionMismatchOrNoRows(ctx, r.db, "webhooks", "webhook_id", id)
+	}
+	return nil
+}
+
+func (r *webhookRepository) Delete(ctx context.Context, idStr string) error {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return ErrNonNumericID
+	}
+
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM webhooks WHERE webhook_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *webhookRepository) CreateDelivery(ctx context.Context, delivery entities.WebhookDelivery) (int64, error) {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload, next_attempt_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING delivery_id
+	`
+
+	var deliveryID int64
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
+		delivery.WebhookID, delivery.EventID, delivery.EventType, string(delivery.Payload),
+		delivery.NextAttemptAt, delivery.CreatedAt,
+	).Scan(&deliveryID)
+	if err != nil {
+		return -1, err
+	}
+	return deliveryID, nil
+}
+
+// Rows locked by another dispatcher are skipped instead of waited for
+func (r *webhookRepository) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.WebhookDelivery, error) {
+	query := `
+		WITH claimed AS (
+			UPDATE webhook_deliveries
+			SET next_attempt_at = $2
+			WHERE delivery_id IN (
+				SELECT delivery_id
+				FROM webhook_deliveries
+				WHERE status = 'pending' AND next_attempt_at <= $1
+				ORDER BY next_attempt_at, delivery_id
+				LIMIT $3
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING ` + deliveryColumns + `
+		)
+		SELECT * FROM claimed ORDER BY delivery_id
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDeliveries(rows)
+}
+
+func (r *webhookRepository) UpdateDelivery(ctx context.Context, delivery entities.WebhookDelivery) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET
+			status = $2,
+			attempts = $3,
+			next_attempt_at = $4,
+			last_error = $5,
+			last_status_code = $6,
+			delivered_at = $7
+		WHERE delivery_id = $1
+	`
+	var deliveredAt sql.NullTime
+	if delivery.DeliveredAt != nil {
+		deliveredAt = sql.NullTime{Time: *delivery.DeliveredAt, Valid: true}
+	}
+
+	res, err := conn(ctx, r.db).ExecContext(ctx, query,
+		delivery.ID, delivery.Status, delivery.Attempts, delivery.NextAttemptAt,
+		delivery.LastError, delivery.LastStatusCode, deliveredAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *webhookRepository) SearchDeliveries(ctx context.Context, text []byte) ([]entities.WebhookDelivery, error) {
+	query := `
+		SELECT ` + deliveryColumns + `
+		FROM webhook_deliveries
+		WHERE strpos(payload, $1) > 0
+		ORDER BY delivery_id
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, string(text))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDeliveries(rows)
+}
+
+func (r *webhookRepository) UpdatePayload(ctx context.Context, id string, payload []byte) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE webhook_deliveries SET payload = $2 WHERE delivery_id = $1`, id, string(payload))
+	if err != nil {
+		return err
+	}
+	if rowsAffected, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *webhookRepository) GetDeliveries(ctx context.Context, webhookID int64, status string) ([]entities.WebhookDelivery, error) {
+	query := `
+		SELECT ` + deliveryColumns + `
+		FROM webhook_deliveries
+		WHERE ($1 = 0 OR webhook_id = $1) AND ($2 = '' OR status::text = $2)
+		ORDER BY delivery_id DESC
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, webhookID, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDeliveries(rows)
+}
+
+func (r *webhookRepository) GetDeliveryById(ctx context.Context, idStr string) (entities.WebhookDelivery, error) {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return entities.WebhookDelivery{}, ErrNonNumericID
+	}
+
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE delivery_id = $1`
+	return scanDelivery(conn(ctx, r.db).QueryRowContext(ctx, query, id))
+}
+
+func scanWebhook(row rowScanner) (entities.Webhook, error) {
+	var webhook entities.Webhook
+	err := row.Scan(
+		&webhook.ID, &webhook.URL, pq.Array(&webhook.EventTypes), &webhook.Secret, &webhook.Disabled, &webhook.Version,
+	)
+	return webhook, err
+}
+
+func scanDelivery(row rowScanner) (entities.WebhookDelivery, error) {
+	var (
+		delivery    entities.WebhookDelivery
+		payload     string
+		deliveredAt sql.NullTime
+	)
+
+	err := row.Scan(
+		&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.EventType, &payload, &delivery.Status,
+		&delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastError, &delivery.LastStatusCode,
+		&delivery.CreatedAt, &deliveredAt,
+	)
+	if err != nil {
+		return delivery, err
+	}
+
+	delivery.Payload = []byte(payload)
+	delivery.DeliveredAt = timePointer(deliveredAt)
+	return delivery, nil
+}
+
+func scanDeliveries(rows *sql.Rows) ([]entities.WebhookDelivery, error) {
+	deliveries := []entities.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
@@ -1,48 +1,186 @@
 package repository
 
 import (
+	"context"
 	"hot-coffee/internal/core/entities"
 	"hot-coffee/internal/vo"
 	"time"
 )
 
 type InventoryRepository interface {
-	Create(item entities.InventoryItem) error
-	GetAll() ([]entities.InventoryItem, error)
-	GetById(id string) (entities.InventoryItem, error)
-	Update(id string, item entities.InventoryItem) error
-	Delete(id string) error
+	Create(ctx context.Context, item entities.InventoryItem) error
+	GetAll(ctx context.Context) ([]entities.InventoryItem, error)
+	GetById(ctx context.Context, id string) (entities.InventoryItem, error)
+	Update(ctx context.Context, id string, item entities.InventoryItem) error
+	// Archives the item, archived items are not listed but can be fetched by id
+	Delete(ctx context.Context, id string) error
+	Restore(ctx context.Context, id string) error
 	// Pager for inventory items \\
-	GetPage(sortBy string, offset, rowCount int) (entities.PaginatedInventoryItems, error)
+	GetPage(ctx context.Context, sortBy string, offset, rowCount int) (entities.PaginatedInventoryItems, error)
+	AdjustQuantity(ctx context.Context, id string, difference float64) error
+	// Fails with ErrInsufficientIngredient if the reserved quantity would exceed the quantity on hand
+	AdjustReserved(ctx context.Context, id string, difference float64) error
+	// Records the change of the quantity made for the order line, see OrderItem.Line
+	SaveTransaction(ctx context.Context, id string, orderID int64, line string, quantity float64) error
+	// Quantity changes recorded for the order, one per inventory item and line
+	GetTransactions(ctx context.Context, orderID int64) ([]entities.IngredientUsage, error)
+	// Adds the quantity to the reservation of the order line
+	SaveReservation(ctx context.Context, id string, orderID int64, line string, quantity float64) error
+	// Reserved quantities of the order, one per inventory item and line
+	GetReservations(ctx context.Context, orderID int64) ([]entities.IngredientUsage, error)
+	DeleteReservations(ctx context.Context, orderID int64) error
 }
 
 type MenuRepository interface {
-	Create(item entities.MenuItem) (int, error)
-	AddPriceDifference(menu_item_id int, price_difference float64) error
-	GetAll() ([]entities.MenuItem, error)
-	GetById(id string) (entities.MenuItem, error)
-	Update(id string, item entities.MenuItem) error
-	Delete(id string) error
-	GetMenusFullTextSearchReport(q string, minPrice, maxPrice int) ([]entities.MenuReport, error)
+	Create(ctx context.Context, item entities.MenuItem) (int, error)
+	AddPriceDifference(ctx context.Context, menu_item_id int, price_difference float64) error
+	GetAll(ctx context.Context) ([]entities.MenuItem, error)
+	GetById(ctx context.Context, id string) (entities.MenuItem, error)
+	Update(ctx context.Context, id string, item entities.MenuItem) error
+	// Archives the item, archived items are not listed but can be fetched by id
+	Delete(ctx context.Context, id string) error
+	Restore(ctx context.Context, id string) error
+	GetMenusFullTextSearchReport(ctx context.Context, q string, minPrice, maxPrice int) ([]entities.MenuReport, error)
 }
 
 type OrderRepository interface {
-	Create(order entities.Order) (int64, error)
-	SetOrderStatusHistory(id int64, pastStatus, newStatus string) error
-	GetAll() ([]entities.Order, error)
-	GetById(id string) (entities.Order, error)
-	GetOrderRevenue(id int64) (float64, error)
-	Update(id string, order entities.Order) error
-	Delete(id string) error
-	GetOrderedItemsCountByPeriod(period, month string, year int) (map[string]int, error)
-	GetOrderedMenuItemsCountByPeriod(startDate, endDate time.Time) (entities.OrderedMenuItemsCount, error)
-	GetCustomerIDByName(fullname string, phone string) (int64, error)
-	GetOrdersFullTextSearchReport(q string, minPrice, maxPrice int) ([]entities.OrderReport, error)
-	FetchInventoryUpdates(orderIDs []int64) ([]vo.InventoryUpdate, error)
+	Create(ctx context.Context, order entities.Order) (int64, error)
+	SetOrderStatusHistory(ctx context.Context, id int64, pastStatus, newStatus, reason string) error
+	// Changes the status only if the order is still in the past status
+	UpdateStatus(ctx context.Context, id int64, pastStatus, newStatus string) error
+	// Status changes of the order, the oldest first
+	GetOrderStatusHistory(ctx context.Context, id int64) ([]entities.OrderStatusChange, error)
+	// Orders closed in the period, zero time leaves the period unbounded
+	GetOrderCloseTimes(ctx context.Context, startDate, endDate time.Time) ([]entities.OrderCloseTime, error)
+	// Orders closed in the period with their menu items and estimates, zero time leaves the period unbounded
+	GetPreparationTimes(ctx context.Context, startDate, endDate time.Time) ([]entities.PreparationTime, error)
+	SetEstimatedReadyAt(ctx context.Context, id int64, readyAt time.Time) error
+	GetAll(ctx context.Context) ([]entities.Order, error)
+	// Replaces the discounts applied to the order
+	SetOrderDiscounts(ctx context.Context, id int64, discounts []entities.AppliedDiscount) error
+	// Orders matching the filter in the filter sort, Next is set when more orders follow
+	GetFiltered(ctx context.Context, filter entities.OrderFilter) (entities.OrdersPage, error)
+	GetById(ctx context.Context, id string) (entities.Order, error)
+	GetOrderRevenue(ctx context.Context, id int64) (float64, error)
+	Update(ctx context.Context, id string, order entities.Order) error
+	Delete(ctx context.Context, id string) error
+	GetOrderedItemsCountByPeriod(ctx context.Context, period, month string, year int) (map[string]int, error)
+	GetOrderedMenuItemsCountByPeriod(ctx context.Context, startDate, endDate time.Time) (entities.OrderedMenuItemsCount, error)
+	GetOrdersFullTextSearchReport(ctx context.Context, q string, minPrice, maxPrice int) ([]entities.OrderReport, error)
+	// Ingredients reserved and deducted for the orders with the available quantities left
+	FetchInventoryUpdates(ctx context.Context, orderIDs []int64) ([]vo.InventoryUpdate, error)
+}
+
+type CustomerRepository interface {
+	// Fails with errors.ErrUniqueViolation if the phone is taken
+	Create(ctx context.Context, customer entities.Customer) (int64, error)
+	// Customers matching the filter, sorted by id
+	GetAll(ctx context.Context, filter entities.CustomerFilter) ([]entities.Customer, error)
+	GetById(ctx context.Context, id string) (entities.Customer, error)
+	// Anonymized customers are not updated
+	Update(ctx context.Context, id string, customer entities.Customer) error
+	// Replaces the name with the given one and drops the phone,
+	// sql.ErrNoRows if the customer does not exist or is anonymized already
+	Anonymize(ctx context.Context, id string, fullname string) error
+	// Fails with errors.ErrReferenced if the customer has orders or loyalty ledger entries
+	Delete(ctx context.Context, id string) error
+}
+
+type LoyaltyRepository interface {
+	// Blocks concurrent ledger changes of the customer until the transaction ends,
+	// sql.ErrNoRows if the customer does not exist
+	LockCustomer(ctx context.Context, customerID int64) error
+	Create(ctx context.Context, entry entities.LoyaltyEntry) (int64, error)
+	// Ledger of the customer in the order the entries were written
+	GetByCustomerID(ctx context.Context, customerID int64) ([]entities.LoyaltyEntry, error)
+}
+
+type AuditRepository interface {
+	Create(ctx context.Context, entry entities.AuditEntry) (int64, error)
+	// Entries matching the filter, the newest first
+	GetAll(ctx context.Context, filter entities.AuditFilter) ([]entities.AuditEntry, error)
+}
+
+type PromotionRepository interface {
+	Create(ctx context.Context, promotion entities.Promotion) (int64, error)
+	GetAll(ctx context.Context) ([]entities.Promotion, error)
+	GetById(ctx context.Context, id string) (entities.Promotion, error)
+	// Fails with errors.ErrUsageLimitReached when the limit is lower than the usages already spent
+	Update(ctx context.Context, id string, promotion entities.Promotion) error
+	Delete(ctx context.Context, id string) error
+	// Counts one more usage, fails with errors.ErrUsageLimitReached when the limit is exhausted
+	IncrementUsage(ctx context.Context, id int64) error
+	// Gives the usage back
+	DecrementUsage(ctx context.Context, id int64) error
+}
+
+type PaymentRepository interface {
+	// Saves the payment with its restocked items
+	Create(ctx context.Context, payment entities.Payment) (int64, error)
+	// Payments and refunds of the order, the oldest first
+	GetByOrderID(ctx context.Context, orderID int64) ([]entities.Payment, error)
+	// Blocks concurrent payments of the order until the transaction ends,
+	// sql.ErrNoRows if the order does not exist
+	LockOrder(ctx context.Context, orderID int64) error
+}
+
+type IdempotencyRepository interface {
+	// Saves the record unless a live record with the same key exists, the existing record is returned then.
+	// The record of the same request whose lease is over is taken over. Expired records are removed.
+	Reserve(ctx context.Context, record entities.IdempotencyRecord, now time.Time) (existing entities.IdempotencyRecord, reserved bool, err error)
+	// Stores the response of the key still reserved with the lease, sql.ErrNoRows if it was taken over
+	Complete(ctx context.Context, key string, lockedUntil time.Time, statusCode int, contentType string, body []byte) error
+	// Deletes the key still reserved with the lease
+	Delete(ctx context.Context, key string, lockedUntil time.Time) error
+	// Completed records whose response body contains the text
+	SearchBodies(ctx context.Context, text []byte) ([]entities.IdempotencyRecord, error)
+	// Replaces the stored response body of the completed record
+	UpdateBody(ctx context.Context, key string, body []byte) error
+}
+
+type WebhookRepository interface {
+	Create(ctx context.Context, webhook entities.Webhook) (int64, error)
+	GetAll(ctx context.Context) ([]entities.Webhook, error)
+	GetById(ctx context.Context, id string) (entities.Webhook, error)
+	Update(ctx context.Context, id string, webhook entities.Webhook) error
+	// Deletes the webhook with its deliveries
+	Delete(ctx context.Context, id string) error
+	// Writes the delivery to the outbox, must be called in the transaction of the change causing the event
+	CreateDelivery(ctx context.Context, delivery entities.WebhookDelivery) (int64, error)
+	// Pending deliveries due at the moment, the oldest first and at most limit of them.
+	// Their next attempt is moved by the lease, so the concurrent dispatchers skip them
+	ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.WebhookDelivery, error)
+	// Saves the outcome of the delivery attempt
+	UpdateDelivery(ctx context.Context, delivery entities.WebhookDelivery) error
+	// Deliveries of any webhook and status whose payload contains the text
+	SearchDeliveries(ctx context.Context, text []byte) ([]entities.WebhookDelivery, error)
+	// Replaces the payload of the delivery, the next attempts send and sign the new one
+	UpdatePayload(ctx context.Context, id string, payload []byte) error
+	// Deliveries of the webhook in the status, zero id and empty status match any. The newest first
+	GetDeliveries(ctx context.Context, webhookID int64, status string) ([]entities.WebhookDelivery, error)
+	GetDeliveryById(ctx context.Context, id string) (entities.WebhookDelivery, error)
+}
+
+// Runs several repository calls in single transaction:
+// the repositories called with context passed to fn take part in it,
+// the transaction is rolled back if fn returns error
+type UnitOfWork interface {
+	Do(ctx context.Context, fn func(ctx context.Context) error) error
+	// Runs the function once the transaction of the context is committed, right away without transaction.
+	// The function gets the context without the transaction, nothing is run if the transaction is rolled back
+	AfterCommit(ctx context.Context, fn func(ctx context.Context))
 }
 
 type Repository struct {
-	Inventory InventoryRepository
-	Menu      MenuRepository
-	Order     OrderRepository
+	Inventory   InventoryRepository
+	Menu        MenuRepository
+	Order       OrderRepository
+	Promotion   PromotionRepository
+	Payment     PaymentRepository
+	Idempotency IdempotencyRepository
+	Webhook     WebhookRepository
+	Customer    CustomerRepository
+	Loyalty     LoyaltyRepository
+	Audit       AuditRepository
+	UnitOfWork  UnitOfWork
 }
@@ -1,52 +1,149 @@
 package service
 
 import (
+	"context"
 	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/dto"
 	"hot-coffee/internal/vo"
+	"time"
 )
 
 type InventoryService interface {
-	CreateInventoryItem(item entities.InventoryItem) error
-	GetInventoryItems() ([]entities.InventoryItem, error)
-	GetInventoryItem(id string) (entities.InventoryItem, error)
-	UpdateInventoryItem(id string, item entities.InventoryItem) error
-	DeleteInventoryItem(id string) error
-	GetLeftovers(sortBy string, page, pageSize int) (entities.PaginatedInventoryItems, error)
+	CreateInventoryItem(ctx context.Context, item entities.InventoryItem) error
+	GetInventoryItems(ctx context.Context) ([]entities.InventoryItem, error)
+	GetInventoryItem(ctx context.Context, id string) (entities.InventoryItem, error)
+	UpdateInventoryItem(ctx context.Context, id string, item entities.InventoryItem) error
+	DeleteInventoryItem(ctx context.Context, id string) error
+	RestoreInventoryItem(ctx context.Context, id string) error
+	GetLeftovers(ctx context.Context, sortBy string, page, pageSize int) (entities.PaginatedInventoryItems, error)
+	ReserveOrderIngredients(ctx context.Context, orderID int64, items []entities.OrderItem) error
+	ReleaseOrderIngredients(ctx context.Context, orderID int64) error
+	CommitOrderIngredients(ctx context.Context, orderID int64) error
+	RestoreOrderIngredients(ctx context.Context, order entities.Order, items []entities.OrderItem) error
 }
 
 type MenuService interface {
-	CreateMenuItem(item entities.MenuItem) error
-	GetMenuItems() ([]entities.MenuItem, error)
-	GetMenuItem(id string) (entities.MenuItem, error)
-	UpdateMenuItem(id string, item entities.MenuItem) error
-	DeleteMenuItem(id string) error
+	CreateMenuItem(ctx context.Context, item entities.MenuItem) error
+	GetMenuItems(ctx context.Context) ([]entities.MenuItem, error)
+	GetMenuItem(ctx context.Context, id string) (entities.MenuItem, error)
+	UpdateMenuItem(ctx context.Context, id string, item entities.MenuItem) error
+	DeleteMenuItem(ctx context.Context, id string) error
+	RestoreMenuItem(ctx context.Context, id string) error
 }
 
 type OrderService interface {
-	CreateOrder(order entities.Order) (int64, error)
-	CreateOrders(orders []entities.Order) (vo.BatchResponse, error)
-	GetOrders() ([]entities.Order, error)
-	GetOrder(id string) (entities.Order, error)
-	GetOrderRevenue(orderID string) (float64, error)
-	UpdateOrder(id string, order entities.Order) error
-	DeleteOrder(id string) error
-	CloseOrder(id string) error
-	SetInProgress(id string) error
-	GetTotalSales() (entities.TotalSales, error)
-	GetPopularMenuItems() ([]entities.MenuItemSales, error)
-	GetOpenOrders() ([]entities.Order, error)
-	GetOrderedItemsByPeriod(period, month string, year int) (entities.OrderedItemsCountByPeriod, error)
-	GetOrderedMenuItemsCountByPeriod(startDate, endDate string) (entities.OrderedMenuItemsCount, error)
+	CreateOrder(ctx context.Context, order entities.Order) (entities.Order, error)
+	CreateOrders(ctx context.Context, orders []dto.BatchOrder, atomic bool) (vo.BatchResponse, error)
+	GetOrders(ctx context.Context) ([]entities.Order, error)
+	ListOrders(ctx context.Context, query dto.OrderQuery) (entities.OrdersPage, error)
+	GetOrder(ctx context.Context, id string) (entities.Order, error)
+	GetOrderRevenue(ctx context.Context, orderID string) (float64, error)
+	UpdateOrder(ctx context.Context, id string, order entities.Order) error
+	DeleteOrder(ctx context.Context, id string) error
+	CloseOrder(ctx context.Context, id string) error
+	SetInProgress(ctx context.Context, id string) error
+	TransitionOrder(ctx context.Context, id, status, reason string) error
+	GetOrderHistory(ctx context.Context, id string) (entities.OrderHistory, error)
+	GetTotalSales(ctx context.Context) (entities.TotalSales, error)
+	GetPopularMenuItems(ctx context.Context) ([]entities.MenuItemSales, error)
+	GetOpenOrders(ctx context.Context) ([]entities.Order, error)
+	GetUpcomingOrders(ctx context.Context, minutes string) ([]entities.Order, error)
+	OpenDueOrders(ctx context.Context, now time.Time) (int, error)
+	GetOrderedItemsByPeriod(ctx context.Context, period, month string, year int) (entities.OrderedItemsCountByPeriod, error)
+	GetOrderedMenuItemsCountByPeriod(ctx context.Context, startDate, endDate string) (entities.OrderedMenuItemsCount, error)
+	GetOrderThroughput(ctx context.Context, startDate, endDate string, percentile int) (entities.OrderThroughputReport, error)
+	GetReadyTimeReport(ctx context.Context, startDate, endDate string) (entities.ReadyTimeReport, error)
+}
+
+type QueueService interface {
+	GetQueue(ctx context.Context) ([]entities.QueueOrder, error)
+	Publish(ctx context.Context, event entities.OrderEvent)
+	Subscribe(lastEventID string) (missed []entities.OrderEvent, events <-chan entities.OrderEvent, resumed bool, unsubscribe func())
+}
+
+type CustomerService interface {
+	CreateCustomer(ctx context.Context, customer entities.Customer) (int64, error)
+	SearchCustomers(ctx context.Context, name, phone string) ([]entities.Customer, error)
+	GetCustomer(ctx context.Context, id string) (entities.Customer, error)
+	UpdateCustomer(ctx context.Context, id string, customer entities.Customer) error
+	DeleteCustomer(ctx context.Context, id, actor string) error
+	GetCustomerOrders(ctx context.Context, id string) ([]entities.Order, error)
+	ExportCustomer(ctx context.Context, id, actor string) (entities.CustomerExport, error)
+	AnonymizeCustomer(ctx context.Context, id, actor, reason string) (entities.Customer, error)
+	ResolveOrderCustomer(ctx context.Context, order *entities.Order) error
+}
+
+type AuditService interface {
+	Record(ctx context.Context, entry entities.AuditEntry) error
+	GetAuditTrail(ctx context.Context, action, entity, entityID string) ([]entities.AuditEntry, error)
+}
+
+type LoyaltyService interface {
+	GetLoyalty(ctx context.Context, customerID string) (entities.LoyaltyAccount, error)
+	ApplyRedemption(ctx context.Context, order *entities.Order) error
+	SpendRedeemedPoints(ctx context.Context, orderID int64, order entities.Order) error
+	EarnPoints(ctx context.Context, orderID int64, order entities.Order) error
+	RestorePoints(ctx context.Context, orderID, customerID int64) error
+	ReverseRefundedPoints(ctx context.Context, order entities.Order, payments entities.OrderPayments) error
+}
+
+type PromotionService interface {
+	CreatePromotion(ctx context.Context, promotion entities.Promotion) (int64, error)
+	GetPromotions(ctx context.Context) ([]entities.Promotion, error)
+	GetPromotion(ctx context.Context, id string) (entities.Promotion, error)
+	UpdatePromotion(ctx context.Context, id string, promotion entities.Promotion) error
+	DeletePromotion(ctx context.Context, id string) error
+	ApplyPromotions(ctx context.Context, order *entities.Order, at time.Time) error
+	ReleasePromotions(ctx context.Context, discounts []entities.AppliedDiscount) error
+	PromoCodes(ctx context.Context, discounts []entities.AppliedDiscount) ([]string, error)
+}
+
+type PaymentService interface {
+	GetOrderPayments(ctx context.Context, orderID string) (entities.OrderPayments, error)
+	AddPayments(ctx context.Context, orderID string, request dto.PaymentRequest) (entities.OrderPayments, error)
+	RefundPayments(ctx context.Context, orderID string, request dto.RefundRequest) (entities.OrderPayments, error)
+	CheckSettled(ctx context.Context, order entities.Order) error
+	CheckNotOverpaid(ctx context.Context, order entities.Order) error
+	CheckNothingPaid(ctx context.Context, order entities.Order) error
+}
+
+type WebhookService interface {
+	CreateWebhook(ctx context.Context, webhook entities.Webhook) (int64, error)
+	GetWebhooks(ctx context.Context) ([]entities.Webhook, error)
+	GetWebhook(ctx context.Context, id string) (entities.Webhook, error)
+	UpdateWebhook(ctx context.Context, id string, webhook entities.Webhook) error
+	DeleteWebhook(ctx context.Context, id string) error
+	GetWebhookDeliveries(ctx context.Context, id, status string) ([]entities.WebhookDelivery, error)
+	GetDeadLetters(ctx context.Context) ([]entities.WebhookDelivery, error)
+	RetryDelivery(ctx context.Context, id string) (entities.WebhookDelivery, error)
+	Enqueue(ctx context.Context, eventType string, data interface{}) error
+	DispatchDue(ctx context.Context, now time.Time) (int, error)
+	RedactCustomerName(ctx context.Context, name string, orderIDs []string) error
+}
+
+type IdempotencyService interface {
+	Begin(ctx context.Context, key, requestHash string) (record entities.IdempotencyRecord, replay bool, err error)
+	Complete(ctx context.Context, record entities.IdempotencyRecord, statusCode int, contentType string, body []byte) error
+	Release(ctx context.Context, record entities.IdempotencyRecord) error
+	RedactCustomerName(ctx context.Context, name string, orderIDs []string) error
 }
 
 // New aggregation interface
 type AggregationService interface {
-	FullTextSearchReport(q, filter, minPriceStr, maxPriceStr string) (entities.FullReport, error)
+	FullTextSearchReport(ctx context.Context, q, filter, minPriceStr, maxPriceStr string) (entities.FullReport, error)
 }
 
 type Service struct {
 	InventoryService   InventoryService
 	MenuService        MenuService
 	OrderService       OrderService
+	CustomerService    CustomerService
+	LoyaltyService     LoyaltyService
+	AuditService       AuditService
+	PromotionService   PromotionService
+	PaymentService     PaymentService
+	IdempotencyService IdempotencyService
+	QueueService       QueueService
+	WebhookService     WebhookService
 	AggregationService AggregationService
 }
@@ -1,6 +1,7 @@
 package serviceinstance
 
 import (
+	"context"
 	"errors"
 	"hot-coffee/internal/core/entities"
 	"hot-coffee/internal/repository"
@@ -46,7 +47,7 @@ func NewAggregationService(menuRepo repository.MenuRepository, orderRepo reposit
 	}
 }
 
-func (s *aggService) FullTextSearchReport(q, filter, minPriceStr, maxPriceStr string) (entities.FullReport, error) {
+func (s *aggService) FullTextSearchReport(ctx context.Context, q, filter, minPriceStr, maxPriceStr string) (entities.FullReport, error) {
 	var result entities.FullReport
 	if q == "" {
 		return result, ErrMissingQueryString
@@ -69,7 +70,7 @@ func (s *aggService) FullTextSearchReport(q, filter, minPriceStr, maxPriceStr st
 	}
 
 	if filter == "" {
-		return s.fetchBothReports(q, minPrice, maxPrice)
+		return s.fetchBothReports(ctx, q, minPrice, maxPrice)
 	}
 
 	// Parse and validate filter options
@@ -94,23 +95,23 @@ func (s *aggService) FullTextSearchReport(q, filter, minPriceStr, maxPriceStr st
 	}
 
 	if isAll || (isMenu && isOrders) {
-		return s.fetchBothReports(q, minPrice, maxPrice)
+		return s.fetchBothReports(ctx, q, minPrice, maxPrice)
 	} else if isMenu {
-		return s.fetchMenuReport(q, minPrice, maxPrice)
+		return s.fetchMenuReport(ctx, q, minPrice, maxPrice)
 	} else if isOrders {
-		return s.fetchOrdersReport(q, minPrice, maxPrice)
+		return s.fetchOrdersReport(ctx, q, minPrice, maxPrice)
 	}
 
 	return result, nil
 }
 
-func (s *aggService) fetchBothReports(q string, minPrice, maxPrice int) (entities.FullReport, error) {
-	menus, err := s.menuRepository.GetMenusFullTextSearchReport(q, minPrice, maxPrice)
+func (s *aggService) fetchBothReports(ctx context.Context, q string, minPrice, maxPrice int) (entities.FullReport, error) {
+	menus, err := s.menuRepository.GetMenusFullTextSearchReport(ctx, q, minPrice, maxPrice)
 	if err != nil {
 		return entities.FullReport{}, err
 	}
 
-	orders, err := s.orderRepository.GetOrdersFullTextSearchReport(q, minPrice, maxPrice)
+	orders, err := s.orderRepository.GetOrdersFullTextSearchReport(ctx, q, minPrice, maxPrice)
 	if err != nil {
 		return entities.FullReport{}, err
 	}
@@ -122,8 +123,8 @@ func (s *aggService) fetchBothReports(q string, minPrice, maxPrice int) (entitie
 	}, nil
 }
 
-func (s *aggService) fetchMenuReport(q string, minPrice, maxPrice int) (entities.FullReport, error) {
-	menus, err := s.menuRepository.GetMenusFullTextSearchReport(q, minPrice, maxPrice)
+func (s *aggService) fetchMenuReport(ctx context.Context, q string, minPrice, maxPrice int) (entities.FullReport, error) {
+	menus, err := s.menuRepository.GetMenusFullTextSearchReport(ctx, q, minPrice, maxPrice)
 	if err != nil {
 		return entities.FullReport{}, err
 	}
@@ -134,8 +135,8 @@ func (s *aggService) fetchMenuReport(q string, minPrice, maxPrice int) (entities
 	}, nil
 }
 
-func (s *aggService) fetchOrdersReport(q string, minPrice, maxPrice int) (entities.FullReport, error) {
-	orders, err := s.orderRepository.GetOrdersFullTextSearchReport(q, minPrice, maxPrice)
+func (s *aggService) fetchOrdersReport(ctx context.Context, q string, minPrice, maxPrice int) (entities.FullReport, error) {
+	orders, err := s.orderRepository.GetOrdersFullTextSearchReport(ctx, q, minPrice, maxPrice)
 	if err != nil {
 		return entities.FullReport{}, err
 	}
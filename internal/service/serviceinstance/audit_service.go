@@ -0,0 +1,67 @@
+package serviceinstance
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+	"hot-coffee/internal/repository"
+)
+
+// Errors
+var (
+	ErrUnknownAuditAction = errors.New("unknown audit action provided")
+	ErrUnknownAuditEntity = errors.New("unknown audit entity provided")
+)
+
+var auditActions = map[string]bool{
+	entities.CustomerExportAction:    true,
+	entities.CustomerAnonymizeAction: true,
+	entities.CustomerDeleteAction:    true,
+}
+
+var auditEntities = map[string]bool{
+	entities.CustomerEntity: true,
+}
+
+type auditService struct {
+	auditRepository repository.AuditRepository
+}
+
+func NewAuditService(auditRepository repository.AuditRepository) *auditService {
+	if auditRepository == nil {
+		slog.Error("Error while creating Audit service: Nil pointer repository provided")
+		os.Exit(1)
+	}
+	return &auditService{auditRepository}
+}
+
+// Writes the entry, must be called in the transaction of the audited action
+// so the action is not done without its entry
+func (s *auditService) Record(ctx context.Context, entry entities.AuditEntry) error {
+	_, err := s.auditRepository.Create(ctx, entry)
+	return err
+}
+
+// Entries matching the filter, the newest first. Empty values are not applied
+func (s *auditService) GetAuditTrail(ctx context.Context, action, entity, entityID string) ([]entities.AuditEntry, error) {
+	if action != "" && !auditActions[action] {
+		return nil, ErrUnknownAuditAction
+	}
+	if entity != "" && !auditEntities[entity] {
+		return nil, ErrUnknownAuditEntity
+	}
+	if entityID != "" {
+		if err := isValidID(entityID); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.auditRepository.GetAll(ctx, entities.AuditFilter{
+		Action:   action,
+		Entity:   entity,
+		EntityID: entityID,
+	})
+}
@@ -0,0 +1,363 @@
+package serviceinstance
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+	"hot-coffee/internal/repository"
+	"hot-coffee/internal/service"
+	"hot-coffee/internal/utils"
+)
+
+// Errors
+var (
+	ErrEmptyCustomerFullname   = errors.New("empty customer fullname provided")
+	ErrInvalidPhone            = errors.New("invalid phone provided. Expected 7 to 15 digits with optional leading +")
+	ErrCustomerPhoneTaken      = errors.New("customer with such phone already exists")
+	ErrCustomerNotExists       = errors.New("customer with such id does not exist")
+	ErrCustomerVersionMismatch = errors.New("customer was modified by another request, fetch it again")
+	ErrCustomerIDCollision     = errors.New("id collision between id in request body and id in url")
+	ErrCustomerHasOrders       = errors.New("customer has orders or loyalty points and cannot be deleted")
+	ErrNegativeCustomerID      = errors.New("negative customer id provided in order")
+	ErrCustomerAnonymized      = errors.New("customer is anonymized and cannot be changed or ordered for")
+)
+
+// Name the anonymized customers are shown with in the orders and the reports
+const anonymizedCustomerName = "Anonymized customer"
+
+var phonePattern = regexp.MustCompile(`^\+?[0-9]{7,15}$`)
+
+// Separators people type in phones, dropped before the phone is stored or searched
+var phoneSeparators = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "")
+
+type customerService struct {
+	customerRepository repository.CustomerRepository
+	orderRepository    repository.OrderRepository
+	uow                repository.UnitOfWork
+	loyaltyService     service.LoyaltyService
+	auditService       service.AuditService
+	webhookService     service.WebhookService
+	idempotencyService service.IdempotencyService
+}
+
+func NewCustomerService(customerRepository repository.CustomerRepository, orderRepository repository.OrderRepository, uow repository.UnitOfWork, loyaltyService service.LoyaltyService, auditService service.AuditService, webhookService service.WebhookService, idempotencyService service.IdempotencyService) *customerService {
+	if customerRepository == nil || orderRepository == nil || uow == nil {
+		slog.Error("Error while creating Customer service: Nil pointer repository provided")
+		os.Exit(1)
+	} else if loyaltyService == nil {
+		slog.Error("Error while creating Customer service: Nil pointer loyalty service provided")
+		os.Exit(1)
+	} else if auditService == nil {
+		slog.Error("Error while creating Customer service: Nil pointer audit service provided")
+		os.Exit(1)
+	} else if webhookService == nil {
+		slog.Error("Error while creating Customer service: Nil pointer webhook service provided")
+		os.Exit(1)
+	} else if idempotencyService == nil {
+		slog.Error("Error while creating Customer service: Nil pointer idempotency service provided")
+		os.Exit(1)
+	}
+	return &customerService{customerRepository, orderRepository, uow, loyaltyService, auditService, webhookService, idempotencyService}
+}
+
+func (s *customerService) CreateCustomer(ctx context.Context, customer entities.Customer) (int64, error) {
+	if err := validateCustomer(&customer); err != nil {
+		return -1, err
+	}
+
+	id, err := s.customerRepository.Create(ctx, customer)
+	if err != nil {
+		if errors.Is(err, errors.ErrUniqueViolation) {
+			return -1, ErrCustomerPhoneTaken
+		}
+		return -1, err
+	}
+	return id, nil
+}
+
+// Customers with the name and the phone containing the given parts, empty parts match everyone
+func (s *customerService) SearchCustomers(ctx context.Context, name, phone string) ([]entities.Customer, error) {
+	filter := entities.CustomerFilter{
+		Name:  strings.TrimSpace(name),
+		Phone: phoneSeparators.Replace(phone),
+	}
+	return s.customerRepository.GetAll(ctx, filter)
+}
+
+func (s *customerService) GetCustomer(ctx context.Context, id string) (entities.Customer, error) {
+	if err := isValidID(id); err != nil {
+		return entities.Customer{}, err
+	}
+
+	customer, err := s.customerRepository.GetById(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entities.Customer{}, ErrCustomerNotExists
+		}
+		return entities.Customer{}, err
+	}
+	return customer, nil
+}
+
+func (s *customerService) UpdateCustomer(ctx context.Context, id string, customer entities.Customer) error {
+	if err := isValidID(id); err != nil {
+		return err
+	}
+	if customer.ID != "" && customer.ID != id {
+		return ErrCustomerIDCollision
+	}
+	if err := validateCustomer(&customer); err != nil {
+		return err
+	}
+
+	return s.uow.Do(ctx, func(ctx context.Context) error {
+		current, err := s.GetCustomer(ctx, id)
+		if err != nil {
+			return err
+		} else if current.AnonymizedAt != nil {
+			return ErrCustomerAnonymized
+		}
+
+		if err := s.customerRepository.Update(ctx, id, customer); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrCustomerNotExists
+			} else if errors.Is(err, errors.ErrVersionMismatch) {
+				return ErrCustomerVersionMismatch
+			} else if errors.Is(err, errors.ErrUniqueViolation) {
+				return ErrCustomerPhoneTaken
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// Customers with orders are kept for the order history, they can be anonymized instead
+func (s *customerService) DeleteCustomer(ctx context.Context, id, actor string) error {
+	if err := isValidID(id); err != nil {
+		return err
+	}
+
+	return s.uow.Do(ctx, func(ctx context.Context) error {
+		if err := s.customerRepository.Delete(ctx, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrCustomerNotExists
+			} else if errors.Is(err, errors.ErrReferenced) {
+				return ErrCustomerHasOrders
+			}
+			return err
+		}
+		return s.auditService.Record(ctx, entities.AuditEntry{
+			Action:   entities.CustomerDeleteAction,
+			Entity:   entities.CustomerEntity,
+			EntityID: id,
+			Actor:    actor,
+		})
+	})
+}
+
+// Everything kept about the customer, for the access requests. The export is audited
+func (s *customerService) ExportCustomer(ctx context.Context, id, actor string) (entities.CustomerExport, error) {
+	var export entities.CustomerExport
+	err := s.uow.Do(ctx, func(ctx context.Context) error {
+		customer, err := s.GetCustomer(ctx, id)
+		if err != nil {
+			return err
+		}
+		orders, err := s.GetCustomerOrders(ctx, id)
+		if err != nil {
+			return err
+		}
+		loyalty, err := s.loyaltyService.GetLoyalty(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		export = entities.CustomerExport{
+			ExportedAt: time.Now(),
+			Customer:   customer,
+			Orders:     orders,
+			Loyalty:    loyalty,
+		}
+		return s.auditService.Record(ctx, entities.AuditEntry{
+			Action:   entities.CustomerExportAction,
+			Entity:   entities.CustomerEntity,
+			EntityID: id,
+			Actor:    actor,
+		})
+	})
+	if err != nil {
+		return entities.CustomerExport{}, err
+	}
+	return export, nil
+}
+
+// Scrubs the name and the phone of the customer, for the deletion requests.
+// The orders and the loyalty ledger stay for the reports, they are linked by id only.
+// The copies of the orders in the webhook events and the stored idempotent responses get the name replaced
+func (s *customerService) AnonymizeCustomer(ctx context.Context, id, actor, reason string) (entities.Customer, error) {
+	var customer entities.Customer
+	err := s.uow.Do(ctx, func(ctx context.Context) error {
+		current, err := s.GetCustomer(ctx, id)
+		if err != nil {
+			return err
+		} else if current.AnonymizedAt != nil {
+			return ErrCustomerAnonymized
+		}
+
+		orders, err := s.GetCustomerOrders(ctx, id)
+		if err != nil {
+			return err
+		}
+		if len(orders) != 0 {
+			orderIDs := make([]string, len(orders))
+			for idx, order := range orders {
+				orderIDs[idx] = order.ID
+			}
+			if err := s.webhookService.RedactCustomerName(ctx, current.Fullname, orderIDs); err != nil {
+				return err
+			}
+			if err := s.idempotencyService.RedactCustomerName(ctx, current.Fullname, orderIDs); err != nil {
+				return err
+			}
+		}
+
+		if err := s.customerRepository.Anonymize(ctx, id, anonymizedCustomerName); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				// Anonymized by the concurrent request
+				return ErrCustomerAnonymized
+			}
+			return err
+		}
+		err = s.auditService.Record(ctx, entities.AuditEntry{
+			Action:   entities.CustomerAnonymizeAction,
+			Entity:   entities.CustomerEntity,
+			EntityID: id,
+			Actor:    actor,
+			Reason:   strings.TrimSpace(reason),
+		})
+		if err != nil {
+			return err
+		}
+
+		customer, err = s.GetCustomer(ctx, id)
+		return err
+	})
+	if err != nil {
+		return entities.Customer{}, err
+	}
+	return customer, nil
+}
+
+// Replaces customer_name of the JSON objects about the orders, nested ones included.
+// Reports false if the document has none of them or is not JSON
+func redactCustomerName(document []byte, orderIDs []string) ([]byte, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return document, false
+	}
+
+	var redact func(value interface{}) bool
+	redact = func(value interface{}) bool {
+		redacted := false
+		switch value := value.(type) {
+		case map[string]interface{}:
+			_, named := value["customer_name"]
+			if orderID, ok := value["order_id"]; ok && named && utils.In(fmt.Sprint(orderID), orderIDs) {
+				value["customer_name"] = anonymizedCustomerName
+				redacted = true
+			}
+			for _, field := range value {
+				redacted = redact(field) || redacted
+			}
+		case []interface{}:
+			for _, element := range value {
+				redacted = redact(element) || redacted
+			}
+		}
+		return redacted
+	}
+	if !redact(value) {
+		return document, false
+	}
+
+	redacted, err := json.Marshal(value)
+	if err != nil {
+		return document, false
+	}
+	return redacted, true
+}
+
+// Orders of the customer, the newest first
+func (s *customerService) GetCustomerOrders(ctx context.Context, id string) ([]entities.Order, error) {
+	if _, err := s.GetCustomer(ctx, id); err != nil {
+		return nil, err
+	}
+	customerID, _ := strconv.ParseInt(id, 10, 64)
+
+	page, err := s.orderRepository.GetFiltered(ctx, entities.OrderFilter{
+		CustomerID: customerID,
+		SortBy:     entities.OrderSortCreatedAt,
+		Descending: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if page.Orders == nil {
+		return []entities.Order{}, nil
+	}
+	return page.Orders, nil
+}
+
+// Sets the customer of the order. Order referencing the customer by id gets the customer name,
+// order with a name only gets a new customer, customers with the same name are different people
+func (s *customerService) ResolveOrderCustomer(ctx context.Context, order *entities.Order) error {
+	if order.CustomerID < 0 {
+		return ErrNegativeCustomerID
+	} else if order.CustomerID != 0 {
+		customer, err := s.customerRepository.GetById(ctx, strconv.FormatInt(order.CustomerID, 10))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrCustomerNotExists
+			}
+			return err
+		} else if customer.AnonymizedAt != nil {
+			return ErrCustomerAnonymized
+		}
+		order.CustomerName = customer.Fullname
+		return nil
+	}
+
+	customerID, err := s.customerRepository.Create(ctx, entities.Customer{Fullname: order.CustomerName})
+	if err != nil {
+		return err
+	}
+	order.CustomerID = customerID
+	return nil
+}
+
+func validateCustomer(customer *entities.Customer) error {
+	customer.Fullname = strings.TrimSpace(customer.Fullname)
+	if customer.Fullname == "" {
+		return ErrEmptyCustomerFullname
+	}
+
+	customer.Phone = phoneSeparators.Replace(customer.Phone)
+	if customer.Phone != "" && !phonePattern.MatchString(customer.Phone) {
+		return ErrInvalidPhone
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package serviceinstance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"hot-coffee/internal/core/entities"
+)
+
+func TestAnonymizeCustomerRedactsOrderCopies(t *testing.T) {
+	services := newTestService(t)
+	ctx := context.Background()
+
+	webhook := entities.Webhook{URL: "http://localhost/hooks", Secret: "s3cr3t", EventTypes: []string{entities.OrderCreatedEvent}}
+	webhookID, err := services.WebhookService.CreateWebhook(ctx, webhook)
+	if err != nil {
+		t.Fatalf("CreateWebhook() error = %v", err)
+	}
+
+	// Customers with the same name are different people, only the orders of the anonymized one are redacted
+	latte := createTestMenuItem(t, services, "Latte", 4)
+	var customerIDs, orderIDs []string
+	for _, phone := range []string{"+77010000001", "+77010000002"} {
+		customerID, err := services.CustomerService.CreateCustomer(ctx, entities.Customer{Fullname: "Jane Doe", Phone: phone})
+		if err != nil {
+			t.Fatalf("CreateCustomer() error = %v", err)
+		}
+		order := entities.Order{CustomerID: customerID, Items: []entities.OrderItem{{ProductID: latte, Quantity: 1}}}
+		if order, err = services.OrderService.CreateOrder(ctx, order); err != nil {
+			t.Fatalf("CreateOrder() error = %v", err)
+		}
+		customerIDs = append(customerIDs, strconv.FormatInt(customerID, 10))
+		orderIDs = append(orderIDs, order.ID)
+	}
+	anonymized, kept := orderIDs[0], orderIDs[1]
+
+	// Response of the batch holding both orders, replayed on the retries
+	record, _, err := services.IdempotencyService.Begin(ctx, "batch", "hash")
+	if err != nil {
+		t.Fatalf("Begin() error = %v", err)
+	}
+	body := fmt.Sprintf(`{"processed_orders": [{"order_id": %s, "customer_name": "Jane Doe"}, {"order_id": %s, "customer_name": "Jane Doe"}]}`, anonymized, kept)
+	if err := services.IdempotencyService.Complete(ctx, record, http.StatusOK, "application/json", []byte(body)); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+
+	if _, err := services.CustomerService.AnonymizeCustomer(ctx, customerIDs[0], "admin", "deletion request"); err != nil {
+		t.Fatalf("AnonymizeCustomer() error = %v", err)
+	}
+
+	// Customer name of every order as the copies hold it now
+	names := make(map[string]string)
+	deliveries, err := services.WebhookService.GetWebhookDeliveries(ctx, strconv.FormatInt(webhookID, 10), "")
+	if err != nil {
+		t.Fatalf("GetWebhookDeliveries() error = %v", err)
+	}
+	for _, delivery := range deliveries {
+		var event struct {
+			Data entities.OrderEventData `json:"data"`
+		}
+		if err := json.Unmarshal(delivery.Payload, &event); err != nil {
+			t.Fatalf("delivery %s payload error = %v", delivery.ID, err)
+		}
+		names["webhook "+event.Data.Order.ID] = event.Data.Order.CustomerName
+	}
+	record, replay, err := services.IdempotencyService.Begin(ctx, "batch", "hash")
+	if err != nil || !replay {
+		t.Fatalf("Begin() replay = %v, error = %v, want replayed response", replay, err)
+	}
+	var response struct {
+		Orders []struct {
+			ID           int64  `json:"order_id"`
+			CustomerName string `json:"customer_name"`
+		} `json:"processed_orders"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(record.Body)).Decode(&response); err != nil {
+		t.Fatalf("replayed body error = %v", err)
+	}
+	for _, order := range response.Orders {
+		names["response "+strconv.FormatInt(order.ID, 10)] = order.CustomerName
+	}
+
+	want := map[string]string{
+		"webhook " + anonymized:  anonymizedCustomerName,
+		"webhook " + kept:        "Jane Doe",
+		"response " + anonymized: anonymizedCustomerName,
+		"response " + kept:       "Jane Doe",
+	}
+	for orderCopy, name := range want {
+		if names[orderCopy] != name {
+			t.Errorf("%s customer name = %q, want %q", orderCopy, names[orderCopy], name)
+		}
+	}
+}
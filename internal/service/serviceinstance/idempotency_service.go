@@ -0,0 +1,96 @@
+package serviceinstance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+	"hot-coffee/internal/flag"
+	"hot-coffee/internal/repository"
+)
+
+// Errors
+var (
+	ErrInvalidIdempotencyKey    = errors.New("Idempotency-Key must be from 1 to 255 characters long")
+	ErrIdempotencyKeyReused     = errors.New("Idempotency-Key was already used with another request")
+	ErrIdempotencyKeyInProgress = errors.New("request with this Idempotency-Key is still being processed")
+)
+
+const maxIdempotencyKeyLength = 255
+
+type idempotencyService struct {
+	idempotencyRepository repository.IdempotencyRepository
+}
+
+func NewIdempotencyService(repository repository.IdempotencyRepository) *idempotencyService {
+	if repository == nil {
+		slog.Error("Error while creating Idempotency service: Nil pointer repository provided")
+		os.Exit(1)
+	}
+	return &idempotencyService{repository}
+}
+
+// Reserves the key for the request. The stored response is returned with replay set
+// if the same request was already processed with the key.
+func (s *idempotencyService) Begin(ctx context.Context, key, requestHash string) (record entities.IdempotencyRecord, replay bool, err error) {
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		return record, false, ErrInvalidIdempotencyKey
+	}
+
+	// The lease identifies the reservation, it is truncated to the precision PostgreSQL stores
+	now := time.Now()
+	record = entities.IdempotencyRecord{
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   now.Add(flag.IdempotencyTTL),
+		LockedUntil: now.Add(flag.IdempotencyLease).Truncate(time.Microsecond),
+	}
+	existing, reserved, err := s.idempotencyRepository.Reserve(ctx, record, now)
+	if err != nil {
+		return record, false, err
+	} else if reserved {
+		return record, false, nil
+	}
+
+	if existing.RequestHash != requestHash {
+		return existing, false, ErrIdempotencyKeyReused
+	} else if existing.StatusCode == 0 {
+		return existing, false, ErrIdempotencyKeyInProgress
+	}
+	return existing, true, nil
+}
+
+// Stores the response replayed on the retries
+func (s *idempotencyService) Complete(ctx context.Context, record entities.IdempotencyRecord, statusCode int, contentType string, body []byte) error {
+	return s.idempotencyRepository.Complete(ctx, record.Key, record.LockedUntil, statusCode, contentType, body)
+}
+
+// Frees the key of the failed request, so it can be retried. The key taken over by a retry is kept.
+func (s *idempotencyService) Release(ctx context.Context, record entities.IdempotencyRecord) error {
+	return s.idempotencyRepository.Delete(ctx, record.Key, record.LockedUntil)
+}
+
+// Replaces the customer name in the stored responses about the orders, the retries replay the replacement
+func (s *idempotencyService) RedactCustomerName(ctx context.Context, name string, orderIDs []string) error {
+	text, _ := json.Marshal(name)
+	records, err := s.idempotencyRepository.SearchBodies(ctx, text)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		body, redacted := redactCustomerName(record.Body, orderIDs)
+		if !redacted {
+			continue
+		}
+		if err := s.idempotencyRepository.UpdateBody(ctx, record.Key, body); err != nil {
+			return fmt.Errorf("failed to redact idempotency record: %w", err)
+		}
+	}
+	return nil
+}
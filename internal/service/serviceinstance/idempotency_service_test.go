@@ -0,0 +1,68 @@
+package serviceinstance
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"hot-coffee/internal/core/errors"
+	"hot-coffee/internal/flag"
+)
+
+func TestIdempotencyBegin(t *testing.T) {
+	setFlag(t, &flag.IdempotencyLease, 50*time.Millisecond)
+	services := newTestService(t)
+	ctx := context.Background()
+	idempotency := services.IdempotencyService
+
+	first, replay, err := idempotency.Begin(ctx, "key", "hash")
+	if err != nil || replay {
+		t.Fatalf("Begin() replay = %v, error = %v, want reserved key", replay, err)
+	}
+
+	steps := []struct {
+		name       string
+		hash       string
+		wait       time.Duration
+		wantReplay bool
+		wantErr    error
+	}{
+		{name: "retry while processed", hash: "hash", wantErr: ErrIdempotencyKeyInProgress},
+		{name: "key reused with other request", hash: "other", wantErr: ErrIdempotencyKeyReused},
+		{name: "other request after lease", hash: "other", wait: 60 * time.Millisecond, wantErr: ErrIdempotencyKeyReused},
+	}
+	for _, step := range steps {
+		time.Sleep(step.wait)
+		_, replay, err := idempotency.Begin(ctx, "key", step.hash)
+		if !errors.Is(err, step.wantErr) || replay != step.wantReplay {
+			t.Fatalf("%s: Begin() replay = %v, error = %v, want %v and %v", step.name, replay, err, step.wantReplay, step.wantErr)
+		}
+	}
+
+	// The retry takes over the key of the request lost after the lease
+	second, replay, err := idempotency.Begin(ctx, "key", "hash")
+	if err != nil || replay {
+		t.Fatalf("Begin() after lease replay = %v, error = %v, want taken over key", replay, err)
+	}
+
+	// The lost request neither stores its response nor frees the key
+	if err := idempotency.Complete(ctx, first, http.StatusCreated, "application/json", []byte(`{"lost":true}`)); err == nil {
+		t.Fatal("Complete() of taken over reservation error = nil, want error")
+	}
+	if err := idempotency.Release(ctx, first); err != nil {
+		t.Fatalf("Release() of taken over reservation error = %v", err)
+	}
+	if _, _, err := idempotency.Begin(ctx, "key", "hash"); !errors.Is(err, ErrIdempotencyKeyInProgress) {
+		t.Fatalf("Begin() after stale release error = %v, want %v", err, ErrIdempotencyKeyInProgress)
+	}
+
+	if err := idempotency.Complete(ctx, second, http.StatusCreated, "application/json", []byte(`{}`)); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	record, replay, err := idempotency.Begin(ctx, "key", "hash")
+	if err != nil || !replay || record.StatusCode != http.StatusCreated || string(record.Body) != `{}` {
+		t.Fatalf("Begin() after complete = %+v, replay = %v, error = %v, want replayed response", record, replay, err)
+	}
+}
@@ -1,13 +1,18 @@
 package serviceinstance
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log/slog"
 	"os"
+	"sort"
+	"strconv"
 
 	"hot-coffee/internal/core/entities"
 	"hot-coffee/internal/core/errors"
 	"hot-coffee/internal/repository"
+	"hot-coffee/internal/service"
 )
 
 // errors
@@ -28,27 +33,39 @@ var (
 	ErrNegativeIngredientID          = errors.New("negative or zero ingredient id provided")
 	ErrInventoryItemDoesntExist      = errors.New("inventory item with such id does not exist")
 	ErrNoInventoryItems              = errors.New("no inventory items")
+	ErrInventoryItemVersionMismatch  = errors.New("inventory item was modified by another request, fetch it again")
+	ErrInventoryItemNotArchived      = errors.New("inventory item with such id is not archived")
+	ErrInventoryItemArchived         = errors.New("inventory item with such id is archived")
+	ErrNegativeReorderLevel          = errors.New("negative reorder level of inventory item")
+	ErrQuantityBelowReserved         = errors.New("quantity of inventory item cannot be lower than the quantity reserved by orders")
 )
 
 type inventoryService struct {
 	inventoryRepository repository.InventoryRepository
+	menuRepository      repository.MenuRepository
+	uow                 repository.UnitOfWork
+	webhookService      service.WebhookService
 }
 
-func NewInventoryService(storage repository.InventoryRepository) *inventoryService {
-	if storage == nil {
+func NewInventoryService(storage repository.InventoryRepository, menuStorage repository.MenuRepository, uow repository.UnitOfWork, webhookService service.WebhookService) *inventoryService {
+	if storage == nil || menuStorage == nil || uow == nil {
 		slog.Error("Error while creating Inventory service: Nil pointer repository provided")
 		os.Exit(1)
+	} else if webhookService == nil {
+		slog.Error("Error while creating Inventory service: Nil pointer webhook service provided")
+		os.Exit(1)
 	}
 
-	return &inventoryService{storage}
+	return &inventoryService{storage, menuStorage, uow, webhookService}
 }
 
-func (s *inventoryService) CreateInventoryItem(item entities.InventoryItem) error {
+func (s *inventoryService) CreateInventoryItem(ctx context.Context, item entities.InventoryItem) error {
 	if err := validateInventoryItem(&item); err != nil && err != ErrEmptyInventoryItemID {
 		return err
 	}
+	item.Reserved, item.Available = 0, 0
 
-	if err := s.inventoryRepository.Create(item); err != nil {
+	if err := s.inventoryRepository.Create(ctx, item); err != nil {
 		if errors.Is(err, errors.ErrIDAlreadyExists) {
 			return ErrInventoryItemAlreadyExists
 		}
@@ -57,36 +74,39 @@ func (s *inventoryService) CreateInventoryItem(item entities.InventoryItem) erro
 	return nil
 }
 
-// Not needed in service layer
-// func (s *inventoryService) SaveInventoryTransaction(id string, quantity float64) error {
-// 	return s.inventoryRepository.SaveInventoryTransaction(id, quantity)
-// }
-
-func (s *inventoryService) GetInventoryItems() ([]entities.InventoryItem, error) {
-	items, err := s.inventoryRepository.GetAll()
+func (s *inventoryService) GetInventoryItems(ctx context.Context) ([]entities.InventoryItem, error) {
+	items, err := s.inventoryRepository.GetAll(ctx)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoInventoryItems
 		}
 		return nil, err
 	}
+	for idx := range items {
+		setAvailable(&items[idx])
+	}
 	return items, nil
 }
 
-func (s *inventoryService) GetInventoryItem(id string) (entities.InventoryItem, error) {
+func (s *inventoryService) GetInventoryItem(ctx context.Context, id string) (entities.InventoryItem, error) {
 	if err := isValidID(id); err != nil {
 		return entities.InventoryItem{}, err
 	}
 
-	item, err := s.inventoryRepository.GetById(id)
+	item, err := s.inventoryRepository.GetById(ctx, id)
 
 	if err == sql.ErrNoRows {
 		return entities.InventoryItem{}, ErrInventoryItemDoesntExist
 	}
+	setAvailable(&item)
 	return item, err
 }
 
-func (s *inventoryService) UpdateInventoryItem(id string, item entities.InventoryItem) error {
+func setAvailable(item *entities.InventoryItem) {
+	item.Available = item.Quantity - item.Reserved
+}
+
+func (s *inventoryService) UpdateInventoryItem(ctx context.Context, id string, item entities.InventoryItem) error {
 	if err := validateInventoryItem(&item); err != nil {
 		return err
 	}
@@ -94,8 +114,38 @@ func (s *inventoryService) UpdateInventoryItem(id string, item entities.Inventor
 	if id != item.IngredientID {
 		return ErrInventoryItemIDCollision
 	}
+	item.Reserved, item.Available = 0, 0
 
-	if err := s.inventoryRepository.Update(id, item); err != nil {
+	return s.uow.Do(ctx, func(ctx context.Context) error {
+		past, err := s.inventoryRepository.GetById(ctx, id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrInventoryItemDoesntExist
+			}
+			return err
+		}
+		if item.Quantity < past.Reserved {
+			return ErrQuantityBelowReserved
+		}
+
+		var errInsufficientIngredient *errors.ErrInsufficientIngredient
+		if err := s.inventoryRepository.Update(ctx, id, item); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrInventoryItemDoesntExist
+			} else if errors.Is(err, errors.ErrVersionMismatch) {
+				return ErrInventoryItemVersionMismatch
+			} else if errors.As(err, &errInsufficientIngredient) {
+				// Reserved by an order after the item was fetched
+				return ErrQuantityBelowReserved
+			}
+			return err
+		}
+		return s.notifyIfLow(ctx, id, item.Quantity-past.Quantity)
+	})
+}
+
+func (s *inventoryService) DeleteInventoryItem(ctx context.Context, id string) error {
+	if err := s.inventoryRepository.Delete(ctx, id); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return ErrInventoryItemDoesntExist
 		}
@@ -104,17 +154,26 @@ func (s *inventoryService) UpdateInventoryItem(id string, item entities.Inventor
 	return nil
 }
 
-func (s *inventoryService) DeleteInventoryItem(id string) error {
-	if err := s.inventoryRepository.Delete(id); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return ErrInventoryItemDoesntExist
-		}
+func (s *inventoryService) RestoreInventoryItem(ctx context.Context, id string) error {
+	if err := isValidID(id); err != nil {
 		return err
 	}
+
+	if err := s.inventoryRepository.Restore(ctx, id); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		// Either absent or not archived
+		if _, err := s.GetInventoryItem(ctx, id); err != nil {
+			return err
+		}
+		return ErrInventoryItemNotArchived
+	}
 	return nil
 }
 
-func (s *inventoryService) GetLeftovers(sortBy string, page, pageSize int) (entities.PaginatedInventoryItems, error) {
+func (s *inventoryService) GetLeftovers(ctx context.Context, sortBy string, page, pageSize int) (entities.PaginatedInventoryItems, error) {
 	emptyPage := entities.PaginatedInventoryItems{}
 
 	// Default values
@@ -140,7 +199,235 @@ func (s *inventoryService) GetLeftovers(sortBy string, page, pageSize int) (enti
 	// Processing
 	offset, rowCount := (page-1)*pageSize, pageSize
 
-	return s.inventoryRepository.GetPage(sortBy, offset, rowCount)
+	return s.inventoryRepository.GetPage(ctx, sortBy, offset, rowCount)
+}
+
+// Reserves the ingredients of order items, the reservation is added to the one the order already has.
+// Must be called inside the transaction of order creation or update
+func (s *inventoryService) ReserveOrderIngredients(ctx context.Context, orderID int64, items []entities.OrderItem) error {
+	usages, err := s.orderIngredients(ctx, items)
+	if err != nil {
+		return err
+	}
+
+	ingredients := sumIngredients(usages)
+	for _, ingredientID := range sortedIngredientIDs(ingredients) {
+		// Archived items are kept for the history only, nothing is reserved from them
+		item, err := s.inventoryRepository.GetById(ctx, ingredientID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrInventoryItemDoesntExist
+			}
+			return err
+		} else if item.DeletedAt != "" {
+			return fmt.Errorf("%w: %s", ErrInventoryItemArchived, item.Name)
+		}
+
+		if err := s.inventoryRepository.AdjustReserved(ctx, ingredientID, ingredients[ingredientID]); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrInventoryItemDoesntExist
+			}
+			return err
+		}
+	}
+	for _, usage := range usages {
+		if err := s.inventoryRepository.SaveReservation(ctx, usage.IngredientID, orderID, usage.Line, usage.Quantity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Gives the ingredients reserved by the rejected, deleted or changed order back to the available quantity
+func (s *inventoryService) ReleaseOrderIngredients(ctx context.Context, orderID int64) error {
+	reservations, err := s.inventoryRepository.GetReservations(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	reserved := sumIngredients(reservations)
+	for _, ingredientID := range sortedIngredientIDs(reserved) {
+		if err := s.inventoryRepository.AdjustReserved(ctx, ingredientID, -reserved[ingredientID]); err != nil {
+			return err
+		}
+	}
+	return s.inventoryRepository.DeleteReservations(ctx, orderID)
+}
+
+// Takes the ingredients reserved by the closed order from the quantity on hand and records the transactions
+// of every order line
+func (s *inventoryService) CommitOrderIngredients(ctx context.Context, orderID int64) error {
+	reservations, err := s.inventoryRepository.GetReservations(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	reserved := sumIngredients(reservations)
+	for _, ingredientID := range sortedIngredientIDs(reserved) {
+		quantity := reserved[ingredientID]
+		// Reservation goes first, the reserved quantity never exceeds the quantity on hand
+		if err := s.inventoryRepository.AdjustReserved(ctx, ingredientID, -quantity); err != nil {
+			return err
+		}
+		if err := s.inventoryRepository.AdjustQuantity(ctx, ingredientID, -quantity); err != nil {
+			return err
+		}
+		if err := s.notifyIfLow(ctx, ingredientID, -quantity); err != nil {
+			return err
+		}
+	}
+	for _, reservation := range reservations {
+		if err := s.inventoryRepository.SaveTransaction(ctx, reservation.IngredientID, orderID, reservation.Line, -reservation.Quantity); err != nil {
+			return err
+		}
+	}
+	return s.inventoryRepository.DeleteReservations(ctx, orderID)
+}
+
+// Returns the ingredients of the closed order items back to inventory. Every restocked item gives back
+// its share of what its order line took, so later recipe changes do not alter the restock.
+// Orders closed before the lines were recorded are restocked by the current recipe
+func (s *inventoryService) RestoreOrderIngredients(ctx context.Context, order entities.Order, items []entities.OrderItem) error {
+	orderID, err := strconv.ParseInt(order.ID, 10, 64)
+	if err != nil {
+		return ErrNonNumericID
+	}
+	transactions, err := s.inventoryRepository.GetTransactions(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	ordered := make(map[string]int)
+	for _, item := range order.Items {
+		ordered[item.Line()] += item.Quantity
+	}
+	taken := make(map[string]map[string]float64)
+	for _, transaction := range transactions {
+		// Restocks recorded earlier are positive and do not change the share of the item
+		if transaction.Line == "" || transaction.Quantity >= 0 {
+			continue
+		}
+		if taken[transaction.Line] == nil {
+			taken[transaction.Line] = make(map[string]float64)
+		}
+		taken[transaction.Line][transaction.IngredientID] -= transaction.Quantity
+	}
+
+	var usages []entities.IngredientUsage
+	for _, item := range items {
+		line := item.Line()
+		if taken[line] == nil {
+			recipe, err := s.orderIngredients(ctx, []entities.OrderItem{item})
+			if err != nil {
+				return err
+			}
+			usages = append(usages, recipe...)
+			continue
+		}
+		share := float64(item.Quantity) / float64(ordered[line])
+		for _, ingredientID := range sortedIngredientIDs(taken[line]) {
+			usages = append(usages, entities.IngredientUsage{
+				IngredientID: ingredientID,
+				Line:         line,
+				Quantity:     taken[line][ingredientID] * share,
+			})
+		}
+	}
+
+	restored := sumIngredients(usages)
+	for _, ingredientID := range sortedIngredientIDs(restored) {
+		if err := s.inventoryRepository.AdjustQuantity(ctx, ingredientID, restored[ingredientID]); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrInventoryItemDoesntExist
+			}
+			return err
+		}
+	}
+	for _, usage := range usages {
+		if err := s.inventoryRepository.SaveTransaction(ctx, usage.IngredientID, orderID, usage.Line, usage.Quantity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Total quantities of the usages by inventory item id
+func sumIngredients(usages []entities.IngredientUsage) map[string]float64 {
+	ingredients := make(map[string]float64)
+	for _, usage := range usages {
+		ingredients[usage.IngredientID] += usage.Quantity
+	}
+	return ingredients
+}
+
+// Stable order of updates prevents deadlocks between concurrent orders
+func sortedIngredientIDs(ingredients map[string]float64) []string {
+	ingredientIDs := make([]string, 0, len(ingredients))
+	for ingredientID := range ingredients {
+		ingredientIDs = append(ingredientIDs, ingredientID)
+	}
+	sort.Slice(ingredientIDs, func(i, j int) bool {
+		left, _ := strconv.Atoi(ingredientIDs[i])
+		right, _ := strconv.Atoi(ingredientIDs[j])
+		return left < right
+	})
+	return ingredientIDs
+}
+
+// Sends inventory.low when the change by the difference takes the quantity below the reorder level,
+// further changes below it send nothing
+func (s *inventoryService) notifyIfLow(ctx context.Context, id string, difference float64) error {
+	if difference >= 0 {
+		return nil
+	}
+	item, err := s.inventoryRepository.GetById(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	pastQuantity := item.Quantity - difference
+	if item.ReorderLevel <= 0 || item.Quantity >= item.ReorderLevel || pastQuantity < item.ReorderLevel {
+		return nil
+	}
+	setAvailable(&item)
+	return s.webhookService.Enqueue(ctx, entities.InventoryLowEvent, entities.InventoryEventData{Item: item})
+}
+
+// Sums up the ingredients needed for order items by order line, sorted by ingredient and line
+func (s *inventoryService) orderIngredients(ctx context.Context, items []entities.OrderItem) ([]entities.IngredientUsage, error) {
+	lines := make(map[string]map[string]float64)
+	for _, item := range items {
+		menuItem, err := s.menuRepository.GetById(ctx, strconv.Itoa(item.ProductID))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrMenuItemNotExists
+			}
+			return nil, err
+		}
+		line := item.Line()
+		if lines[line] == nil {
+			lines[line] = make(map[string]float64)
+		}
+		for ingredientID, quantity := range menuItem.ModifiedIngredients(item.ModifierIDs) {
+			lines[line][ingredientID] += quantity * float64(item.Quantity)
+		}
+	}
+
+	var usages []entities.IngredientUsage
+	for line, ingredients := range lines {
+		for ingredientID, quantity := range ingredients {
+			usages = append(usages, entities.IngredientUsage{IngredientID: ingredientID, Line: line, Quantity: quantity})
+		}
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		left, _ := strconv.Atoi(usages[i].IngredientID)
+		right, _ := strconv.Atoi(usages[j].IngredientID)
+		if left != right {
+			return left < right
+		}
+		return usages[i].Line < usages[j].Line
+	})
+	return usages, nil
 }
 
 // Validation for inventory items \\
@@ -166,6 +453,8 @@ func validateInventoryItem(item *entities.InventoryItem) error {
 		return ErrNegativeInventoryItemQuantity
 	} else if item.Price <= 0 {
 		return ErrInvalidInventoryPrice
+	} else if item.ReorderLevel < 0 {
+		return ErrNegativeReorderLevel
 	}
 
 	if item.Quantity == 0 {
@@ -0,0 +1,76 @@
+package serviceinstance
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+)
+
+func TestReserveOrderIngredients(t *testing.T) {
+	services := newTestService(t)
+	ctx := context.Background()
+
+	latte := createTestMenuItem(t, services, "Latte", 4.5)
+	menuItem, err := services.MenuService.GetMenuItem(ctx, strconv.Itoa(latte))
+	if err != nil {
+		t.Fatalf("GetMenuItem() error = %v", err)
+	}
+	ingredientID := menuItem.Ingredients[0].IngredientID
+	items := []entities.OrderItem{{ProductID: latte, Quantity: 2}}
+
+	// Archived ingredient of the menu item is not reserved
+	if err := services.InventoryService.DeleteInventoryItem(ctx, ingredientID); err != nil {
+		t.Fatalf("DeleteInventoryItem() error = %v", err)
+	}
+	if err := services.InventoryService.ReserveOrderIngredients(ctx, 1, items); !errors.Is(err, ErrInventoryItemArchived) {
+		t.Fatalf("ReserveOrderIngredients() error = %v, want %v", err, ErrInventoryItemArchived)
+	}
+	if _, err := services.OrderService.CreateOrder(ctx, entities.Order{CustomerName: "Test customer", Items: items}); !errors.Is(err, ErrInventoryItemArchived) {
+		t.Fatalf("CreateOrder() error = %v, want %v", err, ErrInventoryItemArchived)
+	}
+
+	// Restored ingredient is reserved again
+	if err := services.InventoryService.RestoreInventoryItem(ctx, ingredientID); err != nil {
+		t.Fatalf("RestoreInventoryItem() error = %v", err)
+	}
+	createTestOrder(t, services, items...)
+	ingredient, err := services.InventoryService.GetInventoryItem(ctx, ingredientID)
+	if err != nil {
+		t.Fatalf("GetInventoryItem() error = %v", err)
+	} else if ingredient.Reserved != 200 {
+		t.Fatalf("reserved = %v, want 200", ingredient.Reserved)
+	}
+}
+
+func TestInventoryVersionKeptByOrders(t *testing.T) {
+	services := newTestService(t)
+	ctx := context.Background()
+
+	latte := createTestMenuItem(t, services, "Latte", 4.5)
+	menuItem, err := services.MenuService.GetMenuItem(ctx, strconv.Itoa(latte))
+	if err != nil {
+		t.Fatalf("GetMenuItem() error = %v", err)
+	}
+	ingredientID := menuItem.Ingredients[0].IngredientID
+	seen, err := services.InventoryService.GetInventoryItem(ctx, ingredientID)
+	if err != nil {
+		t.Fatalf("GetInventoryItem() error = %v", err)
+	}
+
+	// Reserved and taken stock leaves the version the admin has seen
+	order := createTestOrder(t, services, entities.OrderItem{ProductID: latte, Quantity: 2})
+	if err := services.OrderService.DeleteOrder(ctx, order.ID); err != nil {
+		t.Fatalf("DeleteOrder() error = %v", err)
+	}
+
+	seen.Price = 0.02
+	if err := services.InventoryService.UpdateInventoryItem(ctx, ingredientID, seen); err != nil {
+		t.Fatalf("UpdateInventoryItem() with version %d error = %v", seen.Version, err)
+	}
+	if err := services.InventoryService.UpdateInventoryItem(ctx, ingredientID, seen); !errors.Is(err, ErrInventoryItemVersionMismatch) {
+		t.Fatalf("UpdateInventoryItem() with stale version error = %v, want %v", err, ErrInventoryItemVersionMismatch)
+	}
+}
@@ -0,0 +1,449 @@
+package serviceinstance
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+	"hot-coffee/internal/flag"
+	"hot-coffee/internal/repository"
+)
+
+// Errors
+var (
+	ErrNegativeRedeemPoints   = errors.New("negative loyalty points provided for redemption")
+	ErrNotEnoughPoints        = errors.New("customer has not enough loyalty points")
+	ErrNotLoyaltyReward       = errors.New("menu item cannot be taken for loyalty points")
+	ErrRewardNotOrdered       = errors.New("menu item taken for loyalty points is not in the order")
+	ErrRedemptionExceedsPrice = errors.New("redeemed loyalty points exceed the order price")
+	ErrRedemptionTooSmall     = errors.New("redeemed loyalty points are worth less than a cent")
+)
+
+type loyaltyService struct {
+	loyaltyRepository  repository.LoyaltyRepository
+	customerRepository repository.CustomerRepository
+	menuRepository     repository.MenuRepository
+}
+
+func NewLoyaltyService(loyaltyRepository repository.LoyaltyRepository, customerRepository repository.CustomerRepository, menuRepository repository.MenuRepository) *loyaltyService {
+	if loyaltyRepository == nil || customerRepository == nil || menuRepository == nil {
+		slog.Error("Error while creating Loyalty service: Nil pointer repository provided")
+		os.Exit(1)
+	}
+	return &loyaltyService{loyaltyRepository, customerRepository, menuRepository}
+}
+
+// Balance of the customer with the ledger, the expired points are shown as entries of the ledger
+func (s *loyaltyService) GetLoyalty(ctx context.Context, idStr string) (entities.LoyaltyAccount, error) {
+	if err := isValidID(idStr); err != nil {
+		return entities.LoyaltyAccount{}, err
+	}
+	if _, err := s.customerRepository.GetById(ctx, idStr); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entities.LoyaltyAccount{}, ErrCustomerNotExists
+		}
+		return entities.LoyaltyAccount{}, err
+	}
+	customerID, _ := strconv.ParseInt(idStr, 10, 64)
+
+	entries, err := s.loyaltyRepository.GetByCustomerID(ctx, customerID)
+	if err != nil {
+		return entities.LoyaltyAccount{}, err
+	}
+	ledger := replayLedger(entries, time.Now())
+
+	return entities.LoyaltyAccount{
+		CustomerID: idStr,
+		Balance:    ledger.balance(),
+		Expiring:   append([]entities.LoyaltyLot{}, ledger.lots...),
+		Entries:    ledger.entries,
+	}, nil
+}
+
+// Adds the discounts of the redeemed menu items and points to the order after the promotions.
+// The balance is checked here, the points are spent by SpendRedeemedPoints once the order is written,
+// so both calls must be a part of the transaction writing the order
+func (s *loyaltyService) ApplyRedemption(ctx context.Context, order *entities.Order) error {
+	if order.RedeemPoints < 0 {
+		return ErrNegativeRedeemPoints
+	} else if order.RedeemPoints == 0 && len(order.RedeemItems) == 0 {
+		return nil
+	}
+
+	// Concurrent orders of the customer cannot spend the same points
+	if err := s.loyaltyRepository.LockCustomer(ctx, order.CustomerID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrCustomerNotExists
+		}
+		return err
+	}
+
+	var remaining float64
+	for _, item := range order.Items {
+		remaining += item.UnitPrice * float64(item.Quantity)
+	}
+	for _, discount := range order.Discounts {
+		remaining -= discount.Amount
+	}
+
+	var (
+		spent     int64
+		discounts []entities.AppliedDiscount
+		taken     = make(map[int]int)
+	)
+	for _, menuItemID := range order.RedeemItems {
+		cost, ok := flag.LoyaltyRewards[menuItemID]
+		if !ok {
+			return fmt.Errorf("%w: %d", ErrNotLoyaltyReward, menuItemID)
+		}
+
+		// The cheapest of the ordered items is free
+		var (
+			quantity  int
+			unitPrice = math.Inf(1)
+		)
+		for _, item := range order.Items {
+			if item.ProductID == menuItemID {
+				quantity += item.Quantity
+				unitPrice = math.Min(unitPrice, item.UnitPrice)
+			}
+		}
+		taken[menuItemID]++
+		if quantity < taken[menuItemID] {
+			return fmt.Errorf("%w: %d", ErrRewardNotOrdered, menuItemID)
+		}
+
+		menuItem, err := s.menuRepository.GetById(ctx, strconv.Itoa(menuItemID))
+		if err != nil {
+			return err
+		}
+
+		amount := roundMoney(math.Min(unitPrice, remaining))
+		if amount <= 0 {
+			return ErrRedemptionExceedsPrice
+		}
+		remaining -= amount
+		spent += cost
+		discounts = append(discounts, entities.AppliedDiscount{
+			Name:   "Loyalty reward: " + menuItem.Name,
+			Amount: amount,
+			Points: cost,
+		})
+	}
+
+	if order.RedeemPoints > 0 {
+		amount := roundMoney(float64(order.RedeemPoints) * flag.LoyaltyPointValue)
+		if amount <= 0 {
+			return ErrRedemptionTooSmall
+		} else if amount > roundMoney(remaining) {
+			return ErrRedemptionExceedsPrice
+		}
+		spent += order.RedeemPoints
+		discounts = append(discounts, entities.AppliedDiscount{
+			Name:   fmt.Sprintf("Loyalty points: %d", order.RedeemPoints),
+			Amount: amount,
+			Points: order.RedeemPoints,
+		})
+	}
+
+	entries, err := s.loyaltyRepository.GetByCustomerID(ctx, order.CustomerID)
+	if err != nil {
+		return err
+	}
+	if balance := replayLedger(entries, time.Now()).balance(); balance < spent {
+		return fmt.Errorf("%w: %d needed, %d available", ErrNotEnoughPoints, spent, balance)
+	}
+
+	order.Discounts = append(order.Discounts, discounts...)
+	return nil
+}
+
+// Records the points of the loyalty discounts of the written order
+func (s *loyaltyService) SpendRedeemedPoints(ctx context.Context, orderID int64, order entities.Order) error {
+	points := redeemedPoints(order.Discounts)
+	if points == 0 {
+		return nil
+	}
+
+	_, err := s.loyaltyRepository.Create(ctx, entities.LoyaltyEntry{
+		CustomerID: order.CustomerID,
+		OrderID:    orderID,
+		Kind:       entities.RedeemEntry,
+		Points:     -points,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to spend loyalty points: %w", err)
+	}
+	return nil
+}
+
+// Gives the customer the points of the closed order
+func (s *loyaltyService) EarnPoints(ctx context.Context, orderID int64, order entities.Order) error {
+	points := earnedPoints(order)
+	if points <= 0 {
+		return nil
+	}
+	if err := s.loyaltyRepository.LockCustomer(ctx, order.CustomerID); err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(flag.LoyaltyExpiry)
+	_, err := s.loyaltyRepository.Create(ctx, entities.LoyaltyEntry{
+		CustomerID: order.CustomerID,
+		OrderID:    orderID,
+		Kind:       entities.EarnEntry,
+		Points:     points,
+		ExpiresAt:  &expiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to earn loyalty points: %w", err)
+	}
+	return nil
+}
+
+// Gives back the points spent on the order and not given back yet. The points keep
+// the expiry they had when they were spent, so they cannot be prolonged by rejecting the order
+func (s *loyaltyService) RestorePoints(ctx context.Context, orderID, customerID int64) error {
+	if err := s.loyaltyRepository.LockCustomer(ctx, customerID); err != nil {
+		return err
+	}
+	entries, err := s.loyaltyRepository.GetByCustomerID(ctx, customerID)
+	if err != nil {
+		return err
+	}
+	ledger := replayLedger(entries, time.Now())
+
+	var (
+		spent    []entities.LoyaltyLot
+		restored int64
+	)
+	for _, entry := range entries {
+		if entry.OrderID != orderID {
+			continue
+		}
+		switch entry.Kind {
+		case entities.RedeemEntry:
+			spent = append(spent, ledger.consumed[entry.ID]...)
+		case entities.RestoreEntry:
+			restored += entry.Points
+		}
+	}
+
+	// Skips the points given back by the earlier calls
+	for _, lot := range spent {
+		skipped := min(lot.Points, restored)
+		lot.Points -= skipped
+		restored -= skipped
+		if lot.Points == 0 {
+			continue
+		}
+
+		_, err := s.loyaltyRepository.Create(ctx, entities.LoyaltyEntry{
+			CustomerID: customerID,
+			OrderID:    orderID,
+			Kind:       entities.RestoreEntry,
+			Points:     lot.Points,
+			ExpiresAt:  &lot.ExpiresAt,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to restore loyalty points: %w", err)
+		}
+	}
+	return nil
+}
+
+// Takes back the share of the earned points matching the refunded share of the paid amount,
+// the points spent on the order are given back once it is refunded in full
+func (s *loyaltyService) ReverseRefundedPoints(ctx context.Context, order entities.Order, payments entities.OrderPayments) error {
+	// Points are earned and spent for good only when the order is closed
+	if order.Status != entities.ClosedStatus || payments.Paid <= 0 {
+		return nil
+	}
+	if err := s.loyaltyRepository.LockCustomer(ctx, order.CustomerID); err != nil {
+		return err
+	}
+	entries, err := s.loyaltyRepository.GetByCustomerID(ctx, order.CustomerID)
+	if err != nil {
+		return err
+	}
+
+	var earned, reversed int64
+	for _, entry := range entries {
+		if entry.OrderID != payments.OrderID {
+			continue
+		}
+		switch entry.Kind {
+		case entities.EarnEntry:
+			earned += entry.Points
+		case entities.ReverseEntry:
+			reversed -= entry.Points
+		}
+	}
+
+	refundedShare := math.Min(payments.Refunded/payments.Paid, 1)
+	if points := int64(math.Round(float64(earned)*refundedShare)) - reversed; points > 0 {
+		_, err := s.loyaltyRepository.Create(ctx, entities.LoyaltyEntry{
+			CustomerID: order.CustomerID,
+			OrderID:    payments.OrderID,
+			Kind:       entities.ReverseEntry,
+			Points:     -points,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to reverse loyalty points: %w", err)
+		}
+	}
+
+	if refundedShare < 1 {
+		return nil
+	}
+	return s.RestorePoints(ctx, payments.OrderID, order.CustomerID)
+}
+
+// Loyalty discounts of the order stay when the order is updated, capped by the new price.
+// The spent points are not given back for the discount the new price has no room for
+func keepRedemptions(order *entities.Order, past []entities.AppliedDiscount) {
+	var remaining float64
+	for _, item := range order.Items {
+		remaining += item.UnitPrice * float64(item.Quantity)
+	}
+	for _, discount := range order.Discounts {
+		remaining -= discount.Amount
+	}
+
+	for _, discount := range past {
+		if discount.Points == 0 {
+			continue
+		}
+		discount.Amount = roundMoney(math.Min(discount.Amount, remaining))
+		if discount.Amount <= 0 {
+			continue
+		}
+		remaining -= discount.Amount
+		order.Discounts = append(order.Discounts, discount)
+	}
+}
+
+func redeemedPoints(discounts []entities.AppliedDiscount) int64 {
+	var points int64
+	for _, discount := range discounts {
+		points += discount.Points
+	}
+	return points
+}
+
+// Points of the amount paid for the order without the tip and of the ordered menu items
+func earnedPoints(order entities.Order) int64 {
+	amount := roundMoney(order.GrandTotal - order.Tip)
+	points := int64(math.Floor(amount*flag.LoyaltyPointsPerUnit + 1e-9))
+	for _, item := range order.Items {
+		points += flag.LoyaltyItemPoints[item.ProductID] * int64(item.Quantity)
+	}
+	return points
+}
+
+// State of the customer ledger replayed entry by entry
+type ledgerReplay struct {
+	// Points of the balance, the soonest expiring first
+	lots []entities.LoyaltyLot
+	// Points taken when the balance had none, paid off by the next added points
+	debt int64
+	// Lots the points of each taking entry came from, by entry id
+	consumed map[string][]entities.LoyaltyLot
+	// Stored entries with the computed expiry entries between them
+	entries []entities.LoyaltyEntry
+}
+
+// Replays the entries in the order they were written. Points are taken from the soonest
+// expiring lots, the lots left unspent at their expiry are turned into expire entries
+func replayLedger(entries []entities.LoyaltyEntry, now time.Time) *ledgerReplay {
+	replay := &ledgerReplay{
+		consumed: make(map[string][]entities.LoyaltyLot),
+		entries:  []entities.LoyaltyEntry{},
+	}
+	for _, entry := range entries {
+		replay.expire(entry.CustomerID, entry.CreatedAt)
+		replay.entries = append(replay.entries, entry)
+		if entry.Points > 0 {
+			replay.add(entry)
+		} else {
+			replay.take(entry)
+		}
+	}
+	if len(entries) != 0 {
+		replay.expire(entries[0].CustomerID, now)
+	}
+	return replay
+}
+
+func (r *ledgerReplay) add(entry entities.LoyaltyEntry) {
+	paid := min(entry.Points, r.debt)
+	r.debt -= paid
+	if entry.Points == paid {
+		return
+	}
+
+	expiresAt := entry.CreatedAt.Add(flag.LoyaltyExpiry)
+	if entry.ExpiresAt != nil {
+		expiresAt = *entry.ExpiresAt
+	}
+	lot := entities.LoyaltyLot{Points: entry.Points - paid, ExpiresAt: expiresAt}
+
+	idx := len(r.lots)
+	for idx > 0 && r.lots[idx-1].ExpiresAt.After(lot.ExpiresAt) {
+		idx--
+	}
+	if idx > 0 && r.lots[idx-1].ExpiresAt.Equal(lot.ExpiresAt) {
+		r.lots[idx-1].Points += lot.Points
+		return
+	}
+	r.lots = append(r.lots[:idx], append([]entities.LoyaltyLot{lot}, r.lots[idx:]...)...)
+}
+
+func (r *ledgerReplay) take(entry entities.LoyaltyEntry) {
+	points := -entry.Points
+	for points > 0 && len(r.lots) != 0 {
+		taken := min(points, r.lots[0].Points)
+		r.consumed[entry.ID] = append(r.consumed[entry.ID], entities.LoyaltyLot{Points: taken, ExpiresAt: r.lots[0].ExpiresAt})
+		r.lots[0].Points -= taken
+		points -= taken
+		if r.lots[0].Points == 0 {
+			r.lots = r.lots[1:]
+		}
+	}
+	r.debt += points
+}
+
+// Turns the lots expired by the time into expire entries
+func (r *ledgerReplay) expire(customerID int64, at time.Time) {
+	for len(r.lots) != 0 && !r.lots[0].ExpiresAt.After(at) {
+		lot := r.lots[0]
+		r.lots = r.lots[1:]
+
+		// Lot given back after its expiry expires at once
+		expiredAt := lot.ExpiresAt
+		if last := len(r.entries) - 1; last >= 0 && expiredAt.Before(r.entries[last].CreatedAt) {
+			expiredAt = r.entries[last].CreatedAt
+		}
+		r.entries = append(r.entries, entities.LoyaltyEntry{
+			CustomerID: customerID,
+			Kind:       entities.ExpireEntry,
+			Points:     -lot.Points,
+			CreatedAt:  expiredAt,
+		})
+	}
+}
+
+func (r *ledgerReplay) balance() int64 {
+	var balance int64
+	for _, lot := range r.lots {
+		balance += lot.Points
+	}
+	return balance - r.debt
+}
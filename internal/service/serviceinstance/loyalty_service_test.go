@@ -0,0 +1,143 @@
+package serviceinstance
+
+import (
+	"testing"
+	"time"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/flag"
+)
+
+func TestReplayLedger(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	day := func(n int) time.Time { return start.AddDate(0, 0, n) }
+	expiring := func(n int) *time.Time {
+		at := day(n)
+		return &at
+	}
+
+	tests := []struct {
+		name    string
+		entries []entities.LoyaltyEntry
+		now     time.Time
+		// Points of the expire entries in the order they were computed
+		wantExpired []int64
+		wantBalance int64
+		// Lots the points of the entry came from, by entry id
+		wantConsumed map[string][]entities.LoyaltyLot
+	}{
+		{
+			name: "redeemed points taken from balance",
+			entries: []entities.LoyaltyEntry{
+				{ID: "1", Kind: entities.EarnEntry, Points: 100, CreatedAt: day(0)},
+				{ID: "2", Kind: entities.RedeemEntry, Points: -30, CreatedAt: day(1)},
+			},
+			now:          day(2),
+			wantBalance:  70,
+			wantConsumed: map[string][]entities.LoyaltyLot{"2": {{Points: 30, ExpiresAt: day(30)}}},
+		},
+		{
+			name: "unspent points expire",
+			entries: []entities.LoyaltyEntry{
+				{ID: "1", Kind: entities.EarnEntry, Points: 100, CreatedAt: day(0)},
+				{ID: "2", Kind: entities.RedeemEntry, Points: -40, CreatedAt: day(10)},
+			},
+			now:          day(31),
+			wantExpired:  []int64{-60},
+			wantBalance:  0,
+			wantConsumed: map[string][]entities.LoyaltyLot{"2": {{Points: 40, ExpiresAt: day(30)}}},
+		},
+		{
+			name: "soonest expiring lot spent first",
+			entries: []entities.LoyaltyEntry{
+				{ID: "1", Kind: entities.EarnEntry, Points: 50, CreatedAt: day(0), ExpiresAt: expiring(100)},
+				{ID: "2", Kind: entities.EarnEntry, Points: 50, CreatedAt: day(1), ExpiresAt: expiring(10)},
+				{ID: "3", Kind: entities.RedeemEntry, Points: -60, CreatedAt: day(2)},
+			},
+			now:         day(20),
+			wantBalance: 40,
+			wantConsumed: map[string][]entities.LoyaltyLot{"3": {
+				{Points: 50, ExpiresAt: day(10)},
+				{Points: 10, ExpiresAt: day(100)},
+			}},
+		},
+		{
+			name: "reversed points paid off by next earn",
+			entries: []entities.LoyaltyEntry{
+				{ID: "1", Kind: entities.ReverseEntry, Points: -30, CreatedAt: day(0)},
+				{ID: "2", Kind: entities.EarnEntry, Points: 100, CreatedAt: day(1)},
+			},
+			now:         day(2),
+			wantBalance: 70,
+		},
+		{
+			name: "debt kept when nothing earned",
+			entries: []entities.LoyaltyEntry{
+				{ID: "1", Kind: entities.EarnEntry, Points: 20, CreatedAt: day(0)},
+				{ID: "2", Kind: entities.ReverseEntry, Points: -50, CreatedAt: day(1)},
+			},
+			now:          day(2),
+			wantBalance:  -30,
+			wantConsumed: map[string][]entities.LoyaltyLot{"2": {{Points: 20, ExpiresAt: day(30)}}},
+		},
+		{
+			name: "points restored after their expiry expire at once",
+			entries: []entities.LoyaltyEntry{
+				{ID: "1", Kind: entities.RestoreEntry, Points: 40, CreatedAt: day(20), ExpiresAt: expiring(10)},
+			},
+			now:         day(21),
+			wantExpired: []int64{-40},
+			wantBalance: 0,
+		},
+		{
+			name: "lots with same expiry merged",
+			entries: []entities.LoyaltyEntry{
+				{ID: "1", Kind: entities.EarnEntry, Points: 10, CreatedAt: day(0), ExpiresAt: expiring(5)},
+				{ID: "2", Kind: entities.RestoreEntry, Points: 15, CreatedAt: day(1), ExpiresAt: expiring(5)},
+			},
+			now:         day(6),
+			wantExpired: []int64{-25},
+			wantBalance: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, &flag.LoyaltyExpiry, 30*24*time.Hour)
+
+			replay := replayLedger(tt.entries, tt.now)
+			if got := replay.balance(); got != tt.wantBalance {
+				t.Errorf("balance() = %d, want %d", got, tt.wantBalance)
+			}
+
+			var expired []int64
+			for _, entry := range replay.entries {
+				if entry.Kind == entities.ExpireEntry {
+					expired = append(expired, entry.Points)
+					if entry.CreatedAt.After(tt.now) {
+						t.Errorf("expire entry at %v is after now %v", entry.CreatedAt, tt.now)
+					}
+				}
+			}
+			if len(expired) != len(tt.wantExpired) {
+				t.Fatalf("expired = %v, want %v", expired, tt.wantExpired)
+			}
+			for idx := range expired {
+				if expired[idx] != tt.wantExpired[idx] {
+					t.Fatalf("expired = %v, want %v", expired, tt.wantExpired)
+				}
+			}
+
+			for id, want := range tt.wantConsumed {
+				got := replay.consumed[id]
+				if len(got) != len(want) {
+					t.Fatalf("consumed[%s] = %v, want %v", id, got, want)
+				}
+				for idx := range want {
+					if got[idx].Points != want[idx].Points || !got[idx].ExpiresAt.Equal(want[idx].ExpiresAt) {
+						t.Fatalf("consumed[%s] = %v, want %v", id, got, want)
+					}
+				}
+			}
+		})
+	}
+}
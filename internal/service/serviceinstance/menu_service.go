@@ -1,6 +1,7 @@
 package serviceinstance
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log/slog"
@@ -35,6 +36,14 @@ var (
 	ErrNegativeMenuItemID         = errors.New("negative menu item id provided")
 	ErrNonNumericMenuItemID       = errors.New("non-numeric menu item id provided")
 	ErrTheSamePrice               = errors.New("the same price provided while updating menu item")
+	ErrMenuItemVersionMismatch    = errors.New("menu item was modified by another request, fetch it again")
+	ErrMenuItemNotArchived        = errors.New("menu item with such id is not archived")
+	ErrMenuItemArchived           = errors.New("menu item with such id is archived")
+	ErrEmptyModifierName          = errors.New("empty modifier name provided")
+	ErrModifierDuplicate          = errors.New("duplicated modifier name provided in menu item")
+	ErrModifierNotExists          = errors.New("modifier with such id does not belong to the menu item")
+	ErrModifierMakesPriceNegative = errors.New("modifier price delta makes the menu item price negative")
+	ErrModifierRemovesTooMuch     = errors.New("modifier takes away more ingredient than the menu item has")
 )
 
 const eps = 0.000001
@@ -52,12 +61,16 @@ func NewMenuService(repository repository.MenuRepository) *menuService {
 	return &menuService{repository}
 }
 
-func (s *menuService) CreateMenuItem(item entities.MenuItem) error {
-	if err := validateMenuItem(&item); err != nil && err != ErrEmptyMenuItemID {
+func (s *menuService) CreateMenuItem(ctx context.Context, item entities.MenuItem) error {
+	if err := validateMenuItem(ctx, &item); err != nil && err != ErrEmptyMenuItemID {
 		return err
 	}
+	// New menu item gets new modifiers
+	for idx := range item.Modifiers {
+		item.Modifiers[idx].ID = ""
+	}
 
-	id, err := s.menuRepository.Create(item)
+	id, err := s.menuRepository.Create(ctx, item)
 	if err != nil {
 		if errors.Is(err, errors.ErrIDAlreadyExists) {
 			return ErrMenuItemAlreadyExists
@@ -65,20 +78,20 @@ func (s *menuService) CreateMenuItem(item entities.MenuItem) error {
 		return err
 	}
 
-	if err := s.menuRepository.AddPriceDifference(id, item.Price); err != nil {
+	if err := s.menuRepository.AddPriceDifference(ctx, id, item.Price); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (s *menuService) GetMenuItem(idStr string) (entities.MenuItem, error) {
+func (s *menuService) GetMenuItem(ctx context.Context, idStr string) (entities.MenuItem, error) {
 	// ID validation
 	if err := isValidID(idStr); err != nil {
 		return entities.MenuItem{}, err
 	}
 
-	item, err := s.menuRepository.GetById(idStr)
+	item, err := s.menuRepository.GetById(ctx, idStr)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return entities.MenuItem{}, ErrMenuItemNotExists
@@ -88,8 +101,8 @@ func (s *menuService) GetMenuItem(idStr string) (entities.MenuItem, error) {
 	return item, err
 }
 
-func (s *menuService) GetMenuItems() ([]entities.MenuItem, error) {
-	items, err := s.menuRepository.GetAll()
+func (s *menuService) GetMenuItems(ctx context.Context) ([]entities.MenuItem, error) {
+	items, err := s.menuRepository.GetAll(ctx)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoMenuItems
@@ -99,8 +112,8 @@ func (s *menuService) GetMenuItems() ([]entities.MenuItem, error) {
 	return items, err
 }
 
-func (s *menuService) UpdateMenuItem(idStr string, item entities.MenuItem) error {
-	if err := validateMenuItem(&item); err != nil {
+func (s *menuService) UpdateMenuItem(ctx context.Context, idStr string, item entities.MenuItem) error {
+	if err := validateMenuItem(ctx, &item); err != nil {
 		return err
 	}
 
@@ -108,12 +121,26 @@ func (s *menuService) UpdateMenuItem(idStr string, item entities.MenuItem) error
 		return ErrInventoryItemIDCollision
 	}
 
-	menuItem, err := s.GetMenuItem(idStr)
+	menuItem, err := s.GetMenuItem(ctx, idStr)
 	if err != nil {
 		return err
 	}
+	for _, modifier := range item.Modifiers {
+		if modifier.ID == "" {
+			continue
+		}
+		modifierID, err := strconv.ParseInt(modifier.ID, 10, 64)
+		if _, ok := menuItem.Modifier(modifierID); err != nil || !ok {
+			return fmt.Errorf("%w: %s", ErrModifierNotExists, modifier.ID)
+		}
+	}
 
-	if err := s.menuRepository.Update(idStr, item); err != nil {
+	if err := s.menuRepository.Update(ctx, idStr, item); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrMenuItemNotExists
+		} else if errors.Is(err, errors.ErrVersionMismatch) {
+			return ErrMenuItemVersionMismatch
+		}
 		return err
 	}
 
@@ -126,15 +153,15 @@ func (s *menuService) UpdateMenuItem(idStr string, item entities.MenuItem) error
 		return nil
 	}
 
-	return s.menuRepository.AddPriceDifference(id, item.Price-menuItem.Price)
+	return s.menuRepository.AddPriceDifference(ctx, id, item.Price-menuItem.Price)
 }
 
-func (s *menuService) DeleteMenuItem(id string) error {
+func (s *menuService) DeleteMenuItem(ctx context.Context, id string) error {
 	if err := isValidID(id); err != nil {
 		return err
 	}
 
-	if err := s.menuRepository.Delete(id); err != nil {
+	if err := s.menuRepository.Delete(ctx, id); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return ErrMenuItemNotExists
 		}
@@ -143,7 +170,26 @@ func (s *menuService) DeleteMenuItem(id string) error {
 	return nil
 }
 
-func validateMenuItem(item *entities.MenuItem) error {
+func (s *menuService) RestoreMenuItem(ctx context.Context, id string) error {
+	if err := isValidID(id); err != nil {
+		return err
+	}
+
+	if err := s.menuRepository.Restore(ctx, id); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		// Either absent or not archived
+		if _, err := s.GetMenuItem(ctx, id); err != nil {
+			return err
+		}
+		return ErrMenuItemNotArchived
+	}
+	return nil
+}
+
+func validateMenuItem(ctx context.Context, item *entities.MenuItem) error {
 	if item.Name == "" {
 		return ErrEmptyMenuItemName
 	} else if item.Description == "" {
@@ -162,7 +208,7 @@ func validateMenuItem(item *entities.MenuItem) error {
 	inventoryIngredients := make(map[string]bool)
 
 	// Fill the map
-	inventoryItems, err := InventoryService.GetInventoryItems()
+	inventoryItems, err := InventoryService.GetInventoryItems(ctx)
 	if err != nil {
 		return fmt.Errorf("error while getting inventory items: %s", err)
 	}
@@ -192,6 +238,10 @@ func validateMenuItem(item *entities.MenuItem) error {
 		}
 	}
 
+	if err := validateModifiers(item, inventoryIngredients); err != nil {
+		return err
+	}
+
 	// ID Validation
 	err = isValidID(item.ID)
 	if errors.Is(err, ErrEmptyID) {
@@ -205,3 +255,43 @@ func validateMenuItem(item *entities.MenuItem) error {
 	}
 	return nil
 }
+
+// Modifiers validation, each modifier is applied on its own to the menu item recipe
+func validateModifiers(item *entities.MenuItem, inventoryIngredients map[string]bool) error {
+	recipe := make(map[string]float64)
+	for _, ingredient := range item.Ingredients {
+		recipe[ingredient.IngredientID] = ingredient.Quantity
+	}
+
+	names := make(map[string]bool)
+	for _, modifier := range item.Modifiers {
+		name := strings.ToLower(strings.TrimSpace(modifier.Name))
+		if name == "" {
+			return ErrEmptyModifierName
+		} else if names[name] {
+			return ErrModifierDuplicate
+		}
+		names[name] = true
+
+		if item.Price+modifier.PriceDelta < 0 {
+			return ErrModifierMakesPriceNegative
+		}
+
+		ingredientList := make(map[string]bool)
+		for _, ingredient := range modifier.Ingredients {
+			if ingredientList[ingredient.IngredientID] {
+				return ErrIngredientDuplicate
+			}
+			ingredientList[ingredient.IngredientID] = true
+
+			if !inventoryIngredients[ingredient.IngredientID] {
+				return ErrIngredientIsNotInInventory
+			} else if ingredient.Quantity == 0 {
+				return ErrZeroIngredientQuantity
+			} else if recipe[ingredient.IngredientID]+ingredient.Quantity < -eps {
+				return fmt.Errorf("%w: %s", ErrModifierRemovesTooMuch, modifier.Name)
+			}
+		}
+	}
+	return nil
+}
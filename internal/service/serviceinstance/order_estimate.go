@@ -0,0 +1,214 @@
+package serviceinstance
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/flag"
+	"hot-coffee/internal/repository"
+)
+
+const (
+	// Closed orders the preparation times are learned from
+	estimateLookback = 30 * 24 * time.Hour
+	// Time the learned preparation times are reused before they are fetched again
+	estimateTTL = time.Minute
+	// Groups with fewer closed orders fall back to the wider group
+	minEstimateSamples = 3
+	// Used until any order is closed
+	defaultPreparationTime = 5 * time.Minute
+)
+
+type itemHour struct {
+	menuItemID int
+	hour       int
+}
+
+// Median preparation times of the closed orders, by menu item and hour of the day the order was opened
+type preparationModel struct {
+	byItemHour map[itemHour]time.Duration
+	byItem     map[int]time.Duration
+	byHour     map[int]time.Duration
+	overall    time.Duration
+	builtAt    time.Time
+}
+
+// Time the barista spent on the order, orders closed without going in progress are counted from the opening
+func preparationDuration(preparation entities.PreparationTime) time.Duration {
+	if !preparation.StartedAt.IsZero() && preparation.StartedAt.Before(preparation.ClosedAt) {
+		return preparation.ClosedAt.Sub(preparation.StartedAt)
+	}
+	return preparation.ClosedAt.Sub(preparation.OpenedAt)
+}
+
+func buildPreparationModel(preparations []entities.PreparationTime, builtAt time.Time) *preparationModel {
+	byItemHour := make(map[itemHour][]time.Duration)
+	byItem := make(map[int][]time.Duration)
+	byHour := make(map[int][]time.Duration)
+	var overall []time.Duration
+
+	for _, preparation := range preparations {
+		duration := preparationDuration(preparation)
+		hour := preparation.OpenedAt.Local().Hour()
+		for _, menuItemID := range preparation.MenuItemIDs {
+			key := itemHour{menuItemID, hour}
+			byItemHour[key] = append(byItemHour[key], duration)
+			byItem[menuItemID] = append(byItem[menuItemID], duration)
+		}
+		byHour[hour] = append(byHour[hour], duration)
+		overall = append(overall, duration)
+	}
+
+	model := &preparationModel{
+		byItemHour: make(map[itemHour]time.Duration),
+		byItem:     make(map[int]time.Duration),
+		byHour:     make(map[int]time.Duration),
+		overall:    defaultPreparationTime,
+		builtAt:    builtAt,
+	}
+	for key, durations := range byItemHour {
+		if len(durations) >= minEstimateSamples {
+			model.byItemHour[key] = medianDuration(durations)
+		}
+	}
+	for key, durations := range byItem {
+		if len(durations) >= minEstimateSamples {
+			model.byItem[key] = medianDuration(durations)
+		}
+	}
+	for key, durations := range byHour {
+		if len(durations) >= minEstimateSamples {
+			model.byHour[key] = medianDuration(durations)
+		}
+	}
+	if len(overall) >= minEstimateSamples {
+		model.overall = medianDuration(overall)
+	}
+	return model
+}
+
+func medianDuration(durations []time.Duration) time.Duration {
+	sort.Slice(durations, func(i, j int) bool {
+		return durations[i] < durations[j]
+	})
+	middle := len(durations) / 2
+	if len(durations)%2 == 0 {
+		return (durations[middle-1] + durations[middle]) / 2
+	}
+	return durations[middle]
+}
+
+// Preparation time of the menu item at the hour, negative hour skips the hourly times
+func (m *preparationModel) itemTime(menuItemID, hour int) time.Duration {
+	if duration, ok := m.byItemHour[itemHour{menuItemID, hour}]; ok {
+		return duration
+	} else if duration, ok := m.byItem[menuItemID]; ok {
+		return duration
+	} else if duration, ok := m.byHour[hour]; ok {
+		return duration
+	}
+	return m.overall
+}
+
+// Items of the order are prepared together, the slowest one decides
+func (m *preparationModel) orderTime(items []entities.OrderItem, hour int) time.Duration {
+	if len(items) == 0 {
+		if duration, ok := m.byHour[hour]; ok {
+			return duration
+		}
+		return m.overall
+	}
+
+	var longest time.Duration
+	for _, item := range items {
+		longest = max(longest, m.itemTime(item.ProductID, hour))
+	}
+	return longest
+}
+
+// Caches the preparation model shared by the concurrent requests
+type readyTimeEstimator struct {
+	repository repository.OrderRepository
+	mu         sync.Mutex
+	model      *preparationModel
+}
+
+func newReadyTimeEstimator(repository repository.OrderRepository) *readyTimeEstimator {
+	return &readyTimeEstimator{repository: repository}
+}
+
+func (e *readyTimeEstimator) preparationModel(ctx context.Context, now time.Time) (*preparationModel, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.model != nil && now.Sub(e.model.builtAt) < estimateTTL {
+		return e.model, nil
+	}
+
+	preparations, err := e.repository.GetPreparationTimes(ctx, now.Add(-estimateLookback), time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	e.model = buildPreparationModel(preparations, now)
+	return e.model, nil
+}
+
+// Time the order is expected to be ready if it is opened now: the queue of the open and
+// in-progress orders shared by --baristas, followed by the preparation of the order itself
+func (s *orderService) estimateReadyAt(ctx context.Context, order entities.Order, now time.Time) (time.Time, error) {
+	model, err := s.estimator.preparationModel(ctx, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	hour := now.Local().Hour()
+
+	page, err := s.repository.GetFiltered(ctx, entities.OrderFilter{
+		Statuses: queueStatuses,
+		SortBy:   entities.OrderSortCreatedAt,
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var queued time.Duration
+	for _, queuedOrder := range page.Orders {
+		if order.ID != "" && queuedOrder.ID == order.ID {
+			continue
+		}
+
+		preparation := model.orderTime(queuedOrder.Items, hour)
+		if queuedOrder.Status == entities.InProgressStatus {
+			startedAt, err := s.startedAt(ctx, queuedOrder.ID)
+			if err != nil {
+				return time.Time{}, err
+			}
+			// Only the rest of the preparation is waited for, late orders are about to be ready
+			preparation = max(preparation-now.Sub(startedAt), 0)
+		}
+		queued += preparation
+	}
+
+	wait := queued / time.Duration(flag.Baristas)
+	return now.Add(wait + model.orderTime(order.Items, hour)).Round(time.Second), nil
+}
+
+// Last time the order went in progress
+func (s *orderService) startedAt(ctx context.Context, idStr string) (time.Time, error) {
+	orderID, _ := strconv.ParseInt(idStr, 10, 64)
+	history, err := s.repository.GetOrderStatusHistory(ctx, orderID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var startedAt time.Time
+	for _, change := range history {
+		if change.NewStatus == entities.InProgressStatus {
+			startedAt = change.ChangedAt
+		}
+	}
+	return startedAt, nil
+}
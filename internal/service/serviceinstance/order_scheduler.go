@@ -0,0 +1,37 @@
+package serviceinstance
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"hot-coffee/internal/flag"
+)
+
+// Opens the pre-orders due every --scheduler-interval until the context is done
+func RunOrderScheduler(ctx context.Context) {
+	ticker := time.NewTicker(flag.SchedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		openDueOrders(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Every run has the time limit of a request
+func openDueOrders(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, flag.Timeout)
+	defer cancel()
+
+	opened, err := OrderService.OpenDueOrders(ctx, time.Now())
+	if err != nil {
+		slog.Error("Error while opening the scheduled orders: ", "error", err.Error())
+	} else if opened > 0 {
+		slog.Info("Scheduled orders opened", "count", opened)
+	}
+}
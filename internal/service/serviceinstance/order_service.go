@@ -1,9 +1,13 @@
 package serviceinstance
 
 import (
+	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"math"
 	"os"
 	"sort"
 	"strconv"
@@ -14,7 +18,9 @@ import (
 	"hot-coffee/internal/core/entities"
 	"hot-coffee/internal/core/errors"
 	"hot-coffee/internal/dto"
+	"hot-coffee/internal/flag"
 	"hot-coffee/internal/repository"
+	"hot-coffee/internal/service"
 	"hot-coffee/internal/utils"
 	"hot-coffee/internal/vo"
 )
@@ -36,6 +42,17 @@ var (
 	ErrNonNumericOrderID           = errors.New("non-numeric id provided")
 	ErrOrderNotExists              = errors.New("order with such id does not exist")
 	ErrOrderAlreadyExists          = errors.New("order with such id already exists")
+	ErrOrderIDCollision            = errors.New("id collision between order id in request body and id in url")
+	ErrOrderVersionMismatch        = errors.New("order was modified by another request, fetch it again")
+	ErrIllegalOrderTransition      = errors.New("illegal order status transition")
+	ErrNegativeTip                 = errors.New("negative tip provided")
+	ErrOrderModifierNotExists      = errors.New("modifier does not exist or is not available for the menu item")
+	ErrOrderModifierDuplicate      = errors.New("modifier is picked twice for the same order item")
+	ErrNegativeOrderItemPrice      = errors.New("modifiers make the order item price negative")
+	ErrPickupInPast                = errors.New("pickup time must be in the future")
+	ErrScheduledWithoutPickup      = errors.New("scheduled order must have a pickup time")
+	// Rolls back the atomic batch, never returned to the client
+	errBatchRolledBack = errors.New("order of the atomic batch rejected")
 	// OrdersCountByPeriod errors
 	ErrPeriodDayInvalid   = errors.New("incorrect period day provided")
 	ErrPeriodTypeInvalid  = errors.New("incorrect period type provided")
@@ -44,154 +61,367 @@ var (
 	// MenuItemsCountByPeriod
 	ErrEndDateEarlierThanStartDate = errors.New("end date is earlier than start date")
 	ErrInvalidDate                 = errors.New("Invalid date for 'endDate' or 'startDate'. Expected format: DD-MM-YYYY.")
+	// OrderThroughput errors
+	ErrInvalidPercentile = errors.New("percentile must be between 1 and 100")
+	// Orders listing errors
+	ErrInvalidStatusFilter    = errors.New("unknown order status provided in status filter")
+	ErrInvalidCreatedAtFilter = errors.New("invalid created_at filter. Expected format: DD.MM.YYYY or RFC 3339")
+	ErrInvalidMenuItemFilter  = errors.New("menu item filter must be a positive integer")
+	ErrInvalidTotalFilter     = errors.New("total filters must be non-negative numbers")
+	ErrMinTotalGreaterThanMax = errors.New("minimal total is greater than maximal total")
+	ErrInvalidSortField       = errors.New("orders can be sorted by created_at, total or order_id")
+	ErrInvalidSortOrder       = errors.New("sort order must be asc or desc")
+	ErrInvalidLimit           = errors.New("limit must be between 1 and 100")
+	ErrInvalidCursor          = errors.New("invalid cursor provided")
+	// Upcoming orders errors
+	ErrInvalidUpcomingMinutes = errors.New("minutes must be an integer between 1 and 1440")
 )
 
+// Statuses reachable from each status, empty status stands for a new order.
+// Every status change must be allowed by this table
+var orderTransitions = map[string][]string{
+	"":                        {entities.OpenStatus, entities.ScheduledStatus},
+	entities.ScheduledStatus:  {entities.OpenStatus, entities.RejectedStatus},
+	entities.OpenStatus:       {entities.InProgressStatus, entities.RejectedStatus},
+	entities.InProgressStatus: {entities.ClosedStatus, entities.RejectedStatus},
+	entities.ClosedStatus:     {},
+	entities.RejectedStatus:   {},
+}
+
+func checkOrderTransition(from, to string) error {
+	if !utils.In(to, orderTransitions[from]) {
+		if from == "" {
+			return fmt.Errorf("%w: order cannot be created as %q", ErrIllegalOrderTransition, to)
+		}
+		return fmt.Errorf("%w: from %q to %q", ErrIllegalOrderTransition, from, to)
+	}
+	return nil
+}
+
+// Final statuses have no transitions, such orders cannot be modified
+func isFinalOrderStatus(status string) bool {
+	return len(orderTransitions[status]) == 0
+}
+
 type orderService struct {
-	repository repository.OrderRepository
+	repository       repository.OrderRepository
+	uow              repository.UnitOfWork
+	inventoryService service.InventoryService
+	promotionService service.PromotionService
+	paymentService   service.PaymentService
+	queueService     service.QueueService
+	webhookService   service.WebhookService
+	customerService  service.CustomerService
+	loyaltyService   service.LoyaltyService
+	estimator        *readyTimeEstimator
 }
 
-func NewOrderService(repository repository.OrderRepository) *orderService {
-	if repository == nil {
+func NewOrderService(repository repository.OrderRepository, uow repository.UnitOfWork, inventoryService service.InventoryService, promotionService service.PromotionService, paymentService service.PaymentService, queueService service.QueueService, webhookService service.WebhookService, customerService service.CustomerService, loyaltyService service.LoyaltyService) *orderService {
+	if repository == nil || uow == nil {
 		slog.Error("Error while creating Order service: Nil pointer repository provided")
 		os.Exit(1)
+	} else if inventoryService == nil {
+		slog.Error("Error while creating Order service: Nil pointer inventory service provided")
+		os.Exit(1)
+	} else if promotionService == nil {
+		slog.Error("Error while creating Order service: Nil pointer promotion service provided")
+		os.Exit(1)
+	} else if paymentService == nil {
+		slog.Error("Error while creating Order service: Nil pointer payment service provided")
+		os.Exit(1)
+	} else if queueService == nil {
+		slog.Error("Error while creating Order service: Nil pointer queue service provided")
+		os.Exit(1)
+	} else if webhookService == nil {
+		slog.Error("Error while creating Order service: Nil pointer webhook service provided")
+		os.Exit(1)
+	} else if customerService == nil {
+		slog.Error("Error while creating Order service: Nil pointer customer service provided")
+		os.Exit(1)
+	} else if loyaltyService == nil {
+		slog.Error("Error while creating Order service: Nil pointer loyalty service provided")
+		os.Exit(1)
+	}
+	return &orderService{repository, uow, inventoryService, promotionService, paymentService, queueService, webhookService, customerService, loyaltyService, newReadyTimeEstimator(repository)}
+}
+
+// Publishes the event with the order as it is in the transaction
+func (s *orderService) publish(ctx context.Context, event entities.OrderEvent) error {
+	order, err := s.repository.GetById(ctx, strconv.FormatInt(event.OrderID, 10))
+	if err != nil {
+		return err
 	}
-	return &orderService{repository}
+	return s.publishOrder(ctx, event, order)
 }
 
-func (s *orderService) CreateOrder(order entities.Order) (int64, error) {
+// Webhook deliveries are written in the transaction of the change,
+// queue subscribers get the event once the change is committed
+func (s *orderService) publishOrder(ctx context.Context, event entities.OrderEvent, order entities.Order) error {
+	err := s.webhookService.Enqueue(ctx, event.Type, entities.OrderEventData{PastStatus: event.PastStatus, Order: order})
+	if err != nil {
+		return err
+	}
+	s.uow.AfterCommit(ctx, func(ctx context.Context) {
+		s.queueService.Publish(ctx, event)
+	})
+	return nil
+}
+
+// Returns the created order with its ID and estimated ready time
+func (s *orderService) CreateOrder(ctx context.Context, order entities.Order) (entities.Order, error) {
 	if order.Status == "" {
 		order.Status = entities.OpenStatus
+		// Pre-order is opened by the scheduler at the lead time before the pickup
+		if order.PickupAt != nil && time.Until(*order.PickupAt) > flag.PreorderLeadTime {
+			order.Status = entities.ScheduledStatus
+		}
 	}
-
-	if err := validateOrder(&order); err != nil && err != ErrEmptyOrderID {
-		return -1, err
+	if order.PickupAt != nil && !order.PickupAt.After(time.Now()) {
+		return order, ErrPickupInPast
 	}
 
-	// Fetch customer customer_id
-	customerID, err := s.repository.GetCustomerIDByName(order.CustomerName, "")
-	if err != nil {
-		return -1, fmt.Errorf("error while fetching the customer name: %w", err)
+	if err := validateOrder(ctx, &order); err != nil && err != ErrEmptyOrderID {
+		return order, err
+	}
+	if err := checkOrderTransition("", order.Status); err != nil {
+		return order, err
 	}
-	order.CustomerID = customerID
 
-	// TODO: Divide deduction from repository layer, move it to service layer
-	orderID, err := s.repository.Create(order)
-	if err != nil {
-		if errors.Is(err, errors.ErrIDAlreadyExists) {
-			return -1, ErrOrderAlreadyExists
+	var orderID int64
+	err := s.uow.Do(ctx, func(ctx context.Context) error {
+		if err := s.customerService.ResolveOrderCustomer(ctx, &order); err != nil {
+			return err
 		}
-		return -1, fmt.Errorf("failed to create order in repository: %w", err)
-	}
 
-	// Set initial status of order
-	err = s.repository.SetOrderStatusHistory(orderID, "", order.Status)
+		if err := s.promotionService.ApplyPromotions(ctx, &order, time.Now()); err != nil {
+			return err
+		}
+		// Loyalty points pay for what the promotions left
+		if err := s.loyaltyService.ApplyRedemption(ctx, &order); err != nil {
+			return err
+		}
+		calculateOrderTotals(&order)
+
+		// Pre-order is expected at the pickup, it is estimated again once opened
+		order.EstimatedReadyAt = order.PickupAt
+		if order.Status == entities.OpenStatus {
+			readyAt, err := s.estimateReadyAt(ctx, order, time.Now())
+			if err != nil {
+				return fmt.Errorf("failed to estimate the ready time: %w", err)
+			}
+			order.EstimatedReadyAt = &readyAt
+		}
+
+		var err error
+		orderID, err = s.repository.Create(ctx, order)
+		if err != nil {
+			if errors.Is(err, errors.ErrIDAlreadyExists) {
+				return ErrOrderAlreadyExists
+			}
+			return fmt.Errorf("failed to create order in repository: %w", err)
+		}
+
+		if err := s.repository.SetOrderDiscounts(ctx, orderID, order.Discounts); err != nil {
+			return fmt.Errorf("failed to save order discounts: %w", err)
+		}
+		if err := s.loyaltyService.SpendRedeemedPoints(ctx, orderID, order); err != nil {
+			return err
+		}
+
+		// Ingredients are taken from the inventory once the order is closed
+		if err := s.inventoryService.ReserveOrderIngredients(ctx, orderID, order.Items); err != nil {
+			return err
+		}
+
+		// Set initial status of order
+		if err := s.repository.SetOrderStatusHistory(ctx, orderID, "", order.Status, ""); err != nil {
+			return fmt.Errorf("failed to save order status history: %w", err)
+		}
+
+		return s.publish(ctx, entities.OrderEvent{Type: entities.OrderCreatedEvent, OrderID: orderID, Status: order.Status})
+	})
 	if err != nil {
-		return -1, fmt.Errorf("failed to save order status history: %w", err)
+		return order, err
 	}
 
-	return orderID, nil
+	order.ID = strconv.FormatInt(orderID, 10)
+	return order, nil
 }
 
 // TODO: Must be optimized in future, to reduce the number of database queries during the request execution
-func (o *orderService) CreateOrders(orders []entities.Order) (vo.BatchResponse, error) {
+// Creates the orders of the batch with the pool of --batch-workers goroutines.
+// Atomic batch creates them one by one in a single transaction, the first rejected order rolls back the whole batch.
+func (o *orderService) CreateOrders(ctx context.Context, orders []dto.BatchOrder, atomic bool) (vo.BatchResponse, error) {
 	response := vo.BatchResponse{
-		OrderReports: nil,
+		OrderReports: make([]dto.OrderReport, len(orders)),
 		Summary: vo.Summary{
-			TotalOrders:      0,
-			Accepted:         0,
-			Rejected:         0,
-			TotalRevenue:     0,
+			TotalOrders:      len(orders),
 			InventoryUpdates: []vo.InventoryUpdate{},
 		},
 	}
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	orderReports := []dto.OrderReport{}
-	var orderIDs []int64 = []int64{}
 
-	for _, order := range orders {
-		wg.Add(1)
-
-		go func(order entities.Order) {
-			defer wg.Done()
-
-			var orderReport dto.OrderReport
-			orderID, err := o.CreateOrder(order)
-
-			// Critical sectiton: changing "response" struct
-			mu.Lock()
-			defer mu.Unlock()
-
-			if err != nil {
-				var errInsufficientIngredient *errors.ErrInsufficientIngredient
-				if errors.As(err, &errInsufficientIngredient) {
-					orderReport.Reason = "insufficient inventory"
-				} else if errors.Is(err, ErrEmptyCustomerName) {
-					orderReport.Reason = "empty customer name"
-				} else if errors.Is(err, ErrMenuItemNotExists) {
-					orderReport.Reason = "non-existing menu item provided"
-				} else if errors.Is(err, ErrNegativeOrderItemQuantity) {
-					orderReport.Reason = "negative product quantity provided"
-				} else if errors.Is(err, ErrZeroOrderItemQuantity) {
-					orderReport.Reason = "zero product quantity provided"
-				} else {
-					orderReport.Reason = "failed to create order due to unhandled errors"
+	// Reports are written by the index of the order, so they follow the request order
+	if atomic {
+		err := o.uow.Do(ctx, func(ctx context.Context) error {
+			for idx, order := range orders {
+				response.OrderReports[idx] = o.createBatchOrder(ctx, order)
+				if response.OrderReports[idx].Status == "rejected" {
+					return errBatchRolledBack
 				}
-				orderReport.Status = "rejected"
-				response.Summary.Rejected++
-				slog.Error("Error while creating the order: ", "error", err.Error())
-			} else {
-				order.ID = strconv.Itoa(int(orderID))
-				orderReport.Status = "accepted"
-				response.Summary.Accepted++
-				orderRevenue, err := o.repository.GetOrderRevenue(orderID)
-				if err != nil {
-					slog.Error("Error while calculating revenue for the created order: ", "order_id", orderID)
-					orderReport.Total = 0
-					orderReport.Reason = "Error occured while calculating the total revenue"
-				} else {
-					orderReport.Total = orderRevenue
-					response.Summary.TotalRevenue += orderRevenue
-				}
-				orderReport.ID = orderID
-				orderIDs = append(orderIDs, orderID)
 			}
-			orderReport.CustomerName = order.CustomerName
-			orderReports = append(orderReports, orderReport)
-		}(order)
-
+			return nil
+		})
+		if errors.Is(err, errBatchRolledBack) {
+			rollBackReports(response.OrderReports, orders)
+			response.Summary.RolledBack = true
+		} else if err != nil {
+			return vo.BatchResponse{}, err
+		}
+	} else {
+		workers := min(flag.BatchWorkers, len(orders))
+		indexes := make(chan int)
+		var wg sync.WaitGroup
+		for range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for idx := range indexes {
+					response.OrderReports[idx] = o.createBatchOrder(ctx, orders[idx])
+				}
+			}()
+		}
+		for idx := range orders {
+			indexes <- idx
+		}
+		close(indexes)
+		wg.Wait()
 	}
 
-	wg.Wait()
-
-	if len(orderReports) != len(orders) {
-		slog.Error("Incorrect number of orders processed:", "number of processed orders", len(orderReports), "number of orders provided to process", len(orders))
+	var orderIDs []int64 = []int64{}
+	for _, orderReport := range response.OrderReports {
+		if orderReport.Status == "accepted" {
+			response.Summary.Accepted++
+			response.Summary.TotalRevenue += orderReport.Total
+			orderIDs = append(orderIDs, orderReport.ID)
+		} else {
+			response.Summary.Rejected++
+		}
 	}
 
+	if len(orderIDs) == 0 {
+		return response, nil
+	}
 	var err error
-	response.OrderReports = orderReports
-	response.Summary.TotalOrders = len(orderReports)
-	response.Summary.InventoryUpdates, err = o.fetchInventoryUpdates(orderIDs)
+	response.Summary.InventoryUpdates, err = o.fetchInventoryUpdates(ctx, orderIDs)
 
 	return response, err
 
 }
 
+// Creates the order of the batch and reports the outcome of it
+func (o *orderService) createBatchOrder(ctx context.Context, order dto.BatchOrder) dto.OrderReport {
+	orderReport := dto.OrderReport{
+		CustomerName: order.CustomerName,
+		Reference:    order.Reference,
+	}
+	created, err := o.CreateOrder(ctx, order.Order)
+	if err != nil {
+		orderReport.Reason = batchRejectionReason(err)
+		orderReport.Status = "rejected"
+		slog.Error("Error while creating the order: ", "error", err.Error())
+		return orderReport
+	}
+
+	orderID, _ := strconv.ParseInt(created.ID, 10, 64)
+	orderReport.ID = orderID
+	orderReport.Status = "accepted"
+	orderRevenue, err := o.repository.GetOrderRevenue(ctx, orderID)
+	if err != nil {
+		slog.Error("Error while calculating revenue for the created order: ", "order_id", orderID)
+		orderReport.Reason = "Error occured while calculating the total revenue"
+	} else {
+		orderReport.Total = orderRevenue
+	}
+	return orderReport
+}
+
+// Reason of the batch order rejection shown to the client
+func batchRejectionReason(err error) string {
+	var errInsufficientIngredient *errors.ErrInsufficientIngredient
+	if errors.As(err, &errInsufficientIngredient) {
+		return "insufficient inventory"
+	} else if errors.Is(err, ErrEmptyCustomerName) {
+		return "empty customer name"
+	} else if errors.Is(err, ErrCustomerNotExists) {
+		return "non-existing customer provided"
+	} else if errors.Is(err, ErrCustomerAnonymized) {
+		return "anonymized customer provided"
+	} else if errors.Is(err, ErrMenuItemNotExists) {
+		return "non-existing menu item provided"
+	} else if errors.Is(err, ErrMenuItemArchived) {
+		return "archived menu item provided"
+	} else if errors.Is(err, ErrInventoryItemArchived) {
+		return "archived ingredient in menu item"
+	} else if errors.Is(err, ErrIllegalOrderTransition) {
+		return "order must be created as open or scheduled"
+	} else if errors.Is(err, ErrNegativeOrderItemQuantity) {
+		return "negative product quantity provided"
+	} else if errors.Is(err, ErrZeroOrderItemQuantity) {
+		return "zero product quantity provided"
+	} else if errors.Is(err, ErrNegativeTip) {
+		return "negative tip provided"
+	} else if errors.Is(err, ErrPickupInPast) {
+		return "pickup time in the past provided"
+	} else if errors.Is(err, ErrOrderModifierNotExists) {
+		return "unavailable modifier provided"
+	} else if errors.Is(err, ErrUnknownPromoCode) {
+		return "unknown promo code provided"
+	} else if errors.Is(err, ErrPromoCodeNotApplicable) {
+		return "promo code cannot be applied"
+	} else if errors.Is(err, ErrNotEnoughPoints) {
+		return "not enough loyalty points"
+	} else if errors.Is(err, ErrNotLoyaltyReward) || errors.Is(err, ErrRewardNotOrdered) ||
+		errors.Is(err, ErrRedemptionExceedsPrice) || errors.Is(err, ErrRedemptionTooSmall) {
+		return "loyalty points cannot be redeemed"
+	}
+	return "failed to create order due to unhandled errors"
+}
+
+// Rejects every order of the rolled back batch, the one which failed it keeps its reason
+func rollBackReports(orderReports []dto.OrderReport, orders []dto.BatchOrder) {
+	for idx := range orderReports {
+		switch orderReports[idx].Status {
+		case "rejected":
+			continue
+		case "accepted":
+			orderReports[idx].Reason = "batch rolled back"
+		default:
+			orderReports[idx].Reason = "not processed, batch rolled back"
+		}
+		orderReports[idx] = dto.OrderReport{
+			CustomerName: orders[idx].CustomerName,
+			Reference:    orders[idx].Reference,
+			Status:       "rejected",
+			Reason:       orderReports[idx].Reason,
+		}
+	}
+}
+
 // TODO: change the location from Order service to Inventory service
 
 // Takes array of Order IDs and return the total inventory updates data
-func (s *orderService) fetchInventoryUpdates(orderIDs []int64) (InventoryUpdates []vo.InventoryUpdate, err error) {
+func (s *orderService) fetchInventoryUpdates(ctx context.Context, orderIDs []int64) (InventoryUpdates []vo.InventoryUpdate, err error) {
 	// Validation
 	for _, orderID := range orderIDs {
 		if orderID < -1 {
 			return nil, ErrNegativeOrderID
 		}
 	}
-	return s.repository.FetchInventoryUpdates(orderIDs)
+	return s.repository.FetchInventoryUpdates(ctx, orderIDs)
 }
 
-func (s *orderService) GetOrders() ([]entities.Order, error) {
-	orders, err := s.repository.GetAll()
+func (s *orderService) GetOrders(ctx context.Context) ([]entities.Order, error) {
+	orders, err := s.repository.GetAll(ctx)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoOrders
@@ -202,13 +432,144 @@ func (s *orderService) GetOrders() ([]entities.Order, error) {
 	return orders, nil
 }
 
-func (s *orderService) GetOrder(id string) (entities.Order, error) {
+const (
+	defaultOrdersLimit = 20
+	maxOrdersLimit     = 100
+)
+
+// Page of orders matching the query, next_cursor of the page continues the listing
+func (s *orderService) ListOrders(ctx context.Context, query dto.OrderQuery) (entities.OrdersPage, error) {
+	filter, err := parseOrderQuery(query)
+	if err != nil {
+		return entities.OrdersPage{}, err
+	}
+
+	page, err := s.repository.GetFiltered(ctx, filter)
+	if err != nil {
+		return entities.OrdersPage{}, err
+	}
+
+	if page.Next != nil {
+		raw, err := json.Marshal(page.Next)
+		if err != nil {
+			return entities.OrdersPage{}, err
+		}
+		page.NextCursor = base64.RawURLEncoding.EncodeToString(raw)
+	}
+	return page, nil
+}
+
+func parseOrderQuery(query dto.OrderQuery) (entities.OrderFilter, error) {
+	filter := entities.OrderFilter{
+		Status:   query.Status,
+		Customer: strings.TrimSpace(query.Customer),
+		SortBy:   entities.OrderSortCreatedAt,
+		Limit:    defaultOrdersLimit,
+	}
+
+	if filter.Status != "" {
+		if _, exists := orderTransitions[filter.Status]; !exists {
+			return filter, ErrInvalidStatusFilter
+		}
+	}
+
+	var err error
+	if query.CreatedFrom != "" {
+		if filter.CreatedFrom, _, err = parseOrderTime(query.CreatedFrom); err != nil {
+			return filter, err
+		}
+	}
+	if query.CreatedTo != "" {
+		var wholeDay bool
+		if filter.CreatedTo, wholeDay, err = parseOrderTime(query.CreatedTo); err != nil {
+			return filter, err
+		}
+		// The end date is included entirely
+		if wholeDay {
+			filter.CreatedTo = filter.CreatedTo.AddDate(0, 0, 1)
+		}
+	}
+
+	if query.MenuItemID != "" {
+		if filter.MenuItemID, err = strconv.Atoi(query.MenuItemID); err != nil || filter.MenuItemID <= 0 {
+			return filter, ErrInvalidMenuItemFilter
+		}
+	}
+
+	if query.MinTotal != "" {
+		if filter.MinTotal, err = strconv.ParseFloat(query.MinTotal, 64); err != nil || filter.MinTotal < 0 {
+			return filter, ErrInvalidTotalFilter
+		}
+	}
+	if query.MaxTotal != "" {
+		if filter.MaxTotal, err = strconv.ParseFloat(query.MaxTotal, 64); err != nil || filter.MaxTotal < 0 {
+			return filter, ErrInvalidTotalFilter
+		}
+	}
+	if filter.MaxTotal != 0 && filter.MinTotal > filter.MaxTotal {
+		return filter, ErrMinTotalGreaterThanMax
+	}
+
+	switch query.SortBy {
+	case "":
+	case entities.OrderSortCreatedAt, entities.OrderSortTotal, entities.OrderSortID:
+		filter.SortBy = query.SortBy
+	default:
+		return filter, ErrInvalidSortField
+	}
+
+	switch strings.ToLower(query.Order) {
+	case "", "asc":
+	case "desc":
+		filter.Descending = true
+	default:
+		return filter, ErrInvalidSortOrder
+	}
+
+	if query.Limit != "" {
+		if filter.Limit, err = strconv.Atoi(query.Limit); err != nil || filter.Limit < 1 || filter.Limit > maxOrdersLimit {
+			return filter, ErrInvalidLimit
+		}
+	}
+
+	if query.Cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+		if err != nil {
+			return filter, ErrInvalidCursor
+		}
+		var cursor entities.OrderCursor
+		if err := json.Unmarshal(raw, &cursor); err != nil {
+			return filter, ErrInvalidCursor
+		}
+		// The cursor is a position in the sort it was issued for
+		if cursor.SortBy != filter.SortBy {
+			return filter, ErrInvalidCursor
+		}
+		filter.After = &cursor
+	}
+
+	return filter, nil
+}
+
+// Parses RFC 3339 timestamp or the date, reports whether the date was provided
+func parseOrderTime(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	t, err := time.ParseInLocation(dateLayout, value, time.Local)
+	if err != nil {
+		return time.Time{}, false, ErrInvalidCreatedAtFilter
+	}
+	return t, true, nil
+}
+
+func (s *orderService) GetOrder(ctx context.Context, id string) (entities.Order, error) {
 	err := isValidID(id)
 	if err != nil {
 		return entities.Order{}, err
 	}
 
-	order, err := s.repository.GetById(id)
+	order, err := s.repository.GetById(ctx, id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return entities.Order{}, ErrOrderNotExists
@@ -218,139 +579,340 @@ func (s *orderService) GetOrder(id string) (entities.Order, error) {
 	return order, nil
 }
 
-func (s *orderService) GetOrderRevenue(orderIDstr string) (float64, error) {
+func (s *orderService) GetOrderRevenue(ctx context.Context, orderIDstr string) (float64, error) {
 	orderID, err := strconv.Atoi(orderIDstr)
 	if err != nil {
 		return 0, errors.NewErrNonIntegerID("order", orderIDstr)
 	}
 
-	return s.repository.GetOrderRevenue(int64(orderID))
+	return s.repository.GetOrderRevenue(ctx, int64(orderID))
 }
 
-func (s *orderService) UpdateOrder(idStr string, order entities.Order) error {
-	if err := validateOrder(&order); err != nil {
+func (s *orderService) UpdateOrder(ctx context.Context, idStr string, order entities.Order) error {
+	if err := validateOrder(ctx, &order); err != nil {
 		return err
 	}
 	if idStr != order.ID {
-		return ErrInventoryItemIDCollision
+		return ErrOrderIDCollision
 	}
 
-	orderDB, err := s.repository.GetById(idStr)
+	orderID, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		return err
+		return ErrNonNumericOrderID
 	}
-	pastStatus := orderDB.Status
 
-	customerID, err := s.repository.GetCustomerIDByName(order.CustomerName, "")
-	if err != nil {
-		return err
-	}
+	return s.uow.Do(ctx, func(ctx context.Context) error {
+		orderDB, err := s.repository.GetById(ctx, idStr)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrOrderNotExists
+			}
+			return err
+		}
+		pastStatus := orderDB.Status
 
-	if customerID != order.CustomerID {
-		order.CustomerID = customerID
-	}
+		// Pickup of the late pre-order can be kept, but not moved to the past
+		pickupMoved := order.PickupAt != nil && (orderDB.PickupAt == nil || !order.PickupAt.Equal(*orderDB.PickupAt))
+		if pickupMoved && !order.PickupAt.After(time.Now()) {
+			return ErrPickupInPast
+		}
 
-	// TODO: Make atomic fetch and update
-	err = s.repository.Update(idStr, order)
-	if err != nil {
-		return err
-	}
+		if order.Version != 0 && order.Version != orderDB.Version {
+			return ErrOrderVersionMismatch
+		} else if isFinalOrderStatus(pastStatus) {
+			return ErrClosedOrderCannotBeModified
+		} else if pastStatus != order.Status {
+			if err := checkOrderTransition(pastStatus, order.Status); err != nil {
+				return err
+			}
+		}
 
-	// if orderDB.Status == "in progress" {
-	// 	if err := validateSufficienceOfIngredients(order); err != nil {
-	// 		return err
-	// 	}
-	// }
+		// Order keeps its customer unless another customer or another name is given,
+		// the kept customer is not resolved again so anonymized customers keep their orders
+		if order.CustomerID == 0 && order.CustomerName == orderDB.CustomerName || order.CustomerID == orderDB.CustomerID {
+			order.CustomerID = orderDB.CustomerID
+			order.CustomerName = orderDB.CustomerName
+		} else if err := s.customerService.ResolveOrderCustomer(ctx, &order); err != nil {
+			return err
+		}
 
-	if pastStatus != order.Status {
-		if err := s.updateOrderStatusHistory(idStr, pastStatus, order.Status); err != nil {
+		// Replace reservation of the old items by the new ones
+		if err := s.inventoryService.ReleaseOrderIngredients(ctx, orderID); err != nil {
 			return err
 		}
-	}
 
-	return nil
+		// Order to be rejected gets nothing reserved, the rejection gives the points back
+		if err := s.promotionService.ReleasePromotions(ctx, orderDB.Discounts); err != nil {
+			return err
+		}
+		order.Discounts = nil
+		if order.Status != entities.RejectedStatus {
+			if err := s.inventoryService.ReserveOrderIngredients(ctx, orderID, order.Items); err != nil {
+				return err
+			}
+			// Discounts are evaluated again for the new items at the moment the order was placed,
+			// the promo codes of the order are kept unless the request lists the codes
+			if order.PromoCodes == nil {
+				if order.PromoCodes, err = s.promotionService.PromoCodes(ctx, orderDB.Discounts); err != nil {
+					return err
+				}
+			}
+			placedAt, err := time.Parse(time.RFC3339Nano, orderDB.CreatedAt)
+			if err != nil {
+				return err
+			}
+			if err := s.promotionService.ApplyPromotions(ctx, &order, placedAt); err != nil {
+				return err
+			}
+			keepRedemptions(&order, orderDB.Discounts)
+		}
+		calculateOrderTotals(&order)
+
+		// Paid orders cannot become cheaper than the money taken
+		if order.Status != entities.RejectedStatus {
+			if err := s.paymentService.CheckNotOverpaid(ctx, order); err != nil {
+				return err
+			}
+		}
+
+		// The status is changed by the transition after the new items are saved
+		status := order.Status
+		order.Status = pastStatus
+		if err := s.repository.Update(ctx, idStr, order); err != nil {
+			if errors.Is(err, errors.ErrVersionMismatch) {
+				return ErrOrderVersionMismatch
+			}
+			return err
+		}
+		if err := s.repository.SetOrderDiscounts(ctx, orderID, order.Discounts); err != nil {
+			return err
+		}
+		if err := s.publish(ctx, entities.OrderEvent{Type: entities.OrderUpdatedEvent, OrderID: orderID, Status: pastStatus}); err != nil {
+			return err
+		}
+
+		if status != pastStatus {
+			return s.TransitionOrder(ctx, idStr, status, "")
+		}
+		return nil
+	})
 }
 
-func (s *orderService) DeleteOrder(id string) error {
-	if err := s.repository.Delete(id); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return ErrOrderNotExists
+// Deleted order is published with its last state
+func (s *orderService) DeleteOrder(ctx context.Context, id string) error {
+	return s.uow.Do(ctx, func(ctx context.Context) error {
+		order, err := s.repository.GetById(ctx, id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrOrderNotExists
+			}
+			return err
 		}
-		return err
-	}
-	return nil
+
+		// Payments would vanish with the order, the money must be refunded first
+		if err := s.paymentService.CheckNothingPaid(ctx, order); err != nil {
+			return err
+		}
+
+		// Ingredients, promotion usages and loyalty points of the not finished order are available again
+		orderID, _ := strconv.ParseInt(id, 10, 64)
+		if err := s.inventoryService.ReleaseOrderIngredients(ctx, orderID); err != nil {
+			return err
+		}
+		if !isFinalOrderStatus(order.Status) {
+			if err := s.promotionService.ReleasePromotions(ctx, order.Discounts); err != nil {
+				return err
+			}
+			if err := s.loyaltyService.RestorePoints(ctx, orderID, order.CustomerID); err != nil {
+				return err
+			}
+		}
+
+		if err := s.repository.Delete(ctx, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrOrderNotExists
+			}
+			return err
+		}
+		return s.publishOrder(ctx, entities.OrderEvent{Type: entities.OrderDeletedEvent, OrderID: orderID}, order)
+	})
 }
 
-func (s *orderService) CloseOrder(idStr string) error {
-	order, err := s.GetOrder(idStr)
-	if err != nil {
-		return err
-	}
+func (s *orderService) CloseOrder(ctx context.Context, idStr string) error {
+	return s.TransitionOrder(ctx, idStr, entities.ClosedStatus, "")
+}
+
+func (s *orderService) SetInProgress(ctx context.Context, idStr string) error {
+	return s.TransitionOrder(ctx, idStr, entities.InProgressStatus, "")
+}
 
-	if order.Status != "in progress" {
+// Moves the order to the status allowed by the transition table and records the change with the reason
+func (s *orderService) TransitionOrder(ctx context.Context, idStr, status, reason string) error {
+	if !utils.In(status, entities.Statuses) {
 		return ErrIncorrectOrderStatus
 	}
 
-	// Update status and record the change
-	if err := s.updateOrderStatusHistory(idStr, order.Status, "closed"); err != nil {
-		return err
-	}
+	return s.uow.Do(ctx, func(ctx context.Context) error {
+		order, err := s.GetOrder(ctx, idStr)
+		if err != nil {
+			return err
+		}
+		orderID, _ := strconv.ParseInt(order.ID, 10, 64)
+
+		if err := checkOrderTransition(order.Status, status); err != nil {
+			return err
+		}
+		// Opened pre-order joins the queue, it cannot be ready before the pickup
+		if order.Status == entities.ScheduledStatus && status == entities.OpenStatus {
+			readyAt, err := s.estimateReadyAt(ctx, order, time.Now())
+			if err != nil {
+				return err
+			}
+			if order.PickupAt != nil && order.PickupAt.After(readyAt) {
+				readyAt = *order.PickupAt
+			}
+			if err := s.repository.SetEstimatedReadyAt(ctx, orderID, readyAt); err != nil {
+				return err
+			}
+		}
+		if status == entities.ClosedStatus {
+			if err := s.paymentService.CheckSettled(ctx, order); err != nil {
+				return err
+			}
+			// Reserved ingredients are taken from the inventory
+			if err := s.inventoryService.CommitOrderIngredients(ctx, orderID); err != nil {
+				return err
+			}
+			if err := s.loyaltyService.EarnPoints(ctx, orderID, order); err != nil {
+				return err
+			}
+		}
 
-	order.Status = "closed"
-	return s.repository.Update(idStr, order)
+		// Moves only if nobody changed the status after it was fetched
+		if err := s.repository.UpdateStatus(ctx, orderID, order.Status, status); err != nil {
+			if errors.Is(err, errors.ErrVersionMismatch) {
+				return ErrOrderVersionMismatch
+			} else if errors.Is(err, sql.ErrNoRows) {
+				return ErrOrderNotExists
+			}
+			return err
+		}
+
+		// Rejected order releases the ingredients and gives the promotion usages and loyalty points back
+		if status == entities.RejectedStatus {
+			if err := s.inventoryService.ReleaseOrderIngredients(ctx, orderID); err != nil {
+				return err
+			}
+			if err := s.loyaltyService.RestorePoints(ctx, orderID, order.CustomerID); err != nil {
+				return err
+			}
+			if err := s.promotionService.ReleasePromotions(ctx, order.Discounts); err != nil {
+				return err
+			}
+			if err := s.repository.SetOrderDiscounts(ctx, orderID, nil); err != nil {
+				return err
+			}
+		}
+
+		if err := s.repository.SetOrderStatusHistory(ctx, orderID, order.Status, status, reason); err != nil {
+			return err
+		}
+
+		return s.publish(ctx, entities.OrderEvent{Type: entities.OrderStatusChangedEvent, OrderID: orderID, PastStatus: order.Status, Status: status})
+	})
 }
 
-func (s *orderService) updateOrderStatusHistory(idStr, oldStatus, newStatus string) error {
-	id, err := strconv.Atoi(idStr)
+// Returns status changes of the order with the time spent in each status
+func (s *orderService) GetOrderHistory(ctx context.Context, idStr string) (entities.OrderHistory, error) {
+	order, err := s.GetOrder(ctx, idStr)
 	if err != nil {
-		return err
+		return entities.OrderHistory{}, err
 	}
-	return s.repository.SetOrderStatusHistory(int64(id), oldStatus, newStatus)
-}
+	orderID, _ := strconv.ParseInt(order.ID, 10, 64)
 
-func (s *orderService) SetInProgress(id string) error {
-	order, err := s.GetOrder(id)
+	transitions, err := s.repository.GetOrderStatusHistory(ctx, orderID)
 	if err != nil {
-		return err
+		return entities.OrderHistory{}, err
 	}
-	order.Status = entities.ClosedStatus
-	return s.repository.Update(id, order)
 
-}
+	now := time.Now()
+	for idx := range transitions {
+		var until time.Time
+		if idx+1 < len(transitions) {
+			until = transitions[idx+1].ChangedAt
+		} else if !isFinalOrderStatus(transitions[idx].NewStatus) {
+			until = now
+		} else {
+			continue
+		}
+		transitions[idx].DurationSeconds = roundSeconds(until.Sub(transitions[idx].ChangedAt).Seconds())
+	}
 
-var menuItemsMap map[int]bool = make(map[int]bool)
+	return entities.OrderHistory{
+		OrderID:     order.ID,
+		Status:      order.Status,
+		Transitions: transitions,
+	}, nil
+}
 
-func validateOrder(order *entities.Order) error {
-	if order.CustomerName == "" {
+func validateOrder(ctx context.Context, order *entities.Order) error {
+	if order.CustomerName == "" && order.CustomerID == 0 {
 		return ErrEmptyCustomerName
 	} else if !utils.In(order.Status, entities.Statuses) {
 		return ErrIncorrectOrderStatus
 	} else if len(order.Items) == 0 {
 		return ErrNoItemsInOrder
+	} else if order.Tip < 0 {
+		return ErrNegativeTip
+	} else if order.Status == entities.ScheduledStatus && order.PickupAt == nil {
+		return ErrScheduledWithoutPickup
 	}
 
-	// Validate presence of order items in menu
-	if len(menuItemsMap) == 0 {
-		// TODO: On Update of menu items update this map
-		menuItemsList, err := MenuService.GetMenuItems()
+	// Products validation
+	for idx, item := range order.Items {
+		if item.ProductID < 1 {
+			return ErrMenuItemNotExists
+		}
+
+		// Archived menu items are kept for old orders only
+		menuItem, err := MenuService.GetMenuItem(ctx, strconv.Itoa(item.ProductID))
 		if err != nil {
 			return err
+		} else if menuItem.DeletedAt != "" {
+			return ErrMenuItemArchived
 		}
-		for _, menuItem := range menuItemsList {
-			menuItemID, _ := strconv.Atoi(menuItem.ID)
-			menuItemsMap[menuItemID] = true
-		}
-	}
 
-	// Products validation
-	for _, item := range order.Items {
-		if _, exists := menuItemsMap[item.ProductID]; !exists {
-			return ErrMenuItemNotExists
-		} else if item.Quantity < 0 {
+		if item.Quantity < 0 {
 			return ErrNegativeOrderItemQuantity
 		} else if item.Quantity == 0 {
 			return ErrZeroOrderItemQuantity
 		}
+
+		// Picked modifiers change the price and the ingredients of the item
+		unitPrice := menuItem.Price
+		picked := make(map[int64]bool)
+		for _, modifierID := range item.ModifierIDs {
+			modifier, ok := menuItem.Modifier(modifierID)
+			if !ok || modifier.DeletedAt != "" {
+				return fmt.Errorf("%w: %d", ErrOrderModifierNotExists, modifierID)
+			} else if picked[modifierID] {
+				return ErrOrderModifierDuplicate
+			}
+			picked[modifierID] = true
+			unitPrice += modifier.PriceDelta
+		}
+		if unitPrice < 0 {
+			return ErrNegativeOrderItemPrice
+		}
+
+		// Reports use the prices of the moment the order was written
+		unitCost, err := ingredientsCost(ctx, menuItem.ModifiedIngredients(item.ModifierIDs))
+		if err != nil {
+			return err
+		}
+		order.Items[idx].UnitPrice = unitPrice
+		order.Items[idx].UnitCost = unitCost
+		order.Items[idx].TaxRate = menuItemTaxRate(menuItem)
 	}
 
 	// ID Validation
@@ -368,6 +930,60 @@ func validateOrder(order *entities.Order) error {
 	return nil
 }
 
+// Current cost of the ingredient quantities
+func ingredientsCost(ctx context.Context, ingredients map[string]float64) (float64, error) {
+	var cost float64
+	for ingredientID, quantity := range ingredients {
+		inventoryItem, err := InventoryService.GetInventoryItem(ctx, ingredientID)
+		if err != nil {
+			return 0, fmt.Errorf("error while getting ingredient cost: %w", err)
+		}
+		cost += quantity * inventoryItem.Price
+	}
+	return cost, nil
+}
+
+// Tax percent of the menu item category, the default one if category has no own rate
+func menuItemTaxRate(menuItem entities.MenuItem) float64 {
+	if rate, ok := flag.CategoryTaxRates[menuItem.Category]; ok {
+		return rate
+	}
+	return flag.TaxRate
+}
+
+// Calculates the amounts of the order from its items, discounts and tip.
+// Discounts are spread over the items proportionally to their price, so
+// tax and service charge are taken from the discounted amounts.
+func calculateOrderTotals(order *entities.Order) {
+	var subtotal, discountTotal, tax float64
+	for _, item := range order.Items {
+		subtotal += item.UnitPrice * float64(item.Quantity)
+	}
+	for _, discount := range order.Discounts {
+		discountTotal += discount.Amount
+	}
+	discountTotal = math.Min(discountTotal, subtotal)
+
+	discountedShare := 1.0
+	if subtotal > 0 {
+		discountedShare = 1 - discountTotal/subtotal
+	}
+	for _, item := range order.Items {
+		tax += item.UnitPrice * float64(item.Quantity) * discountedShare * item.TaxRate / 100
+	}
+
+	order.Subtotal = roundMoney(subtotal)
+	order.DiscountTotal = roundMoney(discountTotal)
+	order.Tax = roundMoney(tax)
+	order.ServiceCharge = roundMoney((subtotal - discountTotal) * flag.ServiceCharge / 100)
+	order.Tip = roundMoney(order.Tip)
+	order.GrandTotal = roundMoney(order.Subtotal - order.DiscountTotal + order.Tax + order.ServiceCharge + order.Tip)
+}
+
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
 // func validateSufficienceOfIngredients(order entities.Order) error {
 // 	ingredients := make(map[string]float64)
 // 	for _, orderItem := range order.Items {
@@ -425,9 +1041,9 @@ func validateOrder(order *entities.Order) error {
 // 	return nil
 // }
 
-func (o *orderService) GetTotalSales() (entities.TotalSales, error) {
-	var res float64 = 0.0
-	orders, err := o.GetOrders()
+func (o *orderService) GetTotalSales(ctx context.Context) (entities.TotalSales, error) {
+	var res, tax float64
+	orders, err := o.GetOrders(ctx)
 	if err != nil {
 		return entities.TotalSales{}, err
 	}
@@ -435,22 +1051,21 @@ func (o *orderService) GetTotalSales() (entities.TotalSales, error) {
 	for _, order := range orders {
 		if order.Status == entities.ClosedStatus {
 			for _, orderItem := range order.Items {
-				productID := strconv.Itoa(orderItem.ProductID)
-				menuItem, err := MenuService.GetMenuItem(productID)
-				if err != nil {
-					return entities.TotalSales{}, err
-				}
-				res += menuItem.Price * float64(orderItem.Quantity)
+				res += orderItem.UnitPrice * float64(orderItem.Quantity)
 			}
+			for _, discount := range order.Discounts {
+				res -= discount.Amount
+			}
+			tax += order.Tax
 		}
 	}
 
-	return entities.TotalSales{Total: res}, nil
+	return entities.TotalSales{Total: res, Tax: roundMoney(tax)}, nil
 }
 
 // TODO: Refactor and optimize
-func (o *orderService) GetPopularMenuItems() ([]entities.MenuItemSales, error) {
-	orders, err := o.GetOrders()
+func (o *orderService) GetPopularMenuItems(ctx context.Context) ([]entities.MenuItemSales, error) {
+	orders, err := o.GetOrders(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -468,7 +1083,7 @@ func (o *orderService) GetPopularMenuItems() ([]entities.MenuItemSales, error) {
 	itemsSalesCount := make(entities.MenuItemSalesByCount, 0, len(itemSalesCount))
 	for menuItemID, salesCount := range itemSalesCount {
 		menuItemIDString := strconv.Itoa(menuItemID)
-		menuItem, err := MenuService.GetMenuItem(menuItemIDString)
+		menuItem, err := MenuService.GetMenuItem(ctx, menuItemIDString)
 		if err != nil {
 			return nil, err
 		}
@@ -493,19 +1108,70 @@ func (o *orderService) GetPopularMenuItems() ([]entities.MenuItemSales, error) {
 	return highestSales, nil
 }
 
-func (o *orderService) GetOpenOrders() ([]entities.Order, error) {
-	orders, err := o.repository.GetAll()
+func (o *orderService) GetOpenOrders(ctx context.Context) ([]entities.Order, error) {
+	page, err := o.repository.GetFiltered(ctx, entities.OrderFilter{
+		Status: entities.OpenStatus,
+		SortBy: entities.OrderSortCreatedAt,
+	})
 	if err != nil {
-		return []entities.Order{}, nil
+		return nil, err
 	}
-	openOrders := []entities.Order{}
-	for _, order := range orders {
-		if order.Status == entities.OpenStatus {
-			openOrders = append(openOrders, order)
+	return page.Orders, nil
+}
+
+// Opens the scheduled pre-orders picked up within the lead time, returns the number of opened ones
+func (o *orderService) OpenDueOrders(ctx context.Context, now time.Time) (int, error) {
+	page, err := o.repository.GetFiltered(ctx, entities.OrderFilter{
+		Status:   entities.ScheduledStatus,
+		PickupTo: now.Add(flag.PreorderLeadTime),
+		SortBy:   entities.OrderSortCreatedAt,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	opened := 0
+	for _, order := range page.Orders {
+		reason := "pickup at " + order.PickupAt.Format(time.RFC3339)
+		err := o.TransitionOrder(ctx, order.ID, entities.OpenStatus, reason)
+		// Rejected, opened or deleted since it was listed
+		if errors.Is(err, ErrIllegalOrderTransition) || errors.Is(err, ErrOrderVersionMismatch) || errors.Is(err, ErrOrderNotExists) {
+			continue
+		} else if err != nil {
+			return opened, err
+		}
+		opened++
+	}
+	return opened, nil
+}
+
+const (
+	defaultUpcomingMinutes = 60
+	maxUpcomingMinutes     = 24 * 60
+)
+
+// Not finished pre-orders picked up in the next minutes, late ones included, earliest pickup first
+func (o *orderService) GetUpcomingOrders(ctx context.Context, minutesStr string) ([]entities.Order, error) {
+	minutes := defaultUpcomingMinutes
+	if minutesStr != "" {
+		var err error
+		if minutes, err = strconv.Atoi(minutesStr); err != nil || minutes < 1 || minutes > maxUpcomingMinutes {
+			return nil, ErrInvalidUpcomingMinutes
 		}
 	}
 
-	return openOrders, nil
+	page, err := o.repository.GetFiltered(ctx, entities.OrderFilter{
+		Statuses: []string{entities.ScheduledStatus, entities.OpenStatus, entities.InProgressStatus},
+		PickupTo: time.Now().Add(time.Duration(minutes) * time.Minute),
+		SortBy:   entities.OrderSortCreatedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(page.Orders, func(i, j int) bool {
+		return page.Orders[i].PickupAt.Before(*page.Orders[j].PickupAt)
+	})
+	return page.Orders, nil
 }
 
 var monthCapitalized = map[string]string{
@@ -523,7 +1189,7 @@ var monthCapitalized = map[string]string{
 	"december":  "December",
 }
 
-func (o *orderService) GetOrderedItemsByPeriod(period, month string, year int) (entities.OrderedItemsCountByPeriod, error) {
+func (o *orderService) GetOrderedItemsByPeriod(ctx context.Context, period, month string, year int) (entities.OrderedItemsCountByPeriod, error) {
 	orderedItemsCountByPeriod := entities.OrderedItemsCountByPeriod{}
 	if period != "month" && period != "day" {
 		return orderedItemsCountByPeriod, ErrPeriodTypeInvalid
@@ -546,7 +1212,7 @@ func (o *orderService) GetOrderedItemsByPeriod(period, month string, year int) (
 		}
 	}
 
-	itemsCount, err := o.repository.GetOrderedItemsCountByPeriod(period, month, year)
+	itemsCount, err := o.repository.GetOrderedItemsCountByPeriod(ctx, period, month, year)
 	if err != nil {
 		return orderedItemsCountByPeriod, err
 	}
@@ -561,10 +1227,10 @@ func (o *orderService) GetOrderedItemsByPeriod(period, month string, year int) (
 
 var dateLayout = "02.01.2006"
 
-func (o *orderService) GetOrderedMenuItemsCountByPeriod(startDateStr, endDateStr string) (entities.OrderedMenuItemsCount, error) {
+func (o *orderService) GetOrderedMenuItemsCountByPeriod(ctx context.Context, startDateStr, endDateStr string) (entities.OrderedMenuItemsCount, error) {
 	// ✅ If both dates are empty, return all orders
 	if startDateStr == "" && endDateStr == "" {
-		return o.repository.GetOrderedMenuItemsCountByPeriod(time.Time{}, time.Time{})
+		return o.repository.GetOrderedMenuItemsCountByPeriod(ctx, time.Time{}, time.Time{})
 	}
 	// when no startDate or endDate
 	if startDateStr == "" {
@@ -572,13 +1238,13 @@ func (o *orderService) GetOrderedMenuItemsCountByPeriod(startDateStr, endDateStr
 		if err != nil {
 			return entities.OrderedMenuItemsCount{}, ErrInvalidDate
 		}
-		return o.repository.GetOrderedMenuItemsCountByPeriod(time.Time{}, endDate)
+		return o.repository.GetOrderedMenuItemsCountByPeriod(ctx, time.Time{}, endDate)
 	} else if endDateStr == "" {
 		startDate, err := time.Parse(dateLayout, startDateStr)
 		if err != nil {
 			return entities.OrderedMenuItemsCount{}, ErrInvalidDate
 		}
-		return o.repository.GetOrderedMenuItemsCountByPeriod(startDate, time.Time{})
+		return o.repository.GetOrderedMenuItemsCountByPeriod(ctx, startDate, time.Time{})
 	}
 
 	//When both
@@ -594,5 +1260,178 @@ func (o *orderService) GetOrderedMenuItemsCountByPeriod(startDateStr, endDateStr
 	if diff := endDate.Sub(startDate); diff < 0 {
 		return entities.OrderedMenuItemsCount{}, ErrEndDateEarlierThanStartDate
 	}
-	return o.repository.GetOrderedMenuItemsCountByPeriod(startDate, endDate)
+	return o.repository.GetOrderedMenuItemsCountByPeriod(ctx, startDate, endDate)
+}
+
+const defaultThroughputPercentile = 90
+
+// Average and percentile time from open to closed of orders closed on each day of the period
+func (o *orderService) GetOrderThroughput(ctx context.Context, startDateStr, endDateStr string, percentile int) (entities.OrderThroughputReport, error) {
+	report := entities.OrderThroughputReport{Days: []entities.OrderThroughput{}}
+
+	if percentile == 0 {
+		percentile = defaultThroughputPercentile
+	} else if percentile < 1 || percentile > 100 {
+		return report, ErrInvalidPercentile
+	}
+	report.Percentile = percentile
+
+	startDate, endDate, err := parseReportPeriod(startDateStr, endDateStr)
+	if err != nil {
+		return report, err
+	}
+
+	closeTimes, err := o.repository.GetOrderCloseTimes(ctx, startDate, endDate)
+	if err != nil {
+		return report, err
+	}
+
+	durationsByDay := make(map[string][]float64)
+	for _, closeTime := range closeTimes {
+		day := closeTime.ClosedAt.Local().Format(time.DateOnly)
+		durationsByDay[day] = append(durationsByDay[day], closeTime.ClosedAt.Sub(closeTime.OpenedAt).Seconds())
+	}
+
+	for day, durations := range durationsByDay {
+		sort.Float64s(durations)
+
+		var total float64
+		for _, duration := range durations {
+			total += duration
+		}
+
+		// Nearest-rank percentile
+		rank := int(math.Ceil(float64(percentile) / 100 * float64(len(durations))))
+		report.Days = append(report.Days, entities.OrderThroughput{
+			Date:              day,
+			ClosedOrders:      len(durations),
+			AverageSeconds:    roundSeconds(total / float64(len(durations))),
+			PercentileSeconds: roundSeconds(durations[rank-1]),
+		})
+	}
+
+	sort.Slice(report.Days, func(i, j int) bool {
+		return report.Days[i].Date < report.Days[j].Date
+	})
+	return report, nil
+}
+
+// Period of the report, empty date leaves the period unbounded and the end date is included entirely
+func parseReportPeriod(startDateStr, endDateStr string) (startDate, endDate time.Time, err error) {
+	if startDateStr != "" {
+		if startDate, err = time.ParseInLocation(dateLayout, startDateStr, time.Local); err != nil {
+			return startDate, endDate, ErrInvalidDate
+		}
+	}
+	if endDateStr != "" {
+		if endDate, err = time.ParseInLocation(dateLayout, endDateStr, time.Local); err != nil {
+			return startDate, endDate, ErrInvalidDate
+		}
+		endDate = endDate.AddDate(0, 0, 1)
+	}
+	if !startDate.IsZero() && !endDate.IsZero() && !endDate.After(startDate) {
+		return startDate, endDate, ErrEndDateEarlierThanStartDate
+	}
+	return startDate, endDate, nil
+}
+
+// Sums of the ready time errors of the group
+type readyTimeErrors struct {
+	orders   int
+	total    float64
+	absolute float64
+	onTime   int
+}
+
+func (e *readyTimeErrors) add(seconds float64) {
+	e.orders++
+	e.total += seconds
+	e.absolute += math.Abs(seconds)
+	if seconds <= 0 {
+		e.onTime++
+	}
+}
+
+func (e readyTimeErrors) accuracy() entities.ReadyTimeAccuracy {
+	if e.orders == 0 {
+		return entities.ReadyTimeAccuracy{}
+	}
+	return entities.ReadyTimeAccuracy{
+		Orders:                   e.orders,
+		MeanErrorSeconds:         roundSeconds(e.total / float64(e.orders)),
+		MeanAbsoluteErrorSeconds: roundSeconds(e.absolute / float64(e.orders)),
+		OnTimePercent:            roundMoney(float64(e.onTime) / float64(e.orders) * 100),
+	}
+}
+
+// Estimated ready times of the orders closed in the period compared with their close times,
+// overall, by hour of the day the order was opened and by menu item
+func (o *orderService) GetReadyTimeReport(ctx context.Context, startDateStr, endDateStr string) (entities.ReadyTimeReport, error) {
+	report := entities.ReadyTimeReport{
+		ByHour:     []entities.HourReadyTimeAccuracy{},
+		ByMenuItem: []entities.MenuItemReadyTimeAccuracy{},
+	}
+
+	startDate, endDate, err := parseReportPeriod(startDateStr, endDateStr)
+	if err != nil {
+		return report, err
+	}
+
+	preparations, err := o.repository.GetPreparationTimes(ctx, startDate, endDate)
+	if err != nil {
+		return report, err
+	}
+	model, err := o.estimator.preparationModel(ctx, time.Now())
+	if err != nil {
+		return report, err
+	}
+
+	var overall readyTimeErrors
+	byHour := make(map[int]*readyTimeErrors)
+	byMenuItem := make(map[int]*readyTimeErrors)
+	for _, preparation := range preparations {
+		// Orders created before the estimates were introduced
+		if preparation.EstimatedReadyAt == nil {
+			continue
+		}
+		seconds := preparation.ClosedAt.Sub(*preparation.EstimatedReadyAt).Seconds()
+		overall.add(seconds)
+
+		hour := preparation.OpenedAt.Local().Hour()
+		if byHour[hour] == nil {
+			byHour[hour] = &readyTimeErrors{}
+		}
+		byHour[hour].add(seconds)
+
+		for _, menuItemID := range preparation.MenuItemIDs {
+			if byMenuItem[menuItemID] == nil {
+				byMenuItem[menuItemID] = &readyTimeErrors{}
+			}
+			byMenuItem[menuItemID].add(seconds)
+		}
+	}
+
+	report.Overall = overall.accuracy()
+	for hour, hourErrors := range byHour {
+		report.ByHour = append(report.ByHour, entities.HourReadyTimeAccuracy{Hour: hour, ReadyTimeAccuracy: hourErrors.accuracy()})
+	}
+	for menuItemID, itemErrors := range byMenuItem {
+		report.ByMenuItem = append(report.ByMenuItem, entities.MenuItemReadyTimeAccuracy{
+			MenuItemID:         menuItemID,
+			PreparationSeconds: roundSeconds(model.itemTime(menuItemID, -1).Seconds()),
+			ReadyTimeAccuracy:  itemErrors.accuracy(),
+		})
+	}
+
+	sort.Slice(report.ByHour, func(i, j int) bool {
+		return report.ByHour[i].Hour < report.ByHour[j].Hour
+	})
+	sort.Slice(report.ByMenuItem, func(i, j int) bool {
+		return report.ByMenuItem[i].MenuItemID < report.ByMenuItem[j].MenuItemID
+	})
+	return report, nil
+}
+
+func roundSeconds(seconds float64) float64 {
+	return math.Round(seconds*100) / 100
 }
@@ -0,0 +1,249 @@
+package serviceinstance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+	"hot-coffee/internal/dto"
+	"hot-coffee/internal/flag"
+)
+
+func TestCheckOrderTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		allowed  bool
+	}{
+		{"", entities.OpenStatus, true},
+		{"", entities.ScheduledStatus, true},
+		{"", entities.InProgressStatus, false},
+		{"", entities.ClosedStatus, false},
+		{entities.ScheduledStatus, entities.OpenStatus, true},
+		{entities.ScheduledStatus, entities.RejectedStatus, true},
+		{entities.ScheduledStatus, entities.InProgressStatus, false},
+		{entities.OpenStatus, entities.InProgressStatus, true},
+		{entities.OpenStatus, entities.RejectedStatus, true},
+		{entities.OpenStatus, entities.ClosedStatus, false},
+		{entities.OpenStatus, entities.ScheduledStatus, false},
+		{entities.InProgressStatus, entities.ClosedStatus, true},
+		{entities.InProgressStatus, entities.RejectedStatus, true},
+		{entities.InProgressStatus, entities.OpenStatus, false},
+		{entities.ClosedStatus, entities.RejectedStatus, false},
+		{entities.ClosedStatus, entities.OpenStatus, false},
+		{entities.RejectedStatus, entities.OpenStatus, false},
+	}
+	for _, tt := range tests {
+		err := checkOrderTransition(tt.from, tt.to)
+		if tt.allowed && err != nil {
+			t.Errorf("checkOrderTransition(%q, %q) error = %v, want nil", tt.from, tt.to, err)
+		} else if !tt.allowed && !errors.Is(err, ErrIllegalOrderTransition) {
+			t.Errorf("checkOrderTransition(%q, %q) error = %v, want %v", tt.from, tt.to, err, ErrIllegalOrderTransition)
+		}
+	}
+}
+
+func TestIsFinalOrderStatus(t *testing.T) {
+	for _, status := range entities.Statuses {
+		want := status == entities.ClosedStatus || status == entities.RejectedStatus
+		if got := isFinalOrderStatus(status); got != want {
+			t.Errorf("isFinalOrderStatus(%q) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestTransitionOrder(t *testing.T) {
+	setFlag(t, &flag.TaxRate, 0)
+	setFlag(t, &flag.ServiceCharge, 0)
+	services := newTestService(t)
+	ctx := context.Background()
+
+	latte := createTestMenuItem(t, services, "Latte", 4.5)
+	order := createTestOrder(t, services, entities.OrderItem{ProductID: latte, Quantity: 2})
+
+	steps := []struct {
+		name    string
+		status  string
+		pay     float64
+		wantErr error
+	}{
+		{name: "closing open order", status: entities.ClosedStatus, wantErr: ErrIllegalOrderTransition},
+		{name: "taking into work", status: entities.InProgressStatus},
+		{name: "unknown status", status: "ready", wantErr: ErrIncorrectOrderStatus},
+		{name: "closing unpaid order", status: entities.ClosedStatus, wantErr: ErrOrderNotSettled},
+		{name: "closing paid order", status: entities.ClosedStatus, pay: 9},
+		{name: "rejecting closed order", status: entities.RejectedStatus, wantErr: ErrIllegalOrderTransition},
+	}
+	for _, step := range steps {
+		if step.pay != 0 {
+			request := dto.PaymentRequest{Tenders: []dto.TenderAmount{{Tender: entities.CashTender, Amount: step.pay}}}
+			if _, err := services.PaymentService.AddPayments(ctx, order.ID, request); err != nil {
+				t.Fatalf("%s: AddPayments() error = %v", step.name, err)
+			}
+		}
+		err := services.OrderService.TransitionOrder(ctx, order.ID, step.status, "")
+		if step.wantErr == nil && err != nil {
+			t.Fatalf("%s: TransitionOrder() error = %v, want nil", step.name, err)
+		} else if step.wantErr != nil && !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: TransitionOrder() error = %v, want %v", step.name, err, step.wantErr)
+		}
+	}
+
+	history, err := services.OrderService.GetOrderHistory(ctx, order.ID)
+	if err != nil {
+		t.Fatalf("GetOrderHistory() error = %v", err)
+	}
+	var statuses []string
+	for _, change := range history.Transitions {
+		statuses = append(statuses, change.NewStatus)
+	}
+	want := []string{entities.OpenStatus, entities.InProgressStatus, entities.ClosedStatus}
+	if len(statuses) != len(want) {
+		t.Fatalf("history statuses = %v, want %v", statuses, want)
+	}
+	for idx := range want {
+		if statuses[idx] != want[idx] {
+			t.Fatalf("history statuses = %v, want %v", statuses, want)
+		}
+	}
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+	setFlag(t, &flag.TaxRate, 0)
+	setFlag(t, &flag.ServiceCharge, 0)
+	// Pickup is sooner than the preparation, the opened order cannot be ready by it
+	setFlag(t, &flag.PreorderLeadTime, 0)
+	services := newTestService(t)
+	ctx := context.Background()
+
+	latte := createTestMenuItem(t, services, "Latte", 4.5)
+	pickupAt := time.Now().Add(time.Minute)
+	order, err := services.OrderService.CreateOrder(ctx, entities.Order{
+		CustomerName: "Test customer",
+		Items:        []entities.OrderItem{{ProductID: latte, Quantity: 1}},
+		PickupAt:     &pickupAt,
+	})
+	if err != nil || order.Status != entities.ScheduledStatus {
+		t.Fatalf("CreateOrder() status = %s, error = %v, want scheduled order", order.Status, err)
+	}
+
+	// Opening the pre-order with the new items is the same transition as the scheduler makes
+	order.Status = entities.OpenStatus
+	order.Items = []entities.OrderItem{{ProductID: latte, Quantity: 2}}
+	if err := services.OrderService.UpdateOrder(ctx, order.ID, order); err != nil {
+		t.Fatalf("UpdateOrder() error = %v", err)
+	}
+
+	updated, err := services.OrderService.GetOrder(ctx, order.ID)
+	if err != nil {
+		t.Fatalf("GetOrder() error = %v", err)
+	}
+	if updated.Status != entities.OpenStatus || updated.Subtotal != 9 {
+		t.Fatalf("updated order status = %s, subtotal = %.2f, want open and 9", updated.Status, updated.Subtotal)
+	} else if updated.EstimatedReadyAt == nil || !updated.EstimatedReadyAt.After(pickupAt) {
+		t.Fatalf("estimated ready at = %v, want estimated after pickup %v", updated.EstimatedReadyAt, pickupAt)
+	}
+
+	history, err := services.OrderService.GetOrderHistory(ctx, order.ID)
+	if err != nil {
+		t.Fatalf("GetOrderHistory() error = %v", err)
+	}
+	last := history.Transitions[len(history.Transitions)-1]
+	if last.PastStatus != entities.ScheduledStatus || last.NewStatus != entities.OpenStatus {
+		t.Fatalf("last history change = %s -> %s, want scheduled -> open", last.PastStatus, last.NewStatus)
+	}
+
+	// Illegal transition leaves the order as it was
+	updated.Status = entities.ClosedStatus
+	updated.Items = []entities.OrderItem{{ProductID: latte, Quantity: 3}}
+	if err := services.OrderService.UpdateOrder(ctx, order.ID, updated); !errors.Is(err, ErrIllegalOrderTransition) {
+		t.Fatalf("UpdateOrder() error = %v, want %v", err, ErrIllegalOrderTransition)
+	}
+	if kept, _ := services.OrderService.GetOrder(ctx, order.ID); kept.Subtotal != 9 {
+		t.Fatalf("subtotal after failed update = %.2f, want 9", kept.Subtotal)
+	}
+}
+
+func TestUpdateOrderIDCollision(t *testing.T) {
+	services := newTestService(t)
+	latte := createTestMenuItem(t, services, "Latte", 4.5)
+	order := createTestOrder(t, services, entities.OrderItem{ProductID: latte, Quantity: 1})
+
+	if err := services.OrderService.UpdateOrder(context.Background(), order.ID+"0", order); !errors.Is(err, ErrOrderIDCollision) {
+		t.Fatalf("UpdateOrder() with other id in url error = %v, want %v", err, ErrOrderIDCollision)
+	}
+}
+
+// Monetary fields of the order, comparable as a whole
+type orderAmounts struct {
+	Subtotal, DiscountTotal, Tax, ServiceCharge, Tip, GrandTotal float64
+}
+
+func TestCalculateOrderTotals(t *testing.T) {
+	tests := []struct {
+		name          string
+		items         []entities.OrderItem
+		discounts     []float64
+		tip           float64
+		serviceCharge float64
+		want          orderAmounts
+	}{
+		{
+			name:  "tax rounded once per order",
+			items: []entities.OrderItem{{Quantity: 3, UnitPrice: 3.33, TaxRate: 12}},
+			want:  orderAmounts{Subtotal: 9.99, Tax: 1.2, GrandTotal: 11.19},
+		},
+		{
+			name:          "discount lowers tax and service charge",
+			items:         []entities.OrderItem{{Quantity: 3, UnitPrice: 3.33, TaxRate: 12}},
+			discounts:     []float64{1},
+			serviceCharge: 10,
+			want:          orderAmounts{Subtotal: 9.99, DiscountTotal: 1, Tax: 1.08, ServiceCharge: 0.9, GrandTotal: 10.97},
+		},
+		{
+			name: "discount spread over items with different rates",
+			items: []entities.OrderItem{
+				{Quantity: 1, UnitPrice: 4, TaxRate: 10},
+				{Quantity: 2, UnitPrice: 1, TaxRate: 0},
+			},
+			discounts: []float64{2, 1},
+			want:      orderAmounts{Subtotal: 6, DiscountTotal: 3, Tax: 0.2, GrandTotal: 3.2},
+		},
+		{
+			name:      "discounts capped by subtotal",
+			items:     []entities.OrderItem{{Quantity: 1, UnitPrice: 2.5, TaxRate: 20}},
+			discounts: []float64{2, 2},
+			tip:       1,
+			want:      orderAmounts{Subtotal: 2.5, DiscountTotal: 2.5, Tip: 1, GrandTotal: 1},
+		},
+		{
+			name:  "tip rounded to cents",
+			items: []entities.OrderItem{{Quantity: 1, UnitPrice: 2}},
+			tip:   1.236,
+			want:  orderAmounts{Subtotal: 2, Tip: 1.24, GrandTotal: 3.24},
+		},
+		{
+			name:          "service charge rounded half away from zero",
+			items:         []entities.OrderItem{{Quantity: 1, UnitPrice: 0.25}},
+			serviceCharge: 10,
+			want:          orderAmounts{Subtotal: 0.25, ServiceCharge: 0.03, GrandTotal: 0.28},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, &flag.ServiceCharge, tt.serviceCharge)
+
+			order := entities.Order{Items: tt.items, Tip: tt.tip}
+			for _, amount := range tt.discounts {
+				order.Discounts = append(order.Discounts, entities.AppliedDiscount{Amount: amount})
+			}
+			calculateOrderTotals(&order)
+
+			got := orderAmounts{order.Subtotal, order.DiscountTotal, order.Tax, order.ServiceCharge, order.Tip, order.GrandTotal}
+			if got != tt.want {
+				t.Errorf("calculateOrderTotals() amounts = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
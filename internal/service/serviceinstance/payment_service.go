@@ -0,0 +1,356 @@
+package serviceinstance
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+	"hot-coffee/internal/dto"
+	"hot-coffee/internal/repository"
+	"hot-coffee/internal/service"
+	"hot-coffee/internal/utils"
+)
+
+// Errors
+var (
+	ErrNoTenders                = errors.New("no tenders provided")
+	ErrInvalidTender            = errors.New("tender must be cash, card or other")
+	ErrNonPositivePayment       = errors.New("payment amount must be positive")
+	ErrOrderNotPayable          = errors.New("only scheduled, open and in progress orders can be paid")
+	ErrPaymentExceedsBalance    = errors.New("payment exceeds the order balance")
+	ErrRefundExceedsPaid        = errors.New("refund exceeds the amount paid with the tender")
+	ErrNothingToRefund          = errors.New("order has nothing to refund")
+	ErrRestockOfNotClosedOrder  = errors.New("only ingredients of closed orders can be restocked, rejected orders return them on rejection")
+	ErrRestockExceedsOrdered    = errors.New("restocked quantity exceeds the ordered quantity not restocked yet")
+	ErrNonPositiveRestock       = errors.New("restocked quantity must be positive")
+	ErrOrderNotSettled          = errors.New("order balance must be settled before closing")
+	ErrOrderTotalBelowPaidTotal = errors.New("order grand total cannot be lower than the amount already paid")
+	ErrOrderHasPayments         = errors.New("order has payments not refunded, refund them before deleting")
+)
+
+type paymentService struct {
+	paymentRepository repository.PaymentRepository
+	orderRepository   repository.OrderRepository
+	uow               repository.UnitOfWork
+	inventoryService  service.InventoryService
+	loyaltyService    service.LoyaltyService
+}
+
+func NewPaymentService(paymentRepository repository.PaymentRepository, orderRepository repository.OrderRepository, uow repository.UnitOfWork, inventoryService service.InventoryService, loyaltyService service.LoyaltyService) *paymentService {
+	if paymentRepository == nil || orderRepository == nil || uow == nil {
+		slog.Error("Error while creating Payment service: Nil pointer repository provided")
+		os.Exit(1)
+	} else if inventoryService == nil {
+		slog.Error("Error while creating Payment service: Nil pointer inventory service provided")
+		os.Exit(1)
+	} else if loyaltyService == nil {
+		slog.Error("Error while creating Payment service: Nil pointer loyalty service provided")
+		os.Exit(1)
+	}
+	return &paymentService{paymentRepository, orderRepository, uow, inventoryService, loyaltyService}
+}
+
+func (s *paymentService) GetOrderPayments(ctx context.Context, idStr string) (entities.OrderPayments, error) {
+	order, err := s.getOrder(ctx, idStr)
+	if err != nil {
+		return entities.OrderPayments{}, err
+	}
+	return s.orderPayments(ctx, order)
+}
+
+// Records the payment of every tender, the bill is either paid by all of them or by none
+func (s *paymentService) AddPayments(ctx context.Context, idStr string, request dto.PaymentRequest) (entities.OrderPayments, error) {
+	if err := validateTenders(request.Tenders); err != nil {
+		return entities.OrderPayments{}, err
+	}
+
+	var summary entities.OrderPayments
+	err := s.uow.Do(ctx, func(ctx context.Context) error {
+		order, err := s.getLockedOrder(ctx, idStr)
+		if err != nil {
+			return err
+		}
+		if !utils.In(order.Status, []string{entities.ScheduledStatus, entities.OpenStatus, entities.InProgressStatus}) {
+			return ErrOrderNotPayable
+		}
+
+		summary, err = s.orderPayments(ctx, order)
+		if err != nil {
+			return err
+		}
+
+		var amount float64
+		for _, tender := range request.Tenders {
+			amount += tender.Amount
+		}
+		if roundMoney(amount) > summary.Balance {
+			return fmt.Errorf("%w: %.2f left to pay", ErrPaymentExceedsBalance, summary.Balance)
+		}
+
+		for _, tender := range request.Tenders {
+			_, err := s.paymentRepository.Create(ctx, entities.Payment{
+				OrderID: summary.OrderID,
+				Kind:    entities.PaymentKind,
+				Tender:  tender.Tender,
+				Amount:  roundMoney(tender.Amount),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to save payment: %w", err)
+			}
+		}
+
+		summary, err = s.orderPayments(ctx, order)
+		return err
+	})
+	return summary, err
+}
+
+// Gives the money back to the tenders it was paid with.
+// Without tenders everything paid and not refunded yet is given back.
+func (s *paymentService) RefundPayments(ctx context.Context, idStr string, request dto.RefundRequest) (entities.OrderPayments, error) {
+	if len(request.Tenders) != 0 {
+		if err := validateTenders(request.Tenders); err != nil {
+			return entities.OrderPayments{}, err
+		}
+	}
+
+	var summary entities.OrderPayments
+	err := s.uow.Do(ctx, func(ctx context.Context) error {
+		order, err := s.getLockedOrder(ctx, idStr)
+		if err != nil {
+			return err
+		}
+		summary, err = s.orderPayments(ctx, order)
+		if err != nil {
+			return err
+		}
+
+		// Amount which can still be refunded to each tender
+		refundable := make(map[string]float64)
+		for _, payment := range summary.Payments {
+			if payment.Kind == entities.RefundKind {
+				refundable[payment.Tender] -= payment.Amount
+			} else {
+				refundable[payment.Tender] += payment.Amount
+			}
+		}
+
+		tenders := request.Tenders
+		if len(tenders) == 0 {
+			for _, tender := range entities.Tenders {
+				if amount := roundMoney(refundable[tender]); amount > 0 {
+					tenders = append(tenders, dto.TenderAmount{Tender: tender, Amount: amount})
+				}
+			}
+			if len(tenders) == 0 {
+				return ErrNothingToRefund
+			}
+		}
+
+		for _, tender := range tenders {
+			refundable[tender.Tender] -= roundMoney(tender.Amount)
+			if roundMoney(refundable[tender.Tender]) < 0 {
+				return fmt.Errorf("%w: %s", ErrRefundExceedsPaid, tender.Tender)
+			}
+		}
+
+		restock, err := restockItems(order, summary.Payments, request.Restock)
+		if err != nil {
+			return err
+		}
+		if len(restock) != 0 {
+			if err := s.inventoryService.RestoreOrderIngredients(ctx, order, restock); err != nil {
+				return err
+			}
+		}
+
+		// Restocked items are recorded once, with the first tender refunded
+		for idx, tender := range tenders {
+			refund := entities.Payment{
+				OrderID: summary.OrderID,
+				Kind:    entities.RefundKind,
+				Tender:  tender.Tender,
+				Amount:  roundMoney(tender.Amount),
+				Reason:  request.Reason,
+			}
+			if idx == 0 {
+				refund.RestockedItems = restock
+			}
+			if _, err := s.paymentRepository.Create(ctx, refund); err != nil {
+				return fmt.Errorf("failed to save refund: %w", err)
+			}
+		}
+
+		summary, err = s.orderPayments(ctx, order)
+		if err != nil {
+			return err
+		}
+		return s.loyaltyService.ReverseRefundedPoints(ctx, order, summary)
+	})
+	return summary, err
+}
+
+// Fails with ErrOrderNotSettled if the order has anything left to pay
+func (s *paymentService) CheckSettled(ctx context.Context, order entities.Order) error {
+	summary, err := s.orderPayments(ctx, order)
+	if err != nil {
+		return err
+	}
+	if summary.Balance != 0 {
+		return fmt.Errorf("%w: %.2f left to pay", ErrOrderNotSettled, summary.Balance)
+	}
+	return nil
+}
+
+// Fails with ErrOrderTotalBelowPaidTotal if the order was paid more than its grand total
+func (s *paymentService) CheckNotOverpaid(ctx context.Context, order entities.Order) error {
+	summary, err := s.orderPayments(ctx, order)
+	if err != nil {
+		return err
+	}
+	if summary.Balance < 0 {
+		return fmt.Errorf("%w: %.2f paid", ErrOrderTotalBelowPaidTotal, roundMoney(summary.Paid-summary.Refunded))
+	}
+	return nil
+}
+
+// Fails with ErrOrderHasPayments if any money taken for the order was not refunded.
+// Concurrent payments of the order are blocked until the transaction ends, so none is added after the check
+func (s *paymentService) CheckNothingPaid(ctx context.Context, order entities.Order) error {
+	orderID, err := strconv.ParseInt(order.ID, 10, 64)
+	if err != nil {
+		return ErrNonNumericOrderID
+	}
+	if err := s.paymentRepository.LockOrder(ctx, orderID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrOrderNotExists
+		}
+		return err
+	}
+
+	summary, err := s.orderPayments(ctx, order)
+	if err != nil {
+		return err
+	}
+	if summary.Paid != summary.Refunded {
+		return fmt.Errorf("%w: %.2f paid", ErrOrderHasPayments, roundMoney(summary.Paid-summary.Refunded))
+	}
+	return nil
+}
+
+func (s *paymentService) getOrder(ctx context.Context, idStr string) (entities.Order, error) {
+	if err := isValidID(idStr); err != nil {
+		return entities.Order{}, err
+	}
+	order, err := s.orderRepository.GetById(ctx, idStr)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return order, ErrOrderNotExists
+		}
+		return order, err
+	}
+	return order, nil
+}
+
+// Fetches the order after concurrent payments of it are blocked
+func (s *paymentService) getLockedOrder(ctx context.Context, idStr string) (entities.Order, error) {
+	if err := isValidID(idStr); err != nil {
+		return entities.Order{}, err
+	}
+	orderID, _ := strconv.ParseInt(idStr, 10, 64)
+	if err := s.paymentRepository.LockOrder(ctx, orderID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entities.Order{}, ErrOrderNotExists
+		}
+		return entities.Order{}, err
+	}
+	return s.getOrder(ctx, idStr)
+}
+
+func (s *paymentService) orderPayments(ctx context.Context, order entities.Order) (entities.OrderPayments, error) {
+	orderID, err := strconv.ParseInt(order.ID, 10, 64)
+	if err != nil {
+		return entities.OrderPayments{}, ErrNonNumericOrderID
+	}
+	payments, err := s.paymentRepository.GetByOrderID(ctx, orderID)
+	if err != nil {
+		return entities.OrderPayments{}, err
+	}
+
+	summary := entities.OrderPayments{
+		OrderID:    orderID,
+		GrandTotal: order.GrandTotal,
+		Payments:   payments,
+	}
+	for _, payment := range payments {
+		if payment.Kind == entities.RefundKind {
+			summary.Refunded += payment.Amount
+		} else {
+			summary.Paid += payment.Amount
+		}
+	}
+	summary.Paid = roundMoney(summary.Paid)
+	summary.Refunded = roundMoney(summary.Refunded)
+	summary.Balance = roundMoney(summary.GrandTotal - summary.Paid + summary.Refunded)
+	return summary, nil
+}
+
+func validateTenders(tenders []dto.TenderAmount) error {
+	if len(tenders) == 0 {
+		return ErrNoTenders
+	}
+	for _, tender := range tenders {
+		if !utils.In(tender.Tender, entities.Tenders) {
+			return ErrInvalidTender
+		} else if roundMoney(tender.Amount) <= 0 {
+			return ErrNonPositivePayment
+		}
+	}
+	return nil
+}
+
+// Checks the items to restock against the ordered ones which were not restocked by earlier refunds,
+// items are matched by order line, so the modifiers are kept
+func restockItems(order entities.Order, payments []entities.Payment, items []entities.OrderItem) ([]entities.OrderItem, error) {
+	if len(items) == 0 {
+		return nil, nil
+	} else if order.Status != entities.ClosedStatus {
+		return nil, ErrRestockOfNotClosedOrder
+	}
+
+	left := make(map[string]int)
+	for _, item := range order.Items {
+		left[item.Line()] += item.Quantity
+	}
+	for _, payment := range payments {
+		for _, item := range payment.RestockedItems {
+			left[item.Line()] -= item.Quantity
+		}
+	}
+
+	// Same line listed twice is restocked as one line
+	lines := make(map[string]int)
+	var restock []entities.OrderItem
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return nil, ErrNonPositiveRestock
+		}
+		line := item.Line()
+		idx, ok := lines[line]
+		if !ok {
+			idx = len(restock)
+			lines[line] = idx
+			restock = append(restock, entities.OrderItem{ProductID: item.ProductID, ModifierIDs: item.ModifierIDs})
+		}
+		restock[idx].Quantity += item.Quantity
+		if restock[idx].Quantity > left[line] {
+			return nil, fmt.Errorf("%w: product %d", ErrRestockExceedsOrdered, item.ProductID)
+		}
+	}
+	return restock, nil
+}
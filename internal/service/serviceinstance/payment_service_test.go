@@ -0,0 +1,294 @@
+package serviceinstance
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+	"hot-coffee/internal/dto"
+	"hot-coffee/internal/flag"
+)
+
+func TestValidateTenders(t *testing.T) {
+	tests := []struct {
+		name    string
+		tenders []dto.TenderAmount
+		wantErr error
+	}{
+		{name: "bill split over tenders", tenders: []dto.TenderAmount{{Tender: entities.CashTender, Amount: 5}, {Tender: entities.CardTender, Amount: 4}}},
+		{name: "unknown tender", tenders: []dto.TenderAmount{{Tender: "coupon", Amount: 1}}, wantErr: ErrInvalidTender},
+		{name: "amount rounded to zero", tenders: []dto.TenderAmount{{Tender: entities.CashTender, Amount: 0.004}}, wantErr: ErrNonPositivePayment},
+		{name: "negative amount", tenders: []dto.TenderAmount{{Tender: entities.CardTender, Amount: -1}}, wantErr: ErrNonPositivePayment},
+		{name: "no tenders", wantErr: ErrNoTenders},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateTenders(tt.tenders); err != tt.wantErr {
+				t.Errorf("validateTenders() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAddPayments(t *testing.T) {
+	setFlag(t, &flag.TaxRate, 0)
+	setFlag(t, &flag.ServiceCharge, 0)
+	services := newTestService(t)
+	ctx := context.Background()
+
+	latte := createTestMenuItem(t, services, "Latte", 4.5)
+	order := createTestOrder(t, services, entities.OrderItem{ProductID: latte, Quantity: 2})
+
+	// Steps are run one after another against the same order
+	steps := []struct {
+		name        string
+		tenders     []dto.TenderAmount
+		wantErr     error
+		wantPaid    float64
+		wantBalance float64
+	}{
+		{
+			name:        "invalid tenders saved nothing",
+			tenders:     []dto.TenderAmount{{Tender: entities.CashTender, Amount: 1}, {Tender: "coupon", Amount: 1}},
+			wantErr:     ErrInvalidTender,
+			wantBalance: 9,
+		},
+		{
+			name:        "partial payment",
+			tenders:     []dto.TenderAmount{{Tender: entities.CardTender, Amount: 2.005}},
+			wantPaid:    2.01,
+			wantBalance: 6.99,
+		},
+		{
+			name:        "split over balance saves none of tenders",
+			tenders:     []dto.TenderAmount{{Tender: entities.CashTender, Amount: 5}, {Tender: entities.CardTender, Amount: 5}},
+			wantErr:     ErrPaymentExceedsBalance,
+			wantPaid:    2.01,
+			wantBalance: 6.99,
+		},
+		{
+			name:        "rest split over tenders",
+			tenders:     []dto.TenderAmount{{Tender: entities.CashTender, Amount: 5}, {Tender: entities.CardTender, Amount: 1.99}},
+			wantPaid:    9,
+			wantBalance: 0,
+		},
+	}
+	for _, step := range steps {
+		_, err := services.PaymentService.AddPayments(ctx, order.ID, dto.PaymentRequest{Tenders: step.tenders})
+		if step.wantErr == nil && err != nil {
+			t.Fatalf("%s: AddPayments() error = %v, want nil", step.name, err)
+		} else if step.wantErr != nil && !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: AddPayments() error = %v, want %v", step.name, err, step.wantErr)
+		}
+
+		summary, err := services.PaymentService.GetOrderPayments(ctx, order.ID)
+		if err != nil {
+			t.Fatalf("%s: GetOrderPayments() error = %v", step.name, err)
+		}
+		if summary.Paid != step.wantPaid || summary.Balance != step.wantBalance {
+			t.Fatalf("%s: paid = %.2f, balance = %.2f, want %.2f and %.2f", step.name, summary.Paid, summary.Balance, step.wantPaid, step.wantBalance)
+		}
+	}
+}
+
+func TestRefundPayments(t *testing.T) {
+	setFlag(t, &flag.TaxRate, 0)
+	setFlag(t, &flag.ServiceCharge, 0)
+	services := newTestService(t)
+	ctx := context.Background()
+
+	latte := createTestMenuItem(t, services, "Latte", 4.5)
+	order := createTestOrder(t, services, entities.OrderItem{ProductID: latte, Quantity: 2})
+	if err := services.OrderService.TransitionOrder(ctx, order.ID, entities.InProgressStatus, ""); err != nil {
+		t.Fatalf("TransitionOrder() error = %v", err)
+	}
+	paid := dto.PaymentRequest{Tenders: []dto.TenderAmount{{Tender: entities.CashTender, Amount: 5}, {Tender: entities.CardTender, Amount: 4}}}
+	if _, err := services.PaymentService.AddPayments(ctx, order.ID, paid); err != nil {
+		t.Fatalf("AddPayments() error = %v", err)
+	}
+
+	// Steps are run one after another against the same order
+	steps := []struct {
+		name         string
+		request      dto.RefundRequest
+		wantErr      error
+		wantRefunded float64
+		wantBalance  float64
+	}{
+		{
+			name:    "more than paid with tender",
+			request: dto.RefundRequest{Tenders: []dto.TenderAmount{{Tender: entities.CardTender, Amount: 4.01}}},
+			wantErr: ErrRefundExceedsPaid,
+		},
+		{
+			name:    "tender not paid with",
+			request: dto.RefundRequest{Tenders: []dto.TenderAmount{{Tender: entities.OtherTender, Amount: 1}}},
+			wantErr: ErrRefundExceedsPaid,
+		},
+		{
+			name:    "restock of not closed order",
+			request: dto.RefundRequest{Tenders: []dto.TenderAmount{{Tender: entities.CashTender, Amount: 1}}, Restock: []entities.OrderItem{{ProductID: latte, Quantity: 1}}},
+			wantErr: ErrRestockOfNotClosedOrder,
+		},
+		{
+			name:         "part of card payment",
+			request:      dto.RefundRequest{Tenders: []dto.TenderAmount{{Tender: entities.CardTender, Amount: 1.5}}},
+			wantRefunded: 1.5,
+			wantBalance:  1.5,
+		},
+		{
+			name:         "rest of everything paid",
+			request:      dto.RefundRequest{Reason: "spilled"},
+			wantRefunded: 9,
+			wantBalance:  9,
+		},
+		{
+			name:    "nothing left to refund",
+			request: dto.RefundRequest{},
+			wantErr: ErrNothingToRefund,
+		},
+	}
+	for _, step := range steps {
+		_, err := services.PaymentService.RefundPayments(ctx, order.ID, step.request)
+		if step.wantErr == nil && err != nil {
+			t.Fatalf("%s: RefundPayments() error = %v, want nil", step.name, err)
+		} else if step.wantErr != nil && !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: RefundPayments() error = %v, want %v", step.name, err, step.wantErr)
+		}
+		if step.wantErr != nil {
+			continue
+		}
+
+		summary, err := services.PaymentService.GetOrderPayments(ctx, order.ID)
+		if err != nil {
+			t.Fatalf("%s: GetOrderPayments() error = %v", step.name, err)
+		}
+		if summary.Refunded != step.wantRefunded || summary.Balance != step.wantBalance {
+			t.Fatalf("%s: refunded = %.2f, balance = %.2f, want %.2f and %.2f", step.name, summary.Refunded, summary.Balance, step.wantRefunded, step.wantBalance)
+		}
+	}
+
+	// The full refund went back to the tenders the money was paid with
+	summary, err := services.PaymentService.GetOrderPayments(ctx, order.ID)
+	if err != nil {
+		t.Fatalf("GetOrderPayments() error = %v", err)
+	}
+	refunded := make(map[string]float64)
+	for _, payment := range summary.Payments {
+		if payment.Kind == entities.RefundKind {
+			refunded[payment.Tender] += payment.Amount
+		}
+	}
+	if refunded[entities.CashTender] != 5 || refunded[entities.CardTender] != 4 {
+		t.Fatalf("refunded per tender = %v, want 5 cash and 4 card", refunded)
+	}
+}
+
+func TestRefundRestocksOrderLines(t *testing.T) {
+	setFlag(t, &flag.TaxRate, 0)
+	setFlag(t, &flag.ServiceCharge, 0)
+	services := newTestService(t)
+	ctx := context.Background()
+
+	// Latte with oat milk takes the oat milk instead of its base
+	latte := createTestMenuItem(t, services, "Latte", 4)
+	if err := services.InventoryService.CreateInventoryItem(ctx, entities.InventoryItem{Name: "Oat milk", Price: 0.01, Quantity: 1000, Unit: "ml"}); err != nil {
+		t.Fatalf("CreateInventoryItem() error = %v", err)
+	}
+	ingredients, err := services.InventoryService.GetInventoryItems(ctx)
+	if err != nil {
+		t.Fatalf("GetInventoryItems() error = %v", err)
+	}
+	base, oat := ingredients[0].IngredientID, ingredients[1].IngredientID
+	menuItem, err := services.MenuService.GetMenuItem(ctx, strconv.Itoa(latte))
+	if err != nil {
+		t.Fatalf("GetMenuItem() error = %v", err)
+	}
+	menuItem.Modifiers = []entities.MenuItemModifier{{
+		Name:        "Oat milk",
+		Ingredients: []entities.MenuItemIngredient{{IngredientID: base, Quantity: -100}, {IngredientID: oat, Quantity: 120}},
+	}}
+	if err := services.MenuService.UpdateMenuItem(ctx, menuItem.ID, menuItem); err != nil {
+		t.Fatalf("UpdateMenuItem() error = %v", err)
+	}
+	if menuItem, err = services.MenuService.GetMenuItem(ctx, menuItem.ID); err != nil {
+		t.Fatalf("GetMenuItem() error = %v", err)
+	}
+	modifierID, _ := strconv.ParseInt(menuItem.Modifiers[0].ID, 10, 64)
+
+	order := createTestOrder(t, services,
+		entities.OrderItem{ProductID: latte, Quantity: 1, ModifierIDs: []int64{modifierID}},
+		entities.OrderItem{ProductID: latte, Quantity: 2},
+	)
+	if err := services.OrderService.TransitionOrder(ctx, order.ID, entities.InProgressStatus, ""); err != nil {
+		t.Fatalf("TransitionOrder() error = %v", err)
+	}
+	paid := dto.PaymentRequest{Tenders: []dto.TenderAmount{{Tender: entities.CashTender, Amount: order.GrandTotal}}}
+	if _, err := services.PaymentService.AddPayments(ctx, order.ID, paid); err != nil {
+		t.Fatalf("AddPayments() error = %v", err)
+	}
+	if err := services.OrderService.TransitionOrder(ctx, order.ID, entities.ClosedStatus, ""); err != nil {
+		t.Fatalf("TransitionOrder() error = %v", err)
+	}
+
+	// Recipe changed after the order was closed does not change what is restocked
+	menuItem.Ingredients[0].Quantity = 300
+	menuItem.Modifiers[0].Ingredients[1].Quantity = 50
+	if err := services.MenuService.UpdateMenuItem(ctx, menuItem.ID, menuItem); err != nil {
+		t.Fatalf("UpdateMenuItem() error = %v", err)
+	}
+
+	// Steps are run one after another against the same order
+	steps := []struct {
+		name     string
+		restock  entities.OrderItem
+		wantErr  error
+		wantBase float64
+		wantOat  float64
+	}{
+		{
+			name:     "modified item",
+			restock:  entities.OrderItem{ProductID: latte, Quantity: 1, ModifierIDs: []int64{modifierID}},
+			wantBase: 99800,
+			wantOat:  1000,
+		},
+		{
+			name:    "more modified items than ordered",
+			restock: entities.OrderItem{ProductID: latte, Quantity: 1, ModifierIDs: []int64{modifierID}},
+			wantErr: ErrRestockExceedsOrdered,
+		},
+		{
+			name:     "item without modifiers",
+			restock:  entities.OrderItem{ProductID: latte, Quantity: 1},
+			wantBase: 99900,
+			wantOat:  1000,
+		},
+	}
+	for _, step := range steps {
+		request := dto.RefundRequest{
+			Tenders: []dto.TenderAmount{{Tender: entities.CashTender, Amount: 1}},
+			Restock: []entities.OrderItem{step.restock},
+		}
+		_, err := services.PaymentService.RefundPayments(ctx, order.ID, request)
+		if step.wantErr == nil && err != nil {
+			t.Fatalf("%s: RefundPayments() error = %v, want nil", step.name, err)
+		} else if step.wantErr != nil && !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: RefundPayments() error = %v, want %v", step.name, err, step.wantErr)
+		}
+		if step.wantErr != nil {
+			continue
+		}
+
+		for id, want := range map[string]float64{base: step.wantBase, oat: step.wantOat} {
+			item, err := services.InventoryService.GetInventoryItem(ctx, id)
+			if err != nil {
+				t.Fatalf("%s: GetInventoryItem() error = %v", step.name, err)
+			}
+			if item.Quantity != want {
+				t.Fatalf("%s: %s quantity = %.2f, want %.2f", step.name, item.Name, item.Quantity, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package serviceinstance
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+	"hot-coffee/internal/repository"
+	"hot-coffee/internal/utils"
+)
+
+// Errors
+var (
+	ErrEmptyPromotionName       = errors.New("empty promotion name provided")
+	ErrInvalidDiscountType      = errors.New("discount type must be percent, fixed or free_items")
+	ErrNonPositiveDiscount      = errors.New("discount value must be positive")
+	ErrPercentDiscountTooHigh   = errors.New("percent discount cannot exceed 100")
+	ErrNegativeMinQuantity      = errors.New("negative minimal quantity provided")
+	ErrInvalidFreeItemsRule     = errors.New("free items discount needs menu item, whole number of free items and minimal quantity greater than it")
+	ErrInvalidPromotionPeriod   = errors.New("invalid promotion period. Expected format: RFC 3339")
+	ErrPromotionEndsBeforeStart = errors.New("promotion ends before it starts")
+	ErrInvalidDailyWindow       = errors.New("invalid daily window. Expected format: HH:MM, both bounds are required")
+	ErrNegativeUsageLimit       = errors.New("negative usage limit provided")
+	ErrUsageLimitBelowUsage     = errors.New("usage limit cannot be lower than the usages already spent")
+	ErrPromotionAlreadyExists   = errors.New("promotion with such id or code already exists")
+	ErrPromotionNotExists       = errors.New("promotion with such id does not exist")
+	ErrNoPromotions             = errors.New("no promotions")
+	ErrPromotionVersionMismatch = errors.New("promotion was modified by another request, fetch it again")
+	ErrPromotionIDCollision     = errors.New("id collision between id in request body and id in url")
+	ErrUnknownPromoCode         = errors.New("unknown promo code provided")
+	ErrPromoCodeNotApplicable   = errors.New("promo code cannot be applied to the order")
+)
+
+const dailyWindowLayout = "15:04"
+
+type promotionService struct {
+	promotionRepository repository.PromotionRepository
+}
+
+func NewPromotionService(repository repository.PromotionRepository) *promotionService {
+	if repository == nil {
+		slog.Error("Error while creating Promotion service: Nil pointer repository provided")
+		os.Exit(1)
+	}
+	return &promotionService{repository}
+}
+
+func (s *promotionService) CreatePromotion(ctx context.Context, promotion entities.Promotion) (int64, error) {
+	if err := validatePromotion(ctx, &promotion); err != nil && err != ErrEmptyID {
+		return -1, err
+	}
+
+	id, err := s.promotionRepository.Create(ctx, promotion)
+	if err != nil {
+		if errors.Is(err, errors.ErrIDAlreadyExists) {
+			return -1, ErrPromotionAlreadyExists
+		}
+		return -1, err
+	}
+	return id, nil
+}
+
+func (s *promotionService) GetPromotions(ctx context.Context) ([]entities.Promotion, error) {
+	promotions, err := s.promotionRepository.GetAll(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoPromotions
+		}
+		return nil, err
+	}
+	return promotions, nil
+}
+
+func (s *promotionService) GetPromotion(ctx context.Context, id string) (entities.Promotion, error) {
+	if err := isValidID(id); err != nil {
+		return entities.Promotion{}, err
+	}
+
+	promotion, err := s.promotionRepository.GetById(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entities.Promotion{}, ErrPromotionNotExists
+		}
+		return entities.Promotion{}, err
+	}
+	return promotion, nil
+}
+
+func (s *promotionService) UpdatePromotion(ctx context.Context, id string, promotion entities.Promotion) error {
+	if err := validatePromotion(ctx, &promotion); err != nil {
+		return err
+	}
+	if id != promotion.ID {
+		return ErrPromotionIDCollision
+	}
+
+	if err := s.promotionRepository.Update(ctx, id, promotion); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrPromotionNotExists
+		} else if errors.Is(err, errors.ErrVersionMismatch) {
+			return ErrPromotionVersionMismatch
+		} else if errors.Is(err, errors.ErrIDAlreadyExists) {
+			return ErrPromotionAlreadyExists
+		} else if errors.Is(err, errors.ErrUsageLimitReached) {
+			return ErrUsageLimitBelowUsage
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *promotionService) DeletePromotion(ctx context.Context, id string) error {
+	if err := isValidID(id); err != nil {
+		return err
+	}
+
+	if err := s.promotionRepository.Delete(ctx, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrPromotionNotExists
+		}
+		return err
+	}
+	return nil
+}
+
+// Evaluates the promotions against the order items at the given moment and sets the order discounts.
+// Promotions with a code are applied only when the order provides it, every applied promotion spends
+// one usage, so the call must be a part of the transaction writing the order
+func (s *promotionService) ApplyPromotions(ctx context.Context, order *entities.Order, at time.Time) error {
+	order.Discounts = nil
+
+	promotions, err := s.promotionRepository.GetAll(ctx)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	requestedCodes := make(map[string]bool)
+	for _, code := range order.PromoCodes {
+		if code = strings.TrimSpace(code); code != "" {
+			requestedCodes[code] = true
+		}
+	}
+
+	var subtotal float64
+	for _, item := range order.Items {
+		subtotal += item.UnitPrice * float64(item.Quantity)
+	}
+	remaining := subtotal
+
+	for _, promotion := range promotions {
+		requested := requestedCodes[promotion.Code]
+		if promotion.Code != "" && !requested {
+			continue
+		}
+		delete(requestedCodes, promotion.Code)
+
+		// The discounts never exceed the order price
+		amount := math.Min(discountAmount(promotion, order.Items, at), remaining)
+		if amount <= 0 {
+			if requested {
+				return fmt.Errorf("%w: %s", ErrPromoCodeNotApplicable, promotion.Code)
+			}
+			continue
+		}
+
+		promotionID, _ := strconv.ParseInt(promotion.ID, 10, 64)
+		if err := s.promotionRepository.IncrementUsage(ctx, promotionID); err != nil {
+			if !errors.Is(err, errors.ErrUsageLimitReached) {
+				return err
+			} else if requested {
+				return fmt.Errorf("%w: %s usage limit is reached", ErrPromoCodeNotApplicable, promotion.Code)
+			}
+			continue
+		}
+
+		remaining -= amount
+		order.Discounts = append(order.Discounts, entities.AppliedDiscount{
+			PromotionID: promotionID,
+			Name:        promotion.Name,
+			Amount:      amount,
+		})
+	}
+
+	for code := range requestedCodes {
+		return fmt.Errorf("%w: %s", ErrUnknownPromoCode, code)
+	}
+	return nil
+}
+
+// Gives back the usages spent by the discounts
+func (s *promotionService) ReleasePromotions(ctx context.Context, discounts []entities.AppliedDiscount) error {
+	for _, discount := range discounts {
+		if discount.PromotionID == 0 {
+			continue
+		}
+		if err := s.promotionRepository.DecrementUsage(ctx, discount.PromotionID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the codes of the promotions that gave the discounts, deleted promotions are skipped
+func (s *promotionService) PromoCodes(ctx context.Context, discounts []entities.AppliedDiscount) ([]string, error) {
+	codes := []string{}
+	for _, discount := range discounts {
+		if discount.PromotionID == 0 {
+			continue
+		}
+		promotion, err := s.promotionRepository.GetById(ctx, strconv.FormatInt(discount.PromotionID, 10))
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if promotion.Code != "" {
+			codes = append(codes, promotion.Code)
+		}
+	}
+	return codes, nil
+}
+
+// Discount of the promotion for the items at the given moment, zero if the promotion does not apply
+func discountAmount(promotion entities.Promotion, items []entities.OrderItem, at time.Time) float64 {
+	if promotion.Disabled || !promotionActiveAt(promotion, at) {
+		return 0
+	}
+
+	var (
+		quantity      int
+		amount        float64
+		cheapestPrice = math.Inf(1)
+	)
+	for _, item := range items {
+		if promotion.MenuItemID != 0 && item.ProductID != promotion.MenuItemID {
+			continue
+		}
+		quantity += item.Quantity
+		amount += item.UnitPrice * float64(item.Quantity)
+		cheapestPrice = math.Min(cheapestPrice, item.UnitPrice)
+	}
+	if quantity == 0 || quantity < promotion.MinQuantity {
+		return 0
+	}
+
+	var discount float64
+	switch promotion.DiscountType {
+	case entities.PercentDiscount:
+		discount = amount * promotion.DiscountValue / 100
+	case entities.FixedDiscount:
+		discount = math.Min(promotion.DiscountValue, amount)
+	case entities.FreeItemsDiscount:
+		freeItems := quantity / promotion.MinQuantity * int(promotion.DiscountValue)
+		discount = float64(freeItems) * cheapestPrice
+	}
+	return math.Round(discount*100) / 100
+}
+
+func promotionActiveAt(promotion entities.Promotion, at time.Time) bool {
+	if startsAt, err := time.Parse(time.RFC3339, promotion.StartsAt); err == nil && at.Before(startsAt) {
+		return false
+	}
+	if endsAt, err := time.Parse(time.RFC3339, promotion.EndsAt); err == nil && !at.Before(endsAt) {
+		return false
+	}
+
+	if promotion.DailyFrom == "" {
+		return true
+	}
+	from, _ := time.Parse(dailyWindowLayout, promotion.DailyFrom)
+	to, _ := time.Parse(dailyWindowLayout, promotion.DailyTo)
+	local := at.Local()
+	minute := local.Hour()*60 + local.Minute()
+	fromMinute := from.Hour()*60 + from.Minute()
+	toMinute := to.Hour()*60 + to.Minute()
+
+	// The window may pass midnight, e.g. from 22:00 to 02:00
+	if fromMinute <= toMinute {
+		return minute >= fromMinute && minute < toMinute
+	}
+	return minute >= fromMinute || minute < toMinute
+}
+
+func validatePromotion(ctx context.Context, promotion *entities.Promotion) error {
+	promotion.Name = strings.TrimSpace(promotion.Name)
+	promotion.Code = strings.TrimSpace(promotion.Code)
+
+	if promotion.Name == "" {
+		return ErrEmptyPromotionName
+	} else if !utils.In(promotion.DiscountType, entities.DiscountTypes) {
+		return ErrInvalidDiscountType
+	} else if promotion.DiscountValue <= 0 {
+		return ErrNonPositiveDiscount
+	} else if promotion.DiscountType == entities.PercentDiscount && promotion.DiscountValue > 100 {
+		return ErrPercentDiscountTooHigh
+	} else if promotion.MinQuantity < 0 {
+		return ErrNegativeMinQuantity
+	} else if promotion.UsageLimit < 0 {
+		return ErrNegativeUsageLimit
+	}
+
+	if promotion.DiscountType == entities.FreeItemsDiscount {
+		if promotion.MenuItemID == 0 ||
+			promotion.DiscountValue != math.Trunc(promotion.DiscountValue) ||
+			float64(promotion.MinQuantity) <= promotion.DiscountValue {
+			return ErrInvalidFreeItemsRule
+		}
+	}
+
+	if promotion.MenuItemID != 0 {
+		if _, err := MenuService.GetMenuItem(ctx, strconv.Itoa(promotion.MenuItemID)); err != nil {
+			return err
+		}
+	}
+
+	var startsAt, endsAt time.Time
+	var err error
+	if promotion.StartsAt != "" {
+		if startsAt, err = time.Parse(time.RFC3339, promotion.StartsAt); err != nil {
+			return ErrInvalidPromotionPeriod
+		}
+	}
+	if promotion.EndsAt != "" {
+		if endsAt, err = time.Parse(time.RFC3339, promotion.EndsAt); err != nil {
+			return ErrInvalidPromotionPeriod
+		}
+	}
+	if !startsAt.IsZero() && !endsAt.IsZero() && !endsAt.After(startsAt) {
+		return ErrPromotionEndsBeforeStart
+	}
+
+	if promotion.DailyFrom != "" || promotion.DailyTo != "" {
+		if _, err := time.Parse(dailyWindowLayout, promotion.DailyFrom); err != nil {
+			return ErrInvalidDailyWindow
+		}
+		if _, err := time.Parse(dailyWindowLayout, promotion.DailyTo); err != nil {
+			return ErrInvalidDailyWindow
+		}
+	}
+
+	return isValidID(promotion.ID)
+}
@@ -0,0 +1,276 @@
+package serviceinstance
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+	"hot-coffee/internal/flag"
+)
+
+func TestDiscountAmount(t *testing.T) {
+	at := time.Date(2024, 1, 1, 12, 30, 0, 0, time.Local)
+
+	tests := []struct {
+		name      string
+		promotion entities.Promotion
+		items     []entities.OrderItem
+		want      float64
+	}{
+		{
+			name:      "percent of items",
+			promotion: entities.Promotion{DiscountType: entities.PercentDiscount, DiscountValue: 10},
+			items:     []entities.OrderItem{{ProductID: 1, Quantity: 2, UnitPrice: 5}, {ProductID: 2, Quantity: 1, UnitPrice: 1.25}},
+			want:      1.13,
+		},
+		{
+			name:      "fixed discount capped by items price",
+			promotion: entities.Promotion{DiscountType: entities.FixedDiscount, DiscountValue: 5},
+			items:     []entities.OrderItem{{ProductID: 1, Quantity: 1, UnitPrice: 3}},
+			want:      3,
+		},
+		{
+			name:      "free items for every min quantity",
+			promotion: entities.Promotion{MenuItemID: 1, MinQuantity: 3, DiscountType: entities.FreeItemsDiscount, DiscountValue: 1},
+			items:     []entities.OrderItem{{ProductID: 1, Quantity: 7, UnitPrice: 2.5}, {ProductID: 2, Quantity: 3, UnitPrice: 1}},
+			want:      5,
+		},
+		{
+			name:      "bound promotion skips other items",
+			promotion: entities.Promotion{MenuItemID: 1, DiscountType: entities.PercentDiscount, DiscountValue: 20},
+			items:     []entities.OrderItem{{ProductID: 2, Quantity: 4, UnitPrice: 3}},
+		},
+		{
+			name:      "below min quantity",
+			promotion: entities.Promotion{MinQuantity: 5, DiscountType: entities.PercentDiscount, DiscountValue: 10},
+			items:     []entities.OrderItem{{ProductID: 1, Quantity: 4, UnitPrice: 3}},
+		},
+		{
+			name:      "disabled",
+			promotion: entities.Promotion{Disabled: true, DiscountType: entities.FixedDiscount, DiscountValue: 1},
+			items:     []entities.OrderItem{{ProductID: 1, Quantity: 1, UnitPrice: 4}},
+		},
+		{
+			name:      "ended",
+			promotion: entities.Promotion{EndsAt: at.Format(time.RFC3339), DiscountType: entities.FixedDiscount, DiscountValue: 1},
+			items:     []entities.OrderItem{{ProductID: 1, Quantity: 1, UnitPrice: 4}},
+		},
+		{
+			name:      "within daily window over midnight",
+			promotion: entities.Promotion{DailyFrom: "22:00", DailyTo: "13:00", DiscountType: entities.FixedDiscount, DiscountValue: 1},
+			items:     []entities.OrderItem{{ProductID: 1, Quantity: 1, UnitPrice: 4}},
+			want:      1,
+		},
+		{
+			name:      "outside daily window",
+			promotion: entities.Promotion{DailyFrom: "16:00", DailyTo: "18:00", DiscountType: entities.FixedDiscount, DiscountValue: 1},
+			items:     []entities.OrderItem{{ProductID: 1, Quantity: 1, UnitPrice: 4}},
+		},
+	}
+	for _, tt := range tests {
+		if got := discountAmount(tt.promotion, tt.items, at); got != tt.want {
+			t.Errorf("%s: discountAmount() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApplyPromotions(t *testing.T) {
+	tests := []struct {
+		name       string
+		promotions []entities.Promotion
+		codes      []string
+		// Applied discount amounts by promotion name
+		want    map[string]float64
+		wantErr error
+	}{
+		{
+			name: "stacked discounts never exceed order price",
+			promotions: []entities.Promotion{
+				{Name: "Eight off", DiscountType: entities.FixedDiscount, DiscountValue: 8},
+				{Name: "Five off", DiscountType: entities.FixedDiscount, DiscountValue: 5},
+				{Name: "Half off", DiscountType: entities.PercentDiscount, DiscountValue: 50},
+			},
+			want: map[string]float64{"Eight off": 8, "Five off": 2},
+		},
+		{
+			name: "code promotion applied only with its code",
+			promotions: []entities.Promotion{
+				{Name: "Coded", Code: "SAVE1", DiscountType: entities.FixedDiscount, DiscountValue: 1},
+				{Name: "Open", DiscountType: entities.FixedDiscount, DiscountValue: 1},
+			},
+			want: map[string]float64{"Open": 1},
+		},
+		{
+			name: "requested code stacks with open promotion",
+			promotions: []entities.Promotion{
+				{Name: "Coded", Code: "SAVE1", DiscountType: entities.FixedDiscount, DiscountValue: 1},
+				{Name: "Open", DiscountType: entities.FixedDiscount, DiscountValue: 1},
+			},
+			codes: []string{" SAVE1 "},
+			want:  map[string]float64{"Coded": 1, "Open": 1},
+		},
+		{
+			name:       "unknown code",
+			promotions: []entities.Promotion{{Name: "Coded", Code: "SAVE1", DiscountType: entities.FixedDiscount, DiscountValue: 1}},
+			codes:      []string{"SAVE2"},
+			wantErr:    ErrUnknownPromoCode,
+		},
+		{
+			name:       "requested code not applicable",
+			promotions: []entities.Promotion{{Name: "Bulk", Code: "BULK", MinQuantity: 5, DiscountType: entities.PercentDiscount, DiscountValue: 10}},
+			codes:      []string{"BULK"},
+			wantErr:    ErrPromoCodeNotApplicable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services := newTestService(t)
+			ctx := context.Background()
+			for _, promotion := range tt.promotions {
+				if _, err := services.PromotionService.CreatePromotion(ctx, promotion); err != nil {
+					t.Fatalf("CreatePromotion(%q) error = %v", promotion.Name, err)
+				}
+			}
+
+			order := entities.Order{Items: []entities.OrderItem{{ProductID: 1, Quantity: 1, UnitPrice: 10}}, PromoCodes: tt.codes}
+			err := services.PromotionService.ApplyPromotions(ctx, &order, time.Now())
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ApplyPromotions() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("ApplyPromotions() error = %v", err)
+			}
+
+			got := make(map[string]float64)
+			for _, discount := range order.Discounts {
+				got[discount.Name] = discount.Amount
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("discounts = %v, want %v", got, tt.want)
+			}
+			for name, amount := range tt.want {
+				if got[name] != amount {
+					t.Fatalf("discounts = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyPromotionsUsageLimit(t *testing.T) {
+	services := newTestService(t)
+	ctx := context.Background()
+
+	limited := entities.Promotion{Name: "First order", Code: "FIRST", UsageLimit: 1, DiscountType: entities.FixedDiscount, DiscountValue: 1}
+	id, err := services.PromotionService.CreatePromotion(ctx, limited)
+	if err != nil {
+		t.Fatalf("CreatePromotion() error = %v", err)
+	}
+	newOrder := func() entities.Order {
+		return entities.Order{Items: []entities.OrderItem{{ProductID: 1, Quantity: 1, UnitPrice: 3}}, PromoCodes: []string{"FIRST"}}
+	}
+
+	first := newOrder()
+	if err := services.PromotionService.ApplyPromotions(ctx, &first, time.Now()); err != nil || len(first.Discounts) != 1 {
+		t.Fatalf("ApplyPromotions() discounts = %v, error = %v, want one discount", first.Discounts, err)
+	}
+
+	second := newOrder()
+	if err := services.PromotionService.ApplyPromotions(ctx, &second, time.Now()); !errors.Is(err, ErrPromoCodeNotApplicable) {
+		t.Fatalf("ApplyPromotions() over the limit error = %v, want %v", err, ErrPromoCodeNotApplicable)
+	}
+
+	// Raised limit lets the code be used again, but cannot be lowered below the usages spent
+	limited.ID = strconv.FormatInt(id, 10)
+	limited.UsageLimit = 2
+	if err := services.PromotionService.UpdatePromotion(ctx, limited.ID, limited); err != nil {
+		t.Fatalf("UpdatePromotion() error = %v", err)
+	}
+	if err := services.PromotionService.ApplyPromotions(ctx, &second, time.Now()); err != nil || len(second.Discounts) != 1 {
+		t.Fatalf("ApplyPromotions() after raised limit discounts = %v, error = %v, want one discount", second.Discounts, err)
+	}
+	limited.UsageLimit = 1
+	if err := services.PromotionService.UpdatePromotion(ctx, limited.ID, limited); !errors.Is(err, ErrUsageLimitBelowUsage) {
+		t.Fatalf("UpdatePromotion() below usage count error = %v, want %v", err, ErrUsageLimitBelowUsage)
+	}
+
+	// Released usage can be spent again
+	if err := services.PromotionService.ReleasePromotions(ctx, first.Discounts); err != nil {
+		t.Fatalf("ReleasePromotions() error = %v", err)
+	}
+	third := newOrder()
+	if err := services.PromotionService.ApplyPromotions(ctx, &third, time.Now()); err != nil || len(third.Discounts) != 1 {
+		t.Fatalf("ApplyPromotions() after release discounts = %v, error = %v, want one discount", third.Discounts, err)
+	}
+}
+
+func TestUpdateOrderPromotions(t *testing.T) {
+	setFlag(t, &flag.TaxRate, 0)
+	setFlag(t, &flag.ServiceCharge, 0)
+	services := newTestService(t)
+	ctx := context.Background()
+
+	latte := createTestMenuItem(t, services, "Latte", 4.5)
+	happyHour := entities.Promotion{Name: "Happy hour", DiscountType: entities.PercentDiscount, DiscountValue: 10}
+	id, err := services.PromotionService.CreatePromotion(ctx, happyHour)
+	if err != nil {
+		t.Fatalf("CreatePromotion() error = %v", err)
+	}
+	coded := entities.Promotion{Name: "Coded", Code: "SAVE1", DiscountType: entities.FixedDiscount, DiscountValue: 1}
+	if _, err := services.PromotionService.CreatePromotion(ctx, coded); err != nil {
+		t.Fatalf("CreatePromotion() error = %v", err)
+	}
+
+	order, err := services.OrderService.CreateOrder(ctx, entities.Order{
+		CustomerName: "Test customer",
+		Items:        []entities.OrderItem{{ProductID: latte, Quantity: 2}},
+		PromoCodes:   []string{"SAVE1"},
+	})
+	if err != nil {
+		t.Fatalf("CreateOrder() error = %v", err)
+	}
+
+	// Happy hour ends after the order is placed
+	if order, err = services.OrderService.GetOrder(ctx, order.ID); err != nil {
+		t.Fatalf("GetOrder() error = %v", err)
+	}
+	placedAt, _ := time.Parse(time.RFC3339Nano, order.CreatedAt)
+	happyHour.ID = strconv.FormatInt(id, 10)
+	happyHour.EndsAt = placedAt.Add(time.Millisecond).Format(time.RFC3339Nano)
+	if err := services.PromotionService.UpdatePromotion(ctx, happyHour.ID, happyHour); err != nil {
+		t.Fatalf("UpdatePromotion() error = %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+
+	steps := []struct {
+		name  string
+		codes []string
+		want  float64
+	}{
+		{name: "codes not sent are kept", want: 1.35 + 1},
+		{name: "codes sent replace the kept ones", codes: []string{}, want: 1.35},
+	}
+	for _, step := range steps {
+		order, err = services.OrderService.GetOrder(ctx, order.ID)
+		if err != nil {
+			t.Fatalf("%s: GetOrder() error = %v", step.name, err)
+		}
+		order.Items = []entities.OrderItem{{ProductID: latte, Quantity: 3}}
+		order.PromoCodes = step.codes
+		if err := services.OrderService.UpdateOrder(ctx, order.ID, order); err != nil {
+			t.Fatalf("%s: UpdateOrder() error = %v", step.name, err)
+		}
+
+		updated, err := services.OrderService.GetOrder(ctx, order.ID)
+		if err != nil {
+			t.Fatalf("%s: GetOrder() error = %v", step.name, err)
+		} else if updated.DiscountTotal != step.want {
+			t.Fatalf("%s: discount total = %.2f, discounts = %v, want %.2f", step.name, updated.DiscountTotal, updated.Discounts, step.want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package serviceinstance
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/repository"
+	"hot-coffee/internal/utils"
+)
+
+const (
+	// Number of the last events kept for the reconnecting clients
+	queueEventsKept = 1000
+	// Events buffered for every subscriber, the subscriber falling further behind is disconnected
+	queueSubscriberBuffer = 64
+)
+
+// Statuses of the orders waiting for the baristas
+var queueStatuses = []string{entities.OpenStatus, entities.InProgressStatus}
+
+type queueService struct {
+	orderRepository repository.OrderRepository
+	menuRepository  repository.MenuRepository
+
+	// Event ids are <epoch>-<sequence>, the epoch tells apart the ids given before restart
+	epoch       int64
+	mu          sync.Mutex
+	sequence    int64
+	events      []entities.OrderEvent
+	subscribers map[chan entities.OrderEvent]struct{}
+}
+
+func NewQueueService(orderRepository repository.OrderRepository, menuRepository repository.MenuRepository) *queueService {
+	if orderRepository == nil || menuRepository == nil {
+		slog.Error("Error while creating Queue service: Nil pointer repository provided")
+		os.Exit(1)
+	}
+	return &queueService{
+		orderRepository: orderRepository,
+		menuRepository:  menuRepository,
+		epoch:           time.Now().UnixMilli(),
+		subscribers:     make(map[chan entities.OrderEvent]struct{}),
+	}
+}
+
+// Open and in progress orders, the oldest first
+func (s *queueService) GetQueue(ctx context.Context) ([]entities.QueueOrder, error) {
+	page, err := s.orderRepository.GetFiltered(ctx, entities.OrderFilter{
+		Statuses: queueStatuses,
+		SortBy:   entities.OrderSortCreatedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	menuItems := make(map[int]entities.MenuItem)
+	queue := make([]entities.QueueOrder, 0, len(page.Orders))
+	for _, order := range page.Orders {
+		entry, err := s.queueOrder(ctx, order, menuItems, now)
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, entry)
+	}
+	return queue, nil
+}
+
+// Resolves the items of the order to menu names, the menu items are cached in the map
+func (s *queueService) queueOrder(ctx context.Context, order entities.Order, menuItems map[int]entities.MenuItem, now time.Time) (entities.QueueOrder, error) {
+	orderID, _ := strconv.ParseInt(order.ID, 10, 64)
+	entry := entities.QueueOrder{
+		OrderID:      orderID,
+		CustomerName: order.CustomerName,
+		Status:       order.Status,
+		CreatedAt:    order.CreatedAt,
+		PickupAt:     order.PickupAt,
+		Items:        make([]entities.QueueItem, 0, len(order.Items)),
+	}
+	if createdAt, err := time.Parse(time.RFC3339Nano, order.CreatedAt); err == nil {
+		entry.AgeSeconds = roundSeconds(now.Sub(createdAt).Seconds())
+	}
+
+	for _, item := range order.Items {
+		menuItem, ok := menuItems[item.ProductID]
+		if !ok {
+			var err error
+			menuItem, err = s.menuRepository.GetById(ctx, strconv.Itoa(item.ProductID))
+			if err != nil {
+				return entry, fmt.Errorf("failed to fetch menu item %d: %w", item.ProductID, err)
+			}
+			menuItems[item.ProductID] = menuItem
+		}
+
+		queueItem := entities.QueueItem{
+			ProductID:         item.ProductID,
+			Name:              menuItem.Name,
+			Quantity:          item.Quantity,
+			CustomizationInfo: item.CustomizationInfo,
+		}
+		for _, modifierID := range item.ModifierIDs {
+			if modifier, ok := menuItem.Modifier(modifierID); ok {
+				queueItem.Modifiers = append(queueItem.Modifiers, modifier.Name)
+			}
+		}
+		entry.Items = append(entry.Items, queueItem)
+	}
+	return entry, nil
+}
+
+// Numbers the event and sends it to the subscribers, the queue entry is attached while the order is in the queue
+func (s *queueService) Publish(ctx context.Context, event entities.OrderEvent) {
+	event.OccurredAt = time.Now()
+	if event.Type != entities.OrderDeletedEvent && utils.In(event.Status, queueStatuses) {
+		order, err := s.orderRepository.GetById(ctx, strconv.FormatInt(event.OrderID, 10))
+		if err == nil {
+			var entry entities.QueueOrder
+			if entry, err = s.queueOrder(ctx, order, make(map[int]entities.MenuItem), event.OccurredAt); err == nil {
+				event.Order = &entry
+			}
+		}
+		if err != nil {
+			slog.Error("Error while resolving the queue entry of the order event: ", "order_id", event.OrderID, "error", err.Error())
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sequence++
+	event.ID = fmt.Sprintf("%d-%d", s.epoch, s.sequence)
+	s.events = append(s.events, event)
+	if len(s.events) > queueEventsKept {
+		s.events = s.events[len(s.events)-queueEventsKept:]
+	}
+
+	for subscriber := range s.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			// Reconnects and resumes after the last event it got
+			delete(s.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
+
+// Subscribes to the events published after the last seen one, the missed events are returned first.
+// Resumed is false if the last seen event is unknown or no longer kept, the queue should be fetched again.
+// The channel is closed when the subscriber falls behind or unsubscribes
+func (s *queueService) Subscribe(lastEventID string) (missed []entities.OrderEvent, events <-chan entities.OrderEvent, resumed bool, unsubscribe func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resumed = true
+	if lastEventID != "" {
+		missed, resumed = s.eventsAfter(lastEventID)
+	}
+
+	subscriber := make(chan entities.OrderEvent, queueSubscriberBuffer)
+	s.subscribers[subscriber] = struct{}{}
+	unsubscribe = func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.subscribers[subscriber]; ok {
+			delete(s.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+	return missed, subscriber, resumed, unsubscribe
+}
+
+// Kept events after the one with the id, false if the events after it are not kept entirely
+func (s *queueService) eventsAfter(lastEventID string) ([]entities.OrderEvent, bool) {
+	epochStr, sequenceStr, found := strings.Cut(lastEventID, "-")
+	if !found {
+		return nil, false
+	}
+	epoch, err := strconv.ParseInt(epochStr, 10, 64)
+	if err != nil || epoch != s.epoch {
+		return nil, false
+	}
+	sequence, err := strconv.ParseInt(sequenceStr, 10, 64)
+	if err != nil || sequence > s.sequence {
+		return nil, false
+	}
+
+	first := s.sequence - int64(len(s.events)) + 1
+	if sequence < first-1 {
+		return nil, false
+	}
+	return append([]entities.OrderEvent(nil), s.events[sequence-first+1:]...), true
+}
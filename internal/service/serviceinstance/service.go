@@ -1,6 +1,9 @@
 package serviceinstance
 
 import (
+	"hot-coffee/internal/flag"
+	"hot-coffee/internal/infrastructure/storage/jsonfile"
+	"hot-coffee/internal/infrastructure/storage/memory"
 	"hot-coffee/internal/infrastructure/storage/postgres"
 	"hot-coffee/internal/repository"
 	"hot-coffee/internal/service"
@@ -13,15 +16,41 @@ var (
 	InventoryService   service.InventoryService
 	MenuService        service.MenuService
 	OrderService       service.OrderService
+	CustomerService    service.CustomerService
+	LoyaltyService     service.LoyaltyService
+	AuditService       service.AuditService
+	PromotionService   service.PromotionService
+	PaymentService     service.PaymentService
+	IdempotencyService service.IdempotencyService
+	QueueService       service.QueueService
+	WebhookService     service.WebhookService
 	AggregationService service.AggregationService // New aggregation service
 )
 
 func NewService(repositories *repository.Repository) (*service.Service, error) {
 
+	webhookService := NewWebhookService(repositories.Webhook)
+	inventoryService := NewInventoryService(repositories.Inventory, repositories.Menu, repositories.UnitOfWork, webhookService)
+	promotionService := NewPromotionService(repositories.Promotion)
+	loyaltyService := NewLoyaltyService(repositories.Loyalty, repositories.Customer, repositories.Menu)
+	paymentService := NewPaymentService(repositories.Payment, repositories.Order, repositories.UnitOfWork, inventoryService, loyaltyService)
+	queueService := NewQueueService(repositories.Order, repositories.Menu)
+	auditService := NewAuditService(repositories.Audit)
+	idempotencyService := NewIdempotencyService(repositories.Idempotency)
+	customerService := NewCustomerService(repositories.Customer, repositories.Order, repositories.UnitOfWork, loyaltyService, auditService, webhookService, idempotencyService)
+
 	return &service.Service{
-		InventoryService:   NewInventoryService(repositories.Inventory),
+		InventoryService:   inventoryService,
 		MenuService:        NewMenuService(repositories.Menu),
-		OrderService:       NewOrderService(repositories.Order),
+		OrderService:       NewOrderService(repositories.Order, repositories.UnitOfWork, inventoryService, promotionService, paymentService, queueService, webhookService, customerService, loyaltyService),
+		CustomerService:    customerService,
+		LoyaltyService:     loyaltyService,
+		AuditService:       auditService,
+		PromotionService:   promotionService,
+		PaymentService:     paymentService,
+		IdempotencyService: idempotencyService,
+		QueueService:       queueService,
+		WebhookService:     webhookService,
 		AggregationService: NewAggregationService(repositories.Menu, repositories.Order), // New aggregation service
 	}, nil
 }
@@ -29,11 +58,34 @@ func NewService(repositories *repository.Repository) (*service.Service, error) {
 // Initialize services
 func Init() {
 	var err error
-	serviceInstance, err := NewService(postgres.NewRepository())
+	serviceInstance, err := NewService(newRepository())
 	utils.FatalError("Error while initializing inventory service", err)
 	InventoryService = serviceInstance.InventoryService
 	MenuService = serviceInstance.MenuService
 	OrderService = serviceInstance.OrderService
+	CustomerService = serviceInstance.CustomerService
+	LoyaltyService = serviceInstance.LoyaltyService
+	AuditService = serviceInstance.AuditService
+	PromotionService = serviceInstance.PromotionService
+	PaymentService = serviceInstance.PaymentService
+	IdempotencyService = serviceInstance.IdempotencyService
+	QueueService = serviceInstance.QueueService
+	WebhookService = serviceInstance.WebhookService
 	AggregationService = serviceInstance.AggregationService // New aggregation service
 	slog.Info("Services initialized")
 }
+
+// Returns the repository of storage backend chosen by flag
+func newRepository() *repository.Repository {
+	switch flag.Storage {
+	case "memory":
+		slog.Info("Using in-memory storage, data will be lost on shutdown")
+		return memory.NewRepository()
+	case "file":
+		repositories, err := jsonfile.NewRepository(flag.StoragePath)
+		utils.FatalError("Error while opening file storage", err)
+		return repositories
+	default:
+		return postgres.NewRepository()
+	}
+}
@@ -0,0 +1,106 @@
+package serviceinstance
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/infrastructure/storage/memory"
+	"hot-coffee/internal/service"
+)
+
+// Wires the services over a new in-memory storage. The package instances used by
+// the validators are replaced for the test and restored after it
+func newTestService(t *testing.T) *service.Service {
+	t.Helper()
+
+	services, err := NewService(memory.NewRepository())
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+
+	saved := service.Service{
+		InventoryService:   InventoryService,
+		MenuService:        MenuService,
+		OrderService:       OrderService,
+		CustomerService:    CustomerService,
+		LoyaltyService:     LoyaltyService,
+		AuditService:       AuditService,
+		PromotionService:   PromotionService,
+		PaymentService:     PaymentService,
+		IdempotencyService: IdempotencyService,
+		QueueService:       QueueService,
+		WebhookService:     WebhookService,
+		AggregationService: AggregationService,
+	}
+	setServices(services)
+	t.Cleanup(func() { setServices(&saved) })
+	return services
+}
+
+func setServices(services *service.Service) {
+	InventoryService = services.InventoryService
+	MenuService = services.MenuService
+	OrderService = services.OrderService
+	CustomerService = services.CustomerService
+	LoyaltyService = services.LoyaltyService
+	AuditService = services.AuditService
+	PromotionService = services.PromotionService
+	PaymentService = services.PaymentService
+	IdempotencyService = services.IdempotencyService
+	QueueService = services.QueueService
+	WebhookService = services.WebhookService
+	AggregationService = services.AggregationService
+}
+
+// Sets the flag value for the test
+func setFlag[T any](t *testing.T, flag *T, value T) {
+	t.Helper()
+	saved := *flag
+	*flag = value
+	t.Cleanup(func() { *flag = saved })
+}
+
+// Creates the menu item made of 100 ml of a new inventory item, returns its id
+func createTestMenuItem(t *testing.T, services *service.Service, name string, price float64) int {
+	t.Helper()
+	ctx := context.Background()
+
+	ingredient := entities.InventoryItem{Name: name + " base", Price: 0.01, Quantity: 100000, Unit: "ml"}
+	if err := services.InventoryService.CreateInventoryItem(ctx, ingredient); err != nil {
+		t.Fatalf("CreateInventoryItem() error = %v", err)
+	}
+	ingredients, err := services.InventoryService.GetInventoryItems(ctx)
+	if err != nil {
+		t.Fatalf("GetInventoryItems() error = %v", err)
+	}
+
+	item := entities.MenuItem{
+		Name:        name,
+		Description: name,
+		Price:       price,
+		Ingredients: []entities.MenuItemIngredient{{IngredientID: ingredients[len(ingredients)-1].IngredientID, Quantity: 100}},
+	}
+	if err := services.MenuService.CreateMenuItem(ctx, item); err != nil {
+		t.Fatalf("CreateMenuItem() error = %v", err)
+	}
+	items, err := services.MenuService.GetMenuItems(ctx)
+	if err != nil {
+		t.Fatalf("GetMenuItems() error = %v", err)
+	}
+	id, _ := strconv.Atoi(items[len(items)-1].ID)
+	return id
+}
+
+// Creates the open order of the items, returns it with its amounts
+func createTestOrder(t *testing.T, services *service.Service, items ...entities.OrderItem) entities.Order {
+	t.Helper()
+
+	order := entities.Order{CustomerName: "Test customer", Items: items}
+	order, err := services.OrderService.CreateOrder(context.Background(), order)
+	if err != nil {
+		t.Fatalf("CreateOrder() error = %v", err)
+	}
+	return order
+}
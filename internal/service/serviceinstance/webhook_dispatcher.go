@@ -0,0 +1,34 @@
+package serviceinstance
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"hot-coffee/internal/flag"
+)
+
+// Sends the webhook deliveries due every --webhook-interval until the context is done
+func RunWebhookDispatcher(ctx context.Context) {
+	ticker := time.NewTicker(flag.WebhookInterval)
+	defer ticker.Stop()
+
+	for {
+		dispatchWebhooks(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Requests to the webhooks have their own time limit, so the run has none
+func dispatchWebhooks(ctx context.Context) {
+	delivered, err := WebhookService.DispatchDue(ctx, time.Now())
+	if err != nil {
+		slog.Error("Error while dispatching the webhook deliveries: ", "error", err.Error())
+	} else if delivered > 0 {
+		slog.Info("Webhook deliveries sent", "count", delivered)
+	}
+}
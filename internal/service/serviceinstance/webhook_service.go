@@ -0,0 +1,438 @@
+package serviceinstance
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/core/errors"
+	"hot-coffee/internal/flag"
+	"hot-coffee/internal/repository"
+	"hot-coffee/internal/utils"
+)
+
+// Errors
+var (
+	ErrInvalidWebhookURL      = errors.New("webhook url must be absolute http or https url")
+	ErrNoWebhookEventTypes    = errors.New("no webhook event types provided")
+	ErrUnknownWebhookEvent    = errors.New("unknown webhook event type provided")
+	ErrEmptyWebhookSecret     = errors.New("empty webhook secret provided")
+	ErrWebhookAlreadyExists   = errors.New("webhook with such id already exists")
+	ErrWebhookNotExists       = errors.New("webhook with such id does not exist")
+	ErrNoWebhooks             = errors.New("no webhooks")
+	ErrWebhookVersionMismatch = errors.New("webhook was modified by another request, fetch it again")
+	ErrWebhookIDCollision     = errors.New("id collision between id in request body and id in url")
+	ErrInvalidDeliveryStatus  = errors.New("delivery status must be pending, delivered or dead")
+	ErrDeliveryNotExists      = errors.New("webhook delivery with such id does not exist")
+	ErrDeliveryNotDead        = errors.New("only dead deliveries can be retried")
+)
+
+const (
+	// Deliveries claimed by one dispatcher run
+	webhookDispatchBatch = 100
+	// Time the claimed delivery is hidden from other dispatchers, longer than its request may take
+	webhookDeliveryLease  = time.Minute
+	webhookRequestTimeout = 10 * time.Second
+	// Part of the lease kept for saving the results of the batch
+	webhookUpdateMargin = 10 * time.Second
+	// Longest delay between the retries
+	maxWebhookBackoff = time.Hour
+	// Part of the failed response body kept as the delivery error
+	webhookErrorBodyLimit = 512
+)
+
+// Headers of the webhook request
+const (
+	WebhookEventHeader     = "X-Hot-Coffee-Event"
+	WebhookDeliveryHeader  = "X-Hot-Coffee-Delivery"
+	WebhookTimestampHeader = "X-Hot-Coffee-Timestamp"
+	// sha256=<hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the webhook secret>
+	WebhookSignatureHeader = "X-Hot-Coffee-Signature"
+)
+
+type webhookService struct {
+	webhookRepository repository.WebhookRepository
+	client            *http.Client
+}
+
+func NewWebhookService(repository repository.WebhookRepository) *webhookService {
+	if repository == nil {
+		slog.Error("Error while creating Webhook service: Nil pointer repository provided")
+		os.Exit(1)
+	}
+	return &webhookService{repository, &http.Client{}}
+}
+
+func (s *webhookService) CreateWebhook(ctx context.Context, webhook entities.Webhook) (int64, error) {
+	if err := validateWebhook(&webhook); err != nil && err != ErrEmptyID {
+		return -1, err
+	} else if webhook.Secret == "" {
+		return -1, ErrEmptyWebhookSecret
+	}
+
+	id, err := s.webhookRepository.Create(ctx, webhook)
+	if err != nil {
+		if errors.Is(err, errors.ErrIDAlreadyExists) {
+			return -1, ErrWebhookAlreadyExists
+		}
+		return -1, err
+	}
+	return id, nil
+}
+
+// Secrets are never returned
+func (s *webhookService) GetWebhooks(ctx context.Context) ([]entities.Webhook, error) {
+	webhooks, err := s.webhookRepository.GetAll(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoWebhooks
+		}
+		return nil, err
+	}
+	for idx := range webhooks {
+		webhooks[idx].Secret = ""
+	}
+	return webhooks, nil
+}
+
+func (s *webhookService) GetWebhook(ctx context.Context, id string) (entities.Webhook, error) {
+	webhook, err := s.getWebhook(ctx, id)
+	webhook.Secret = ""
+	return webhook, err
+}
+
+// Empty secret keeps the current one
+func (s *webhookService) UpdateWebhook(ctx context.Context, id string, webhook entities.Webhook) error {
+	if err := validateWebhook(&webhook); err != nil {
+		return err
+	}
+	if id != webhook.ID {
+		return ErrWebhookIDCollision
+	}
+
+	if webhook.Secret == "" {
+		current, err := s.getWebhook(ctx, id)
+		if err != nil {
+			return err
+		}
+		webhook.Secret = current.Secret
+	}
+
+	if err := s.webhookRepository.Update(ctx, id, webhook); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrWebhookNotExists
+		} else if errors.Is(err, errors.ErrVersionMismatch) {
+			return ErrWebhookVersionMismatch
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *webhookService) DeleteWebhook(ctx context.Context, id string) error {
+	if err := isValidID(id); err != nil {
+		return err
+	}
+
+	if err := s.webhookRepository.Delete(ctx, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrWebhookNotExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *webhookService) GetWebhookDeliveries(ctx context.Context, id, status string) ([]entities.WebhookDelivery, error) {
+	if status != "" && !utils.In(status, []string{entities.DeliveryPending, entities.DeliveryDelivered, entities.DeliveryDead}) {
+		return nil, ErrInvalidDeliveryStatus
+	}
+	if _, err := s.getWebhook(ctx, id); err != nil {
+		return nil, err
+	}
+
+	webhookID, _ := strconv.ParseInt(id, 10, 64)
+	return s.webhookRepository.GetDeliveries(ctx, webhookID, status)
+}
+
+// Deliveries of every webhook which exhausted their retries, the newest first
+func (s *webhookService) GetDeadLetters(ctx context.Context) ([]entities.WebhookDelivery, error) {
+	return s.webhookRepository.GetDeliveries(ctx, 0, entities.DeliveryDead)
+}
+
+// Moves the dead delivery back to the outbox with the attempts reset
+func (s *webhookService) RetryDelivery(ctx context.Context, id string) (entities.WebhookDelivery, error) {
+	if err := isValidID(id); err != nil {
+		return entities.WebhookDelivery{}, err
+	}
+
+	delivery, err := s.webhookRepository.GetDeliveryById(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return delivery, ErrDeliveryNotExists
+		}
+		return delivery, err
+	} else if delivery.Status != entities.DeliveryDead {
+		return delivery, ErrDeliveryNotDead
+	}
+
+	delivery.Status = entities.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+	if err := s.webhookRepository.UpdateDelivery(ctx, delivery); err != nil {
+		return delivery, err
+	}
+	return delivery, nil
+}
+
+// Writes the event to the outbox of every enabled webhook subscribed to it.
+// Must be called in the transaction of the change, so the event is kept only if the change is
+func (s *webhookService) Enqueue(ctx context.Context, eventType string, data interface{}) error {
+	webhooks, err := s.webhookRepository.GetAll(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	var (
+		event   entities.WebhookEvent
+		payload []byte
+	)
+	for _, webhook := range webhooks {
+		if webhook.Disabled || !utils.In(eventType, webhook.EventTypes) {
+			continue
+		}
+
+		// Every subscriber gets the same event
+		if payload == nil {
+			event = entities.WebhookEvent{
+				ID:         newEventID(),
+				Type:       eventType,
+				OccurredAt: time.Now().UTC(),
+				Data:       data,
+			}
+			if payload, err = json.Marshal(event); err != nil {
+				return fmt.Errorf("failed to encode webhook event: %w", err)
+			}
+		}
+
+		webhookID, _ := strconv.ParseInt(webhook.ID, 10, 64)
+		_, err := s.webhookRepository.CreateDelivery(ctx, entities.WebhookDelivery{
+			WebhookID:     webhookID,
+			EventID:       event.ID,
+			EventType:     eventType,
+			Payload:       payload,
+			NextAttemptAt: event.OccurredAt,
+			CreatedAt:     event.OccurredAt,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to save webhook delivery: %w", err)
+		}
+	}
+	return nil
+}
+
+// Sends the deliveries due, failed ones are retried with exponential backoff
+// until --webhook-max-attempts and dead-lettered then. Returns the number of deliveries sent.
+// The batch is sent at once and every request ends before the claim lease does,
+// so no other dispatcher sends the claimed deliveries again
+func (s *webhookService) DispatchDue(ctx context.Context, now time.Time) (int, error) {
+	claimedAt := time.Now()
+	deliveries, err := s.webhookRepository.ClaimDueDeliveries(ctx, now, webhookDeliveryLease, webhookDispatchBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	webhooks := make(map[int64]entities.Webhook)
+	var sent []entities.WebhookDelivery
+	for _, delivery := range deliveries {
+		if _, ok := webhooks[delivery.WebhookID]; ok {
+			sent = append(sent, delivery)
+			continue
+		}
+		webhook, err := s.webhookRepository.GetById(ctx, strconv.FormatInt(delivery.WebhookID, 10))
+		if errors.Is(err, sql.ErrNoRows) {
+			// Deleted with its deliveries in the meantime
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		webhooks[delivery.WebhookID] = webhook
+		sent = append(sent, delivery)
+	}
+
+	// Time left to save the results before the lease is over
+	deadline := claimedAt.Add(webhookDeliveryLease - webhookUpdateMargin)
+	statusCodes := make([]int, len(sent))
+	errs := make([]error, len(sent))
+	var wg sync.WaitGroup
+	for idx, delivery := range sent {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			requestDeadline := time.Now().Add(webhookRequestTimeout)
+			if deadline.Before(requestDeadline) {
+				requestDeadline = deadline
+			}
+			sendCtx, cancel := context.WithDeadline(ctx, requestDeadline)
+			defer cancel()
+			statusCodes[idx], errs[idx] = s.send(sendCtx, webhooks[delivery.WebhookID], delivery)
+		}()
+	}
+	wg.Wait()
+
+	delivered := 0
+	for idx, delivery := range sent {
+		delivery.Attempts++
+		delivery.LastStatusCode = statusCodes[idx]
+		if errs[idx] == nil {
+			deliveredAt := time.Now()
+			delivery.Status = entities.DeliveryDelivered
+			delivery.DeliveredAt = &deliveredAt
+			delivery.LastError = ""
+			delivered++
+		} else {
+			delivery.LastError = errs[idx].Error()
+			if delivery.Attempts >= flag.WebhookMaxAttempts {
+				delivery.Status = entities.DeliveryDead
+				slog.Warn("Webhook delivery moved to dead letters", "delivery_id", delivery.ID, "webhook_id", delivery.WebhookID, "error", delivery.LastError)
+			} else {
+				delivery.NextAttemptAt = time.Now().Add(webhookBackoff(delivery.Attempts))
+			}
+		}
+
+		if err := s.webhookRepository.UpdateDelivery(ctx, delivery); err != nil {
+			return delivered, err
+		}
+	}
+	return delivered, nil
+}
+
+// Replaces the customer name in the events of the orders, deliveries not sent yet carry the replacement
+func (s *webhookService) RedactCustomerName(ctx context.Context, name string, orderIDs []string) error {
+	text, _ := json.Marshal(name)
+	deliveries, err := s.webhookRepository.SearchDeliveries(ctx, text)
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		payload, redacted := redactCustomerName(delivery.Payload, orderIDs)
+		if !redacted {
+			continue
+		}
+		if err := s.webhookRepository.UpdatePayload(ctx, delivery.ID, payload); err != nil {
+			return fmt.Errorf("failed to redact webhook delivery %s: %w", delivery.ID, err)
+		}
+	}
+	return nil
+}
+
+// Posts the payload to the webhook url, any response but 2xx is a failure
+func (s *webhookService) send(ctx context.Context, webhook entities.Webhook, delivery entities.WebhookDelivery) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "hot-coffee-webhooks")
+	request.Header.Set(WebhookEventHeader, delivery.EventType)
+	request.Header.Set(WebhookDeliveryHeader, delivery.ID)
+	request.Header.Set(WebhookTimestampHeader, timestamp)
+	request.Header.Set(WebhookSignatureHeader, "sha256="+signPayload(webhook.Secret, timestamp, delivery.Payload))
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, webhookErrorBodyLimit))
+		return response.StatusCode, fmt.Errorf("unexpected response status %d: %s", response.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return response.StatusCode, nil
+}
+
+// Signature covers the timestamp, so a captured request cannot be replayed later with a new one
+func signPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Delay before the next attempt after the given number of failed ones
+func webhookBackoff(attempts int) time.Duration {
+	backoff := flag.WebhookBackoff
+	for i := 1; i < attempts && backoff < maxWebhookBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxWebhookBackoff)
+}
+
+func newEventID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func (s *webhookService) getWebhook(ctx context.Context, id string) (entities.Webhook, error) {
+	if err := isValidID(id); err != nil {
+		return entities.Webhook{}, err
+	}
+
+	webhook, err := s.webhookRepository.GetById(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entities.Webhook{}, ErrWebhookNotExists
+		}
+		return entities.Webhook{}, err
+	}
+	return webhook, nil
+}
+
+func validateWebhook(webhook *entities.Webhook) error {
+	webhook.URL = strings.TrimSpace(webhook.URL)
+
+	parsed, err := url.Parse(webhook.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return ErrInvalidWebhookURL
+	}
+
+	if len(webhook.EventTypes) == 0 {
+		return ErrNoWebhookEventTypes
+	}
+	var eventTypes []string
+	for _, eventType := range webhook.EventTypes {
+		if !utils.In(eventType, entities.WebhookEventTypes) {
+			return fmt.Errorf("%w: %s", ErrUnknownWebhookEvent, eventType)
+		} else if !utils.In(eventType, eventTypes) {
+			eventTypes = append(eventTypes, eventType)
+		}
+	}
+	webhook.EventTypes = eventTypes
+
+	return isValidID(webhook.ID)
+}
@@ -0,0 +1,145 @@
+package serviceinstance
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"hot-coffee/internal/core/entities"
+	"hot-coffee/internal/flag"
+)
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		base     time.Duration
+		attempts int
+		want     time.Duration
+	}{
+		{base: 30 * time.Second, attempts: 1, want: 30 * time.Second},
+		{base: 30 * time.Second, attempts: 2, want: time.Minute},
+		{base: 30 * time.Second, attempts: 3, want: 2 * time.Minute},
+		{base: 30 * time.Second, attempts: 7, want: 32 * time.Minute},
+		{base: 30 * time.Second, attempts: 8, want: maxWebhookBackoff},
+		{base: 30 * time.Second, attempts: 1000, want: maxWebhookBackoff},
+		{base: 2 * time.Hour, attempts: 1, want: maxWebhookBackoff},
+	}
+	for _, tt := range tests {
+		setFlag(t, &flag.WebhookBackoff, tt.base)
+		if got := webhookBackoff(tt.attempts); got != tt.want {
+			t.Errorf("webhookBackoff(%d) with %v base = %v, want %v", tt.attempts, tt.base, got, tt.want)
+		}
+	}
+}
+
+func TestDispatchDue(t *testing.T) {
+	setFlag(t, &flag.WebhookBackoff, time.Minute)
+	setFlag(t, &flag.WebhookMaxAttempts, 3)
+	services := newTestService(t)
+	ctx := context.Background()
+
+	// The endpoint fails until it is told to accept
+	var accept atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !accept.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	webhook := entities.Webhook{URL: server.URL, Secret: "s3cr3t", EventTypes: []string{entities.InventoryLowEvent}}
+	id, err := services.WebhookService.CreateWebhook(ctx, webhook)
+	if err != nil {
+		t.Fatalf("CreateWebhook() error = %v", err)
+	}
+	webhookID := strconv.FormatInt(id, 10)
+	if err := services.WebhookService.Enqueue(ctx, entities.InventoryLowEvent, map[string]string{"ingredient_id": "1"}); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	// Steps are run one after another, each dispatches the deliveries due at its moment
+	start := time.Now()
+	steps := []struct {
+		name          string
+		at            time.Time
+		accept        bool
+		wantDelivered int
+		wantAttempts  int
+		wantStatus    string
+		// Delay of the next attempt after the dispatch, checked for the pending delivery
+		wantBackoff time.Duration
+	}{
+		{name: "first attempt fails", at: start, wantAttempts: 1, wantStatus: entities.DeliveryPending, wantBackoff: time.Minute},
+		{name: "not due before backoff", at: start.Add(30 * time.Second), wantAttempts: 1, wantStatus: entities.DeliveryPending},
+		{name: "second attempt doubles backoff", at: start.Add(2 * time.Minute), wantAttempts: 2, wantStatus: entities.DeliveryPending, wantBackoff: 2 * time.Minute},
+		{name: "last attempt dead-letters", at: start.Add(5 * time.Minute), wantAttempts: 3, wantStatus: entities.DeliveryDead},
+		{name: "dead letter not retried", at: start.Add(time.Hour), accept: true, wantAttempts: 3, wantStatus: entities.DeliveryDead},
+	}
+	for _, step := range steps {
+		accept.Store(step.accept)
+		dispatchedAt := time.Now()
+		delivered, err := services.WebhookService.DispatchDue(ctx, step.at)
+		if err != nil {
+			t.Fatalf("%s: DispatchDue() error = %v", step.name, err)
+		} else if delivered != step.wantDelivered {
+			t.Fatalf("%s: DispatchDue() = %d, want %d", step.name, delivered, step.wantDelivered)
+		}
+
+		deliveries, err := services.WebhookService.GetWebhookDeliveries(ctx, webhookID, "")
+		if err != nil || len(deliveries) != 1 {
+			t.Fatalf("%s: GetWebhookDeliveries() = %v, error = %v, want one delivery", step.name, deliveries, err)
+		}
+		delivery := deliveries[0]
+		if delivery.Attempts != step.wantAttempts || delivery.Status != step.wantStatus {
+			t.Fatalf("%s: attempts = %d, status = %s, want %d and %s", step.name, delivery.Attempts, delivery.Status, step.wantAttempts, step.wantStatus)
+		}
+		if step.wantBackoff != 0 {
+			if delivery.NextAttemptAt.Before(dispatchedAt.Add(step.wantBackoff)) || delivery.NextAttemptAt.After(time.Now().Add(step.wantBackoff)) {
+				t.Fatalf("%s: next attempt at %v, want %v after the dispatch", step.name, delivery.NextAttemptAt, step.wantBackoff)
+			}
+		}
+	}
+
+	// Retried dead letter is sent again
+	deliveries, _ := services.WebhookService.GetDeadLetters(ctx)
+	if _, err := services.WebhookService.RetryDelivery(ctx, deliveries[0].ID); err != nil {
+		t.Fatalf("RetryDelivery() error = %v", err)
+	}
+	if delivered, err := services.WebhookService.DispatchDue(ctx, time.Now().Add(time.Second)); err != nil || delivered != 1 {
+		t.Fatalf("DispatchDue() after retry = %d, error = %v, want 1", delivered, err)
+	}
+}
+
+func TestDispatchDueSendsBatchAtOnce(t *testing.T) {
+	services := newTestService(t)
+	ctx := context.Background()
+
+	// Sent one after another the batch would take three times as long
+	delay := 200 * time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+	}))
+	defer server.Close()
+
+	webhook := entities.Webhook{URL: server.URL, Secret: "s3cr3t", EventTypes: []string{entities.InventoryLowEvent}}
+	if _, err := services.WebhookService.CreateWebhook(ctx, webhook); err != nil {
+		t.Fatalf("CreateWebhook() error = %v", err)
+	}
+	for range 3 {
+		if err := services.WebhookService.Enqueue(ctx, entities.InventoryLowEvent, map[string]string{"ingredient_id": "1"}); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+
+	start := time.Now()
+	delivered, err := services.WebhookService.DispatchDue(ctx, start)
+	if err != nil || delivered != 3 {
+		t.Fatalf("DispatchDue() = %d, error = %v, want 3", delivered, err)
+	}
+	if elapsed := time.Since(start); elapsed >= 2*delay {
+		t.Fatalf("DispatchDue() took %v, want less than %v", elapsed, 2*delay)
+	}
+}
@@ -14,9 +14,11 @@ type BatchResponse struct {
 }
 
 type Summary struct {
-	TotalOrders      int               `json:"total_orders"`
-	Accepted         int               `json:"accepted,omitempty"`
-	Rejected         int               `json:"rejected,omitempty"`
+	TotalOrders int `json:"total_orders"`
+	Accepted    int `json:"accepted,omitempty"`
+	Rejected    int `json:"rejected,omitempty"`
+	// Atomic batch with a rejected order, none of its orders were created
+	RolledBack       bool              `json:"rolled_back,omitempty"`
 	TotalRevenue     float64           `json:"total_revenue"`
 	InventoryUpdates []InventoryUpdate `json:"inventory_updates"`
 }
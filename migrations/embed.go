@@ -0,0 +1,9 @@
+package migrations
+
+import "embed"
+
+// SQL migrations embedded into the binary, every version has up and down file:
+// schema/ holds the database structure, seed/ holds the mock data for development
+//
+//go:embed schema/*.sql seed/*.sql
+var FS embed.FS
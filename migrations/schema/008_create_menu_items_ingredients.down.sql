@@ -0,0 +1 @@
+DROP TABLE menu_items_ingredients;
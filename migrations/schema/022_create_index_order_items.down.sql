@@ -0,0 +1,2 @@
+DROP INDEX oi_quantity_idx;
+DROP INDEX oi_orderid_idx;
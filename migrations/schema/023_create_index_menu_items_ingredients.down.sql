@@ -0,0 +1,2 @@
+DROP INDEX mii_menu_item_id;
+DROP INDEX mii_inventory_item_id;
@@ -0,0 +1,3 @@
+ALTER TABLE inventory DROP COLUMN version;
+ALTER TABLE menu_items DROP COLUMN version;
+ALTER TABLE orders DROP COLUMN version;
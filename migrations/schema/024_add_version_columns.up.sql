@@ -0,0 +1,3 @@
+ALTER TABLE orders ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE menu_items ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE inventory ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
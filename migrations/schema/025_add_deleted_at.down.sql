@@ -0,0 +1,10 @@
+ALTER TABLE inventory_transactions DROP CONSTRAINT inventory_transactions_inventory_item_id_fkey;
+ALTER TABLE inventory_transactions ADD CONSTRAINT inventory_transactions_inventory_item_id_fkey
+    FOREIGN KEY (inventory_item_id) REFERENCES inventory (inventory_item_id) ON DELETE CASCADE;
+
+ALTER TABLE order_items DROP CONSTRAINT order_items_menu_item_id_fkey;
+ALTER TABLE order_items ADD CONSTRAINT order_items_menu_item_id_fkey
+    FOREIGN KEY (menu_item_id) REFERENCES menu_items (menu_item_id) ON DELETE CASCADE;
+
+ALTER TABLE inventory DROP COLUMN deleted_at;
+ALTER TABLE menu_items DROP COLUMN deleted_at;
@@ -0,0 +1,12 @@
+ALTER TABLE menu_items ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE inventory ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- Menu and inventory items are archived instead of deleting,
+-- the history of orders must not be wiped by a hard delete either
+ALTER TABLE order_items DROP CONSTRAINT order_items_menu_item_id_fkey;
+ALTER TABLE order_items ADD CONSTRAINT order_items_menu_item_id_fkey
+    FOREIGN KEY (menu_item_id) REFERENCES menu_items (menu_item_id) ON DELETE RESTRICT;
+
+ALTER TABLE inventory_transactions DROP CONSTRAINT inventory_transactions_inventory_item_id_fkey;
+ALTER TABLE inventory_transactions ADD CONSTRAINT inventory_transactions_inventory_item_id_fkey
+    FOREIGN KEY (inventory_item_id) REFERENCES inventory (inventory_item_id) ON DELETE RESTRICT;
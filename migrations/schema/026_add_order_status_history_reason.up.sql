@@ -0,0 +1 @@
+ALTER TABLE order_status_history ADD COLUMN reason TEXT NOT NULL DEFAULT '';
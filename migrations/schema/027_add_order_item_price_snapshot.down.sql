@@ -0,0 +1,4 @@
+DROP TRIGGER order_items_price_snapshot ON order_items;
+DROP FUNCTION snapshot_order_item_prices();
+ALTER TABLE order_items DROP COLUMN unit_cost;
+ALTER TABLE order_items DROP COLUMN unit_price;
@@ -0,0 +1,46 @@
+-- Price and ingredient cost of a single menu item at the moment the order line was written,
+-- reports use them instead of the current menu and inventory prices
+ALTER TABLE order_items ADD COLUMN unit_price NUMERIC CONSTRAINT non_negative_unit_price CHECK (unit_price >= 0);
+ALTER TABLE order_items ADD COLUMN unit_cost NUMERIC CONSTRAINT non_negative_unit_cost CHECK (unit_cost >= 0);
+
+-- Backfill: the price at order time is the current price without the changes made after the order.
+-- Inventory prices have no history, so the cost is taken from the current prices
+UPDATE order_items oi
+SET unit_price = GREATEST(mi.price - COALESCE((
+        SELECT SUM(ph.price_difference)
+        FROM price_history ph
+        WHERE ph.menu_item_id = oi.menu_item_id AND ph.changed_at > o.created_at
+    ), 0), 0)
+FROM menu_items mi, orders o
+WHERE mi.menu_item_id = oi.menu_item_id AND o.order_id = oi.order_id;
+
+UPDATE order_items oi
+SET unit_cost = COALESCE((
+    SELECT SUM(mii.quantity * i.price)
+    FROM menu_items_ingredients mii
+    JOIN inventory i USING(inventory_item_id)
+    WHERE mii.menu_item_id = oi.menu_item_id
+), 0);
+
+-- Rows inserted without the snapshot (seeds, manual inserts) take the current prices
+CREATE FUNCTION snapshot_order_item_prices() RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.unit_price IS NULL THEN
+        SELECT price INTO NEW.unit_price FROM menu_items WHERE menu_item_id = NEW.menu_item_id;
+    END IF;
+    IF NEW.unit_cost IS NULL THEN
+        SELECT COALESCE(SUM(mii.quantity * i.price), 0) INTO NEW.unit_cost
+        FROM menu_items_ingredients mii
+        JOIN inventory i USING(inventory_item_id)
+        WHERE mii.menu_item_id = NEW.menu_item_id;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER order_items_price_snapshot
+    BEFORE INSERT ON order_items
+    FOR EACH ROW EXECUTE FUNCTION snapshot_order_item_prices();
+
+ALTER TABLE order_items ALTER COLUMN unit_price SET NOT NULL;
+ALTER TABLE order_items ALTER COLUMN unit_cost SET NOT NULL;
@@ -0,0 +1,34 @@
+CREATE TYPE discount_type AS ENUM ('percent', 'fixed', 'free_items');
+
+CREATE TABLE promotions(
+    promotion_id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    code TEXT CONSTRAINT promotions_code_key UNIQUE,
+    menu_item_id INTEGER,
+    min_quantity INTEGER NOT NULL DEFAULT 0 CONSTRAINT non_negative_min_quantity CHECK (min_quantity >= 0),
+    discount_type discount_type NOT NULL,
+    discount_value NUMERIC NOT NULL CONSTRAINT positive_discount_value CHECK (discount_value > 0),
+    starts_at TIMESTAMPTZ,
+    ends_at TIMESTAMPTZ,
+    daily_from TIME,
+    daily_to TIME,
+    usage_limit INTEGER NOT NULL DEFAULT 0 CONSTRAINT non_negative_usage_limit CHECK (usage_limit >= 0),
+    usage_count INTEGER NOT NULL DEFAULT 0,
+    disabled BOOLEAN NOT NULL DEFAULT FALSE,
+    version BIGINT NOT NULL DEFAULT 1,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (menu_item_id) REFERENCES menu_items (menu_item_id) ON DELETE RESTRICT,
+    CONSTRAINT usage_within_limit CHECK (usage_limit = 0 OR usage_count <= usage_limit)
+);
+
+-- Discounts applied to the order, the name is kept if the promotion is deleted
+CREATE TABLE order_discounts(
+    order_id INTEGER NOT NULL,
+    promotion_id INTEGER,
+    name TEXT NOT NULL,
+    amount NUMERIC NOT NULL CONSTRAINT positive_amount CHECK (amount > 0),
+    FOREIGN KEY (order_id) REFERENCES orders (order_id) ON DELETE CASCADE,
+    FOREIGN KEY (promotion_id) REFERENCES promotions (promotion_id) ON DELETE SET NULL
+);
+
+CREATE INDEX order_discounts_order_id_idx ON order_discounts (order_id);
@@ -0,0 +1,10 @@
+DROP INDEX orders_grand_total_idx;
+ALTER TABLE orders
+    DROP COLUMN grand_total,
+    DROP COLUMN tip,
+    DROP COLUMN service_charge,
+    DROP COLUMN tax,
+    DROP COLUMN discount_total,
+    DROP COLUMN subtotal;
+ALTER TABLE order_items DROP COLUMN tax_rate;
+ALTER TABLE menu_items DROP COLUMN category;
@@ -0,0 +1,25 @@
+-- Menu item category selects the tax rate
+ALTER TABLE menu_items ADD COLUMN category TEXT NOT NULL DEFAULT '';
+
+-- Tax percent of the order line at the time the order was written
+ALTER TABLE order_items ADD COLUMN tax_rate NUMERIC NOT NULL DEFAULT 0;
+
+ALTER TABLE orders
+    ADD COLUMN subtotal NUMERIC NOT NULL DEFAULT 0,
+    ADD COLUMN discount_total NUMERIC NOT NULL DEFAULT 0,
+    ADD COLUMN tax NUMERIC NOT NULL DEFAULT 0,
+    ADD COLUMN service_charge NUMERIC NOT NULL DEFAULT 0,
+    ADD COLUMN tip NUMERIC NOT NULL DEFAULT 0 CONSTRAINT non_negative_tip CHECK (tip >= 0),
+    ADD COLUMN grand_total NUMERIC NOT NULL DEFAULT 0;
+
+-- Backfill: taxes were not charged before, the grand total is the discounted items price
+UPDATE orders o
+SET subtotal = COALESCE((
+        SELECT SUM(oi.unit_price * oi.quantity) FROM order_items oi WHERE oi.order_id = o.order_id
+    ), 0),
+    discount_total = COALESCE((
+        SELECT SUM(od.amount) FROM order_discounts od WHERE od.order_id = o.order_id
+    ), 0);
+UPDATE orders SET grand_total = subtotal - discount_total;
+
+CREATE INDEX orders_grand_total_idx ON orders (grand_total);
@@ -0,0 +1,4 @@
+DROP TABLE refund_items;
+DROP TABLE payments;
+DROP TYPE payment_kind;
+DROP TYPE payment_tender;
@@ -0,0 +1,36 @@
+CREATE TYPE payment_tender AS ENUM ('cash', 'card', 'other');
+CREATE TYPE payment_kind AS ENUM ('payment', 'refund');
+
+-- Money received for the order and given back, several tenders can split the bill
+CREATE TABLE payments(
+    payment_id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL,
+    kind payment_kind NOT NULL,
+    tender payment_tender NOT NULL,
+    amount NUMERIC NOT NULL CONSTRAINT positive_amount CHECK (amount > 0),
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (order_id) REFERENCES orders (order_id) ON DELETE CASCADE
+);
+
+CREATE INDEX payments_order_id_idx ON payments (order_id);
+
+-- Order items whose ingredients were returned to inventory by the refund
+CREATE TABLE refund_items(
+    payment_id INTEGER NOT NULL,
+    menu_item_id INTEGER NOT NULL,
+    quantity INTEGER NOT NULL CONSTRAINT positive_quantity CHECK (quantity > 0),
+    PRIMARY KEY (payment_id, menu_item_id),
+    FOREIGN KEY (payment_id) REFERENCES payments (payment_id) ON DELETE CASCADE,
+    FOREIGN KEY (menu_item_id) REFERENCES menu_items (menu_item_id) ON DELETE RESTRICT
+);
+
+-- Orders closed before the payments were recorded are considered paid
+INSERT INTO payments (order_id, kind, tender, amount, reason, created_at)
+SELECT o.order_id, 'payment', 'other', o.grand_total, 'recorded before payments tracking',
+    COALESCE((
+        SELECT MAX(h.changed_at) FROM order_status_history h
+        WHERE h.order_id = o.order_id AND h.new_status = 'closed'
+    ), NOW())
+FROM orders o
+WHERE o.status = 'closed' AND o.grand_total > 0;
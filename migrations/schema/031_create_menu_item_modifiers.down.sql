@@ -0,0 +1,3 @@
+ALTER TABLE order_items DROP COLUMN modifier_ids;
+DROP TABLE menu_item_modifier_ingredients;
+DROP TABLE menu_item_modifiers;
@@ -0,0 +1,24 @@
+-- Options of the menu item changing its price and ingredients
+CREATE TABLE menu_item_modifiers(
+    modifier_id SERIAL PRIMARY KEY,
+    menu_item_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    price_delta NUMERIC NOT NULL DEFAULT 0,
+    deleted_at TIMESTAMPTZ,
+    FOREIGN KEY (menu_item_id) REFERENCES menu_items (menu_item_id) ON DELETE CASCADE
+);
+
+CREATE INDEX menu_item_modifiers_menu_item_id_idx ON menu_item_modifiers (menu_item_id);
+
+-- Change of the ingredient quantity per item, negative takes the ingredient away
+CREATE TABLE menu_item_modifier_ingredients(
+    modifier_id INTEGER NOT NULL,
+    inventory_item_id INTEGER NOT NULL,
+    quantity NUMERIC NOT NULL CONSTRAINT non_zero_quantity CHECK (quantity != 0),
+    PRIMARY KEY (modifier_id, inventory_item_id),
+    FOREIGN KEY (modifier_id) REFERENCES menu_item_modifiers (modifier_id) ON DELETE CASCADE,
+    FOREIGN KEY (inventory_item_id) REFERENCES inventory (inventory_item_id) ON DELETE CASCADE
+);
+
+-- Modifiers picked for the order item, they are archived instead of deleting
+ALTER TABLE order_items ADD COLUMN modifier_ids INTEGER[] NOT NULL DEFAULT '{}';
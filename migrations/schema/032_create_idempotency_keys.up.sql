@@ -0,0 +1,13 @@
+-- Responses of the requests sent with Idempotency-Key header, replayed on retries
+CREATE TABLE idempotency_keys(
+    key TEXT PRIMARY KEY,
+    request_hash TEXT NOT NULL,
+    -- NULL while the request is being processed
+    status_code INTEGER,
+    content_type TEXT NOT NULL DEFAULT '',
+    body BYTEA,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
@@ -0,0 +1,10 @@
+DROP INDEX orders_pickup_at_idx;
+ALTER TABLE orders DROP COLUMN pickup_at;
+
+-- Enum values cannot be dropped, the type is recreated without the scheduled status.
+-- Pre-orders not opened yet are rejected
+UPDATE orders SET status = 'rejected' WHERE status = 'scheduled';
+ALTER TYPE status RENAME TO status_old;
+CREATE TYPE status AS ENUM ('open', 'in progress', 'rejected', 'closed');
+ALTER TABLE orders ALTER COLUMN status TYPE status USING status::text::status;
+DROP TYPE status_old;
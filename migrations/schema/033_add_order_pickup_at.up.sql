@@ -0,0 +1,6 @@
+-- Pre-orders wait in the scheduled status until the lead time before the pickup
+ALTER TYPE status ADD VALUE IF NOT EXISTS 'scheduled' BEFORE 'open';
+
+ALTER TABLE orders ADD COLUMN pickup_at TIMESTAMPTZ;
+
+CREATE INDEX orders_pickup_at_idx ON orders (pickup_at);
@@ -0,0 +1,2 @@
+-- inventory.low webhook event is sent when the quantity falls below the level, zero disables it
+ALTER TABLE inventory ADD COLUMN reorder_level NUMERIC NOT NULL DEFAULT 0 CONSTRAINT non_negative_reorder_level CHECK (reorder_level >= 0);
@@ -0,0 +1 @@
+ALTER TABLE orders DROP COLUMN estimated_ready_at;
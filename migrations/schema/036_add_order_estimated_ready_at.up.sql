@@ -0,0 +1,2 @@
+-- Ready time promised when the order was opened, compared with the close time by the estimates report
+ALTER TABLE orders ADD COLUMN estimated_ready_at TIMESTAMPTZ;
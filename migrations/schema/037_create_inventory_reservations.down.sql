@@ -0,0 +1,8 @@
+-- Reservations are deducted as they were before
+INSERT INTO inventory_transactions (inventory_item_id, order_id, transaction_quantity)
+SELECT inventory_item_id, order_id, -quantity FROM inventory_reservations;
+
+UPDATE inventory SET quantity = quantity - reserved WHERE reserved > 0;
+
+DROP TABLE inventory_reservations;
+ALTER TABLE inventory DROP COLUMN reserved;
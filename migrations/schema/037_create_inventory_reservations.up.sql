@@ -0,0 +1,40 @@
+-- Ingredients held by the not finished orders, available quantity is quantity - reserved
+ALTER TABLE inventory ADD COLUMN reserved NUMERIC NOT NULL DEFAULT 0
+    CONSTRAINT reserved_within_quantity CHECK (reserved >= 0 AND reserved <= quantity);
+
+-- Released when the order is rejected or deleted, deducted into inventory_transactions when it is closed
+CREATE TABLE inventory_reservations(
+    order_id INTEGER NOT NULL,
+    inventory_item_id INTEGER NOT NULL,
+    quantity NUMERIC NOT NULL CONSTRAINT positive_reservation CHECK (quantity > 0),
+    PRIMARY KEY (order_id, inventory_item_id),
+    -- The order must release its reservations before it is deleted
+    FOREIGN KEY (order_id) REFERENCES orders (order_id) ON DELETE RESTRICT,
+    FOREIGN KEY (inventory_item_id) REFERENCES inventory (inventory_item_id) ON DELETE RESTRICT
+);
+
+CREATE INDEX inventory_reservations_inventory_item_id_idx ON inventory_reservations (inventory_item_id);
+
+-- Not finished orders deducted their ingredients on creation, the deductions become reservations
+INSERT INTO inventory_reservations (order_id, inventory_item_id, quantity)
+SELECT t.order_id, t.inventory_item_id, -SUM(t.transaction_quantity)
+FROM inventory_transactions t
+JOIN orders o ON o.order_id = t.order_id
+WHERE o.status IN ('scheduled', 'open', 'in progress')
+GROUP BY t.order_id, t.inventory_item_id
+HAVING SUM(t.transaction_quantity) < 0;
+
+DELETE FROM inventory_transactions t
+USING orders o
+WHERE o.order_id = t.order_id AND o.status IN ('scheduled', 'open', 'in progress');
+
+UPDATE inventory i
+SET
+    quantity = i.quantity + r.quantity,
+    reserved = r.quantity
+FROM (
+    SELECT inventory_item_id, SUM(quantity) AS quantity
+    FROM inventory_reservations
+    GROUP BY inventory_item_id
+) r
+WHERE i.inventory_item_id = r.inventory_item_id;
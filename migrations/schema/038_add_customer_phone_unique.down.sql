@@ -0,0 +1,5 @@
+ALTER TABLE customers DROP COLUMN version;
+
+DROP INDEX orders_customer_id_idx;
+DROP INDEX customers_fullname_idx;
+DROP INDEX customers_phone_key;
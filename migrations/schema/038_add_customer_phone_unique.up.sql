@@ -0,0 +1,16 @@
+-- Phones are stored as digits with optional leading +
+UPDATE customers SET phone = regexp_replace(phone, '[\s\-()]', '', 'g') WHERE phone IS NOT NULL;
+UPDATE customers SET phone = NULL WHERE phone = '';
+
+-- Phone taken by several customers is kept by the earliest one
+UPDATE customers c
+SET phone = NULL
+WHERE c.phone IS NOT NULL AND EXISTS (
+    SELECT 1 FROM customers e WHERE e.phone = c.phone AND e.customer_id < c.customer_id
+);
+
+CREATE UNIQUE INDEX customers_phone_key ON customers (phone);
+CREATE INDEX customers_fullname_idx ON customers (lower(fullname));
+CREATE INDEX orders_customer_id_idx ON orders (customer_id);
+
+ALTER TABLE customers ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,4 @@
+ALTER TABLE order_discounts DROP COLUMN points;
+
+DROP TABLE loyalty_ledger;
+DROP TYPE loyalty_entry_kind;
@@ -0,0 +1,21 @@
+CREATE TYPE loyalty_entry_kind AS ENUM ('earn', 'redeem', 'restore', 'reverse');
+
+-- Loyalty points added to and taken from the customer balance, the expired points are computed
+CREATE TABLE loyalty_ledger(
+    entry_id SERIAL PRIMARY KEY,
+    customer_id INTEGER NOT NULL,
+    order_id INTEGER,
+    kind loyalty_entry_kind NOT NULL,
+    points INTEGER NOT NULL CONSTRAINT non_zero_points CHECK (points <> 0),
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (customer_id) REFERENCES customers (customer_id) ON DELETE RESTRICT,
+    FOREIGN KEY (order_id) REFERENCES orders (order_id) ON DELETE SET NULL,
+    CONSTRAINT added_points_expire CHECK ((points > 0) = (expires_at IS NOT NULL))
+);
+
+CREATE INDEX loyalty_ledger_customer_id_idx ON loyalty_ledger (customer_id);
+CREATE INDEX loyalty_ledger_order_id_idx ON loyalty_ledger (order_id);
+
+-- Points the discount was redeemed for, promotion discounts have none
+ALTER TABLE order_discounts ADD COLUMN points INTEGER NOT NULL DEFAULT 0 CONSTRAINT non_negative_points CHECK (points >= 0);
@@ -0,0 +1,5 @@
+DROP TRIGGER audit_log_append_only ON audit_log;
+DROP FUNCTION reject_audit_log_change();
+DROP TABLE audit_log;
+
+ALTER TABLE customers DROP COLUMN anonymized_at;
@@ -0,0 +1,26 @@
+-- Anonymized customers keep their orders, the name and the phone are scrubbed
+ALTER TABLE customers ADD COLUMN anonymized_at TIMESTAMPTZ;
+
+-- Personal data actions, the entity is not referenced so the trail outlives it
+CREATE TABLE audit_log(
+    audit_id SERIAL PRIMARY KEY,
+    action TEXT NOT NULL,
+    entity TEXT NOT NULL,
+    entity_id TEXT NOT NULL,
+    actor TEXT NOT NULL DEFAULT '',
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX audit_log_entity_idx ON audit_log (entity, entity_id);
+
+-- The trail is only appended to
+CREATE FUNCTION reject_audit_log_change() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit log entries cannot be changed or deleted';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION reject_audit_log_change();
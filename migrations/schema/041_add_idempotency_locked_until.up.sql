@@ -0,0 +1,6 @@
+-- Processing lease of the reserved key: a retry takes over the key once the lease is over,
+-- so a request lost by a crash does not hold the key until it expires
+ALTER TABLE idempotency_keys ADD COLUMN locked_until TIMESTAMPTZ;
+
+-- Keys reserved before the leases are free to take over
+UPDATE idempotency_keys SET locked_until = NOW() WHERE status_code IS NULL;
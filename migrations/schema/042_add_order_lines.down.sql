@@ -0,0 +1,24 @@
+-- Lines of the same product are merged back
+CREATE TEMPORARY TABLE merged_refund_items AS
+SELECT payment_id, menu_item_id, SUM(quantity) AS quantity
+FROM refund_items
+GROUP BY payment_id, menu_item_id;
+DELETE FROM refund_items;
+ALTER TABLE refund_items DROP CONSTRAINT refund_items_pkey;
+ALTER TABLE refund_items DROP COLUMN modifier_ids;
+ALTER TABLE refund_items ADD PRIMARY KEY (payment_id, menu_item_id);
+INSERT INTO refund_items (payment_id, menu_item_id, quantity)
+SELECT payment_id, menu_item_id, quantity FROM merged_refund_items;
+
+ALTER TABLE inventory_transactions DROP COLUMN order_line;
+
+CREATE TEMPORARY TABLE merged_reservations AS
+SELECT order_id, inventory_item_id, SUM(quantity) AS quantity
+FROM inventory_reservations
+GROUP BY order_id, inventory_item_id;
+DELETE FROM inventory_reservations;
+ALTER TABLE inventory_reservations DROP CONSTRAINT inventory_reservations_pkey;
+ALTER TABLE inventory_reservations DROP COLUMN order_line;
+ALTER TABLE inventory_reservations ADD PRIMARY KEY (order_id, inventory_item_id);
+INSERT INTO inventory_reservations (order_id, inventory_item_id, quantity)
+SELECT order_id, inventory_item_id, quantity FROM merged_reservations;
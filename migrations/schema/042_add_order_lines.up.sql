@@ -0,0 +1,12 @@
+-- Ingredients are reserved and taken per order line: the product with the picked modifiers,
+-- so a refund restocks what the line actually took. Rows written before are left without a line
+ALTER TABLE inventory_reservations ADD COLUMN order_line TEXT NOT NULL DEFAULT '';
+ALTER TABLE inventory_reservations DROP CONSTRAINT inventory_reservations_pkey;
+ALTER TABLE inventory_reservations ADD PRIMARY KEY (order_id, inventory_item_id, order_line);
+
+ALTER TABLE inventory_transactions ADD COLUMN order_line TEXT NOT NULL DEFAULT '';
+
+-- Restocked items keep their modifiers
+ALTER TABLE refund_items ADD COLUMN modifier_ids INTEGER[] NOT NULL DEFAULT '{}';
+ALTER TABLE refund_items DROP CONSTRAINT refund_items_pkey;
+ALTER TABLE refund_items ADD PRIMARY KEY (payment_id, menu_item_id, modifier_ids);
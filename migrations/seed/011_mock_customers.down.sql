@@ -0,0 +1,7 @@
+-- Only the mock customers 1 to 8 are removed, the orders created after the seed and the loyalty points
+-- of the mock customers stop the rollback by the foreign keys
+DELETE FROM customers WHERE customer_id BETWEEN 1 AND 8;
+
+-- Seeding again gets the same ids unless real rows were added
+SELECT setval(pg_get_serial_sequence('customers', 'customer_id'), 1, false)
+WHERE NOT EXISTS (SELECT 1 FROM customers);
@@ -0,0 +1,7 @@
+-- Only the mock menu items 1 to 15 are removed, the orders created after the seed
+-- and the promotions referencing them stop the rollback by ON DELETE RESTRICT
+DELETE FROM menu_items WHERE menu_item_id BETWEEN 1 AND 15;
+
+-- Seeding again gets the same ids unless real rows were added
+SELECT setval(pg_get_serial_sequence('menu_items', 'menu_item_id'), 1, false)
+WHERE NOT EXISTS (SELECT 1 FROM menu_items);
@@ -0,0 +1,28 @@
+-- Only the mock inventory items 1 to 15 are removed. The recipes of the other menu items
+-- would lose them silently by ON DELETE CASCADE, so such recipes stop the rollback.
+-- Transactions and reservations of the other orders stop it by ON DELETE RESTRICT
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM menu_items_ingredients
+        WHERE inventory_item_id BETWEEN 1 AND 15 AND menu_item_id > 15
+    ) THEN
+        RAISE EXCEPTION 'mock inventory items are used by menu items created after the seed';
+    END IF;
+
+    -- Modifiers were added after the seed was written
+    IF to_regclass('menu_item_modifier_ingredients') IS NOT NULL THEN
+        IF EXISTS (
+            SELECT 1 FROM menu_item_modifier_ingredients WHERE inventory_item_id BETWEEN 1 AND 15
+        ) THEN
+            RAISE EXCEPTION 'mock inventory items are used by menu item modifiers';
+        END IF;
+    END IF;
+END;
+$$;
+
+DELETE FROM inventory WHERE inventory_item_id BETWEEN 1 AND 15;
+
+-- Seeding again gets the same ids unless real rows were added
+SELECT setval(pg_get_serial_sequence('inventory', 'inventory_item_id'), 1, false)
+WHERE NOT EXISTS (SELECT 1 FROM inventory);
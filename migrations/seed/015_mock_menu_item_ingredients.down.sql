@@ -0,0 +1,2 @@
+-- Recipes of the mock menu items 1 to 15
+DELETE FROM menu_items_ingredients WHERE menu_item_id BETWEEN 1 AND 15;
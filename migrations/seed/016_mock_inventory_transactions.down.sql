@@ -0,0 +1,2 @@
+-- Usage and restock rows the seed wrote for the mock orders 1 and 2, 020 is rolled back before
+DELETE FROM inventory_transactions WHERE order_id IN (1, 2);
@@ -0,0 +1,2 @@
+-- Items of the mock orders 1 to 48, the closed orders got no other items
+DELETE FROM order_items WHERE order_id BETWEEN 1 AND 48;
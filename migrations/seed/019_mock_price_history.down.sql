@@ -0,0 +1,8 @@
+-- Only the rows of the seed are removed, they are the earliest changes of the mock menu items
+DELETE FROM price_history
+WHERE ctid IN (
+    SELECT DISTINCT ON (menu_item_id, price_difference) ctid
+    FROM price_history
+    WHERE (menu_item_id, price_difference) IN ((2, 1), (3, 2), (4, 1), (5, 1))
+    ORDER BY menu_item_id, price_difference, changed_at
+);
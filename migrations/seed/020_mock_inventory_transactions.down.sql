@@ -0,0 +1,11 @@
+-- Only the rows of the seed are removed: 016 wrote the same first rows for order 1 earlier,
+-- so the latest row of every seeded value is taken
+DELETE FROM inventory_transactions
+WHERE ctid IN (
+    SELECT DISTINCT ON (inventory_item_id, transaction_quantity) ctid
+    FROM inventory_transactions
+    WHERE order_id = 1 AND (inventory_item_id, transaction_quantity) IN (
+        (1, -40), (2, -2000), (3, -1000), (4, -300), (5, 600)
+    )
+    ORDER BY inventory_item_id, transaction_quantity, changed_at DESC
+);